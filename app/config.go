@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/stiks/gobs/lib/controllers"
+	"github.com/stiks/gobs/lib/services"
+	"github.com/stiks/gobs/pkg/config"
+	"github.com/stiks/gobs/pkg/helpers"
+	"github.com/stiks/gobs/pkg/server"
+)
+
+// Config of the application, resolved once on boot
+type Config struct {
+	Port    string `env:"PORT" default:"8080"`
+	Runtime string `env:"SERVER_RUNTIME"`
+	// TrustedProxies are CIDR ranges of proxies whose X-Forwarded-For tells
+	// client IP, without them client IP is the peer address
+	TrustedProxies []string `env:"TRUSTED_PROXIES"`
+
+	Server   server.Config
+	Auth     services.AuthConfig
+	Cache    services.CacheConfig
+	Keys     services.KeyConfig
+	Lockout  services.LockoutConfig
+	Public   controllers.PublicConfig
+	Register controllers.RegisterConfig
+
+	RateLimit RateLimitConfig
+}
+
+// RateLimitConfig of anonymous endpoints, limits are requests per period and
+// 0 turns limit of the group off
+type RateLimitConfig struct {
+	// Store is "memory" for limits of this instance or "cache" to share them
+	// through cache provider
+	Store  string        `env:"RATE_LIMIT_STORE" default:"memory"`
+	Period time.Duration `env:"RATE_LIMIT_PERIOD" default:"1m"`
+	// AuthIP limits /auth endpoints per IP whatever username and client_id,
+	// so guessing passwords of many users doesn't get a limit per user
+	AuthIP int `env:"RATE_LIMIT_AUTH_IP" default:"300"`
+	// Auth limits /auth endpoints per IP, username and client_id on top of AuthIP
+	Auth int `env:"RATE_LIMIT_AUTH" default:"60"`
+	// Account limits /account endpoints per IP, reset sends email
+	Account int `env:"RATE_LIMIT_ACCOUNT" default:"10"`
+	// Register limits /register endpoints per IP
+	Register int `env:"RATE_LIMIT_REGISTER" default:"10"`
+}
+
+// Validate ...
+func (c *RateLimitConfig) Validate() error {
+	switch c.Store {
+	case "memory", "cache":
+	default:
+		return fmt.Errorf("RATE_LIMIT_STORE: unknown store %q, expected memory or cache", c.Store)
+	}
+
+	if c.Period < time.Second {
+		return errors.New("RATE_LIMIT_PERIOD must be at least 1s")
+	}
+
+	if c.AuthIP < 0 || c.Auth < 0 || c.Account < 0 || c.Register < 0 {
+		return errors.New("RATE_LIMIT_AUTH_IP, RATE_LIMIT_AUTH, RATE_LIMIT_ACCOUNT and RATE_LIMIT_REGISTER can't be negative")
+	}
+
+	return nil
+}
+
+// Validate ...
+func (c *Config) Validate() error {
+	switch c.Runtime {
+	case "", "appengine", "native":
+	default:
+		return fmt.Errorf("SERVER_RUNTIME: unknown runtime %q, expected appengine or native", c.Runtime)
+	}
+
+	if _, err := helpers.NewIPExtractor(c.TrustedProxies); err != nil {
+		return fmt.Errorf("TRUSTED_PROXIES: %s", err.Error())
+	}
+
+	// retired key has to verify every token it signed
+	if c.Keys.RetentionPeriod < c.Auth.AccessTokenLifetime {
+		return errors.New("AUTH_KEY_RETENTION_PERIOD must be at least AUTH_ACCESS_TOKEN_LIFETIME")
+	}
+
+	return nil
+}
+
+// loadSource reads .env from working directory and YAML file named by
+// CONFIG_FILE, process environment takes precedence over both
+func loadSource() *config.Source {
+	src, err := config.New(config.Options{
+		EnvFile:  ".env",
+		YAMLFile: os.Getenv("CONFIG_FILE"),
+	})
+	if err != nil {
+		log.Fatalf("Unable to load configuration: %s", err.Error())
+	}
+
+	return src
+}
+
+// loadConfig fills Config, every problem is reported before exit
+func loadConfig(src *config.Source) *Config {
+	cfg := new(Config)
+	if err := src.Fill(cfg); err != nil {
+		log.Fatalf("Invalid configuration: %s", err.Error())
+	}
+
+	cfg.Server.Addr = ":" + cfg.Port
+
+	return cfg
+}
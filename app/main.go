@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
@@ -10,51 +11,163 @@ import (
 	"google.golang.org/appengine"
 
 	"github.com/stiks/gobs/lib/controllers"
-	"github.com/stiks/gobs/lib/providers/dummy"
 	"github.com/stiks/gobs/lib/providers/mock"
+	"github.com/stiks/gobs/lib/providers/registry"
+	"github.com/stiks/gobs/lib/repositories"
 	"github.com/stiks/gobs/lib/services"
+	"github.com/stiks/gobs/pkg/auth"
 	"github.com/stiks/gobs/pkg/helpers"
+	"github.com/stiks/gobs/pkg/server"
 )
 
 func main() {
+	src := loadSource()
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(src, os.Args[2:])
+
+		return
+	}
+
+	cfg := loadConfig(src)
+
 	e := echo.New()
 
 	// Hide banner
 	e.HideBanner = true
 	e.HidePort = true
 
+	// Rate limits and lockouts key on client IP, see Config.TrustedProxies
+	e.IPExtractor, _ = helpers.NewIPExtractor(cfg.TrustedProxies)
+
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 	e.Use(helpers.DefaultHeadersMiddleware())
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	log.Printf("Server started, v%s", echo.Version)
+
+	srv := server.New(e, cfg.Server)
+
+	// Queued tasks are delivered in process to a handler of their own, so
+	// task routes sending emails are never reachable from outside
+	tasks := echo.New()
+	tasks.Use(middleware.Recover())
+
+	// Providers are picked by configuration, see selection
+	providers, err := registry.Build(selection(src.Get), src.Get, tasks)
+	if err != nil {
+		log.Fatalf("Invalid provider configuration: %s", err.Error())
 	}
 
-	log.Printf("Server started, v%s", echo.Version)
+	srv.OnShutdown("providers", func(ctx context.Context) error { return providers.Close() })
 
-	// Start server
-	http.Handle("/", e)
+	// Access tokens are signed by rotated keys, see services.KeyConfig
+	keySrv, err := services.NewKeyService(providers.Data.Keys, cfg.Keys, []byte(cfg.Auth.SecretKey))
+	if err != nil {
+		log.Fatalf("Invalid key config: %s", err.Error())
+	}
+	if err := keySrv.Load(context.Background()); err != nil {
+		log.Fatalf("Unable to load signing keys: %s", err.Error())
+	}
+
+	cfg.Auth.Keys = keySrv
 
 	// Some stuff
 	var (
-		cacheSrv = services.NewCacheService(dummy.NewCacheRepository())
-		queueSrv = services.NewQueueService(mock.NewQueueRepository())
-		emailSrv = services.NewEmailService(mock.NewEmailRepository())
-		authSrv  = services.NewAuthService(mock.NewAuthRepository())
-		userSrv  = services.NewUserService(mock.NewUserRepository(), queueSrv, cacheSrv)
-		statsSrv = services.NewStatsService(mock.NewStatsRepository())
+		cacheSrv  = services.NewCacheService(providers.Cache, cfg.Cache)
+		queueSrv  = services.NewQueueService(providers.Queue)
+		emailSrv  = services.NewEmailService(providers.Email)
+		userSrv   = services.NewUserService(providers.Data.Users, queueSrv, cacheSrv)
+		clientSrv = services.NewClientService(providers.Data.Clients)
+		policySrv = services.NewPolicyService(providers.Data.Roles, cacheSrv)
+		lockSrv   = services.NewLockoutService(providers.Data.Auth, providers.Data.Users, queueSrv, cacheSrv, cfg.Lockout)
+		mfaSrv    = services.NewMFAService(providers.Data.Users, policySrv, cacheSrv, lockSrv, cfg.Public.Name)
+		statsSrv  = services.NewStatsService(mock.NewStatsRepository(), providers.Cache)
 	)
 
+	// Password logins are challenged for second factor, see services.MFAService
+	cfg.Auth.MFA = mfaSrv
+	// Failed password logins are throttled, see services.LockoutConfig
+	cfg.Auth.Lockout = lockSrv
+	authSrv, err := services.NewAuthService(providers.Data.Auth, cfg.Auth)
+	if err != nil {
+		log.Fatalf("Invalid auth config: %s", err.Error())
+	}
+
+	auth.Configure(auth.Config{SecretKey: []byte(cfg.Auth.SecretKey), Keyfunc: keySrv.Keyfunc, Denylist: authSrv})
+
 	// Core endpoints
+	controllers.NewKeyController(keySrv).Routes(e.Group(""))
+	controllers.NewDiscoveryController(authSrv).Routes(e.Group(""))
 	controllers.NewHealthController(statsSrv).Routes(e.Group("api"))
-	controllers.NewWorkerController(userSrv, queueSrv, emailSrv).Routes(e.Group("api"))
+	controllers.NewWorkerController(userSrv, queueSrv, emailSrv, lockSrv, cfg.Public).Routes(tasks.Group("api"))
+
+	// Anonymous endpoints checking credentials or sending email are throttled
+	limits := helpers.NewMemoryRateLimitStore()
+	if cfg.RateLimit.Store == "cache" {
+		// no-op cache would turn limits off, entries of a cache unable to
+		// expire them would pile up
+		cache, ok := providers.Cache.(repositories.ExpiringCacheRepository)
+		if !ok {
+			log.Fatalf("RATE_LIMIT_STORE=cache requires cache provider able to expire entries, %s isn't", selection(src.Get)[registry.KindCache])
+		}
+
+		limits = helpers.NewCacheRateLimitStore(cache)
+	}
+
+	// per IP limit comes first, usernames and clients of the request can't escape it
+	authLimit := append(
+		rateLimit(limits, "auth-ip", cfg.RateLimit.AuthIP, helpers.NewTokenBucket(cfg.RateLimit.AuthIP, cfg.RateLimit.Period), helpers.RateLimitByIP),
+		rateLimit(limits, "auth", cfg.RateLimit.Auth, helpers.NewTokenBucket(cfg.RateLimit.Auth, cfg.RateLimit.Period), helpers.RateLimitByLogin(knownClient(providers.Data.Auth)))...,
+	)
+	accountLimit := rateLimit(limits, "account", cfg.RateLimit.Account, helpers.NewSlidingWindow(cfg.RateLimit.Account, cfg.RateLimit.Period), helpers.RateLimitByIP)
+	registerLimit := rateLimit(limits, "register", cfg.RateLimit.Register, helpers.NewSlidingWindow(cfg.RateLimit.Register, cfg.RateLimit.Period), helpers.RateLimitByIP)
 
 	// Base controllers
-	controllers.NewAuthController(authSrv).Routes(e.Group("api"))
-	controllers.NewUserController(userSrv).Routes(e.Group("api"))
-	controllers.NewAccountController(userSrv).Routes(e.Group("api"))
+	controllers.NewAuthController(authSrv).Routes(e.Group("api", authLimit...))
+	controllers.NewUserController(userSrv, policySrv, lockSrv).Routes(e.Group("api"))
+	controllers.NewAccountController(userSrv, mfaSrv).Routes(e.Group("api", accountLimit...))
+	controllers.NewRegisterController(userSrv, cfg.Register).Routes(e.Group("api", registerLimit...))
+	controllers.NewClientController(clientSrv, policySrv).Routes(e.Group("api"))
+	controllers.NewRoleController(policySrv).Routes(e.Group("api"))
+	controllers.NewAuthClientController(authSrv, policySrv).Routes(e.Group("api"))
+
+	// Workers start once routes are in place and are stopped before providers are closed
+	srv.Go("signing keys", keySrv.Run)
+
+	for _, worker := range providers.Workers() {
+		srv.Go(worker.Name, worker.Run)
+	}
+
+	if useAppEngine(cfg.Runtime) {
+		http.Handle("/", e)
+		appengine.Main()
 
-	appengine.Main()
+		return
+	}
+
+	if err := srv.ListenAndServe(context.Background()); err != nil {
+		log.Fatalf("Server stopped with error: %s", err.Error())
+	}
+
+	log.Printf("Server stopped")
+}
+
+// rateLimit returns middleware of route group, none when limit is 0
+func rateLimit(store helpers.RateLimitStore, name string, limit int, algorithm helpers.RateLimitAlgorithm, key helpers.RateLimitKey) []echo.MiddlewareFunc {
+	if limit == 0 {
+		return nil
+	}
+
+	return []echo.MiddlewareFunc{helpers.RateLimit(helpers.RateLimitConfig{Name: name, Algorithm: algorithm, Store: store, Key: key})}
+}
+
+// knownClient reports whether auth client is registered, so made up client_id
+// doesn't get rate limit of its own
+func knownClient(repo repositories.AuthRepository) func(ctx context.Context, clientID string) bool {
+	return func(ctx context.Context, clientID string) bool {
+		_, err := repo.FindByClientID(ctx, clientID)
+
+		return err == nil
+	}
 }
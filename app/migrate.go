@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/stiks/gobs/lib/providers/postgres"
+	"github.com/stiks/gobs/lib/providers/registry"
+	"github.com/stiks/gobs/lib/providers/sqlite"
+	"github.com/stiks/gobs/pkg/config"
+	"github.com/stiks/gobs/pkg/migrate"
+)
+
+// runMigrate handles "migrate up|down [steps]|status" command against the
+// configured database, schema is otherwise migrated on boot
+func runMigrate(src *config.Source, args []string) {
+	var (
+		db       *sql.DB
+		migrator *migrate.Migrator
+		err      error
+	)
+
+	switch provider := selection(src.Get)[registry.KindData]; provider {
+	case "postgres":
+		if db, err = postgres.Open(src.Get("DATABASE_URL")); err == nil {
+			migrator, err = postgres.NewMigrator(db)
+		}
+	case "sqlite":
+		if db, err = sqlite.Open(src.Get("SQLITE_DATABASE")); err == nil {
+			migrator, err = sqlite.NewMigrator(db)
+		}
+	default:
+		log.Fatalf("Provider %q has no schema to migrate, use DB_PROVIDER=postgres or sqlite", provider)
+	}
+
+	if err != nil {
+		log.Fatalf("Unable to open database: %s", err.Error())
+	}
+	defer db.Close()
+
+	command := "status"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	ctx := context.Background()
+
+	switch command {
+	case "up":
+		done, err := migrator.Up(ctx)
+		for _, m := range done {
+			fmt.Printf("applied  %d %s\n", m.Version, m.Name)
+		}
+
+		if err != nil {
+			log.Fatalf("Migration failed: %s", err.Error())
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				log.Fatalf("Invalid number of steps: %s", args[1])
+			}
+		}
+
+		done, err := migrator.Down(ctx, steps)
+		for _, m := range done {
+			fmt.Printf("reverted %d %s\n", m.Version, m.Name)
+		}
+
+		if err != nil {
+			log.Fatalf("Migration failed: %s", err.Error())
+		}
+	case "status":
+		list, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalf("Unable to read migration status: %s", err.Error())
+		}
+
+		for _, s := range list {
+			state := "pending"
+			switch {
+			case s.Unknown:
+				state = "unknown"
+			case s.Modified:
+				state = "modified"
+			case s.Applied:
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+
+			fmt.Printf("%6d  %-30s %s\n", s.Version, s.Name, state)
+		}
+	default:
+		log.Fatalf("Unknown migrate command %q, expected up, down [steps] or status", command)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	// compiled in providers, each registers itself by name
+	_ "github.com/stiks/gobs/lib/providers/appengine"
+	_ "github.com/stiks/gobs/lib/providers/dummy"
+	_ "github.com/stiks/gobs/lib/providers/memory"
+	_ "github.com/stiks/gobs/lib/providers/mock"
+	_ "github.com/stiks/gobs/lib/providers/postgres"
+	_ "github.com/stiks/gobs/lib/providers/redis"
+	_ "github.com/stiks/gobs/lib/providers/sqlite"
+
+	"github.com/stiks/gobs/lib/providers/registry"
+)
+
+// selection reads provider names, e.g. DB_PROVIDER=postgres. When a name is not
+// set it is inferred from settings present, so DATABASE_URL alone still selects
+// postgres and REDIS_URL redis cache, otherwise mock data and no-op cache are used.
+func selection(lookup func(key string) string) registry.Selection {
+	data := lookup(registry.KindData)
+	if data == "" {
+		switch {
+		case lookup("DATABASE_URL") != "":
+			data = "postgres"
+		case lookup("SQLITE_DATABASE") != "":
+			data = "sqlite"
+		default:
+			data = "mock"
+		}
+	}
+
+	queue := lookup(registry.KindQueue)
+	if queue == "" {
+		queue = "mock"
+
+		// embedded database brings its own durable queue
+		if data == "sqlite" {
+			queue = "sqlite"
+		}
+	}
+
+	cache := lookup(registry.KindCache)
+	if cache == "" {
+		cache = "dummy"
+
+		if lookup("REDIS_URL") != "" {
+			cache = "redis"
+		}
+	}
+
+	email := lookup(registry.KindEmail)
+	if email == "" {
+		email = "mock"
+	}
+
+	return registry.Selection{
+		registry.KindData:  data,
+		registry.KindQueue: queue,
+		registry.KindCache: cache,
+		registry.KindEmail: email,
+	}
+}
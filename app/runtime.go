@@ -0,0 +1,18 @@
+package main
+
+import (
+	"google.golang.org/appengine"
+)
+
+// useAppEngine reports whether requests are served by App Engine runtime,
+// SERVER_RUNTIME set to "appengine" or "native" overrides detection
+func useAppEngine(runtime string) bool {
+	switch runtime {
+	case "appengine":
+		return true
+	case "native":
+		return false
+	}
+
+	return appengine.IsAppEngine()
+}
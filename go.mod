@@ -3,14 +3,18 @@ module github.com/stiks/gobs
 go 1.13
 
 require (
-	github.com/dgrijalva/jwt-go v3.2.0+incompatible
+	github.com/fergusstrange/embedded-postgres v1.19.0
 	github.com/go-ozzo/ozzo-validation/v4 v4.0.0
+	github.com/golang-jwt/jwt v3.2.2+incompatible
 	github.com/google/uuid v1.1.1
 	github.com/joho/godotenv v1.3.0
 	github.com/labstack/echo/v4 v4.9.0
 	github.com/labstack/gommon v0.3.1
+	github.com/lib/pq v1.10.9
 	github.com/matcornic/hermes/v2 v2.1.0
+	github.com/mattn/go-sqlite3 v1.14.14
 	github.com/stretchr/testify v1.7.0
 	golang.org/x/crypto v0.31.0
 	google.golang.org/appengine v1.6.5
+	gopkg.in/yaml.v2 v2.2.2
 )
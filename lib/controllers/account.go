@@ -1,7 +1,9 @@
 package controllers
 
 import (
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -18,17 +20,23 @@ type AccountControllerInterface interface {
 	ResetRequest(c echo.Context) error
 	EmailConfirm(c echo.Context) error
 	GetProfile(c echo.Context) error
+	EnrollMFA(c echo.Context) error
+	ConfirmMFA(c echo.Context) error
+	DisableMFA(c echo.Context) error
+	RecoveryCodes(c echo.Context) error
 	Routes(g *echo.Group)
 }
 
 type accountController struct {
 	user services.UserService
+	mfa  services.MFAService
 }
 
 // NewAccountController returns a new Service instance
-func NewAccountController(userSrv services.UserService) AccountControllerInterface {
+func NewAccountController(userSrv services.UserService, mfaSrv services.MFAService) AccountControllerInterface {
 	return &accountController{
 		user: userSrv,
+		mfa:  mfaSrv,
 	}
 }
 
@@ -38,6 +46,136 @@ func (ctl *accountController) Routes(g *echo.Group) {
 	g.POST("/account/reset", ctl.ResetRequest)
 	g.POST("/account/email-confirm", ctl.EmailConfirm)
 	g.GET("/account/profile", ctl.GetProfile, auth.EnableAuthorisation(), auth.RequiredAuth())
+	g.POST("/account/mfa", ctl.EnrollMFA, auth.EnableAuthorisation(), auth.RequiredAuth())
+	g.POST("/account/mfa/confirm", ctl.ConfirmMFA, auth.EnableAuthorisation(), auth.RequiredAuth())
+	g.DELETE("/account/mfa", ctl.DisableMFA, auth.EnableAuthorisation(), auth.RequiredAuth())
+	g.POST("/account/mfa/recovery-codes", ctl.RecoveryCodes, auth.EnableAuthorisation(), auth.RequiredAuth())
+}
+
+// mfaError maps MFA errors to HTTP errors
+func mfaError(c echo.Context, err error) error {
+	if throttled, ok := err.(*models.LoginThrottledError); ok {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+
+		return echo.NewHTTPError(http.StatusTooManyRequests, throttled.Error())
+	}
+
+	switch err {
+	case models.ErrInvalidMFAToken, models.ErrInvalidGrantType:
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case models.ErrMFARequiredByRole:
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	case models.ErrUserNotFound:
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case models.ErrInvalidMFACode, models.ErrMFAAlreadyEnabled, models.ErrMFANotEnabled, models.ErrMFANotEnrolled:
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+	}
+
+	return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+}
+
+// mfaCode binds code of signed in user
+func mfaCode(c echo.Context) (*models.MFACode, error) {
+	req := new(models.MFACode)
+	if err := c.Bind(req); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := req.Validate(); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return req, nil
+}
+
+// EnrollMFA starts TOTP enrollment, secret is returned once
+func (ctl *accountController) EnrollMFA(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, models.ErrInvalidUUID.Error())
+	}
+
+	enrollment, err := ctl.mfa.Enroll(ctx, userID)
+	if err != nil {
+		xlog.Errorf(ctx, "Unable to start MFA enrollment, %s", err.Error())
+
+		return mfaError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, enrollment)
+}
+
+// ConfirmMFA enables MFA with code of pending secret
+func (ctl *accountController) ConfirmMFA(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, models.ErrInvalidUUID.Error())
+	}
+
+	req, err := mfaCode(c)
+	if err != nil {
+		return err
+	}
+
+	codes, err := ctl.mfa.Confirm(ctx, userID, req.Code)
+	if err != nil {
+		xlog.Debugf(ctx, "Unable to confirm MFA, %s", err.Error())
+
+		return mfaError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, models.RecoveryCodes{Codes: codes})
+}
+
+// DisableMFA ...
+func (ctl *accountController) DisableMFA(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, models.ErrInvalidUUID.Error())
+	}
+
+	req, err := mfaCode(c)
+	if err != nil {
+		return err
+	}
+
+	if err := ctl.mfa.Disable(ctx, userID, req.Code, c.RealIP()); err != nil {
+		xlog.Debugf(ctx, "Unable to disable MFA, %s", err.Error())
+
+		return mfaError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"status": "ok"})
+}
+
+// RecoveryCodes replaces recovery codes
+func (ctl *accountController) RecoveryCodes(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, models.ErrInvalidUUID.Error())
+	}
+
+	req, err := mfaCode(c)
+	if err != nil {
+		return err
+	}
+
+	codes, err := ctl.mfa.RegenerateRecoveryCodes(ctx, userID, req.Code, c.RealIP())
+	if err != nil {
+		xlog.Debugf(ctx, "Unable to regenerate recovery codes, %s", err.Error())
+
+		return mfaError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, models.RecoveryCodes{Codes: codes})
 }
 
 // GetProfile ...
@@ -181,6 +319,15 @@ func (ctl *accountController) EmailConfirm(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusUnprocessableEntity, models.ErrEmailConfirmationCode.Error())
 	}
 
+	if user.ValidationExpired() {
+		xlog.Debugf(ctx, "Email confirmation code expired")
+
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, models.ErrEmailCodeExpired.Error())
+	}
+
+	// Confirmation code can be used only once
+	user.ValidationHash = ""
+	user.Verified = true
 	user.IsActive = true
 
 	if _, err := ctl.user.Update(ctx, user); err != nil {
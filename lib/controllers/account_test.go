@@ -1,8 +1,12 @@
 package controllers_test
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -10,17 +14,21 @@ import (
 
 	"github.com/stiks/gobs/lib/controllers"
 	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/providers/mock"
+	"github.com/stiks/gobs/lib/services"
 	"github.com/stiks/gobs/pkg/helpers"
 )
 
+var _mfaSrv = services.NewMFAService(mock.NewUserRepository(), _policySrv, _cacheSrv, nil, "GOBS")
+
 func TestControllers_Account_NewAccountController(t *testing.T) {
-	assert.NotNil(t, controllers.NewAccountController(_userSrv))
+	assert.NotNil(t, controllers.NewAccountController(_userSrv, _mfaSrv))
 }
 
 func TestControllers_Account_Routes(t *testing.T) {
 	t.Run("Get profile", func(t *testing.T) {
 		e := echo.New()
-		controllers.NewAccountController(_userSrv).Routes(e.Group("api"))
+		controllers.NewAccountController(_userSrv, _mfaSrv).Routes(e.Group("api"))
 
 		c, _ := helpers.RequestTest(http.MethodGet, "/api/account/profile", e)
 		assert.Equal(t, 400, c)
@@ -28,7 +36,7 @@ func TestControllers_Account_Routes(t *testing.T) {
 
 	t.Run("Post reset confirmation", func(t *testing.T) {
 		e := echo.New()
-		controllers.NewAccountController(_userSrv).Routes(e.Group("api"))
+		controllers.NewAccountController(_userSrv, _mfaSrv).Routes(e.Group("api"))
 
 		c, _ := helpers.RequestTest(http.MethodPost, "/api/account/reset-confirm", e)
 		assert.Equal(t, 400, c)
@@ -36,7 +44,7 @@ func TestControllers_Account_Routes(t *testing.T) {
 
 	t.Run("Post reset", func(t *testing.T) {
 		e := echo.New()
-		controllers.NewAccountController(_userSrv).Routes(e.Group("api"))
+		controllers.NewAccountController(_userSrv, _mfaSrv).Routes(e.Group("api"))
 
 		c, _ := helpers.RequestTest(http.MethodPost, "/api/account/reset", e)
 		assert.Equal(t, 400, c)
@@ -44,7 +52,7 @@ func TestControllers_Account_Routes(t *testing.T) {
 
 	t.Run("Confirmation email address", func(t *testing.T) {
 		e := echo.New()
-		controllers.NewAccountController(_userSrv).Routes(e.Group("api"))
+		controllers.NewAccountController(_userSrv, _mfaSrv).Routes(e.Group("api"))
 
 		c, _ := helpers.RequestTest(http.MethodPost, "/api/account/email-confirm", e)
 		assert.Equal(t, 400, c)
@@ -52,7 +60,7 @@ func TestControllers_Account_Routes(t *testing.T) {
 }
 
 func TestControllers_Account_GetProfile(t *testing.T) {
-	ctl := controllers.NewAccountController(_userSrv)
+	ctl := controllers.NewAccountController(_userSrv, _mfaSrv)
 
 	t.Run("Invalid UUID", func(t *testing.T) {
 		_, ctx := helpers.RequestWithBody(http.MethodGet, "/", nil, echo.New())
@@ -86,7 +94,7 @@ func TestControllers_Account_GetProfile(t *testing.T) {
 }
 
 func TestControllers_Account_EmailConfirm(t *testing.T) {
-	ctl := controllers.NewAccountController(_userSrv)
+	ctl := controllers.NewAccountController(_userSrv, _mfaSrv)
 
 	t.Run("Non-existing user", func(t *testing.T) {
 		user := models.ConfirmEmail{
@@ -160,7 +168,7 @@ func TestControllers_Account_EmailConfirm(t *testing.T) {
 }
 
 func TestControllers_Account_ResetRequest(t *testing.T) {
-	ctl := controllers.NewAccountController(_userSrv)
+	ctl := controllers.NewAccountController(_userSrv, _mfaSrv)
 
 	t.Run("Non-existing user", func(t *testing.T) {
 		rec, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", models.PasswordResetRequest{Email: "test@google.com"}, echo.New())
@@ -184,7 +192,7 @@ func TestControllers_Account_ResetRequest(t *testing.T) {
 }
 
 func TestControllers_Account_PasswordConfirm(t *testing.T) {
-	ctl := controllers.NewAccountController(_userSrv)
+	ctl := controllers.NewAccountController(_userSrv, _mfaSrv)
 
 	t.Run("Blank code", func(t *testing.T) {
 		_, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", models.PasswordResetRequest{Email: "test@google.com"}, echo.New())
@@ -289,3 +297,106 @@ func TestControllers_Account_PasswordConfirm(t *testing.T) {
 		}
 	})
 }
+
+func TestControllers_Account_MFA(t *testing.T) {
+	roles := services.NewPolicyService(mock.NewRoleRepository(), _cacheSrv)
+	ctl := controllers.NewAccountController(_userSrv, services.NewMFAService(mock.NewUserRepository(), roles, _cacheSrv, nil, "GOBS"))
+
+	request := func(handler func(echo.Context) error, body interface{}) (*httptest.ResponseRecorder, error) {
+		rec, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", body, echo.New())
+		_actor(ctx, "3ab1ba2a-6031-4e34-aae3-dcd43a987775", models.RoleUser)
+
+		return rec, handler(ctx)
+	}
+
+	code := func(secret string) string {
+		code, _ := models.TOTPCode(secret, models.TOTPStep(time.Now()))
+
+		return code
+	}
+
+	t.Run("Not enrolled", func(t *testing.T) {
+		_, err := request(ctl.ConfirmMFA, models.MFACode{Code: "123456"})
+		if assert.Error(t, err) {
+			assert.Equal(t, http.StatusUnprocessableEntity, err.(*echo.HTTPError).Code)
+		}
+
+		_, err = request(ctl.DisableMFA, models.MFACode{Code: "123456"})
+		if assert.Error(t, err) {
+			assert.Equal(t, http.StatusUnprocessableEntity, err.(*echo.HTTPError).Code)
+		}
+	})
+
+	enrollment := new(models.MFAEnrollment)
+
+	rec, err := request(ctl.EnrollMFA, nil)
+	if !assert.NoError(t, err) || !assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), enrollment)) {
+		return
+	}
+
+	assert.Contains(t, enrollment.URI, "otpauth://totp/GOBS:user@test.com?")
+
+	t.Run("Code is required", func(t *testing.T) {
+		_, err := request(ctl.ConfirmMFA, models.MFACode{})
+		if assert.Error(t, err) {
+			assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+		}
+	})
+
+	t.Run("Wrong code", func(t *testing.T) {
+		_, err := request(ctl.ConfirmMFA, models.MFACode{Code: "000000x"})
+		if assert.Error(t, err) {
+			assert.Equal(t, http.StatusUnprocessableEntity, err.(*echo.HTTPError).Code)
+		}
+	})
+
+	codes := new(models.RecoveryCodes)
+
+	rec, err = request(ctl.ConfirmMFA, models.MFACode{Code: code(enrollment.Secret)})
+	if !assert.NoError(t, err) || !assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), codes)) {
+		return
+	}
+
+	assert.Len(t, codes.Codes, models.RecoveryCodeCount)
+
+	t.Run("Already enabled", func(t *testing.T) {
+		_, err := request(ctl.EnrollMFA, nil)
+		if assert.Error(t, err) {
+			assert.Equal(t, http.StatusUnprocessableEntity, err.(*echo.HTTPError).Code)
+		}
+	})
+
+	t.Run("Regenerate recovery codes", func(t *testing.T) {
+		old := codes.Codes[0]
+
+		rec, err := request(ctl.RecoveryCodes, models.MFACode{Code: old})
+		if assert.NoError(t, err) && assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), codes)) {
+			assert.NotContains(t, codes.Codes, old)
+		}
+
+		_, err = request(ctl.DisableMFA, models.MFACode{Code: codes.Codes[1] + "x"})
+		if assert.Error(t, err) {
+			assert.Equal(t, http.StatusUnprocessableEntity, err.(*echo.HTTPError).Code)
+		}
+	})
+
+	t.Run("Role requires MFA", func(t *testing.T) {
+		_, _ = roles.RequireMFA(context.Background(), models.RoleUser, true)
+		defer roles.RequireMFA(context.Background(), models.RoleUser, false)
+
+		_, err := request(ctl.DisableMFA, models.MFACode{Code: codes.Codes[0]})
+		if assert.Error(t, err) {
+			assert.Equal(t, http.StatusForbidden, err.(*echo.HTTPError).Code)
+		}
+	})
+
+	t.Run("Disable", func(t *testing.T) {
+		_, err := request(ctl.DisableMFA, models.MFACode{Code: codes.Codes[0]})
+		assert.NoError(t, err)
+
+		_, err = request(ctl.RecoveryCodes, models.MFACode{Code: codes.Codes[1]})
+		if assert.Error(t, err) {
+			assert.Equal(t, http.StatusUnprocessableEntity, err.(*echo.HTTPError).Code)
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/services"
+	"github.com/stiks/gobs/pkg/auth"
+	"github.com/stiks/gobs/pkg/xlog"
+)
+
+// AuthClientControllerInterface ...
+type AuthClientControllerInterface interface {
+	UpdateScope(c echo.Context) error
+	Routes(g *echo.Group)
+}
+
+type authClientController struct {
+	auth   services.AuthService
+	policy services.PolicyService
+}
+
+// NewAuthClientController returns controller managing auth clients
+func NewAuthClientController(authSrv services.AuthService, policy services.PolicyService) AuthClientControllerInterface {
+	return &authClientController{
+		auth:   authSrv,
+		policy: policy,
+	}
+}
+
+// Routes registers route handlers for auth clients
+func (ctl *authClientController) Routes(g *echo.Group) {
+	manage := auth.RequirePermission(ctl.policy, models.PermAuthClientsManage)
+
+	g.PUT("/auth/clients/:client_id/scope", ctl.UpdateScope, auth.EnableAuthorisation(), auth.RequiredAuth(), manage)
+}
+
+// UpdateScope replaces scopes the client may request, refresh grants are
+// narrowed to the new scope
+func (ctl *authClientController) UpdateScope(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	req := new(models.ClientScope)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	client, err := ctl.auth.UpdateClientScope(ctx, c.Param("client_id"), req)
+	switch err {
+	case nil:
+	case models.ErrInvalidScope:
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case models.ErrAuthClientNotFound:
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	default:
+		xlog.Errorf(ctx, "Unable to update auth client scope, err: %s", err.Error())
+
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusAccepted, echo.Map{"client_id": client.ClientID, "scope": client.Scope})
+}
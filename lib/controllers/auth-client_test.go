@@ -0,0 +1,58 @@
+package controllers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/controllers"
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/providers/mock"
+	"github.com/stiks/gobs/lib/services"
+)
+
+func TestControllers_AuthClient_NewAuthClientController(t *testing.T) {
+	assert.NotNil(t, controllers.NewAuthClientController(_authSrv, _policySrv))
+}
+
+func TestControllers_AuthClient_UpdateScope(t *testing.T) {
+	e := echo.New()
+	controllers.NewAuthClientController(_mustAuth(services.NewAuthService(mock.NewAuthRepository(), _authCfg)), _policySrv).Routes(e.Group("api"))
+
+	request := func(path, role string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, path, bytes.NewBufferString(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderAuthorization, _bearer(t, role))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	t.Run("Admins are denied", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, request("/api/auth/clients/SecRetAuthKey/scope", models.RoleAdmin, `{"scope":"users:read"}`).Code)
+	})
+
+	t.Run("Unknown scope", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, request("/api/auth/clients/SecRetAuthKey/scope", models.RoleSuperUser, `{"scope":"users:read root"}`).Code)
+	})
+
+	t.Run("Unknown client", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, request("/api/auth/clients/Nope/scope", models.RoleSuperUser, `{"scope":"users:read"}`).Code)
+	})
+
+	t.Run("Scope replaced", func(t *testing.T) {
+		rec := request("/api/auth/clients/PublicSpa/scope", models.RoleSuperUser, `{"scope":"users:read users:write users:read"}`)
+		if assert.Equal(t, http.StatusAccepted, rec.Code) {
+			var resp map[string]string
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, map[string]string{"client_id": "PublicSpa", "scope": "users:read users:write"}, resp, "duplicates are dropped, secret is not shown")
+		}
+	})
+}
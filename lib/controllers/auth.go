@@ -2,12 +2,16 @@ package controllers
 
 import (
 	"context"
+	"math"
 	"net/http"
+	"strconv"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 
 	"github.com/stiks/gobs/lib/models"
 	"github.com/stiks/gobs/lib/services"
+	"github.com/stiks/gobs/pkg/auth"
 	"github.com/stiks/gobs/pkg/xlog"
 )
 
@@ -19,6 +23,12 @@ type authController struct {
 type AuthControllerInterface interface {
 	Routes(g *echo.Group)
 	TokenHandler(c echo.Context) error
+	EnrollMFA(c echo.Context) error
+	Authorize(c echo.Context) error
+	Consent(c echo.Context) error
+	Revoke(c echo.Context) error
+	Introspect(c echo.Context) error
+	UserInfo(c echo.Context) error
 }
 
 // NewAuthController returns a new Service instance
@@ -30,7 +40,67 @@ func NewAuthController(authSrv services.AuthService) AuthControllerInterface {
 
 // Routes registers routes
 func (ctl *authController) Routes(g *echo.Group) {
+	authorised := auth.EnableAuthorisation()
+
 	g.POST("/auth/token", ctl.TokenHandler)
+	g.POST("/auth/mfa/enroll", ctl.EnrollMFA)
+	g.POST("/auth/revoke", ctl.Revoke)
+	g.POST("/auth/introspect", ctl.Introspect)
+	g.GET("/auth/authorize", ctl.Authorize, authorised, auth.RequiredAuth())
+	g.POST("/auth/authorize", ctl.Consent, authorised, auth.RequiredAuth())
+	g.GET("/auth/userinfo", ctl.UserInfo, authorised, auth.RequiredAuth(), auth.RequireScopes(models.ScopeOpenID))
+	g.POST("/auth/userinfo", ctl.UserInfo, authorised, auth.RequiredAuth(), auth.RequireScopes(models.ScopeOpenID))
+}
+
+// authorizeError maps authorization request errors to HTTP errors, nothing is
+// redirected until client and redirect URI are known to be valid
+func authorizeError(err error) error {
+	switch err {
+	case models.ErrAuthClientNotFound, models.ErrInvalidRedirectURI, models.ErrInvalidScope:
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+}
+
+// Authorize starts authorization_code grant for signed in user, the response
+// either redirects back to the client or asks UI to show consent screen
+func (ctl *authController) Authorize(c echo.Context) error {
+	return ctl.authorize(c, ctl.auth.Authorize)
+}
+
+// Consent submits user's answer on consent screen
+func (ctl *authController) Consent(c echo.Context) error {
+	return ctl.authorize(c, ctl.auth.Consent)
+}
+
+func (ctl *authController) authorize(c echo.Context, handler func(ctx context.Context, r *models.AuthorizeRequest, userID uuid.UUID) (*models.AuthorizeResponse, error)) error {
+	ctx := c.Request().Context()
+
+	req := new(models.AuthorizeRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := req.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	req.AuthTime = auth.GetAuthTime(c)
+
+	resp, err := handler(ctx, req, userID)
+	if err != nil {
+		xlog.Infof(ctx, "Authorization request of ClientID: %s failed, err: %s", req.ClientID, err.Error())
+
+		return authorizeError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
 }
 
 // TokenHandler ...
@@ -42,14 +112,24 @@ func (ctl *authController) TokenHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
+	// client_secret_basic takes precedence over client_secret_post
+	if id, secret, ok := c.Request().BasicAuth(); ok {
+		req.ClientID, req.ClientSecret = id, secret
+	}
+
 	if err := req.Validate(); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
+	req.ClientIP = c.RealIP()
+
 	// Map of grant types against handler functions
 	grantTypes := map[string]func(ctx context.Context, r *models.AuthRequest, client *models.AuthClient) (*models.TokenResponse, error){
-		"password":      ctl.auth.PasswordGrant,
-		"refresh_token": ctl.auth.RefreshTokenGrant,
+		"password":           ctl.auth.PasswordGrant,
+		"refresh_token":      ctl.auth.RefreshTokenGrant,
+		"client_credentials": ctl.auth.ClientCredentialsGrant,
+		"authorization_code": ctl.auth.AuthorizationCodeGrant,
+		"mfa":                ctl.auth.MFAGrant,
 	}
 
 	// Check the grant type
@@ -70,6 +150,23 @@ func (ctl *authController) TokenHandler(c echo.Context) error {
 
 	// Grant processing
 	resp, err := grantHandler(ctx, req, client)
+	if challenge, ok := err.(*models.MFAChallenge); ok {
+		xlog.Infof(ctx, "Login of ClientID: %s requires second factor", client.ClientID)
+
+		return c.JSON(http.StatusForbidden, echo.Map{
+			"error":               "mfa_required",
+			"error_description":   "multi-factor authentication required",
+			"mfa_token":           challenge.Token,
+			"enrollment_required": challenge.EnrollmentRequired,
+		})
+	}
+
+	if throttled, ok := err.(*models.LoginThrottledError); ok {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+
+		return echo.NewHTTPError(http.StatusTooManyRequests, throttled.Error())
+	}
+
 	if err != nil {
 		xlog.Errorf(ctx, "Login error, %s", err.Error())
 		xlog.Debugf(ctx, "Response, %+v", resp)
@@ -81,3 +178,132 @@ func (ctl *authController) TokenHandler(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, resp)
 }
+
+// EnrollMFA returns TOTP secret for user challenged by password grant whose
+// role requires MFA not set up yet, login is completed by mfa grant
+func (ctl *authController) EnrollMFA(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	req := new(models.MFAEnrollRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if id, secret, ok := c.Request().BasicAuth(); ok {
+		req.ClientID, req.ClientSecret = id, secret
+	}
+
+	client, err := ctl.auth.AuthenticateClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		xlog.Infof(ctx, "Info: MFA enrollment with ClientID: %s, err: %s", req.ClientID, err.Error())
+
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	if err := req.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	enrollment, err := ctl.auth.EnrollMFA(ctx, req.MFAToken, client)
+	if err != nil {
+		xlog.Infof(ctx, "MFA enrollment failed, err: %s", err.Error())
+
+		return mfaError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, enrollment)
+}
+
+// tokenRequest binds request of revocation and introspection endpoints and
+// authenticates the client, Basic auth takes precedence over body
+func (ctl *authController) tokenRequest(c echo.Context) (*models.TokenRequest, *models.AuthClient, error) {
+	ctx := c.Request().Context()
+
+	req := new(models.TokenRequest)
+	if err := c.Bind(req); err != nil {
+		return nil, nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if id, secret, ok := c.Request().BasicAuth(); ok {
+		req.ClientID, req.ClientSecret = id, secret
+	}
+
+	client, err := ctl.auth.AuthenticateClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		xlog.Infof(ctx, "Info: Token request with ClientID: %s, err: %s", req.ClientID, err.Error())
+
+		return nil, nil, echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	if err := req.Validate(); err != nil {
+		return nil, nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return req, client, nil
+}
+
+// Revoke revokes refresh or access token (RFC 7009)
+func (ctl *authController) Revoke(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	req, client, err := ctl.tokenRequest(c)
+	if err != nil {
+		return err
+	}
+
+	if err := ctl.auth.RevokeToken(ctx, req, client); err != nil {
+		if err == models.ErrUnauthorizedClient {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+// Introspect describes token state (RFC 7662)
+func (ctl *authController) Introspect(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	req, client, err := ctl.tokenRequest(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := ctl.auth.IntrospectToken(ctx, req, client)
+	if err != nil {
+		if err == models.ErrUnauthorizedClient {
+			return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+		}
+
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// UserInfo returns claims of the signed in user (OpenID Connect), access
+// token must have openid scope
+func (ctl *authController) UserInfo(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	info, err := ctl.auth.UserInfo(ctx, userID, auth.GetScope(c))
+	if err != nil {
+		switch err {
+		case models.ErrInsufficientScope:
+			return echo.NewHTTPError(http.StatusForbidden, err.Error())
+		case models.ErrUserNotFound:
+			return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+		}
+
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, info)
+}
@@ -1,9 +1,15 @@
 package controllers_test
 
 import (
+	"context"
+	"encoding/json"
+	"io"
 	"net/http"
-	"os"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
@@ -12,16 +18,28 @@ import (
 	"github.com/stiks/gobs/lib/models"
 	"github.com/stiks/gobs/lib/providers/mock"
 	"github.com/stiks/gobs/lib/services"
+	"github.com/stiks/gobs/pkg/auth"
 	"github.com/stiks/gobs/pkg/helpers"
 )
 
 var (
-	_        = os.Setenv("AUTH_SECRET_KEY", "123")
-	_        = os.Setenv("AUTH_ACCESS_TOKEN_LIFETIME", "123")
-	_        = os.Setenv("AUTH_REFRESH_TOKEN_LIFETIME", "123")
-	_authSrv = services.NewAuthService(mock.NewAuthRepository())
+	_authCfg = services.AuthConfig{SecretKey: "123", AccessTokenLifetime: 123 * time.Second, RefreshTokenLifetime: 123 * time.Second}
+	_authSrv = _mustAuth(services.NewAuthService(mock.NewAuthRepository(), _authCfg))
 )
 
+// _mustAuth panics on invalid config of test service
+func _mustAuth(srv services.AuthService, err error) services.AuthService {
+	if err != nil {
+		panic(err)
+	}
+
+	return srv
+}
+
+func init() {
+	auth.Configure(auth.Config{SecretKey: []byte(_authCfg.SecretKey)})
+}
+
 func TestControllers_Auth_NewAuthController(t *testing.T) {
 	assert.NotNil(t, controllers.NewAuthController(_authSrv))
 }
@@ -184,6 +202,232 @@ func TestControllers_Auth_TokenHandler_Password(t *testing.T) {
 	})
 }
 
+func TestControllers_Auth_TokenHandler_Lockout(t *testing.T) {
+	cfg := _authCfg
+	cfg.Lockout = services.NewLockoutService(mock.NewAuthRepository(), mock.NewUserRepository(), _queueSrv, _cacheSrv, services.LockoutConfig{MaxAttempts: 2, MaxIPAttempts: 20, Duration: 15 * time.Minute, Window: time.Hour})
+	ctl := controllers.NewAuthController(_mustAuth(services.NewAuthService(mock.NewAuthRepository(), cfg)))
+
+	body := models.AuthRequest{
+		GrantType:    "password",
+		ClientID:     "SecRetAuthKey",
+		ClientSecret: "SecretSuper",
+		Username:     "peter@test.com",
+		Password:     "wrong-pass",
+	}
+
+	for i := 0; i < 2; i++ {
+		_, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", body, echo.New())
+
+		err := ctl.TokenHandler(ctx)
+		if assert.Error(t, err) {
+			assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+		}
+	}
+
+	body.Password = "testpass"
+
+	rec, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", body, echo.New())
+
+	err := ctl.TokenHandler(ctx)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusTooManyRequests, err.(*echo.HTTPError).Code)
+		assert.Contains(t, err.Error(), models.ErrTooManyLoginAttempts.Error())
+		assert.Equal(t, "900", rec.Header().Get("Retry-After"))
+	}
+}
+
+func TestControllers_Auth_TokenHandler_MFA(t *testing.T) {
+	roles := services.NewPolicyService(mock.NewRoleRepository(), _cacheSrv)
+	_, _ = roles.RequireMFA(context.Background(), models.RoleSuperUser, true)
+
+	cfg := _authCfg
+	cfg.MFA = services.NewMFAService(mock.NewUserRepository(), roles, _cacheSrv, nil, "GOBS")
+	ctl := controllers.NewAuthController(_mustAuth(services.NewAuthService(mock.NewAuthRepository(), cfg)))
+
+	password := models.AuthRequest{
+		GrantType:    "password",
+		ClientID:     "SecRetAuthKey",
+		ClientSecret: "SecretSuper",
+		Username:     "peter@test.com",
+		Password:     "testpass",
+	}
+
+	rec, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", password, echo.New())
+	if !assert.NoError(t, ctl.TokenHandler(ctx)) || !assert.Equal(t, http.StatusForbidden, rec.Code) {
+		return
+	}
+
+	var challenge struct {
+		Error              string `json:"error"`
+		Token              string `json:"mfa_token"`
+		EnrollmentRequired bool   `json:"enrollment_required"`
+	}
+
+	if !assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &challenge)) {
+		return
+	}
+
+	assert.Equal(t, "mfa_required", challenge.Error)
+	assert.True(t, challenge.EnrollmentRequired)
+
+	t.Run("MFA token is not an access token", func(t *testing.T) {
+		e := echo.New()
+		e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, auth.EnableAuthorisation(), auth.RequiredAuth())
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+challenge.Token)
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		assert.NotEqual(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("Enrollment requires client", func(t *testing.T) {
+		body := models.MFAEnrollRequest{MFAToken: challenge.Token, ClientID: "RandomStuffHere", ClientSecret: "RandomKeySecret"}
+
+		_, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", body, echo.New())
+
+		err := ctl.EnrollMFA(ctx)
+		if assert.Error(t, err) {
+			assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+		}
+	})
+
+	body := models.MFAEnrollRequest{MFAToken: challenge.Token, ClientID: "SecRetAuthKey", ClientSecret: "SecretSuper"}
+	enrollment := new(models.MFAEnrollment)
+
+	rec, ctx = helpers.RequestObjectWithBody(t, http.MethodPost, "/", body, echo.New())
+	if !assert.NoError(t, ctl.EnrollMFA(ctx)) || !assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), enrollment)) {
+		return
+	}
+
+	mfa := models.AuthRequest{
+		GrantType:    "mfa",
+		ClientID:     "SecRetAuthKey",
+		ClientSecret: "SecretSuper",
+		MFAToken:     challenge.Token,
+		Code:         "000000",
+	}
+
+	t.Run("Wrong code", func(t *testing.T) {
+		_, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", mfa, echo.New())
+
+		err := ctl.TokenHandler(ctx)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), models.ErrInvalidMFACode.Error())
+		}
+	})
+
+	mfa.Code, _ = models.TOTPCode(enrollment.Secret, models.TOTPStep(time.Now()))
+
+	rec, ctx = helpers.RequestObjectWithBody(t, http.MethodPost, "/", mfa, echo.New())
+	if assert.NoError(t, ctl.TokenHandler(ctx)) && assert.Equal(t, http.StatusOK, rec.Code) {
+		resp := new(models.TokenResponse)
+		if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), resp)) {
+			assert.NotEmpty(t, resp.AccessToken)
+			assert.Len(t, resp.RecoveryCodes, models.RecoveryCodeCount)
+		}
+	}
+
+	t.Run("Code is not replayed", func(t *testing.T) {
+		_, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", mfa, echo.New())
+
+		err := ctl.TokenHandler(ctx)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), models.ErrInvalidMFACode.Error())
+		}
+	})
+}
+
+func TestControllers_Auth_TokenHandler_ClientCredentials(t *testing.T) {
+	ctl := controllers.NewAuthController(_authSrv)
+
+	t.Run("Client token", func(t *testing.T) {
+		body := models.AuthRequest{
+			GrantType:    "client_credentials",
+			ClientID:     "SecRetAuthKey",
+			ClientSecret: "SecretSuper",
+		}
+
+		rec, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", body, echo.New())
+
+		if assert.NoError(t, ctl.TokenHandler(ctx)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Contains(t, rec.Body.String(), `"scope":"users:read users:write clients:read clients:write"`)
+			assert.NotContains(t, rec.Body.String(), "refresh_token")
+			assert.NotContains(t, rec.Body.String(), "user_id")
+		}
+	})
+
+	t.Run("Client without role", func(t *testing.T) {
+		body := models.AuthRequest{
+			GrantType:    "client_credentials",
+			ClientID:     "RandomStuffHere",
+			ClientSecret: "RandomKeySecret",
+		}
+
+		_, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", body, echo.New())
+
+		err := ctl.TokenHandler(ctx)
+		if assert.Error(t, err) {
+			assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+			assert.Contains(t, err.Error(), models.ErrUnauthorizedClient.Error())
+		}
+	})
+
+	t.Run("Client principal", func(t *testing.T) {
+		e := echo.New()
+		controllers.NewAuthController(_authSrv).Routes(e.Group("api"))
+
+		var principal echo.Map
+		e.GET("/whoami", func(c echo.Context) error {
+			clientID, err := auth.GetClientID(c)
+			if err != nil {
+				return err
+			}
+
+			principal = echo.Map{"client": clientID.String(), "role": c.Get("ROLE"), "scope": c.Get("SCOPE")}
+
+			return c.NoContent(http.StatusNoContent)
+		}, auth.EnableAuthorisation(), auth.RequiredClientAuth())
+		e.GET("/user", func(c echo.Context) error {
+			return c.NoContent(http.StatusNoContent)
+		}, auth.EnableAuthorisation(), auth.RequiredAuth())
+
+		rec, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", models.AuthRequest{
+			GrantType:    "client_credentials",
+			ClientID:     "SecRetAuthKey",
+			ClientSecret: "SecretSuper",
+			Scope:        "clients:read",
+		}, e)
+		if !assert.NoError(t, ctl.TokenHandler(ctx)) {
+			return
+		}
+
+		var resp models.TokenResponse
+		if !assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp)) {
+			return
+		}
+
+		request := func(path, bearer string) int {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.Header.Set(echo.HeaderAuthorization, bearer)
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			return rec.Code
+		}
+
+		assert.Equal(t, http.StatusNoContent, request("/whoami", "Bearer "+resp.AccessToken))
+		assert.Equal(t, echo.Map{"client": "775a5b37-1742-4e54-9439-0357e768b011", "role": models.RoleClient, "scope": "clients:read"}, principal)
+
+		assert.Equal(t, http.StatusUnauthorized, request("/user", "Bearer "+resp.AccessToken), "client is not a user")
+		assert.Equal(t, http.StatusUnauthorized, request("/whoami", _bearer(t, models.RoleAdmin)), "user is not a client")
+	})
+}
+
 func TestControllers_Auth_TokenHandler_RefreshToken(t *testing.T) {
 	ctl := controllers.NewAuthController(_authSrv)
 
@@ -253,3 +497,246 @@ func TestControllers_Auth_TokenHandler_RefreshToken(t *testing.T) {
 		}
 	})
 }
+
+func TestControllers_Auth_AuthorizationCode(t *testing.T) {
+	e := echo.New()
+	controllers.NewAuthController(_mustAuth(services.NewAuthService(mock.NewAuthRepository(), _authCfg))).Routes(e.Group("api"))
+
+	request := func(method, path string, body interface{}, bearer string) *httptest.ResponseRecorder {
+		var payload io.Reader
+		if body != nil {
+			payload = helpers.ObjectToByte(t, body)
+		}
+
+		req := httptest.NewRequest(method, path, payload)
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if bearer != "" {
+			req.Header.Set(echo.HeaderAuthorization, bearer)
+		}
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	authorize := models.AuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            "PublicSpa",
+		RedirectURI:         "https://spa.test/callback",
+		State:               "xyz",
+		CodeChallenge:       "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+		CodeChallengeMethod: "S256",
+	}
+
+	query := url.Values{
+		"response_type":         {authorize.ResponseType},
+		"client_id":             {authorize.ClientID},
+		"redirect_uri":          {authorize.RedirectURI},
+		"state":                 {authorize.State},
+		"code_challenge":        {authorize.CodeChallenge},
+		"code_challenge_method": {authorize.CodeChallengeMethod},
+	}.Encode()
+
+	t.Run("User token required", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, request(http.MethodGet, "/api/auth/authorize?"+query, nil, "").Code)
+	})
+
+	t.Run("Invalid request", func(t *testing.T) {
+		rec := request(http.MethodGet, "/api/auth/authorize?client_id=PublicSpa", nil, _bearer(t, models.RoleUser))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		rec = request(http.MethodGet, "/api/auth/authorize?"+strings.Replace(query, "spa.test", "evil.test", 1), nil, _bearer(t, models.RoleUser))
+		if assert.Equal(t, http.StatusBadRequest, rec.Code) {
+			assert.Contains(t, rec.Body.String(), models.ErrInvalidRedirectURI.Error())
+		}
+	})
+
+	t.Run("Consent then exchange", func(t *testing.T) {
+		rec := request(http.MethodGet, "/api/auth/authorize?"+query, nil, _bearer(t, models.RoleUser))
+		if assert.Equal(t, http.StatusOK, rec.Code) {
+			assert.Contains(t, rec.Body.String(), `"consent_required":true`)
+		}
+
+		authorize.Approve = true
+
+		rec = request(http.MethodPost, "/api/auth/authorize", authorize, _bearer(t, models.RoleUser))
+		if !assert.Equal(t, http.StatusOK, rec.Code) {
+			return
+		}
+
+		var resp models.AuthorizeResponse
+		if !assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp)) {
+			return
+		}
+
+		redirect, err := url.Parse(resp.RedirectTo)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.Equal(t, "xyz", redirect.Query().Get("state"))
+
+		exchange := models.AuthRequest{
+			GrantType:    "authorization_code",
+			ClientID:     "PublicSpa",
+			Code:         redirect.Query().Get("code"),
+			RedirectURI:  "https://spa.test/callback",
+			CodeVerifier: "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk",
+		}
+
+		rec = request(http.MethodPost, "/api/auth/token", exchange, "")
+		if assert.Equal(t, http.StatusOK, rec.Code) {
+			assert.Contains(t, rec.Body.String(), `"user_id":"775a5b37-1742-4e54-9439-0357e768b011"`)
+			assert.Contains(t, rec.Body.String(), `"scope":"users:read"`)
+		}
+
+		rec = request(http.MethodPost, "/api/auth/token", exchange, "")
+		if assert.Equal(t, http.StatusBadRequest, rec.Code, "code is single-use") {
+			assert.Contains(t, rec.Body.String(), models.ErrAuthorizationCodeNotFound.Error())
+		}
+	})
+}
+
+func TestControllers_Auth_RevokeIntrospect(t *testing.T) {
+	authSrv := _mustAuth(services.NewAuthService(mock.NewAuthRepository(), _authCfg))
+
+	auth.Configure(auth.Config{SecretKey: []byte(_authCfg.SecretKey), Denylist: authSrv})
+	defer auth.Configure(auth.Config{SecretKey: []byte(_authCfg.SecretKey)})
+
+	e := echo.New()
+	controllers.NewAuthController(authSrv).Routes(e.Group("api"))
+	e.GET("/api/me", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}, auth.EnableAuthorisation(), auth.RequiredAuth())
+
+	request := func(method, path string, form url.Values, bearer string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		req.SetBasicAuth("SecRetAuthKey", "SecretSuper")
+		if bearer != "" {
+			req.Header.Set(echo.HeaderAuthorization, bearer)
+		}
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	rec := request(http.MethodPost, "/api/auth/token", url.Values{
+		"grant_type":    {"password"},
+		"client_id":     {"SecRetAuthKey"},
+		"client_secret": {"SecretSuper"},
+		"username":      {"peter@test.com"},
+		"password":      {"testpass"},
+	}, "")
+	if !assert.Equal(t, http.StatusOK, rec.Code) {
+		return
+	}
+
+	var token models.TokenResponse
+	if !assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &token)) {
+		return
+	}
+
+	t.Run("Client authentication required", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/introspect", strings.NewReader("token="+token.AccessToken))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		req.SetBasicAuth("SecRetAuthKey", "wrong")
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("Active token", func(t *testing.T) {
+		rec := request(http.MethodPost, "/api/auth/introspect", url.Values{"token": {token.AccessToken}}, "")
+		if assert.Equal(t, http.StatusOK, rec.Code) {
+			assert.Contains(t, rec.Body.String(), `"active":true`)
+			assert.Contains(t, rec.Body.String(), `"username":"peter@test.com"`)
+		}
+
+		assert.Equal(t, http.StatusNoContent, request(http.MethodGet, "/api/me", nil, "Bearer "+token.AccessToken).Code)
+	})
+
+	t.Run("Revoked token", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, request(http.MethodPost, "/api/auth/revoke", url.Values{"token": {token.AccessToken}}, "").Code)
+
+		rec := request(http.MethodPost, "/api/auth/introspect", url.Values{"token": {token.AccessToken}}, "")
+		if assert.Equal(t, http.StatusOK, rec.Code) {
+			assert.JSONEq(t, `{"active":false}`, rec.Body.String())
+		}
+
+		rec = request(http.MethodGet, "/api/me", nil, "Bearer "+token.AccessToken)
+		if assert.Equal(t, http.StatusUnauthorized, rec.Code) {
+			assert.Contains(t, rec.Body.String(), "token revoked")
+		}
+	})
+
+	t.Run("Unknown token", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, request(http.MethodPost, "/api/auth/revoke", url.Values{"token": {"unknown"}}, "").Code)
+	})
+}
+
+func TestControllers_Auth_UserInfo(t *testing.T) {
+	e := echo.New()
+	controllers.NewAuthController(_authSrv).Routes(e.Group("api"))
+
+	request := func(method, path string, form url.Values, bearer string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		if bearer != "" {
+			req.Header.Set(echo.HeaderAuthorization, bearer)
+		} else {
+			req.SetBasicAuth("SecRetAuthKey", "SecretSuper")
+		}
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	login := func(scope string) *models.TokenResponse {
+		rec := request(http.MethodPost, "/api/auth/token", url.Values{
+			"grant_type": {"password"},
+			"username":   {"peter@test.com"},
+			"password":   {"testpass"},
+			"scope":      {scope},
+		}, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("login failed: %s", rec.Body.String())
+		}
+
+		token := new(models.TokenResponse)
+		if err := json.Unmarshal(rec.Body.Bytes(), token); err != nil {
+			t.Fatal(err)
+		}
+
+		return token
+	}
+
+	t.Run("Claims released by scope", func(t *testing.T) {
+		token := login("openid profile")
+		assert.NotEmpty(t, token.IDToken, "client authenticated with Basic auth")
+
+		rec := request(http.MethodGet, "/api/auth/userinfo", nil, "Bearer "+token.AccessToken)
+		if assert.Equal(t, http.StatusOK, rec.Code) {
+			assert.Contains(t, rec.Body.String(), `"sub":"775a5b37-1742-4e54-9439-0357e768b011"`)
+			assert.Contains(t, rec.Body.String(), `"given_name":"Apple"`)
+			assert.NotContains(t, rec.Body.String(), "peter@test.com")
+		}
+	})
+
+	t.Run("Token without openid scope", func(t *testing.T) {
+		rec := request(http.MethodPost, "/api/auth/userinfo", nil, "Bearer "+login("users:read").AccessToken)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("Token required", func(t *testing.T) {
+		rec := request(http.MethodGet, "/api/auth/userinfo", nil, "Bearer nope")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
@@ -0,0 +1,242 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/services"
+	"github.com/stiks/gobs/pkg/auth"
+	"github.com/stiks/gobs/pkg/xlog"
+)
+
+type clientController struct {
+	client services.ClientService
+	policy services.PolicyService
+}
+
+// ClientControllerInterface ...
+type ClientControllerInterface interface {
+	View(c echo.Context) error
+	List(c echo.Context) error
+	Create(c echo.Context) error
+	Update(c echo.Context) error
+	Delete(c echo.Context) error
+	Routes(g *echo.Group)
+}
+
+// NewClientController ...
+func NewClientController(service services.ClientService, policy services.PolicyService) ClientControllerInterface {
+	return &clientController{
+		client: service,
+		policy: policy,
+	}
+}
+
+// Routes registers route handlers for the client service
+func (ctl *clientController) Routes(g *echo.Group) {
+	authorised := auth.EnableAuthorisation()
+	read, write := auth.RequireScopes(models.ScopeClientsRead), auth.RequireScopes(models.ScopeClientsWrite)
+
+	g.GET("/clients", ctl.List, authorised, auth.RequiredAuth(), auth.RequirePermission(ctl.policy, models.PermClientsView), read)
+	g.GET("/clients/:id", ctl.View, authorised, auth.RequiredAuth(), auth.RequirePermission(ctl.policy, models.PermClientsView), read)
+	g.POST("/clients", ctl.Create, authorised, auth.RequiredAuth(), auth.RequirePermission(ctl.policy, models.PermClientsCreate), write)
+	g.PUT("/clients/:id", ctl.Update, authorised, auth.RequiredAuth(), auth.RequirePermission(ctl.policy, models.PermClientsUpdate), write)
+	g.DELETE("/clients/:id", ctl.Delete, authorised, auth.RequiredAuth(), auth.RequirePermission(ctl.policy, models.PermClientsDelete), write)
+}
+
+// authorize checks actor may use permission on client
+func (ctl *clientController) authorize(c echo.Context, permission string, client *models.Client) error {
+	actor, err := getActor(c)
+	if err != nil {
+		return err
+	}
+
+	return policyError(ctl.policy.Authorize(c.Request().Context(), actor, permission, client.OwnerID))
+}
+
+// clientError maps client service errors to HTTP errors
+func clientError(err error) error {
+	switch err {
+	case models.ErrClientNotFound:
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case models.ErrClientNameTaken:
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+
+	return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+}
+
+// List ...
+func (ctl *clientController) List(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	params := new(models.ClientQueryParams)
+	if err := c.Bind(params); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// Set hard limit for page size
+	if params.PerPage <= 0 || params.PerPage > 100 {
+		params.PerPage = 10
+	}
+
+	if params.Page <= 0 {
+		params.Page = 1
+	}
+
+	actor, err := getActor(c)
+	if err != nil {
+		return err
+	}
+
+	access, err := ctl.policy.Access(ctx, actor, models.PermClientsView)
+	if err != nil {
+		return policyError(err)
+	}
+
+	// users with own access only see clients they own
+	if access != models.AccessAll {
+		params.OwnerID = &actor.ID
+	}
+
+	clients, err := ctl.client.GetAll(ctx, params)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	total, err := ctl.client.CountAll(ctx, params)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	// hack to get non-empty list
+	if len(clients) <= 0 {
+		clients = []models.Client{}
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"data":     clients,
+		"total":    total,
+		"pageSize": params.PerPage,
+		"current":  params.Page,
+	})
+}
+
+// View ...
+func (ctl *clientController) View(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	client, err := ctl.client.GetByID(ctx, id)
+	if err != nil {
+		return clientError(err)
+	}
+
+	if err := ctl.authorize(c, models.PermClientsView, client); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, client)
+}
+
+// Create ...
+func (ctl *clientController) Create(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	req := new(models.CreateClient)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := req.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	id, err := auth.GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	client, err := ctl.client.Create(ctx, req.ToClient(&id))
+	if err != nil {
+		xlog.Errorf(ctx, "Unable to create client, err: %s", err.Error())
+
+		return clientError(err)
+	}
+
+	return c.JSON(http.StatusCreated, client)
+}
+
+// Update ...
+func (ctl *clientController) Update(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	client, err := ctl.client.GetByID(ctx, id)
+	if err != nil {
+		return clientError(err)
+	}
+
+	if err := ctl.authorize(c, models.PermClientsUpdate, client); err != nil {
+		return err
+	}
+
+	req := new(models.UpdateClient)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := req.Validate(); err != nil {
+		xlog.Errorf(ctx, "Unable to validate client query, err: %s", err.Error())
+
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// Populate changes
+	client.FromUpdate(req)
+
+	client, err = ctl.client.Update(ctx, client)
+	if err != nil {
+		xlog.Errorf(ctx, "Unable to update client, err: %s", err.Error())
+
+		return clientError(err)
+	}
+
+	return c.JSON(http.StatusAccepted, client)
+}
+
+// Delete ...
+func (ctl *clientController) Delete(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	client, err := ctl.client.GetByID(ctx, id)
+	if err != nil {
+		return clientError(err)
+	}
+
+	if err := ctl.authorize(c, models.PermClientsDelete, client); err != nil {
+		return err
+	}
+
+	if err := ctl.client.Delete(ctx, id); err != nil {
+		return clientError(err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"status": "ok"})
+}
@@ -0,0 +1,337 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/controllers"
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/providers/mock"
+	"github.com/stiks/gobs/lib/services"
+	"github.com/stiks/gobs/pkg/helpers"
+)
+
+func _clientCtl() controllers.ClientControllerInterface {
+	return controllers.NewClientController(services.NewClientService(mock.NewClientRepository()), _policySrv)
+}
+
+// _bearer signs access token the way auth service does, with every
+// management scope granted
+func _bearer(t *testing.T, role string) string {
+	return _scopedBearer(t, role, "users:read users:write clients:read clients:write")
+}
+
+// _scopedBearer signs access token with scope
+func _scopedBearer(t *testing.T, role string, scope string) string {
+	return _tenantBearer(t, role, scope, "")
+}
+
+// _tenantBearer signs access token of user in tenant, tokens without tenant
+// are the ones issued before tenants were introduced
+func _tenantBearer(t *testing.T, role string, scope string, tenant string) string {
+	claims := jwt.MapClaims{
+		"uid":   "775a5b37-1742-4e54-9439-0357e768b011",
+		"auth":  role,
+		"scope": scope,
+	}
+
+	if tenant != "" {
+		claims["tid"] = tenant
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(_authCfg.SecretKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return "Bearer " + token
+}
+
+func TestControllers_Client_NewClientController(t *testing.T) {
+	assert.NotNil(t, _clientCtl())
+}
+
+func TestControllers_Client_Routes(t *testing.T) {
+	e := echo.New()
+	_clientCtl().Routes(e.Group("api"))
+
+	request := func(method, path, role string) int {
+		req := httptest.NewRequest(method, path, nil)
+		if role != "" {
+			req.Header.Set(echo.HeaderAuthorization, _bearer(t, role))
+		}
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		return rec.Code
+	}
+
+	scoped := func(method, path, scope string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set(echo.HeaderAuthorization, _scopedBearer(t, models.RoleAdmin, scope))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	t.Run("Token required", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, request(http.MethodGet, "/api/clients", ""))
+	})
+
+	t.Run("Users are denied", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, request(http.MethodGet, "/api/clients", models.RoleUser))
+		assert.Equal(t, http.StatusForbidden, request(http.MethodDelete, "/api/clients/775a5b37-1742-4e54-9439-0357e768b011", models.RoleClient))
+	})
+
+	t.Run("Admins are allowed", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, request(http.MethodGet, "/api/clients", models.RoleAdmin))
+		assert.Equal(t, http.StatusOK, request(http.MethodGet, "/api/clients/775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser))
+	})
+
+	t.Run("Read scope cannot write", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, scoped(http.MethodGet, "/api/clients", "clients:read").Code)
+
+		rec := scoped(http.MethodDelete, "/api/clients/775a5b37-1742-4e54-9439-0357e768b011", "clients:read users:write")
+		if assert.Equal(t, http.StatusForbidden, rec.Code) {
+			assert.Contains(t, rec.Body.String(), `"error":"insufficient_scope"`)
+			assert.Equal(t, `Bearer error="insufficient_scope", scope="clients:write"`, rec.Header().Get(echo.HeaderWWWAuthenticate))
+		}
+	})
+
+	t.Run("No scope", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, scoped(http.MethodGet, "/api/clients", "").Code)
+	})
+}
+
+func TestControllers_Client_List(t *testing.T) {
+	ctl := _clientCtl()
+
+	t.Run("All clients", func(t *testing.T) {
+		rec, ctx := helpers.RequestWithBody(http.MethodGet, "/", nil, echo.New())
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
+
+		if assert.NoError(t, ctl.List(ctx)) {
+			assert.Contains(t, rec.Body.String(), "peter@test.com")
+			assert.Contains(t, rec.Body.String(), `"total":2`)
+			assert.Contains(t, rec.Body.String(), `"pageSize":10`)
+		}
+	})
+
+	t.Run("Paging and filtering", func(t *testing.T) {
+		rec, ctx := helpers.RequestWithBody(http.MethodGet, "/?current=2&pageSize=1", nil, echo.New())
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
+
+		if assert.NoError(t, ctl.List(ctx)) {
+			var resp struct {
+				Data  []models.Client `json:"data"`
+				Total int             `json:"total"`
+			}
+
+			if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp)) && assert.Len(t, resp.Data, 1) {
+				assert.Equal(t, "john@snow.com", resp.Data[0].Email)
+				assert.Equal(t, 2, resp.Total)
+			}
+		}
+
+		rec, ctx = helpers.RequestWithBody(http.MethodGet, "/?query=SNOW", nil, echo.New())
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
+
+		if assert.NoError(t, ctl.List(ctx)) {
+			assert.Contains(t, rec.Body.String(), "john@snow.com")
+			assert.NotContains(t, rec.Body.String(), "peter@test.com")
+		}
+	})
+
+	t.Run("No matches", func(t *testing.T) {
+		rec, ctx := helpers.RequestWithBody(http.MethodGet, "/?status=-1", nil, echo.New())
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
+
+		if assert.NoError(t, ctl.List(ctx)) {
+			assert.Contains(t, rec.Body.String(), `"data":[]`)
+		}
+	})
+}
+
+func TestControllers_Client_View(t *testing.T) {
+	ctl := _clientCtl()
+
+	t.Run("Invalid UUID", func(t *testing.T) {
+		_, ctx := helpers.RequestWithBody(http.MethodGet, "/", nil, echo.New())
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
+
+		err := ctl.View(ctx)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "invalid UUID", "error message %s", "formatted")
+		}
+	})
+
+	t.Run("Existing client", func(t *testing.T) {
+		rec, ctx := helpers.RequestWithBody(http.MethodGet, "/", nil, echo.New())
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
+		ctx.SetPath("/clients/:id")
+		ctx.SetParamNames("id")
+		ctx.SetParamValues("775a5b37-1742-4e54-9439-0357e768b011")
+
+		if assert.NoError(t, ctl.View(ctx)) {
+			assert.Contains(t, rec.Body.String(), "peter@test.com")
+		}
+	})
+
+	t.Run("Non existing client", func(t *testing.T) {
+		_, ctx := helpers.RequestWithBody(http.MethodGet, "/", nil, echo.New())
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
+		ctx.SetPath("/clients/:id")
+		ctx.SetParamNames("id")
+		ctx.SetParamValues("5fcc94e5-c6aa-4320-8469-f5021af54b88")
+
+		err := ctl.View(ctx)
+		if assert.Error(t, err) {
+			assert.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+			assert.Contains(t, err.Error(), "client not found", "error message %s", "formatted")
+		}
+	})
+}
+
+func TestControllers_Client_Create(t *testing.T) {
+	ctl := _clientCtl()
+
+	t.Run("New client", func(t *testing.T) {
+		body := models.CreateClient{Name: "Acme", Email: "acme@test.com", Status: models.StatusActive}
+
+		rec, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", body, echo.New())
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
+
+		if assert.NoError(t, ctl.Create(ctx)) {
+			assert.Equal(t, http.StatusCreated, rec.Code)
+			assert.Contains(t, rec.Body.String(), `"ownerId":"775a5b37-1742-4e54-9439-0357e768b011"`)
+		}
+	})
+
+	t.Run("Invalid client", func(t *testing.T) {
+		body := models.CreateClient{Email: "not an email", Status: 42}
+
+		_, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", body, echo.New())
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
+
+		err := ctl.Create(ctx)
+		if assert.Error(t, err) {
+			assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+		}
+	})
+
+	t.Run("Existing client", func(t *testing.T) {
+		body := models.CreateClient{Name: "Peter", Email: "peter@test.com", Status: models.StatusActive}
+
+		_, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", body, echo.New())
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
+
+		err := ctl.Create(ctx)
+		if assert.Error(t, err) {
+			assert.Equal(t, http.StatusConflict, err.(*echo.HTTPError).Code)
+			assert.Contains(t, err.Error(), "client name taken", "error message %s", "formatted")
+		}
+	})
+}
+
+func TestControllers_Client_Update(t *testing.T) {
+	ctl := _clientCtl()
+
+	t.Run("Invalid UUID", func(t *testing.T) {
+		_, ctx := helpers.RequestWithBody(http.MethodPut, "/", nil, echo.New())
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
+
+		err := ctl.Update(ctx)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "invalid UUID", "error message %s", "formatted")
+		}
+	})
+
+	t.Run("Existing client", func(t *testing.T) {
+		body := models.UpdateClient{Name: "Renamed", Email: "peter@test.com", Status: models.StatusDraft}
+
+		rec, ctx := helpers.RequestObjectWithBody(t, http.MethodPut, "/", body, echo.New())
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
+		ctx.SetPath("/clients/:id")
+		ctx.SetParamNames("id")
+		ctx.SetParamValues("775a5b37-1742-4e54-9439-0357e768b011")
+
+		if assert.NoError(t, ctl.Update(ctx)) {
+			assert.Equal(t, http.StatusAccepted, rec.Code)
+			assert.Contains(t, rec.Body.String(), "Renamed")
+		}
+	})
+
+	t.Run("Email taken", func(t *testing.T) {
+		body := models.UpdateClient{Name: "Peter", Email: "john@snow.com", Status: models.StatusActive}
+
+		_, ctx := helpers.RequestObjectWithBody(t, http.MethodPut, "/", body, echo.New())
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
+		ctx.SetPath("/clients/:id")
+		ctx.SetParamNames("id")
+		ctx.SetParamValues("775a5b37-1742-4e54-9439-0357e768b011")
+
+		err := ctl.Update(ctx)
+		if assert.Error(t, err) {
+			assert.Equal(t, http.StatusConflict, err.(*echo.HTTPError).Code)
+		}
+	})
+
+	t.Run("Non existing client", func(t *testing.T) {
+		_, ctx := helpers.RequestWithBody(http.MethodPut, "/", nil, echo.New())
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
+		ctx.SetPath("/clients/:id")
+		ctx.SetParamNames("id")
+		ctx.SetParamValues("5fcc94e5-c6aa-4320-8469-f5021af54b88")
+
+		err := ctl.Update(ctx)
+		if assert.Error(t, err) {
+			assert.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+		}
+	})
+}
+
+func TestControllers_Client_Delete(t *testing.T) {
+	ctl := _clientCtl()
+
+	t.Run("Invalid UUID", func(t *testing.T) {
+		_, ctx := helpers.RequestWithBody(http.MethodDelete, "/", nil, echo.New())
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
+
+		err := ctl.Delete(ctx)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "invalid UUID", "error message %s", "formatted")
+		}
+	})
+
+	t.Run("Existing client", func(t *testing.T) {
+		_, ctx := helpers.RequestWithBody(http.MethodDelete, "/", nil, echo.New())
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
+		ctx.SetPath("/clients/:id")
+		ctx.SetParamNames("id")
+		ctx.SetParamValues("775a5b37-1742-4e54-9439-0357e768b011")
+
+		assert.NoError(t, ctl.Delete(ctx))
+	})
+
+	t.Run("Non existing client", func(t *testing.T) {
+		_, ctx := helpers.RequestWithBody(http.MethodDelete, "/", nil, echo.New())
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
+		ctx.SetPath("/clients/:id")
+		ctx.SetParamNames("id")
+		ctx.SetParamValues("775a5b37-1742-4e54-9439-0357e768b011")
+
+		err := ctl.Delete(ctx)
+		if assert.Error(t, err) {
+			assert.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+		}
+	})
+}
@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/stiks/gobs/lib/services"
+)
+
+// DiscoveryControllerInterface ...
+type DiscoveryControllerInterface interface {
+	Routes(g *echo.Group)
+	OpenIDConfiguration(c echo.Context) error
+}
+
+type discoveryController struct {
+	auth services.AuthService
+}
+
+// NewDiscoveryController returns controller of OpenID Connect discovery
+func NewDiscoveryController(authSrv services.AuthService) DiscoveryControllerInterface {
+	return &discoveryController{
+		auth: authSrv,
+	}
+}
+
+// Routes registers routes, mount on the root group next to the JWKS
+func (ctl *discoveryController) Routes(g *echo.Group) {
+	g.GET("/.well-known/openid-configuration", ctl.OpenIDConfiguration)
+}
+
+// OpenIDConfiguration ...
+func (ctl *discoveryController) OpenIDConfiguration(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "public, max-age=3600")
+	c.Response().Header().Del("Expires")
+	c.Response().Header().Del("Pragma")
+
+	return c.JSON(http.StatusOK, ctl.auth.Discovery())
+}
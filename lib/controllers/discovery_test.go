@@ -0,0 +1,39 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/controllers"
+	"github.com/stiks/gobs/lib/models"
+)
+
+func TestControllers_Discovery_NewDiscoveryController(t *testing.T) {
+	assert.NotNil(t, controllers.NewDiscoveryController(_authSrv))
+}
+
+func TestControllers_Discovery_OpenIDConfiguration(t *testing.T) {
+	e := echo.New()
+	controllers.NewDiscoveryController(_authSrv).Routes(e.Group(""))
+
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if !assert.Equal(t, http.StatusOK, rec.Code) {
+		return
+	}
+
+	var cfg models.OpenIDConfiguration
+	if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &cfg)) {
+		assert.Equal(t, "http://localhost:8080", cfg.Issuer)
+		assert.Empty(t, cfg.AuthorizationEndpoint, "API endpoint needs a Bearer token, browsers can't be sent there")
+		assert.Equal(t, []string{"code"}, cfg.ResponseTypesSupported)
+		assert.Equal(t, []string{"S256"}, cfg.CodeChallengeMethodsSupported)
+	}
+}
@@ -13,7 +13,7 @@ import (
 	"github.com/stiks/gobs/pkg/helpers"
 )
 
-var _statsSrv = services.NewStatsService(mock.NewStatsRepository())
+var _statsSrv = services.NewStatsService(mock.NewStatsRepository(), mock.NewCacheRepository())
 
 func TestControllers_Health_NewHealthController(t *testing.T) {
 	assert.NotNil(t, controllers.NewHealthController(_statsSrv))
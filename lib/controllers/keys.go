@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/stiks/gobs/lib/services"
+)
+
+// KeyControllerInterface ...
+type KeyControllerInterface interface {
+	Routes(g *echo.Group)
+	JWKS(c echo.Context) error
+}
+
+type keyController struct {
+	keys services.KeyService
+}
+
+// NewKeyController returns controller publishing token verification keys
+func NewKeyController(keys services.KeyService) KeyControllerInterface {
+	return &keyController{
+		keys: keys,
+	}
+}
+
+// Routes registers routes, mount on the root group so the set is found at
+// the well-known location
+func (ctl *keyController) Routes(g *echo.Group) {
+	g.GET("/.well-known/jwks.json", ctl.JWKS)
+}
+
+// JWKS ...
+func (ctl *keyController) JWKS(c echo.Context) error {
+	// verifiers may cache the set, unknown kid makes them fetch it again
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	c.Response().Header().Del("Expires")
+	c.Response().Header().Del("Pragma")
+
+	return c.JSON(http.StatusOK, ctl.keys.JWKS())
+}
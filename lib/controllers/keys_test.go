@@ -0,0 +1,128 @@
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/controllers"
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/providers/mock"
+	"github.com/stiks/gobs/lib/services"
+	"github.com/stiks/gobs/pkg/auth"
+	"github.com/stiks/gobs/pkg/helpers"
+)
+
+// _mustKeys panics on invalid config of test service
+func _mustKeys(srv services.KeyService, err error) services.KeyService {
+	if err != nil {
+		panic(err)
+	}
+
+	return srv
+}
+
+func _keySrv(t *testing.T) services.KeyService {
+	srv := _mustKeys(services.NewKeyService(mock.NewKeyRepository(), services.KeyConfig{
+		Algorithm:       models.AlgorithmEdDSA,
+		RotationPeriod:  time.Hour,
+		RetentionPeriod: time.Hour,
+		ReloadInterval:  time.Minute,
+		LegacyUntil:     time.Now().Add(time.Hour),
+	}, []byte(_authCfg.SecretKey)))
+
+	if err := srv.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return srv
+}
+
+func TestControllers_Keys_JWKS(t *testing.T) {
+	keys := _keySrv(t)
+
+	e := echo.New()
+	e.Use(helpers.DefaultHeadersMiddleware())
+	controllers.NewKeyController(keys).Routes(e.Group(""))
+
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if !assert.Equal(t, http.StatusOK, rec.Code) {
+		return
+	}
+
+	assert.Equal(t, "public, max-age=300", rec.Header().Get("Cache-Control"))
+	assert.Empty(t, rec.Header().Get("Pragma"))
+
+	var set models.JWKS
+	if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &set)) && assert.Len(t, set.Keys, 1) {
+		assert.Equal(t, "OKP", set.Keys[0].Kty)
+		assert.Equal(t, keys.JWKS().Keys[0].Kid, set.Keys[0].Kid)
+	}
+}
+
+func TestControllers_Keys_VerifyByKid(t *testing.T) {
+	keys := _keySrv(t)
+
+	auth.Configure(auth.Config{SecretKey: []byte(_authCfg.SecretKey), Keyfunc: keys.Keyfunc})
+	defer auth.Configure(auth.Config{SecretKey: []byte(_authCfg.SecretKey)})
+
+	e := echo.New()
+	e.GET("/api/me", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}, auth.EnableAuthorisation(), auth.RequiredAuth())
+
+	request := func(bearer string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+		req.Header.Set(echo.HeaderAuthorization, bearer)
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		return rec.Code
+	}
+
+	issue := func(keys models.TokenKeys) string {
+		cfg := _authCfg
+		cfg.Keys = keys
+
+		token, err := _mustAuth(services.NewAuthService(mock.NewAuthRepository(), cfg)).PasswordGrant(context.Background(), &models.AuthRequest{
+			GrantType: "password",
+			Username:  "peter@test.com",
+			Password:  "testpass",
+		}, &models.AuthClient{ClientID: "SecRetAuthKey"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return "Bearer " + token.AccessToken
+	}
+
+	t.Run("Signed by active key", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, request(issue(keys)))
+	})
+
+	t.Run("Signed by retired key", func(t *testing.T) {
+		bearer := issue(keys)
+
+		if assert.NoError(t, keys.Rotate(context.Background())) {
+			assert.Equal(t, http.StatusNoContent, request(bearer))
+		}
+	})
+
+	t.Run("Legacy HS256 token", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, request(_bearer(t, models.RoleUser)))
+	})
+
+	t.Run("Unknown key", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, request(issue(_keySrv(t))))
+	})
+}
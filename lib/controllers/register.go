@@ -2,38 +2,50 @@ package controllers
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/labstack/echo/v4"
-	"github.com/labstack/gommon/random"
 
 	"github.com/stiks/gobs/lib/models"
 	"github.com/stiks/gobs/lib/services"
 	"github.com/stiks/gobs/pkg/xlog"
 )
 
+// RegisterConfig of self-service registration
+type RegisterConfig struct {
+	// CodeLifetime is how long email confirmation code can be used
+	CodeLifetime time.Duration `env:"REGISTER_CODE_LIFETIME" default:"24h"`
+	// ResendCooldown is minimal time between two confirmation emails
+	ResendCooldown time.Duration `env:"REGISTER_RESEND_COOLDOWN" default:"1m"`
+}
+
 // RegisterControllerInterface ...
 type RegisterControllerInterface interface {
 	User(c echo.Context) error
+	Resend(c echo.Context) error
 	Routes(g *echo.Group)
 }
 
 type registerController struct {
 	user services.UserService
+	cfg  RegisterConfig
 }
 
 // NewRegisterController returns a new Service instance
-func NewRegisterController(userSrv services.UserService) RegisterControllerInterface {
+func NewRegisterController(userSrv services.UserService, cfg RegisterConfig) RegisterControllerInterface {
 	return &registerController{
 		user: userSrv,
+		cfg:  cfg,
 	}
 }
 
 // Routes registers routes
 func (ctl *registerController) Routes(g *echo.Group) {
 	g.POST("/register", ctl.User)
+	g.POST("/register/resend", ctl.Resend)
 }
 
-// ResetRequest ...
+// User registers new user and sends email confirmation code
 func (ctl *registerController) User(c echo.Context) error {
 	ctx := c.Request().Context()
 
@@ -54,17 +66,24 @@ func (ctl *registerController) User(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	// Checking if users already exist
+	// For security reasons, response does not reveal whether email is registered
 	if _, err := ctl.user.GetByUsername(ctx, req.Email); err == nil {
 		xlog.Infof(ctx, "User already exist")
 
-		return echo.NewHTTPError(http.StatusConflict, models.ErrUsernameTaken.Error())
+		return c.JSON(http.StatusCreated, echo.Map{"status": "ok"})
 	}
 
-	user := req.ToUser(nil)
-	user.ValidationHash = random.String(32, random.Alphanumeric)
+	// account is activated once email is confirmed
+	req.Active = false
+
+	_, err := ctl.user.Register(ctx, req.Password, req.ToUser(nil), ctl.cfg.CodeLifetime)
+	if err == models.ErrUsernameTaken {
+		xlog.Infof(ctx, "User already exist")
+
+		return c.JSON(http.StatusCreated, echo.Map{"status": "ok"})
+	}
 
-	if _, err := ctl.user.Create(ctx, req.Password, user); err != nil {
+	if err != nil {
 		xlog.Errorf(ctx, "Unable to create user, err: %s", err.Error())
 
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
@@ -72,3 +91,45 @@ func (ctl *registerController) User(c echo.Context) error {
 
 	return c.JSON(http.StatusCreated, echo.Map{"status": "ok"})
 }
+
+// Resend sends a new email confirmation code, at most once per cooldown
+func (ctl *registerController) Resend(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	req := new(models.ResendConfirmation)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := req.Validate(); err != nil {
+		xlog.Errorf(ctx, "Unable to validate query, err: %s", err.Error())
+
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// For security reasons, response does not reveal whether email is
+	// registered, nor whether a code was sent within the cooldown
+	user, err := ctl.user.GetByUsername(ctx, req.Email)
+	if err != nil || user.IsActive {
+		return c.JSON(http.StatusOK, echo.Map{"status": "ok"})
+	}
+
+	if time.Since(user.ValidationSentAt) < ctl.cfg.ResendCooldown {
+		xlog.Infof(ctx, "Confirmation of user %s was sent recently", user.ID)
+
+		return c.JSON(http.StatusOK, echo.Map{"status": "ok"})
+	}
+
+	_, err = ctl.user.ResendConfirmation(ctx, user, ctl.cfg.CodeLifetime)
+	if err == models.ErrEmailAlreadyConfirmed {
+		return c.JSON(http.StatusOK, echo.Map{"status": "ok"})
+	}
+
+	if err != nil {
+		xlog.Errorf(ctx, "Unable to resend confirmation, err: %s", err.Error())
+
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"status": "ok"})
+}
@@ -1,8 +1,12 @@
 package controllers_test
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -10,25 +14,78 @@ import (
 
 	"github.com/stiks/gobs/lib/controllers"
 	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/providers/mock"
+	"github.com/stiks/gobs/lib/services"
 	"github.com/stiks/gobs/pkg/helpers"
 )
 
+var _registerCfg = controllers.RegisterConfig{CodeLifetime: 24 * time.Hour, ResendCooldown: time.Minute}
+
+// _recordingQueue keeps confirmation requests published to user-confirm-email
+type _recordingQueue struct {
+	confirmations []models.WorkerRequest
+}
+
+func (q *_recordingQueue) Add(ctx context.Context, queue string, data []byte) error {
+	return nil
+}
+
+func (q *_recordingQueue) AddObject(ctx context.Context, queue string, data interface{}) error {
+	if queue != "user-confirm-email" {
+		return nil
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	req := models.WorkerRequest{}
+	if err := json.Unmarshal(b, &req); err != nil {
+		return err
+	}
+
+	q.confirmations = append(q.confirmations, req)
+
+	return nil
+}
+
+func (q *_recordingQueue) AddToURL(ctx context.Context, queue string, data url.Values) error {
+	return nil
+}
+
+// _registration returns controller backed by its own users and queue
+func _registration(cfg controllers.RegisterConfig) (controllers.RegisterControllerInterface, services.UserService, *_recordingQueue) {
+	queue := new(_recordingQueue)
+	userSrv := services.NewUserService(mock.NewUserRepository(), services.NewQueueService(queue), services.NewCacheService(mock.NewCacheRepository(), services.CacheConfig{}))
+
+	return controllers.NewRegisterController(userSrv, cfg), userSrv, queue
+}
+
 func TestControllers_Register_NewRegisterController(t *testing.T) {
-	assert.NotNil(t, controllers.NewRegisterController(_userSrv))
+	assert.NotNil(t, controllers.NewRegisterController(_userSrv, _registerCfg))
 }
 
 func TestControllers_Register_Routes(t *testing.T) {
 	t.Run("User registration", func(t *testing.T) {
 		e := echo.New()
-		controllers.NewRegisterController(_userSrv).Routes(e.Group("api"))
+		controllers.NewRegisterController(_userSrv, _registerCfg).Routes(e.Group("api"))
 
 		c, _ := helpers.RequestTest(http.MethodPost, "/api/register", e)
 		assert.Equal(t, 400, c)
 	})
+
+	t.Run("Resend confirmation", func(t *testing.T) {
+		e := echo.New()
+		controllers.NewRegisterController(_userSrv, _registerCfg).Routes(e.Group("api"))
+
+		c, _ := helpers.RequestTest(http.MethodPost, "/api/register/resend", e)
+		assert.Equal(t, 400, c)
+	})
 }
 
 func TestControllers_Register_Register(t *testing.T) {
-	ctl := controllers.NewRegisterController(_userSrv)
+	ctl := controllers.NewRegisterController(_userSrv, _registerCfg)
 
 	t.Run("Non-existing user", func(t *testing.T) {
 		user := models.CreateUser{
@@ -48,6 +105,8 @@ func TestControllers_Register_Register(t *testing.T) {
 	})
 
 	t.Run("Existing user", func(t *testing.T) {
+		ctl, userSrv, queue := _registration(_registerCfg)
+
 		user := models.CreateUser{
 			ID:        uuid.New(),
 			Email:     "user@test.com",
@@ -59,11 +118,126 @@ func TestControllers_Register_Register(t *testing.T) {
 			Active:    true,
 		}
 
-		_, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", user, echo.New())
+		rec, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", user, echo.New())
 
-		err := ctl.User(ctx)
-		if assert.Error(t, err) {
-			assert.Contains(t, err.Error(), "username taken", "error message %s", "formatted")
+		if assert.NoError(t, ctl.User(ctx)) {
+			assert.Equal(t, http.StatusCreated, rec.Code, "same as new email")
+		}
+
+		assert.Empty(t, queue.confirmations)
+
+		existing, err := userSrv.GetByUsername(context.Background(), "user@test.com")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "SomeHash123", existing.ValidationHash, "user is left alone")
+		}
+	})
+}
+
+func TestControllers_Register_Confirmation(t *testing.T) {
+	ctl, userSrv, queue := _registration(_registerCfg)
+
+	body := models.CreateUser{FirstName: "Arya", LastName: "Stark", Email: "arya@stark.com", Password: "Test123456"}
+
+	rec, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", body, echo.New())
+	if !assert.NoError(t, ctl.User(ctx)) {
+		return
+	}
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	user, err := userSrv.GetByUsername(context.Background(), "arya@stark.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.False(t, user.IsActive)
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), user.ValidationExpiresAt, time.Minute)
+
+	if assert.Len(t, queue.confirmations, 1, "confirmation is published") {
+		assert.Equal(t, user.ID, queue.confirmations[0].ID)
+		assert.Equal(t, user.ValidationHash, queue.confirmations[0].Code)
+	}
+
+	t.Run("Resend within cooldown", func(t *testing.T) {
+		rec, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", models.ResendConfirmation{Email: "arya@stark.com"}, echo.New())
+
+		if assert.NoError(t, ctl.Resend(ctx)) {
+			assert.Equal(t, http.StatusOK, rec.Code, "same as unknown email")
+			assert.Empty(t, rec.Header().Get("Retry-After"))
+		}
+
+		assert.Len(t, queue.confirmations, 1)
+	})
+
+	t.Run("Unknown email", func(t *testing.T) {
+		rec, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", models.ResendConfirmation{Email: "nobody@stark.com"}, echo.New())
+
+		if assert.NoError(t, ctl.Resend(ctx)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
 		}
+
+		assert.Len(t, queue.confirmations, 1)
 	})
+
+	t.Run("Resend after cooldown", func(t *testing.T) {
+		ctl := controllers.NewRegisterController(userSrv, controllers.RegisterConfig{CodeLifetime: time.Hour})
+
+		rec, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", models.ResendConfirmation{Email: "arya@stark.com"}, echo.New())
+		if assert.NoError(t, ctl.Resend(ctx)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+		}
+
+		if assert.Len(t, queue.confirmations, 2) {
+			assert.NotEqual(t, queue.confirmations[0].Code, queue.confirmations[1].Code, "code is replaced")
+		}
+
+		user, err := userSrv.GetByUsername(context.Background(), "arya@stark.com")
+		if assert.NoError(t, err) {
+			assert.Equal(t, queue.confirmations[1].Code, user.ValidationHash)
+			assert.WithinDuration(t, time.Now().Add(time.Hour), user.ValidationExpiresAt, time.Minute)
+		}
+	})
+
+	t.Run("Confirmed user", func(t *testing.T) {
+		ctl := controllers.NewRegisterController(userSrv, controllers.RegisterConfig{CodeLifetime: time.Hour})
+
+		user, _ := userSrv.GetByUsername(context.Background(), "arya@stark.com")
+		confirm := models.ConfirmEmail{UserID: user.ID, Code: user.ValidationHash}
+
+		_, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", confirm, echo.New())
+		if !assert.NoError(t, controllers.NewAccountController(userSrv, _mfaSrv).EmailConfirm(ctx)) {
+			return
+		}
+
+		_, ctx = helpers.RequestObjectWithBody(t, http.MethodPost, "/", models.ResendConfirmation{Email: "arya@stark.com"}, echo.New())
+		assert.NoError(t, ctl.Resend(ctx))
+		assert.Len(t, queue.confirmations, 2, "nothing to resend")
+	})
+}
+
+func TestControllers_Register_ExpiredCode(t *testing.T) {
+	ctl, userSrv, _ := _registration(_registerCfg)
+
+	body := models.CreateUser{FirstName: "Bran", LastName: "Stark", Email: "bran@stark.com", Password: "Test123456"}
+
+	_, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", body, echo.New())
+	if !assert.NoError(t, ctl.User(ctx)) {
+		return
+	}
+
+	user, _ := userSrv.GetByUsername(context.Background(), "bran@stark.com")
+
+	user, err := userSrv.ResendConfirmation(context.Background(), user, -time.Second)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	confirm := models.ConfirmEmail{UserID: user.ID, Code: user.ValidationHash}
+
+	_, ctx = helpers.RequestObjectWithBody(t, http.MethodPost, "/", confirm, echo.New())
+
+	err = controllers.NewAccountController(userSrv, _mfaSrv).EmailConfirm(ctx)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "email confirmation code already used or expired")
+	}
 }
@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/services"
+	"github.com/stiks/gobs/pkg/auth"
+	"github.com/stiks/gobs/pkg/xlog"
+)
+
+// RoleControllerInterface ...
+type RoleControllerInterface interface {
+	List(c echo.Context) error
+	View(c echo.Context) error
+	Update(c echo.Context) error
+	RequireMFA(c echo.Context) error
+	Routes(g *echo.Group)
+}
+
+type roleController struct {
+	policy services.PolicyService
+}
+
+// NewRoleController returns controller managing permissions of roles
+func NewRoleController(policy services.PolicyService) RoleControllerInterface {
+	return &roleController{
+		policy: policy,
+	}
+}
+
+// Routes registers route handlers for the role service
+func (ctl *roleController) Routes(g *echo.Group) {
+	manage := auth.RequirePermission(ctl.policy, models.PermRolesManage)
+
+	g.GET("/roles", ctl.List, auth.EnableAuthorisation(), auth.RequiredAuth(), manage)
+	g.GET("/roles/:name", ctl.View, auth.EnableAuthorisation(), auth.RequiredAuth(), manage)
+	g.PUT("/roles/:name", ctl.Update, auth.EnableAuthorisation(), auth.RequiredAuth(), manage)
+	g.PUT("/roles/:name/mfa", ctl.RequireMFA, auth.EnableAuthorisation(), auth.RequiredAuth(), manage)
+}
+
+// getActor returns signed in user permissions are checked for
+func getActor(c echo.Context) (*models.Actor, error) {
+	id, err := auth.GetUserID(c)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return &models.Actor{ID: id, Role: auth.GetRole(c)}, nil
+}
+
+// policyError maps policy service errors to HTTP errors
+func policyError(err error) error {
+	switch err {
+	case nil:
+		return nil
+	case models.ErrPermissionDenied, models.ErrRoleNotEditable:
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	case models.ErrRoleNotFound:
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+}
+
+// List ...
+func (ctl *roleController) List(c echo.Context) error {
+	roles, err := ctl.policy.Roles(c.Request().Context())
+	if err != nil {
+		return policyError(err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"data": roles})
+}
+
+// View ...
+func (ctl *roleController) View(c echo.Context) error {
+	role, err := ctl.policy.Role(c.Request().Context(), c.Param("name"))
+	if err != nil {
+		return policyError(err)
+	}
+
+	return c.JSON(http.StatusOK, role)
+}
+
+// Update ...
+func (ctl *roleController) Update(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	role, err := ctl.policy.Role(ctx, c.Param("name"))
+	if err != nil {
+		return policyError(err)
+	}
+
+	req := new(models.UpdateRole)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	role.Permissions = req.Permissions
+
+	// super user role is rejected before permissions are validated
+	if role.Name == models.RoleSuperUser {
+		return policyError(models.ErrRoleNotEditable)
+	}
+
+	if err := role.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	role, err = ctl.policy.UpdateRole(ctx, role)
+	if err != nil {
+		xlog.Errorf(ctx, "Unable to update role, err: %s", err.Error())
+
+		return policyError(err)
+	}
+
+	return c.JSON(http.StatusAccepted, role)
+}
+
+// RequireMFA enforces MFA for users of the role, only super user decides it
+func (ctl *roleController) RequireMFA(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if auth.GetRole(c) != models.RoleSuperUser {
+		return policyError(models.ErrPermissionDenied)
+	}
+
+	req := new(models.RoleMFA)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	role, err := ctl.policy.RequireMFA(ctx, c.Param("name"), req.Required)
+	if err != nil {
+		xlog.Errorf(ctx, "Unable to change MFA requirement of role, err: %s", err.Error())
+
+		return policyError(err)
+	}
+
+	return c.JSON(http.StatusAccepted, role)
+}
@@ -0,0 +1,148 @@
+package controllers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/controllers"
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/providers/mock"
+	"github.com/stiks/gobs/lib/services"
+	"github.com/stiks/gobs/pkg/helpers"
+)
+
+var _policySrv = services.NewPolicyService(mock.NewRoleRepository(), _cacheSrv)
+
+// _actor signs in user with role the way EnableAuthorisation does
+func _actor(c echo.Context, id string, role string) {
+	c.Set("USER_ID", id)
+	c.Set("ROLE", role)
+}
+
+func TestControllers_Role_NewRoleController(t *testing.T) {
+	assert.NotNil(t, controllers.NewRoleController(_policySrv))
+}
+
+func TestControllers_Role_Routes(t *testing.T) {
+	e := echo.New()
+	controllers.NewRoleController(services.NewPolicyService(mock.NewRoleRepository(), _cacheSrv)).Routes(e.Group("api"))
+
+	request := func(method, path, role string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if role != "" {
+			req.Header.Set(echo.HeaderAuthorization, _bearer(t, role))
+		}
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	t.Run("Token required", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, request(http.MethodGet, "/api/roles", "", "").Code)
+	})
+
+	t.Run("Admins are denied", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, request(http.MethodGet, "/api/roles", models.RoleAdmin, "").Code)
+	})
+
+	t.Run("List roles", func(t *testing.T) {
+		rec := request(http.MethodGet, "/api/roles", models.RoleSuperUser, "")
+		if !assert.Equal(t, http.StatusOK, rec.Code) {
+			return
+		}
+
+		var resp struct {
+			Data []models.Role `json:"data"`
+		}
+
+		if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp)) {
+			assert.Len(t, resp.Data, len(models.DefaultRoles()))
+		}
+	})
+
+	t.Run("Unknown role", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, request(http.MethodGet, "/api/roles/guest", models.RoleSuperUser, "").Code)
+	})
+
+	t.Run("Update role", func(t *testing.T) {
+		rec := request(http.MethodPut, "/api/roles/manager", models.RoleSuperUser, `{"permissions":["users.view:own"]}`)
+		if !assert.Equal(t, http.StatusAccepted, rec.Code) {
+			return
+		}
+
+		rec = request(http.MethodGet, "/api/roles/manager", models.RoleSuperUser, "")
+		if assert.Equal(t, http.StatusOK, rec.Code) {
+			assert.Contains(t, rec.Body.String(), `"permissions":["users.view:own"]`)
+		}
+	})
+
+	t.Run("Unknown permission", func(t *testing.T) {
+		rec := request(http.MethodPut, "/api/roles/manager", models.RoleSuperUser, `{"permissions":["users.fly"]}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("Super user role is fixed", func(t *testing.T) {
+		rec := request(http.MethodPut, "/api/roles/super", models.RoleSuperUser, `{"permissions":[]}`)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("Enforce MFA", func(t *testing.T) {
+		rec := request(http.MethodPut, "/api/roles/super/mfa", models.RoleSuperUser, `{"required":true}`)
+		if !assert.Equal(t, http.StatusAccepted, rec.Code) {
+			return
+		}
+
+		role := new(models.Role)
+		rec = request(http.MethodGet, "/api/roles/super", models.RoleSuperUser, "")
+		if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), role)) {
+			assert.True(t, role.MFARequired)
+			assert.Len(t, role.Permissions, len(models.Permissions))
+		}
+	})
+
+	t.Run("Permissions keep MFA requirement", func(t *testing.T) {
+		request(http.MethodPut, "/api/roles/manager/mfa", models.RoleSuperUser, `{"required":true}`)
+
+		rec := request(http.MethodPut, "/api/roles/manager", models.RoleSuperUser, `{"permissions":[]}`)
+		if assert.Equal(t, http.StatusAccepted, rec.Code) {
+			assert.Contains(t, rec.Body.String(), `"mfaRequired":true`)
+		}
+	})
+}
+
+func TestControllers_Role_RequireMFA(t *testing.T) {
+	ctl := controllers.NewRoleController(services.NewPolicyService(mock.NewRoleRepository(), _cacheSrv))
+
+	t.Run("Only super users", func(t *testing.T) {
+		_, ctx := helpers.RequestObjectWithBody(t, http.MethodPut, "/", models.RoleMFA{Required: true}, echo.New())
+		_actor(ctx, "3ab1ba2a-6031-4e34-aae3-dcd43a987775", models.RoleAdmin)
+		ctx.SetParamNames("name")
+		ctx.SetParamValues(models.RoleUser)
+
+		err := ctl.RequireMFA(ctx)
+		if assert.Error(t, err) {
+			assert.Equal(t, http.StatusForbidden, err.(*echo.HTTPError).Code)
+		}
+	})
+
+	t.Run("Unknown role", func(t *testing.T) {
+		_, ctx := helpers.RequestObjectWithBody(t, http.MethodPut, "/", models.RoleMFA{Required: true}, echo.New())
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
+		ctx.SetParamNames("name")
+		ctx.SetParamValues("guest")
+
+		err := ctl.RequireMFA(ctx)
+		if assert.Error(t, err) {
+			assert.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/google/uuid"
@@ -13,7 +14,9 @@ import (
 )
 
 type userController struct {
-	user services.UserService
+	user    services.UserService
+	policy  services.PolicyService
+	lockout services.LockoutService
 }
 
 // UserControllerInterface ...
@@ -23,13 +26,16 @@ type UserControllerInterface interface {
 	Create(c echo.Context) error
 	Update(c echo.Context) error
 	Delete(c echo.Context) error
+	Unlock(c echo.Context) error
 	Routes(g *echo.Group)
 }
 
 // NewUserController ...
-func NewUserController(service services.UserService) UserControllerInterface {
+func NewUserController(service services.UserService, policy services.PolicyService, lockout services.LockoutService) UserControllerInterface {
 	return &userController{
-		user: service,
+		user:    service,
+		policy:  policy,
+		lockout: lockout,
 	}
 }
 
@@ -37,11 +43,24 @@ func NewUserController(service services.UserService) UserControllerInterface {
 func (ctl *userController) Routes(g *echo.Group) {
 	g.Use(auth.EnableAuthorisation())
 
-	g.GET("/users", ctl.List, auth.RequiredAuth(), auth.SuperOrAdminOnly())
-	g.GET("/users/:id", ctl.View, auth.RequiredAuth(), auth.SuperOrAdminOnly())
-	g.POST("/users", ctl.Create, auth.RequiredAuth(), auth.SuperOrAdminOnly())
-	g.PUT("/users/:id", ctl.Update, auth.RequiredAuth(), auth.SuperOrAdminOnly())
-	g.DELETE("/users/:id", ctl.Delete, auth.RequiredAuth(), auth.SuperOrAdminOnly())
+	read, write := auth.RequireScopes(models.ScopeUsersRead), auth.RequireScopes(models.ScopeUsersWrite)
+
+	g.GET("/users", ctl.List, auth.RequiredAuth(), auth.RequirePermission(ctl.policy, models.PermUsersView), read)
+	g.GET("/users/:id", ctl.View, auth.RequiredAuth(), auth.RequirePermission(ctl.policy, models.PermUsersView), read)
+	g.POST("/users", ctl.Create, auth.RequiredAuth(), auth.RequirePermission(ctl.policy, models.PermUsersCreate), write)
+	g.PUT("/users/:id", ctl.Update, auth.RequiredAuth(), auth.RequirePermission(ctl.policy, models.PermUsersUpdate), write)
+	g.DELETE("/users/:id", ctl.Delete, auth.RequiredAuth(), auth.RequirePermission(ctl.policy, models.PermUsersDelete), write)
+	g.POST("/users/:id/unlock", ctl.Unlock, auth.RequiredAuth(), auth.RequirePermission(ctl.policy, models.PermUsersUpdate), write)
+}
+
+// authorize checks actor may use permission on user
+func (ctl *userController) authorize(c echo.Context, permission string, user *models.User) error {
+	actor, err := getActor(c)
+	if err != nil {
+		return err
+	}
+
+	return policyError(ctl.policy.Authorize(c.Request().Context(), actor, permission, user.OwnerID))
 }
 
 // List ...
@@ -58,6 +77,21 @@ func (ctl *userController) List(c echo.Context) error {
 		params.PerPage = 3
 	}
 
+	actor, err := getActor(c)
+	if err != nil {
+		return err
+	}
+
+	access, err := ctl.policy.Access(ctx, actor, models.PermUsersView)
+	if err != nil {
+		return policyError(err)
+	}
+
+	// users with own access only see users they own
+	if access != models.AccessAll {
+		params.OwnerID = &actor.ID
+	}
+
 	users, err := ctl.user.GetAll(ctx, params)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
@@ -95,6 +129,10 @@ func (ctl *userController) View(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusNotFound, err.Error())
 	}
 
+	if err := ctl.authorize(c, models.PermUsersView, user); err != nil {
+		return err
+	}
+
 	return c.JSON(http.StatusOK, user)
 }
 
@@ -111,9 +149,13 @@ func (ctl *userController) Create(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	id, err := auth.GetUserID(c)
+	actor, err := getActor(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		return err
+	}
+
+	if err := ctl.policy.AuthorizeRole(ctx, actor, u.Role); err != nil {
+		return policyError(err)
 	}
 
 	// Checking if users already exist
@@ -121,7 +163,12 @@ func (ctl *userController) Create(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusConflict, models.ErrUsernameTaken.Error())
 	}
 
-	user, err := ctl.user.Create(ctx, u.Password, u.ToUser(&id))
+	// emails are unique across tenants, the check above sees own tenant only
+	user, err := ctl.user.Create(ctx, u.Password, u.ToUser(&actor.ID))
+	if errors.Is(err, models.ErrUsernameTaken) {
+		return echo.NewHTTPError(http.StatusConflict, models.ErrUsernameTaken.Error())
+	}
+
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
@@ -143,6 +190,10 @@ func (ctl *userController) Update(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusNotFound, models.ErrUserNotFound.Error())
 	}
 
+	if err := ctl.authorize(c, models.PermUsersUpdate, user); err != nil {
+		return err
+	}
+
 	u := new(models.UpdateUser)
 	if err := c.Bind(u); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
@@ -154,6 +205,20 @@ func (ctl *userController) Update(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
+	// changing role needs authority over both the current and the new role
+	if u.Role != user.Role {
+		actor, err := getActor(c)
+		if err != nil {
+			return err
+		}
+
+		for _, role := range []string{user.Role, u.Role} {
+			if err := ctl.policy.AuthorizeRole(ctx, actor, role); err != nil {
+				return policyError(err)
+			}
+		}
+	}
+
 	// Populate changes
 	user.FromUpdate(u)
 
@@ -180,6 +245,15 @@ func (ctl *userController) Delete(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, models.ErrUnableDeleteOwnAccount.Error())
 	}
 
+	user, err := ctl.user.GetByID(ctx, id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	if err := ctl.authorize(c, models.PermUsersDelete, user); err != nil {
+		return err
+	}
+
 	err = ctl.user.Delete(ctx, id)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusNotFound, err.Error())
@@ -187,3 +261,31 @@ func (ctl *userController) Delete(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, echo.Map{"status": "ok"})
 }
+
+// Unlock lifts lockout of failed logins and lock of the account
+func (ctl *userController) Unlock(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	user, err := ctl.user.GetByID(ctx, id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, models.ErrUserNotFound.Error())
+	}
+
+	if err := ctl.authorize(c, models.PermUsersUpdate, user); err != nil {
+		return err
+	}
+
+	user, err = ctl.lockout.Unlock(ctx, user.ID)
+	if err != nil {
+		xlog.Errorf(ctx, "Unable to unlock user, err: %s", err.Error())
+
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, user)
+}
@@ -1,8 +1,11 @@
 package controllers_test
 
 import (
+	"context"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -12,23 +15,27 @@ import (
 	"github.com/stiks/gobs/lib/models"
 	"github.com/stiks/gobs/lib/providers/mock"
 	"github.com/stiks/gobs/lib/services"
+	"github.com/stiks/gobs/pkg/auth"
 	"github.com/stiks/gobs/pkg/helpers"
+	"github.com/stiks/gobs/pkg/tenant"
 )
 
 var (
-	_cacheSrv = services.NewCacheService(mock.NewCacheRepository())
+	_cacheSrv = services.NewCacheService(mock.NewCacheRepository(), services.CacheConfig{})
 	_queueSrv = services.NewQueueService(mock.NewQueueRepository())
 	_userSrv  = services.NewUserService(mock.NewUserRepository(), _queueSrv, _cacheSrv)
+
+	_lockoutSrv = services.NewLockoutService(mock.NewAuthRepository(), mock.NewUserRepository(), _queueSrv, _cacheSrv, services.LockoutConfig{MaxAttempts: 5, MaxIPAttempts: 20, Duration: 15 * time.Minute, Backoff: time.Second, Window: time.Hour})
 )
 
 func TestControllers_User_NewUserController(t *testing.T) {
-	assert.NotNil(t, controllers.NewUserController(_userSrv))
+	assert.NotNil(t, controllers.NewUserController(_userSrv, _policySrv, _lockoutSrv))
 }
 
 func TestControllers_User_Routes(t *testing.T) {
 	t.Run("Get users", func(t *testing.T) {
 		e := echo.New()
-		controllers.NewUserController(_userSrv).Routes(e.Group("api"))
+		controllers.NewUserController(_userSrv, _policySrv, _lockoutSrv).Routes(e.Group("api"))
 
 		c, _ := helpers.RequestTest(http.MethodGet, "/api/users", e)
 		assert.Equal(t, 400, c)
@@ -36,7 +43,7 @@ func TestControllers_User_Routes(t *testing.T) {
 
 	t.Run("View user", func(t *testing.T) {
 		e := echo.New()
-		controllers.NewUserController(_userSrv).Routes(e.Group("api"))
+		controllers.NewUserController(_userSrv, _policySrv, _lockoutSrv).Routes(e.Group("api"))
 
 		c, _ := helpers.RequestTest(http.MethodGet, "/api/users/123123", e)
 		assert.Equal(t, 400, c)
@@ -44,7 +51,7 @@ func TestControllers_User_Routes(t *testing.T) {
 
 	t.Run("Create user", func(t *testing.T) {
 		e := echo.New()
-		controllers.NewUserController(_userSrv).Routes(e.Group("api"))
+		controllers.NewUserController(_userSrv, _policySrv, _lockoutSrv).Routes(e.Group("api"))
 
 		c, _ := helpers.RequestTest(http.MethodPost, "/api/users", e)
 		assert.Equal(t, 400, c)
@@ -52,7 +59,7 @@ func TestControllers_User_Routes(t *testing.T) {
 
 	t.Run("Update user", func(t *testing.T) {
 		e := echo.New()
-		controllers.NewUserController(_userSrv).Routes(e.Group("api"))
+		controllers.NewUserController(_userSrv, _policySrv, _lockoutSrv).Routes(e.Group("api"))
 
 		c, _ := helpers.RequestTest(http.MethodPost, "/api/users", e)
 		assert.Equal(t, 400, c)
@@ -60,19 +67,34 @@ func TestControllers_User_Routes(t *testing.T) {
 
 	t.Run("Delete user", func(t *testing.T) {
 		e := echo.New()
-		controllers.NewUserController(_userSrv).Routes(e.Group("api"))
+		controllers.NewUserController(_userSrv, _policySrv, _lockoutSrv).Routes(e.Group("api"))
 
 		c, _ := helpers.RequestTest(http.MethodDelete, "/api/users/123", e)
 		assert.Equal(t, 400, c)
 	})
+
+	t.Run("Read scope cannot delete users", func(t *testing.T) {
+		e := echo.New()
+		controllers.NewUserController(_userSrv, _policySrv, _lockoutSrv).Routes(e.Group("api"))
+
+		req := httptest.NewRequest(http.MethodDelete, "/api/users/5fcc94e5-c6aa-4320-8469-f5021af54b88", nil)
+		req.Header.Set(echo.HeaderAuthorization, _scopedBearer(t, models.RoleAdmin, "users:read"))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		if assert.Equal(t, http.StatusForbidden, rec.Code) {
+			assert.Contains(t, rec.Body.String(), `"scope":"users:write"`)
+		}
+	})
 }
 
 func TestControllers_User_List(t *testing.T) {
-	ctl := controllers.NewUserController(_userSrv)
+	ctl := controllers.NewUserController(_userSrv, _policySrv, _lockoutSrv)
 
 	t.Run("All users", func(t *testing.T) {
 		rec, ctx := helpers.RequestWithBody(http.MethodGet, "/", nil, echo.New())
-		ctx.Set("USER_ID", "775a5b37-1742-4e54-9439-0357e768b011")
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
 
 		err := ctl.List(ctx)
 		if assert.NoError(t, err) {
@@ -82,11 +104,11 @@ func TestControllers_User_List(t *testing.T) {
 }
 
 func TestControllers_User_View(t *testing.T) {
-	ctl := controllers.NewUserController(_userSrv)
+	ctl := controllers.NewUserController(_userSrv, _policySrv, _lockoutSrv)
 
 	t.Run("Invalid UUID", func(t *testing.T) {
 		_, ctx := helpers.RequestWithBody(http.MethodGet, "/", nil, echo.New())
-		ctx.Set("USER_ID", "775a5b37-1742-4e54-9439-0357e768b011")
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
 
 		err := ctl.View(ctx)
 		if assert.Error(t, err) {
@@ -96,9 +118,9 @@ func TestControllers_User_View(t *testing.T) {
 
 	t.Run("Existing user", func(t *testing.T) {
 		e := echo.New()
-		e.SetMaxParam(2)
 
 		rec, ctx := helpers.RequestWithBody(http.MethodGet, "/", nil, e)
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
 		ctx.SetPath("/users/:id")
 		ctx.SetParamNames("id")
 		ctx.SetParamValues("775a5b37-1742-4e54-9439-0357e768b011")
@@ -110,9 +132,9 @@ func TestControllers_User_View(t *testing.T) {
 
 	t.Run("Non existing user", func(t *testing.T) {
 		e := echo.New()
-		e.SetMaxParam(2)
 
 		_, ctx := helpers.RequestWithBody(http.MethodGet, "/", nil, e)
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
 		ctx.SetPath("/users/:id")
 		ctx.SetParamNames("id")
 		ctx.SetParamValues("5fcc94e5-c6aa-4320-8469-f5021af54b88")
@@ -125,7 +147,7 @@ func TestControllers_User_View(t *testing.T) {
 }
 
 func TestControllers_User_Create(t *testing.T) {
-	ctl := controllers.NewUserController(_userSrv)
+	ctl := controllers.NewUserController(_userSrv, _policySrv, _lockoutSrv)
 
 	t.Run("Non-existing user", func(t *testing.T) {
 		user := models.CreateUser{
@@ -140,7 +162,7 @@ func TestControllers_User_Create(t *testing.T) {
 		}
 
 		rec, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", user, echo.New())
-		ctx.Set("USER_ID", "775a5b37-1742-4e54-9439-0357e768b011")
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
 
 		err := ctl.Create(ctx)
 		if assert.NoError(t, err) {
@@ -161,21 +183,43 @@ func TestControllers_User_Create(t *testing.T) {
 		}
 
 		_, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", user, echo.New())
-		ctx.Set("USER_ID", "775a5b37-1742-4e54-9439-0357e768b011")
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
 
 		err := ctl.Create(ctx)
 		if assert.Error(t, err) {
 			assert.Contains(t, err.Error(), "username taken", "error message %s", "formatted")
 		}
 	})
+
+	t.Run("User of another tenant", func(t *testing.T) {
+		user := models.CreateUser{
+			ID:        uuid.New(),
+			Email:     "user@test.com",
+			FirstName: "User",
+			LastName:  "Example",
+			Role:      "user",
+			Password:  "Test123456",
+			Status:    models.StatusActive,
+			Active:    true,
+		}
+
+		_, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", user, echo.New())
+		ctx.SetRequest(ctx.Request().WithContext(tenant.NewContext(ctx.Request().Context(), uuid.New())))
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
+
+		err := ctl.Create(ctx)
+		if he, ok := err.(*echo.HTTPError); assert.True(t, ok, "got %v", err) {
+			assert.Equal(t, http.StatusConflict, he.Code)
+		}
+	})
 }
 
 func TestControllers_User_Update(t *testing.T) {
-	ctl := controllers.NewUserController(_userSrv)
+	ctl := controllers.NewUserController(_userSrv, _policySrv, _lockoutSrv)
 
 	t.Run("Invalid UUID", func(t *testing.T) {
 		_, ctx := helpers.RequestWithBody(http.MethodPut, "/", nil, echo.New())
-		ctx.Set("USER_ID", "775a5b37-1742-4e54-9439-0357e768b011")
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
 
 		err := ctl.Update(ctx)
 		if assert.Error(t, err) {
@@ -194,9 +238,9 @@ func TestControllers_User_Update(t *testing.T) {
 		}
 
 		e := echo.New()
-		e.SetMaxParam(2)
 
 		rec, ctx := helpers.RequestObjectWithBody(t, http.MethodPut, "/", body, e)
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
 		ctx.SetPath("/users/:id")
 		ctx.SetParamNames("id")
 		ctx.SetParamValues("775a5b37-1742-4e54-9439-0357e768b011")
@@ -208,10 +252,10 @@ func TestControllers_User_Update(t *testing.T) {
 
 	t.Run("Non existing user", func(t *testing.T) {
 		e := echo.New()
-		e.SetMaxParam(2)
 
 		_, ctx := helpers.RequestWithBody(http.MethodPut, "/", nil, e)
 
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
 		ctx.SetPath("/users/:id")
 		ctx.SetParamNames("id")
 		ctx.SetParamValues("5fcc94e5-c6aa-4320-8469-f5021af54b88")
@@ -224,11 +268,11 @@ func TestControllers_User_Update(t *testing.T) {
 }
 
 func TestControllers_User_Delete(t *testing.T) {
-	ctl := controllers.NewUserController(_userSrv)
+	ctl := controllers.NewUserController(_userSrv, _policySrv, _lockoutSrv)
 
 	t.Run("Invalid UUID", func(t *testing.T) {
 		_, ctx := helpers.RequestWithBody(http.MethodDelete, "/", nil, echo.New())
-		ctx.Set("USER_ID", "775a5b37-1742-4e54-9439-0357e768b011")
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
 
 		err := ctl.Delete(ctx)
 		if assert.Error(t, err) {
@@ -238,10 +282,9 @@ func TestControllers_User_Delete(t *testing.T) {
 
 	t.Run("Cannot delete self", func(t *testing.T) {
 		e := echo.New()
-		e.SetMaxParam(2)
 
 		_, ctx := helpers.RequestWithBody(http.MethodDelete, "/", nil, e)
-		ctx.Set("USER_ID", "775a5b37-1742-4e54-9439-0357e768b011")
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
 
 		ctx.SetPath("/users/:id")
 		ctx.SetParamNames("id")
@@ -255,10 +298,9 @@ func TestControllers_User_Delete(t *testing.T) {
 
 	t.Run("Existing user", func(t *testing.T) {
 		e := echo.New()
-		e.SetMaxParam(2)
 
 		_, ctx := helpers.RequestWithBody(http.MethodDelete, "/", nil, e)
-		ctx.Set("USER_ID", "3ab1ba2a-6031-4e34-aae3-dcd43a987775")
+		_actor(ctx, "3ab1ba2a-6031-4e34-aae3-dcd43a987775", models.RoleSuperUser)
 
 		ctx.SetPath("/users/:id")
 		ctx.SetParamNames("id")
@@ -269,10 +311,9 @@ func TestControllers_User_Delete(t *testing.T) {
 
 	t.Run("Non existing user", func(t *testing.T) {
 		e := echo.New()
-		e.SetMaxParam(2)
 
 		_, ctx := helpers.RequestWithBody(http.MethodDelete, "/", nil, e)
-		ctx.Set("USER_ID", "775a5b37-1742-4e54-9439-0357e768b011")
+		_actor(ctx, "775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser)
 
 		ctx.SetPath("/users/:id")
 		ctx.SetParamNames("id")
@@ -284,3 +325,181 @@ func TestControllers_User_Delete(t *testing.T) {
 		}
 	})
 }
+
+func TestControllers_User_Unlock(t *testing.T) {
+	users := mock.NewUserRepository()
+	lockout := services.NewLockoutService(mock.NewAuthRepository(), users, _queueSrv, _cacheSrv, services.LockoutConfig{MaxAttempts: 5, MaxIPAttempts: 20, Duration: 15 * time.Minute, Window: time.Hour})
+	ctl := controllers.NewUserController(services.NewUserService(users, _queueSrv, _cacheSrv), _policySrv, lockout)
+
+	root, err := users.FindByUsername(context.Background(), "root@test.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	request := func(actor string, role string, id string) (*httptest.ResponseRecorder, echo.Context) {
+		rec, ctx := helpers.RequestWithBody(http.MethodPost, "/", nil, echo.New())
+		_actor(ctx, actor, role)
+
+		ctx.SetPath("/users/:id/unlock")
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(id)
+
+		return rec, ctx
+	}
+
+	t.Run("Manager of other user", func(t *testing.T) {
+		_, ctx := request("3ab1ba2a-6031-4e34-aae3-dcd43a987775", models.RoleManager, root.ID.String())
+
+		err := ctl.Unlock(ctx)
+		if assert.Error(t, err) {
+			assert.Equal(t, http.StatusForbidden, err.(*echo.HTTPError).Code)
+		}
+	})
+
+	t.Run("Non existing user", func(t *testing.T) {
+		_, ctx := request("775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser, "5fcc94e5-c6aa-4320-8469-f5021af54b88")
+
+		err := ctl.Unlock(ctx)
+		if assert.Error(t, err) {
+			assert.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+		}
+	})
+
+	t.Run("Locked user", func(t *testing.T) {
+		rec, ctx := request("775a5b37-1742-4e54-9439-0357e768b011", models.RoleSuperUser, root.ID.String())
+
+		if assert.NoError(t, ctl.Unlock(ctx)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Contains(t, rec.Body.String(), `"locked":false`)
+		}
+
+		if user, err := users.FindByID(context.Background(), root.ID); assert.NoError(t, err) {
+			assert.False(t, user.Locked)
+		}
+	})
+}
+
+func TestControllers_User_Ownership(t *testing.T) {
+	// manager 775a5b37 owns user@test.com but not peter@test.com
+	ctl := controllers.NewUserController(services.NewUserService(mock.NewUserRepository(), _queueSrv, _cacheSrv), _policySrv, _lockoutSrv)
+	manager := "775a5b37-1742-4e54-9439-0357e768b011"
+
+	request := func(method string, id string, body interface{}) (*httptest.ResponseRecorder, echo.Context) {
+		rec, ctx := helpers.RequestObjectWithBody(t, method, "/", body, echo.New())
+		_actor(ctx, manager, models.RoleManager)
+
+		ctx.SetPath("/users/:id")
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(id)
+
+		return rec, ctx
+	}
+
+	t.Run("List owned users", func(t *testing.T) {
+		rec, ctx := request(http.MethodGet, "", nil)
+
+		if assert.NoError(t, ctl.List(ctx)) {
+			assert.Contains(t, rec.Body.String(), "user@test.com")
+			assert.NotContains(t, rec.Body.String(), "peter@test.com")
+		}
+	})
+
+	t.Run("View owned user", func(t *testing.T) {
+		rec, ctx := request(http.MethodGet, "3ab1ba2a-6031-4e34-aae3-dcd43a987775", nil)
+
+		if assert.NoError(t, ctl.View(ctx)) {
+			assert.Contains(t, rec.Body.String(), "user@test.com")
+		}
+	})
+
+	t.Run("View other user", func(t *testing.T) {
+		_, ctx := request(http.MethodGet, manager, nil)
+
+		err := ctl.View(ctx)
+		if assert.Error(t, err) {
+			assert.Equal(t, http.StatusForbidden, err.(*echo.HTTPError).Code)
+		}
+	})
+
+	t.Run("Update owned user", func(t *testing.T) {
+		body := models.UpdateUser{FirstName: "John", LastName: "Snow", Role: models.RoleUser}
+		rec, ctx := request(http.MethodPut, "3ab1ba2a-6031-4e34-aae3-dcd43a987775", body)
+
+		if assert.NoError(t, ctl.Update(ctx)) {
+			assert.Equal(t, http.StatusAccepted, rec.Code)
+		}
+	})
+
+	t.Run("Role escalation is denied", func(t *testing.T) {
+		body := models.UpdateUser{FirstName: "John", LastName: "Snow", Role: models.RoleAdmin}
+		_, ctx := request(http.MethodPut, "3ab1ba2a-6031-4e34-aae3-dcd43a987775", body)
+
+		err := ctl.Update(ctx)
+		if assert.Error(t, err) {
+			assert.Equal(t, http.StatusForbidden, err.(*echo.HTTPError).Code)
+		}
+	})
+
+	t.Run("Create with role is denied", func(t *testing.T) {
+		body := models.CreateUser{Email: "boss@test.com", FirstName: "Boss", LastName: "Man", Role: models.RoleSuperUser, Password: "Test123456"}
+		_, ctx := request(http.MethodPost, "", body)
+
+		err := ctl.Create(ctx)
+		if assert.Error(t, err) {
+			assert.Equal(t, http.StatusForbidden, err.(*echo.HTTPError).Code)
+		}
+	})
+
+	t.Run("Delete other user", func(t *testing.T) {
+		_, ctx := request(http.MethodDelete, manager, nil)
+		_actor(ctx, "3ab1ba2a-6031-4e34-aae3-dcd43a987775", models.RoleManager)
+
+		err := ctl.Delete(ctx)
+		if assert.Error(t, err) {
+			assert.Equal(t, http.StatusForbidden, err.(*echo.HTTPError).Code)
+		}
+	})
+}
+
+func TestControllers_User_Tenant(t *testing.T) {
+	e := echo.New()
+	controllers.NewUserController(services.NewUserService(mock.NewUserRepository(), _queueSrv, _cacheSrv), _policySrv, _lockoutSrv).Routes(e.Group("api"))
+
+	// mock users belong to uuid.Nil tenant
+	other := uuid.New().String()
+	scope := "users:read users:write"
+
+	request := func(role string, tid string, header string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/users/3ab1ba2a-6031-4e34-aae3-dcd43a987775", nil)
+		req.Header.Set(echo.HeaderAuthorization, _tenantBearer(t, role, scope, tid))
+		if header != "" {
+			req.Header.Set(auth.HeaderTenantID, header)
+		}
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		return rec.Code
+	}
+
+	t.Run("Same tenant", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, request(models.RoleAdmin, uuid.Nil.String(), ""))
+	})
+
+	t.Run("Other tenant is not found", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, request(models.RoleAdmin, other, ""))
+	})
+
+	t.Run("Tenant header must match token", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, request(models.RoleAdmin, other, uuid.Nil.String()))
+	})
+
+	t.Run("Super user acts across tenants", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, request(models.RoleSuperUser, other, ""))
+	})
+
+	t.Run("Super user picks tenant", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, request(models.RoleSuperUser, "", other))
+		assert.Equal(t, http.StatusOK, request(models.RoleSuperUser, "", uuid.Nil.String()))
+	})
+}
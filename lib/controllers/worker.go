@@ -9,14 +9,21 @@ import (
 
 	"github.com/stiks/gobs/lib/models"
 	"github.com/stiks/gobs/lib/services"
-	"github.com/stiks/gobs/pkg/env"
 	"github.com/stiks/gobs/pkg/xlog"
 )
 
+// PublicConfig describes the site links in emails point to
+type PublicConfig struct {
+	Name     string `env:"PUBLIC_NAME" required:"true"`
+	Hostname string `env:"PUBLIC_HOSTNAME" required:"true"`
+}
+
 type workerController struct {
-	queue services.QueueService
-	user  services.UserService
-	email services.EmailService
+	queue  services.QueueService
+	user   services.UserService
+	email  services.EmailService
+	lock   services.LockoutService
+	public PublicConfig
 }
 
 // WorkerControllerInterface ...
@@ -26,14 +33,18 @@ type WorkerControllerInterface interface {
 	UserPasswordReset(c echo.Context) error
 	UserProfileUpdated(c echo.Context) error
 	UserPasswordChanged(c echo.Context) error
+	UserLocked(c echo.Context) error
+	UserUnlocked(c echo.Context) error
 }
 
 // NewWorkerController returns a controller
-func NewWorkerController(userSrv services.UserService, queueSrv services.QueueService, emailSrv services.EmailService) WorkerControllerInterface {
+func NewWorkerController(userSrv services.UserService, queueSrv services.QueueService, emailSrv services.EmailService, lockSrv services.LockoutService, public PublicConfig) WorkerControllerInterface {
 	return &workerController{
-		user:  userSrv,
-		queue: queueSrv,
-		email: emailSrv,
+		user:   userSrv,
+		queue:  queueSrv,
+		email:  emailSrv,
+		lock:   lockSrv,
+		public: public,
 	}
 }
 
@@ -43,6 +54,8 @@ func (ctl *workerController) Routes(g *echo.Group) {
 	g.POST("/user-password-reset", ctl.UserPasswordReset)
 	g.POST("/user-profile-updated", ctl.UserProfileUpdated)
 	g.POST("/user-password-changed", ctl.UserPasswordChanged)
+	g.POST("/user-locked", ctl.UserLocked)
+	g.POST("/user-unlocked", ctl.UserUnlocked)
 }
 
 // UserPasswordReset ...
@@ -67,7 +80,7 @@ func (ctl *workerController) UserPasswordReset(c echo.Context) error {
 		Body: hermes.Body{
 			Name: fmt.Sprintf("%s", user.FirstName),
 			Intros: []string{
-				fmt.Sprintf("You have received this email because a password reset request for %s account was received.", env.MustGetString("PUBLIC_NAME")),
+				fmt.Sprintf("You have received this email because a password reset request for %s account was received.", ctl.public.Name),
 			},
 			Actions: []hermes.Action{
 				{
@@ -75,7 +88,7 @@ func (ctl *workerController) UserPasswordReset(c echo.Context) error {
 					Button: hermes.Button{
 						Color: "#DC4D2F",
 						Text:  "Reset your password",
-						Link:  fmt.Sprintf("%s/user/reset-password/%s", env.MustGetString("PUBLIC_HOSTNAME"), user.PasswordResetHash),
+						Link:  fmt.Sprintf("%s/user/reset-password/%s", ctl.public.Hostname, user.PasswordResetHash),
 					},
 				},
 			},
@@ -148,6 +161,15 @@ func (ctl *workerController) ConfirmEmail(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
+	// Code was replaced by a resend or already used, newer task carries the current one
+	if user.IsActive || req.Code == "" || req.Code != user.ValidationHash {
+		xlog.Infof(ctx, "Skipping stale confirmation email for %s", user.ID.String())
+
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	link := fmt.Sprintf("%s/account/validate?id=%s&code=%s", ctl.public.Hostname, user.ID.String(), req.Code)
+
 	msg := hermes.Email{
 		Body: hermes.Body{
 			Name: fmt.Sprintf("%s", user.FirstName),
@@ -160,12 +182,12 @@ func (ctl *workerController) ConfirmEmail(c echo.Context) error {
 					Button: hermes.Button{
 						Color: "#DC4D2F",
 						Text:  "Confirm email",
-						Link:  fmt.Sprintf("%s/client/register?code=%s", env.MustGetString("PUBLIC_HOSTNAME"), req.Code),
+						Link:  link,
 					},
 				},
 			},
 			Outros: []string{
-				fmt.Sprintf("Or you can click here: %s/account/validate?code=%s", env.MustGetString("PUBLIC_HOSTNAME"), req.Code),
+				fmt.Sprintf("Or you can click here: %s", link),
 				"If you didn't request this, please ignore this email.",
 			},
 			Signature: "Thanks",
@@ -215,3 +237,89 @@ func (ctl *workerController) UserPasswordChanged(c echo.Context) error {
 
 	return c.NoContent(http.StatusNoContent)
 }
+
+// UserLocked ...
+func (ctl *workerController) UserLocked(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	req := new(models.WorkerRequest)
+	if err := c.Bind(req); err != nil {
+		xlog.Errorf(ctx, "Bind error: %s", err.Error())
+
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	user, err := ctl.user.GetByID(ctx, req.ID)
+	if err != nil {
+		xlog.Errorf(ctx, "Unable to find user, err: %s", err.Error())
+
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// lockout is looked up rather than taken from request, it may be over
+	until, err := ctl.lock.LockedUntil(ctx, user)
+	if err != nil {
+		xlog.Errorf(ctx, "Unable to find lockout, err: %s", err.Error())
+
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	if until.IsZero() {
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	msg := hermes.Email{
+		Body: hermes.Body{
+			Name: fmt.Sprintf("%s", user.FirstName),
+			Intros: []string{
+				fmt.Sprintf("Your %s account was temporarily locked after too many failed login attempts.", ctl.public.Name),
+				fmt.Sprintf("You can try to sign in again after %s.", until.UTC().Format("2006-01-02 15:04 MST")),
+			},
+			Outros:    []string{"If it wasn't you, please change your password once the lock is over."},
+			Signature: "Thanks",
+		},
+	}
+
+	if err := ctl.email.SendEmail(ctx, user.Email, "Account temporarily locked", msg); err != nil {
+		xlog.Errorf(ctx, "Unable to send email, err: %s", err.Error())
+
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// UserUnlocked ...
+func (ctl *workerController) UserUnlocked(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	req := new(models.WorkerRequest)
+	if err := c.Bind(req); err != nil {
+		xlog.Errorf(ctx, "Bind error: %s", err.Error())
+
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	user, err := ctl.user.GetByID(ctx, req.ID)
+	if err != nil {
+		xlog.Errorf(ctx, "Unable to find user, err: %s", err.Error())
+
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	msg := hermes.Email{
+		Body: hermes.Body{
+			Name:      fmt.Sprintf("%s", user.FirstName),
+			Intros:    []string{fmt.Sprintf("Your %s account was unlocked by an administrator, you can sign in again.", ctl.public.Name)},
+			Signature: "Thanks",
+		},
+	}
+
+	if err := ctl.email.SendEmail(ctx, user.Email, "Account unlocked", msg); err != nil {
+		xlog.Errorf(ctx, "Unable to send email, err: %s", err.Error())
+
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -1,11 +1,13 @@
 package controllers_test
 
 import (
+	"context"
 	"net/http"
-	"os"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/matcornic/hermes/v2"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/stiks/gobs/lib/controllers"
@@ -16,19 +18,29 @@ import (
 )
 
 var (
-	_         = os.Setenv("PUBLIC_NAME", "something")
-	_         = os.Setenv("PUBLIC_HOSTNAME", "something")
 	_emailSrv = services.NewEmailService(mock.NewEmailRepository())
+	_public   = controllers.PublicConfig{Name: "something", Hostname: "something"}
 )
 
+// _recordingEmail counts sent emails
+type _recordingEmail struct {
+	sent int
+}
+
+func (r *_recordingEmail) SendEmail(ctx context.Context, to string, subject string, email hermes.Email) error {
+	r.sent++
+
+	return nil
+}
+
 func TestControllers_Worker_NewUserController(t *testing.T) {
-	assert.NotNil(t, controllers.NewWorkerController(_userSrv, _queueSrv, _emailSrv))
+	assert.NotNil(t, controllers.NewWorkerController(_userSrv, _queueSrv, _emailSrv, _lockoutSrv, _public))
 }
 
 func TestControllers_Worker_Routes(t *testing.T) {
 	t.Run("User password reset", func(t *testing.T) {
 		e := echo.New()
-		controllers.NewWorkerController(_userSrv, _queueSrv, _emailSrv).Routes(e.Group("worker"))
+		controllers.NewWorkerController(_userSrv, _queueSrv, _emailSrv, _lockoutSrv, _public).Routes(e.Group("worker"))
 
 		c, _ := helpers.RequestTest(http.MethodPost, "/worker/user-password-reset", e)
 		assert.Equal(t, 400, c)
@@ -36,7 +48,7 @@ func TestControllers_Worker_Routes(t *testing.T) {
 
 	t.Run("VUser profile updated", func(t *testing.T) {
 		e := echo.New()
-		controllers.NewUserController(_userSrv).Routes(e.Group("worker"))
+		controllers.NewUserController(_userSrv, _policySrv, _lockoutSrv).Routes(e.Group("worker"))
 
 		c, _ := helpers.RequestTest(http.MethodPost, "/worker/user-profile-updated", e)
 		assert.Equal(t, 400, c)
@@ -44,7 +56,7 @@ func TestControllers_Worker_Routes(t *testing.T) {
 
 	t.Run("User password changed", func(t *testing.T) {
 		e := echo.New()
-		controllers.NewUserController(_userSrv).Routes(e.Group("worker"))
+		controllers.NewUserController(_userSrv, _policySrv, _lockoutSrv).Routes(e.Group("worker"))
 
 		c, _ := helpers.RequestTest(http.MethodPost, "/worker/user-password-changed", e)
 		assert.Equal(t, 400, c)
@@ -52,7 +64,7 @@ func TestControllers_Worker_Routes(t *testing.T) {
 }
 
 func TestControllers_Worker_UserPasswordReset(t *testing.T) {
-	ctl := controllers.NewWorkerController(_userSrv, _queueSrv, _emailSrv)
+	ctl := controllers.NewWorkerController(_userSrv, _queueSrv, _emailSrv, _lockoutSrv, _public)
 
 	t.Run("Existing user", func(t *testing.T) {
 		data := models.WorkerRequest{ID: helpers.UUIDFromString(t, "3ab1ba2a-6031-4e34-aae3-dcd43a987775")}
@@ -73,7 +85,7 @@ func TestControllers_Worker_UserPasswordReset(t *testing.T) {
 }
 
 func TestControllers_Worker_UserProfileUpdated(t *testing.T) {
-	ctl := controllers.NewWorkerController(_userSrv, _queueSrv, _emailSrv)
+	ctl := controllers.NewWorkerController(_userSrv, _queueSrv, _emailSrv, _lockoutSrv, _public)
 
 	t.Run("Existing user", func(t *testing.T) {
 		data := models.WorkerRequest{ID: helpers.UUIDFromString(t, "3ab1ba2a-6031-4e34-aae3-dcd43a987775")}
@@ -94,15 +106,35 @@ func TestControllers_Worker_UserProfileUpdated(t *testing.T) {
 }
 
 func TestControllers_Worker_ConfirmEmail(t *testing.T) {
-	ctl := controllers.NewWorkerController(_userSrv, _queueSrv, _emailSrv)
+	ctl := controllers.NewWorkerController(_userSrv, _queueSrv, _emailSrv, _lockoutSrv, _public)
 
 	t.Run("Existing user", func(t *testing.T) {
-		data := models.WorkerRequest{ID: helpers.UUIDFromString(t, "3ab1ba2a-6031-4e34-aae3-dcd43a987775")}
+		data := models.WorkerRequest{ID: helpers.UUIDFromString(t, "3ab1ba2a-6031-4e34-aae3-dcd43a987775"), Code: "SomeHash123"}
 		_, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", data, echo.New())
 
 		assert.NoError(t, ctl.ConfirmEmail(ctx))
 	})
 
+	t.Run("Stale code", func(t *testing.T) {
+		emails := new(_recordingEmail)
+		ctl := controllers.NewWorkerController(services.NewUserService(mock.NewUserRepository(), _queueSrv, _cacheSrv), _queueSrv, services.NewEmailService(emails), _lockoutSrv, _public)
+
+		data := models.WorkerRequest{ID: helpers.UUIDFromString(t, "3ab1ba2a-6031-4e34-aae3-dcd43a987775"), Code: "ReplacedHash"}
+		rec, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", data, echo.New())
+
+		if assert.NoError(t, ctl.ConfirmEmail(ctx)) {
+			assert.Equal(t, http.StatusNoContent, rec.Code)
+			assert.Zero(t, emails.sent, "replaced code is not emailed")
+		}
+
+		data.Code = "SomeHash123"
+		_, ctx = helpers.RequestObjectWithBody(t, http.MethodPost, "/", data, echo.New())
+
+		if assert.NoError(t, ctl.ConfirmEmail(ctx)) {
+			assert.Equal(t, 1, emails.sent)
+		}
+	})
+
 	t.Run("Non-existing user", func(t *testing.T) {
 		data := models.WorkerRequest{ID: helpers.UUIDFromString(t, "5fcc94e5-c6aa-4320-8469-f5021af54b88")}
 		_, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", data, echo.New())
@@ -115,7 +147,7 @@ func TestControllers_Worker_ConfirmEmail(t *testing.T) {
 }
 
 func TestControllers_Worker_UserPasswordChanged(t *testing.T) {
-	ctl := controllers.NewWorkerController(_userSrv, _queueSrv, _emailSrv)
+	ctl := controllers.NewWorkerController(_userSrv, _queueSrv, _emailSrv, _lockoutSrv, _public)
 
 	t.Run("Existing user", func(t *testing.T) {
 		data := models.WorkerRequest{ID: helpers.UUIDFromString(t, "3ab1ba2a-6031-4e34-aae3-dcd43a987775")}
@@ -134,3 +166,76 @@ func TestControllers_Worker_UserPasswordChanged(t *testing.T) {
 		}
 	})
 }
+
+func TestControllers_Worker_UserLocked(t *testing.T) {
+	t.Run("Locked out user", func(t *testing.T) {
+		repo := mock.NewAuthRepository()
+		_, err := repo.SaveLoginAttempts(context.Background(), &models.LoginAttempts{Key: models.UserAttemptsKey("user@test.com"), Failures: 5, LastFailure: time.Now(), LockedUntil: time.Now().Add(15 * time.Minute)})
+		assert.NoError(t, err)
+
+		lockSrv := services.NewLockoutService(repo, mock.NewUserRepository(), _queueSrv, _cacheSrv, services.LockoutConfig{MaxAttempts: 5, MaxIPAttempts: 20, Duration: 15 * time.Minute, Window: time.Hour})
+
+		emails := new(_recordingEmail)
+		ctl := controllers.NewWorkerController(_userSrv, _queueSrv, services.NewEmailService(emails), lockSrv, _public)
+
+		data := models.WorkerRequest{ID: helpers.UUIDFromString(t, "3ab1ba2a-6031-4e34-aae3-dcd43a987775")}
+		rec, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", data, echo.New())
+
+		if assert.NoError(t, ctl.UserLocked(ctx)) {
+			assert.Equal(t, http.StatusNoContent, rec.Code)
+			assert.Equal(t, 1, emails.sent)
+		}
+	})
+
+	t.Run("User not locked out", func(t *testing.T) {
+		emails := new(_recordingEmail)
+		ctl := controllers.NewWorkerController(_userSrv, _queueSrv, services.NewEmailService(emails), _lockoutSrv, _public)
+
+		data := models.WorkerRequest{ID: helpers.UUIDFromString(t, "3ab1ba2a-6031-4e34-aae3-dcd43a987775")}
+		rec, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", data, echo.New())
+
+		if assert.NoError(t, ctl.UserLocked(ctx)) {
+			assert.Equal(t, http.StatusNoContent, rec.Code)
+			assert.Equal(t, 0, emails.sent)
+		}
+	})
+
+	t.Run("Non-existing user", func(t *testing.T) {
+		ctl := controllers.NewWorkerController(_userSrv, _queueSrv, _emailSrv, _lockoutSrv, _public)
+
+		data := models.WorkerRequest{ID: helpers.UUIDFromString(t, "5fcc94e5-c6aa-4320-8469-f5021af54b88")}
+		_, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", data, echo.New())
+
+		err := ctl.UserLocked(ctx)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "user not found", "error message %s", "formatted")
+		}
+	})
+}
+
+func TestControllers_Worker_UserUnlocked(t *testing.T) {
+	t.Run("Existing user", func(t *testing.T) {
+		emails := new(_recordingEmail)
+		ctl := controllers.NewWorkerController(_userSrv, _queueSrv, services.NewEmailService(emails), _lockoutSrv, _public)
+
+		data := models.WorkerRequest{ID: helpers.UUIDFromString(t, "3ab1ba2a-6031-4e34-aae3-dcd43a987775")}
+		rec, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", data, echo.New())
+
+		if assert.NoError(t, ctl.UserUnlocked(ctx)) {
+			assert.Equal(t, http.StatusNoContent, rec.Code)
+			assert.Equal(t, 1, emails.sent)
+		}
+	})
+
+	t.Run("Non-existing user", func(t *testing.T) {
+		ctl := controllers.NewWorkerController(_userSrv, _queueSrv, _emailSrv, _lockoutSrv, _public)
+
+		data := models.WorkerRequest{ID: helpers.UUIDFromString(t, "5fcc94e5-c6aa-4320-8469-f5021af54b88")}
+		_, ctx := helpers.RequestObjectWithBody(t, http.MethodPost, "/", data, echo.New())
+
+		err := ctl.UserUnlocked(ctx)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "user not found", "error message %s", "formatted")
+		}
+	})
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"errors"
+	"strings"
 
 	"github.com/google/uuid"
 )
@@ -11,13 +12,133 @@ var (
 	ErrAuthClientNotFound = errors.New("auth client could not be found")
 	// ErrAuthClientAlreadyExist ...
 	ErrAuthClientAlreadyExist = errors.New("auth client already exist")
+	// ErrUnauthorizedClient ...
+	ErrUnauthorizedClient = errors.New("client is not authorised to use this grant type")
+	// ErrInvalidScope ...
+	ErrInvalidScope = errors.New("requested scope is invalid or exceeds granted scope")
+	// ErrInsufficientScope ...
+	ErrInsufficientScope = errors.New("token scope is insufficient")
 )
 
+const (
+	// ScopeUsersRead ...
+	ScopeUsersRead = "users:read"
+	// ScopeUsersWrite allows creating, updating and deleting users
+	ScopeUsersWrite = "users:write"
+	// ScopeClientsRead ...
+	ScopeClientsRead = "clients:read"
+	// ScopeClientsWrite allows creating, updating and deleting clients
+	ScopeClientsWrite = "clients:write"
+)
+
+// ResourceScopes may be allowed to auth clients, identity scopes are granted
+// to every client
+var ResourceScopes = []string{ScopeUsersRead, ScopeUsersWrite, ScopeClientsRead, ScopeClientsWrite}
+
 // AuthClient ...
 type AuthClient struct {
 	ID           uuid.UUID `json:"id"`
 	ClientID     string    `json:"client_id"`
 	ClientSecret string    `json:"client_secret"`
+	// Role and Scope are carried by tokens the client gets as itself with the
+	// client_credentials grant, a client without role cannot use that grant
+	Role  string `json:"role"`
+	Scope string `json:"scope"`
+	// RedirectURIs registered for authorization_code grant, exact match
+	RedirectURIs []string `json:"redirect_uris"`
+}
+
+// ClientScope is a request to replace scopes allowed to an auth client
+type ClientScope struct {
+	Scope string `json:"scope"`
+}
+
+// Validate ...
+func (r *ClientScope) Validate() error {
+	for _, scope := range strings.Fields(r.Scope) {
+		if !hasScope(ResourceScopes, scope) {
+			return ErrInvalidScope
+		}
+	}
+
+	return nil
+}
+
+// GrantScope returns scope for a token, requested scope must be a subset of
+// client scope, empty request gets everything the client has
+func (u *AuthClient) GrantScope(requested string) (string, error) {
+	return grantScope(strings.Fields(u.Scope), requested)
+}
+
+// grantScope returns requested scope when it is a subset of allowed one
+func grantScope(allowed []string, requested string) (string, error) {
+	if strings.TrimSpace(requested) == "" {
+		return strings.Join(allowed, " "), nil
+	}
+
+	var granted []string
+	for _, scope := range strings.Fields(requested) {
+		if !hasScope(allowed, scope) {
+			return "", ErrInvalidScope
+		}
+
+		granted = append(granted, scope)
+	}
+
+	return strings.Join(granted, " "), nil
+}
+
+// GrantUserScope returns scope for a token issued on behalf of a user, identity
+// scopes are granted to every client, the rest is checked by GrantScope
+func (u *AuthClient) GrantUserScope(requested string) (string, error) {
+	var identity, rest []string
+	for _, scope := range strings.Fields(requested) {
+		switch {
+		case !hasScope(IdentityScopes, scope):
+			rest = append(rest, scope)
+		case !hasScope(identity, scope):
+			identity = append(identity, scope)
+		}
+	}
+
+	if len(identity) > 0 && len(rest) == 0 {
+		return strings.Join(identity, " "), nil
+	}
+
+	granted, err := u.GrantScope(strings.Join(rest, " "))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(strings.Join(identity, " ") + " " + granted), nil
+}
+
+// ValidRedirectURI reports whether uri exactly matches a registered one
+func (u *AuthClient) ValidRedirectURI(uri string) bool {
+	for _, registered := range u.RedirectURIs {
+		if registered == uri {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsPublic reports whether the client has no secret, such as SPA, public
+// clients may only use authorization_code grant with PKCE
+func (u *AuthClient) IsPublic() bool {
+	return u.ClientSecret == ""
+}
+
+// hasScope ...
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
 }
 
 // ValidateSecret ...
@@ -26,3 +26,76 @@ func TestModel_AuthClient_ValidateSecret(t *testing.T) {
 		assert.Equal(t, false, data.ValidateSecret("WrongPass"))
 	})
 }
+
+func TestModel_AuthClient_GrantScope(t *testing.T) {
+	data := &models.AuthClient{
+		ClientID: "zzZzz",
+		Scope:    "users:read  clients:read",
+	}
+
+	t.Run("Empty request", func(t *testing.T) {
+		scope, err := data.GrantScope("")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "users:read clients:read", scope)
+		}
+	})
+
+	t.Run("Subset", func(t *testing.T) {
+		scope, err := data.GrantScope("clients:read")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "clients:read", scope)
+		}
+	})
+
+	t.Run("Exceeds client scope", func(t *testing.T) {
+		_, err := data.GrantScope("clients:read clients:write")
+		assert.Equal(t, models.ErrInvalidScope, err)
+	})
+}
+
+func TestModel_AuthClient_GrantUserScope(t *testing.T) {
+	data := &models.AuthClient{
+		ClientID: "zzZzz",
+		Scope:    "users:read clients:read",
+	}
+
+	t.Run("Empty request", func(t *testing.T) {
+		scope, err := data.GrantUserScope("")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "users:read clients:read", scope)
+		}
+	})
+
+	t.Run("Identity scopes only", func(t *testing.T) {
+		scope, err := data.GrantUserScope("openid email openid")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "openid email", scope)
+		}
+	})
+
+	t.Run("Identity and client scopes", func(t *testing.T) {
+		scope, err := data.GrantUserScope("openid users:read")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "openid users:read", scope)
+		}
+	})
+
+	t.Run("Exceeds client scope", func(t *testing.T) {
+		_, err := data.GrantUserScope("openid users:write")
+		assert.Equal(t, models.ErrInvalidScope, err)
+	})
+}
+
+func TestModel_AuthClient_ValidRedirectURI(t *testing.T) {
+	data := &models.AuthClient{RedirectURIs: []string{"https://app.test/callback"}}
+
+	assert.True(t, data.ValidRedirectURI("https://app.test/callback"))
+	assert.False(t, data.ValidRedirectURI("https://app.test/callback/"))
+	assert.False(t, data.ValidRedirectURI("https://evil.test/callback"))
+}
+
+func TestModel_ClientScope_Validate(t *testing.T) {
+	assert.NoError(t, (&models.ClientScope{Scope: "users:read clients:write"}).Validate())
+	assert.NoError(t, (&models.ClientScope{}).Validate(), "client may lose every scope")
+	assert.Equal(t, models.ErrInvalidScope, (&models.ClientScope{Scope: "users:read openid"}).Validate(), "identity scopes are not allowed per client")
+}
@@ -15,6 +15,13 @@ type AuthRequest struct {
 	Username     string `json:"username"      form:"username"      query:"username"`
 	Password     string `json:"password"      form:"password"      query:"password"`
 	RefreshToken string `json:"refresh_token" form:"refresh_token" query:"refresh_token"`
+	Scope        string `json:"scope"         form:"scope"         query:"scope"`
+	Code         string `json:"code"          form:"code"          query:"code"`
+	RedirectURI  string `json:"redirect_uri"  form:"redirect_uri"  query:"redirect_uri"`
+	CodeVerifier string `json:"code_verifier" form:"code_verifier" query:"code_verifier"`
+	MFAToken     string `json:"mfa_token"     form:"mfa_token"     query:"mfa_token"`
+	// ClientIP is set by token endpoint, failed logins are counted per IP
+	ClientIP string `json:"-" form:"-" query:"-"`
 }
 
 var (
@@ -29,18 +36,52 @@ var (
 // Validate users model
 func (u *AuthRequest) Validate() error {
 	return validation.ValidateStruct(u,
-		validation.Field(&u.GrantType, validation.Required, validation.In("password", "refresh_token")),
+		validation.Field(&u.GrantType, validation.Required, validation.In("password", "refresh_token", "client_credentials", "authorization_code", "mfa")),
 	)
 }
 
 // TokenResponse ...
 type TokenResponse struct {
-	UserID       uuid.UUID `json:"user_id,omitempty"`
-	User         *User     `json:"-"`
-	AccessToken  string    `json:"access_token"`
-	ExpiresIn    int       `json:"expires_in"`
-	TokenType    string    `json:"token_type"`
-	RefreshToken string    `json:"refresh_token,omitempty"`
-	Scope        string    `json:"scope,omitempty"`
-	Authority    string    `json:"authority,omitempty"`
+	UserID       *uuid.UUID `json:"user_id,omitempty"`
+	User         *User      `json:"-"`
+	AccessToken  string     `json:"access_token"`
+	ExpiresIn    int        `json:"expires_in"`
+	TokenType    string     `json:"token_type"`
+	RefreshToken string     `json:"refresh_token,omitempty"`
+	Scope        string     `json:"scope,omitempty"`
+	Authority    string     `json:"authority,omitempty"`
+	// IDToken is issued when openid scope is granted
+	IDToken string `json:"id_token,omitempty"`
+	// RecoveryCodes are issued when login completed MFA enrollment
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// TokenRequest is a request of revocation (RFC 7009) and introspection
+// (RFC 7662) endpoints, client credentials may come in Basic auth instead
+type TokenRequest struct {
+	Token         string `json:"token"           form:"token"`
+	TokenTypeHint string `json:"token_type_hint" form:"token_type_hint"`
+	ClientID      string `json:"client_id"       form:"client_id"`
+	ClientSecret  string `json:"client_secret"   form:"client_secret"`
+}
+
+// Validate ...
+func (u *TokenRequest) Validate() error {
+	return validation.ValidateStruct(u,
+		validation.Field(&u.Token, validation.Required),
+		validation.Field(&u.TokenTypeHint, validation.In("access_token", "refresh_token")),
+	)
+}
+
+// IntrospectionResponse ...
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	ID        string `json:"jti,omitempty"`
 }
@@ -31,6 +31,17 @@ func TestModel_AuthRequest_Validate(t *testing.T) {
 		assert.NoError(t, data.Validate())
 	})
 
+	t.Run("Grant client credentials", func(t *testing.T) {
+		data := &models.AuthRequest{
+			ClientID:     "zzZzz",
+			ClientSecret: "ZzzZzz",
+			GrantType:    "client_credentials",
+			Scope:        "users:read",
+		}
+
+		assert.NoError(t, data.Validate())
+	})
+
 	t.Run("Wrong grant", func(t *testing.T) {
 		data := &models.AuthRequest{
 			ClientID:     "zzZzz",
@@ -58,3 +69,10 @@ func TestModel_AuthRequest_Validate(t *testing.T) {
 		}
 	})
 }
+
+func TestModel_TokenRequest_Validate(t *testing.T) {
+	assert.NoError(t, (&models.TokenRequest{Token: "zzZzz"}).Validate())
+	assert.NoError(t, (&models.TokenRequest{Token: "zzZzz", TokenTypeHint: "refresh_token"}).Validate())
+	assert.Error(t, (&models.TokenRequest{Token: "zzZzz", TokenTypeHint: "id_token"}).Validate())
+	assert.Error(t, (&models.TokenRequest{}).Validate())
+}
@@ -0,0 +1,179 @@
+package models
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/google/uuid"
+	"github.com/labstack/gommon/random"
+)
+
+var (
+	// ErrAuthorizationCodeNotFound ...
+	ErrAuthorizationCodeNotFound = errors.New("authorization code not found")
+	// ErrAuthorizationCodeExpired ...
+	ErrAuthorizationCodeExpired = errors.New("authorization code expired")
+	// ErrInvalidRedirectURI ...
+	ErrInvalidRedirectURI = errors.New("redirect URI is not registered for the client")
+	// ErrInvalidCodeVerifier ...
+	ErrInvalidCodeVerifier = errors.New("code verifier does not match code challenge")
+	// ErrConsentRequired ...
+	ErrConsentRequired = errors.New("user consent is required")
+	// ErrConsentNotFound ...
+	ErrConsentNotFound = errors.New("consent not found")
+)
+
+// AuthorizeRequest is the authorization request of authorization_code grant,
+// PKCE with S256 is mandatory for every client
+type AuthorizeRequest struct {
+	ResponseType        string `json:"response_type"         form:"response_type"         query:"response_type"`
+	ClientID            string `json:"client_id"             form:"client_id"             query:"client_id"`
+	RedirectURI         string `json:"redirect_uri"          form:"redirect_uri"          query:"redirect_uri"`
+	Scope               string `json:"scope"                 form:"scope"                 query:"scope"`
+	State               string `json:"state"                 form:"state"                 query:"state"`
+	CodeChallenge       string `json:"code_challenge"        form:"code_challenge"        query:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method" form:"code_challenge_method" query:"code_challenge_method"`
+	// Nonce is echoed in ID token to bind it to the client session (OpenID Connect)
+	Nonce string `json:"nonce" form:"nonce" query:"nonce"`
+	// Approve is the user's answer on consent screen, only read on POST
+	Approve bool `json:"approve" form:"approve"`
+	// AuthTime is when the user signed in, taken from the access token
+	AuthTime int64 `json:"-" form:"-" query:"-"`
+}
+
+// Validate ...
+func (r *AuthorizeRequest) Validate() error {
+	return validation.ValidateStruct(r,
+		validation.Field(&r.ResponseType, validation.Required, validation.In("code")),
+		validation.Field(&r.ClientID, validation.Required),
+		validation.Field(&r.RedirectURI, validation.Required),
+		// base64url of SHA-256 digest is always 43 characters
+		validation.Field(&r.CodeChallenge, validation.Required, validation.Length(43, 43)),
+		validation.Field(&r.CodeChallengeMethod, validation.Required, validation.In("S256")),
+		validation.Field(&r.Nonce, validation.Length(0, 255)),
+	)
+}
+
+// RedirectWith returns redirect URI with params and request state appended
+func (r *AuthorizeRequest) RedirectWith(params url.Values) string {
+	u, err := url.Parse(r.RedirectURI)
+	if err != nil {
+		return r.RedirectURI
+	}
+
+	query := u.Query()
+	for k, v := range params {
+		query[k] = v
+	}
+
+	if r.State != "" {
+		query.Set("state", r.State)
+	}
+
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// AuthorizeResponse tells the UI where to send the user, or that consent
+// screen has to be shown first
+type AuthorizeResponse struct {
+	RedirectTo      string `json:"redirect_to,omitempty"`
+	ConsentRequired bool   `json:"consent_required,omitempty"`
+	ClientID        string `json:"client_id,omitempty"`
+	Scope           string `json:"scope,omitempty"`
+}
+
+// AuthorizationCode is single-use and short-lived, exchanged for tokens with
+// the code verifier matching CodeChallenge
+type AuthorizationCode struct {
+	ID            uuid.UUID `json:"id"`
+	Code          string    `json:"-"`
+	ClientID      uuid.UUID `json:"client_id"`
+	UserID        uuid.UUID `json:"user_id"`
+	RedirectURI   string    `json:"redirect_uri"`
+	Scope         string    `json:"scope"`
+	CodeChallenge string    `json:"-"`
+	Nonce         string    `json:"-"`
+	AuthTime      int64     `json:"-"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// NewAuthorizationCode ...
+func NewAuthorizationCode(client *AuthClient, userID uuid.UUID, req *AuthorizeRequest, scope string, lifetime time.Duration) *AuthorizationCode {
+	now := time.Now().UTC()
+
+	return &AuthorizationCode{
+		ID:            uuid.New(),
+		Code:          random.String(48, random.Alphanumeric),
+		ClientID:      client.ID,
+		UserID:        userID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         scope,
+		CodeChallenge: req.CodeChallenge,
+		Nonce:         req.Nonce,
+		AuthTime:      req.AuthTime,
+		ExpiresAt:     now.Add(lifetime),
+		CreatedAt:     now,
+	}
+}
+
+// Expired ...
+func (a *AuthorizationCode) Expired() bool {
+	return time.Now().UTC().After(a.ExpiresAt)
+}
+
+// VerifyChallenge checks S256 code verifier against stored challenge
+func (a *AuthorizationCode) VerifyChallenge(verifier string) bool {
+	if verifier == "" {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(challenge), []byte(a.CodeChallenge)) == 1
+}
+
+// Consent records scope a user approved for a client
+type Consent struct {
+	ID        uuid.UUID `json:"id"`
+	ClientID  uuid.UUID `json:"client_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Scope     string    `json:"scope"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Covers reports whether every requested scope was approved before
+func (c *Consent) Covers(scope string) bool {
+	approved := strings.Fields(c.Scope)
+
+	for _, s := range strings.Fields(scope) {
+		if !hasScope(approved, s) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Add merges scope into approved scope
+func (c *Consent) Add(scope string) {
+	approved := strings.Fields(c.Scope)
+
+	for _, s := range strings.Fields(scope) {
+		if !hasScope(approved, s) {
+			approved = append(approved, s)
+		}
+	}
+
+	c.Scope = strings.Join(approved, " ")
+}
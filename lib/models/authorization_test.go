@@ -0,0 +1,101 @@
+package models_test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/models"
+)
+
+// verifier and challenge from RFC 7636 appendix B
+const (
+	_verifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	_challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestModel_AuthorizeRequest_Validate(t *testing.T) {
+	data := func() *models.AuthorizeRequest {
+		return &models.AuthorizeRequest{
+			ResponseType:        "code",
+			ClientID:            "zzZzz",
+			RedirectURI:         "https://app.test/callback",
+			CodeChallenge:       _challenge,
+			CodeChallengeMethod: "S256",
+		}
+	}
+
+	t.Run("All good", func(t *testing.T) {
+		assert.NoError(t, data().Validate())
+	})
+
+	t.Run("Plain challenge", func(t *testing.T) {
+		req := data()
+		req.CodeChallengeMethod = "plain"
+
+		assert.Error(t, req.Validate())
+	})
+
+	t.Run("Missing challenge", func(t *testing.T) {
+		req := data()
+		req.CodeChallenge = ""
+
+		assert.Error(t, req.Validate())
+	})
+
+	t.Run("Wrong response type", func(t *testing.T) {
+		req := data()
+		req.ResponseType = "token"
+
+		assert.Error(t, req.Validate())
+	})
+}
+
+func TestModel_AuthorizeRequest_RedirectWith(t *testing.T) {
+	req := &models.AuthorizeRequest{RedirectURI: "https://app.test/callback?tab=1", State: "xyz"}
+
+	u, err := url.Parse(req.RedirectWith(url.Values{"code": {"abc"}}))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "app.test", u.Host)
+		assert.Equal(t, url.Values{"tab": {"1"}, "code": {"abc"}, "state": {"xyz"}}, u.Query())
+	}
+}
+
+func TestModel_AuthorizationCode(t *testing.T) {
+	client := &models.AuthClient{ID: uuid.New()}
+	req := &models.AuthorizeRequest{RedirectURI: "https://app.test/callback", CodeChallenge: _challenge}
+
+	code := models.NewAuthorizationCode(client, uuid.New(), req, "users:read", time.Minute)
+
+	t.Run("New code", func(t *testing.T) {
+		assert.Len(t, code.Code, 48)
+		assert.Equal(t, client.ID, code.ClientID)
+		assert.False(t, code.Expired())
+	})
+
+	t.Run("Verifier", func(t *testing.T) {
+		assert.True(t, code.VerifyChallenge(_verifier))
+		assert.False(t, code.VerifyChallenge(_challenge))
+		assert.False(t, code.VerifyChallenge(""))
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		assert.True(t, models.NewAuthorizationCode(client, uuid.New(), req, "", -time.Second).Expired())
+	})
+}
+
+func TestModel_Consent(t *testing.T) {
+	consent := &models.Consent{Scope: "users:read"}
+
+	assert.True(t, consent.Covers(""))
+	assert.True(t, consent.Covers("users:read"))
+	assert.False(t, consent.Covers("users:read clients:read"))
+
+	consent.Add("clients:read users:read")
+
+	assert.Equal(t, "users:read clients:read", consent.Scope)
+	assert.True(t, consent.Covers("clients:read users:read"))
+}
@@ -2,8 +2,10 @@ package models
 
 import (
 	"errors"
+	"regexp"
 	"time"
 
+	"github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/google/uuid"
 )
 
@@ -21,6 +23,8 @@ type ClientQueryParams struct {
 	Role    string `query:"role"`
 	Status  *int   `query:"status"`
 	Query   string `query:"query"`
+	// OwnerID limits results to clients owned by the user, set by policy
+	OwnerID *uuid.UUID `query:"-"`
 }
 
 // Client model
@@ -31,6 +35,7 @@ type Client struct {
 	Status    int       `json:"status"`
 	OwnerID   uuid.UUID `json:"ownerId"    sql:",type:uuid"`
 	Owner     *Client   `json:"owner"`
+	TenantID  uuid.UUID `json:"tenantId"   sql:",type:uuid"`
 	CreatedAt time.Time `json:"createdAt"  sql:"default:now()"`
 	UpdatedAt time.Time `json:"updatedAt"  sql:"default:now()"`
 }
@@ -41,3 +46,61 @@ type CreateClient struct {
 	Email  string `json:"email"      sql:",unique,index"`
 	Status int    `json:"status"`
 }
+
+// Validate ...
+func (c *CreateClient) Validate() error {
+	return validation.ValidateStruct(c,
+		validation.Field(&c.Name, validation.Required),
+		validation.Field(&c.Email, validation.Required, validation.Match(regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$"))),
+		validation.Field(&c.Status, validation.In(
+			StatusInit,
+			StatusDraft,
+			StatusActive,
+			StatusDisabled,
+		)),
+	)
+}
+
+// ToClient ...
+func (c *CreateClient) ToClient(ownerID *uuid.UUID) *Client {
+	client := &Client{
+		ID:     uuid.New(),
+		Name:   c.Name,
+		Email:  c.Email,
+		Status: c.Status,
+	}
+
+	if ownerID != nil {
+		client.OwnerID = *ownerID
+	}
+
+	return client
+}
+
+// UpdateClient model
+type UpdateClient struct {
+	Name   string `json:"firstName"`
+	Email  string `json:"email"`
+	Status int    `json:"status"`
+}
+
+// Validate ...
+func (c *UpdateClient) Validate() error {
+	return validation.ValidateStruct(c,
+		validation.Field(&c.Name, validation.Required),
+		validation.Field(&c.Email, validation.Required, validation.Match(regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$"))),
+		validation.Field(&c.Status, validation.In(
+			StatusInit,
+			StatusDraft,
+			StatusActive,
+			StatusDisabled,
+		)),
+	)
+}
+
+// FromUpdate ...
+func (c *Client) FromUpdate(data *UpdateClient) {
+	c.Name = data.Name
+	c.Email = data.Email
+	c.Status = data.Status
+}
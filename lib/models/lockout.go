@@ -0,0 +1,76 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrTooManyLoginAttempts ...
+	ErrTooManyLoginAttempts = errors.New("too many failed login attempts, try again later")
+	// ErrLoginAttemptsNotFound ...
+	ErrLoginAttemptsNotFound = errors.New("login attempts not found")
+)
+
+// LoginThrottledError is returned while password logins of a user or client IP
+// are delayed by backoff or lockout
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+// Error ...
+func (e *LoginThrottledError) Error() string {
+	return ErrTooManyLoginAttempts.Error()
+}
+
+// LoginAttempts counts failed password logins of a user or client IP
+type LoginAttempts struct {
+	Key         string    `json:"key"`
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"lastFailure"`
+	LockedUntil time.Time `json:"lockedUntil"`
+}
+
+// UserAttemptsKey identifies failures of username, unknown usernames are
+// counted too so lockout doesn't tell which accounts exist
+func UserAttemptsKey(username string) string {
+	return "user:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+// IPAttemptsKey identifies failures of client IP
+func IPAttemptsKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Locked reports whether temporary lockout is in force
+func (a *LoginAttempts) Locked(now time.Time) bool {
+	return now.Before(a.LockedUntil)
+}
+
+// Wait returns time left until next attempt is allowed, backoff doubles with
+// every failure up to limit
+func (a *LoginAttempts) Wait(now time.Time, backoff time.Duration, limit time.Duration) time.Duration {
+	if a.Locked(now) {
+		return a.LockedUntil.Sub(now)
+	}
+
+	if a.Failures == 0 || backoff <= 0 {
+		return 0
+	}
+
+	delay := backoff
+	for i := 1; i < a.Failures && delay < limit; i++ {
+		delay *= 2
+	}
+
+	if delay > limit {
+		delay = limit
+	}
+
+	if wait := a.LastFailure.Add(delay).Sub(now); wait > 0 {
+		return wait
+	}
+
+	return 0
+}
@@ -0,0 +1,47 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/models"
+)
+
+func TestModel_Lockout_Keys(t *testing.T) {
+	assert.Equal(t, "user:peter@test.com", models.UserAttemptsKey(" Peter@Test.com "))
+	assert.Equal(t, "ip:10.0.0.1", models.IPAttemptsKey("10.0.0.1"))
+}
+
+func TestModel_Lockout_Wait(t *testing.T) {
+	now := time.Now()
+
+	t.Run("No failures", func(t *testing.T) {
+		a := models.LoginAttempts{}
+		assert.Zero(t, a.Wait(now, time.Second, time.Minute))
+	})
+
+	t.Run("Backoff doubles up to limit", func(t *testing.T) {
+		for failures, expected := range map[int]time.Duration{
+			1:  time.Second,
+			2:  2 * time.Second,
+			3:  4 * time.Second,
+			10: time.Minute,
+		} {
+			a := models.LoginAttempts{Failures: failures, LastFailure: now}
+			assert.Equal(t, expected, a.Wait(now, time.Second, time.Minute), "failures %d", failures)
+		}
+	})
+
+	t.Run("Backoff is over", func(t *testing.T) {
+		a := models.LoginAttempts{Failures: 2, LastFailure: now.Add(-3 * time.Second)}
+		assert.Zero(t, a.Wait(now, time.Second, time.Minute))
+	})
+
+	t.Run("Locked", func(t *testing.T) {
+		a := models.LoginAttempts{Failures: 5, LastFailure: now, LockedUntil: now.Add(10 * time.Minute)}
+		assert.True(t, a.Locked(now))
+		assert.Equal(t, 10*time.Minute, a.Wait(now, 0, time.Minute))
+	})
+}
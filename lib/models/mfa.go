@@ -0,0 +1,290 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidMFACode ...
+	ErrInvalidMFACode = errors.New("invalid MFA code")
+	// ErrInvalidMFAToken ...
+	ErrInvalidMFAToken = errors.New("MFA token is invalid or expired")
+	// ErrMFAAlreadyEnabled ...
+	ErrMFAAlreadyEnabled = errors.New("MFA already enabled")
+	// ErrMFANotEnabled ...
+	ErrMFANotEnabled = errors.New("MFA not enabled")
+	// ErrMFANotEnrolled ...
+	ErrMFANotEnrolled = errors.New("MFA enrollment was not started")
+	// ErrMFARequiredByRole ...
+	ErrMFARequiredByRole = errors.New("MFA is required for the role")
+)
+
+const (
+	// TOTPPeriod is time step of codes in seconds (RFC 6238)
+	TOTPPeriod = 30
+	// TOTPDigits ...
+	TOTPDigits = 6
+	// RecoveryCodeCount is number of recovery codes issued at once
+	RecoveryCodeCount = 10
+	// MFATokenLifetime limits time between password and second factor
+	MFATokenLifetime = 5 * time.Minute
+
+	// totpSkew is number of steps accepted on either side of current one
+	totpSkew = 1
+)
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// MFAChallenge is returned by password grant instead of tokens when the user
+// has to pass second factor, client completes login with mfa grant
+type MFAChallenge struct {
+	Token string `json:"mfa_token"`
+	// EnrollmentRequired is set when role requires MFA the user has not set up
+	EnrollmentRequired bool `json:"enrollment_required,omitempty"`
+}
+
+// Error ...
+func (c *MFAChallenge) Error() string {
+	return "mfa required"
+}
+
+// MFAEnrollment is TOTP secret of pending enrollment, URI is shown as QR code
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// MFACode is TOTP or recovery code submitted by the user
+type MFACode struct {
+	Code string `json:"code" form:"code"`
+}
+
+// Validate ...
+func (u *MFACode) Validate() error {
+	return validation.ValidateStruct(u,
+		validation.Field(&u.Code, validation.Required),
+	)
+}
+
+// MFAEnrollRequest starts enrollment of user who can't sign in until MFA is
+// set up, client credentials may come in Basic auth instead
+type MFAEnrollRequest struct {
+	MFAToken     string `json:"mfa_token"     form:"mfa_token"`
+	ClientID     string `json:"client_id"     form:"client_id"`
+	ClientSecret string `json:"client_secret" form:"client_secret"`
+}
+
+// Validate ...
+func (u *MFAEnrollRequest) Validate() error {
+	return validation.ValidateStruct(u,
+		validation.Field(&u.MFAToken, validation.Required),
+	)
+}
+
+// RecoveryCodes are shown once, only their hashes are stored
+type RecoveryCodes struct {
+	Codes []string `json:"recoveryCodes"`
+}
+
+// NewTOTPSecret returns random base32 encoded 160 bit secret
+func NewTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base32NoPadding.EncodeToString(b), nil
+}
+
+// TOTPStep returns time step of t
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / TOTPPeriod
+}
+
+// TOTPCode returns code of secret for time step
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := base32NoPadding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", err
+	}
+
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	// dynamic truncation (RFC 4226)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%06d", value%1000000), nil
+}
+
+// TOTPURI returns otpauth URI understood by authenticator apps
+func TOTPURI(issuer string, account string, secret string) string {
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(TOTPDigits))
+	q.Set("period", fmt.Sprint(TOTPPeriod))
+
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + q.Encode()
+}
+
+// VerifyTOTP checks code against user secret, every time step is accepted once
+func (u *User) VerifyTOTP(code string, now time.Time) bool {
+	if u.MFASecret == "" || len(code) != TOTPDigits {
+		return false
+	}
+
+	current := TOTPStep(now)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= u.MFALastStep {
+			continue
+		}
+
+		expected, err := TOTPCode(u.MFASecret, step)
+		if err != nil {
+			return false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			u.MFALastStep = step
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// GenerateRecoveryCodes replaces recovery codes and returns them in plain text
+func (u *User) GenerateRecoveryCodes() ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+
+		code := strings.ToLower(base32NoPadding.EncodeToString(b))[:10]
+
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashRecoveryCode(code)
+	}
+
+	u.MFARecoveryCodes = hashes
+
+	return codes, nil
+}
+
+// UseRecoveryCode removes matching recovery code, so it works only once
+func (u *User) UseRecoveryCode(code string) bool {
+	hash := hashRecoveryCode(code)
+
+	for i, stored := range u.MFARecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+			u.MFARecoveryCodes = append(u.MFARecoveryCodes[:i:i], u.MFARecoveryCodes[i+1:]...)
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// VerifyMFA accepts TOTP or recovery code of enabled MFA
+func (u *User) VerifyMFA(code string, now time.Time) bool {
+	if !u.MFAEnabled {
+		return false
+	}
+
+	return u.VerifyTOTP(code, now) || u.UseRecoveryCode(code)
+}
+
+// ResetMFA drops secret and recovery codes
+func (u *User) ResetMFA() {
+	u.MFASecret = ""
+	u.MFAEnabled = false
+	u.MFARecoveryCodes = nil
+	u.MFALastStep = 0
+}
+
+// hashRecoveryCode ignores case and separators the code is displayed with
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// MFAClaims are claims of token issued between password and second factor
+type MFAClaims struct {
+	UserID   uuid.UUID
+	ClientID uuid.UUID
+	Scope    string
+}
+
+// NewMFAToken signs token proving the password was checked, it carries no uid
+// nor cid claims so it is never accepted as access token
+func NewMFAToken(client *AuthClient, user *User, scope string, keys TokenKeys) (string, error) {
+	claims := make(jwt.MapClaims)
+	claims["jti"] = uuid.New()
+	claims["typ"] = "mfa"
+	claims["sub"] = user.ID
+	claims["azp"] = client.ID
+	claims["exp"] = time.Now().UTC().Add(MFATokenLifetime).Unix()
+	claims["iat"] = time.Now().UTC().Unix()
+
+	if scope != "" {
+		claims["scope"] = scope
+	}
+
+	return keys.Sign(claims)
+}
+
+// ParseMFAToken verifies signature, expiry and type of MFA token
+func ParseMFAToken(token string, keys TokenKeys) (*MFAClaims, error) {
+	parsed, err := jwt.Parse(token, keys.Keyfunc)
+	if err != nil || !parsed.Valid {
+		return nil, ErrInvalidMFAToken
+	}
+
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok || claimString(claims, "typ") != "mfa" {
+		return nil, ErrInvalidMFAToken
+	}
+
+	out := &MFAClaims{Scope: claimString(claims, "scope")}
+
+	if out.UserID, err = uuid.Parse(claimString(claims, "sub")); err != nil {
+		return nil, ErrInvalidMFAToken
+	}
+
+	if out.ClientID, err = uuid.Parse(claimString(claims, "azp")); err != nil {
+		return nil, ErrInvalidMFAToken
+	}
+
+	return out, nil
+}
@@ -0,0 +1,139 @@
+package models_test
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/models"
+)
+
+// RFC 6238 test secret for SHA1
+var _totpSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestModel_MFA_TOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, last six digits
+	for at, expected := range map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	} {
+		code, err := models.TOTPCode(_totpSecret, models.TOTPStep(time.Unix(at, 0)))
+		if assert.NoError(t, err) {
+			assert.Equal(t, expected, code, "time %d", at)
+		}
+	}
+
+	_, err := models.TOTPCode("not base32!", 1)
+	assert.Error(t, err)
+}
+
+func TestModel_MFA_NewTOTPSecret(t *testing.T) {
+	secret, err := models.NewTOTPSecret()
+	if assert.NoError(t, err) {
+		assert.Len(t, secret, 32)
+		assert.NotContains(t, secret, "=")
+	}
+
+	uri := models.TOTPURI("GOBS", "peter@test.com", secret)
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/GOBS:peter@test.com?"), uri)
+	assert.Contains(t, uri, "secret="+secret)
+	assert.Contains(t, uri, "issuer=GOBS")
+}
+
+func TestModel_MFA_VerifyTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	t.Run("Skew of one step", func(t *testing.T) {
+		user := &models.User{MFASecret: _totpSecret}
+
+		previous, _ := models.TOTPCode(_totpSecret, models.TOTPStep(now)-1)
+		assert.True(t, user.VerifyTOTP(previous, now))
+
+		stale, _ := models.TOTPCode(_totpSecret, models.TOTPStep(now)-2)
+		assert.False(t, user.VerifyTOTP(stale, now))
+	})
+
+	t.Run("Code is not replayed", func(t *testing.T) {
+		user := &models.User{MFASecret: _totpSecret}
+
+		assert.True(t, user.VerifyTOTP("050471", now))
+		assert.False(t, user.VerifyTOTP("050471", now))
+
+		previous, _ := models.TOTPCode(_totpSecret, models.TOTPStep(now)-1)
+		assert.False(t, user.VerifyTOTP(previous, now), "older step after newer one")
+	})
+
+	t.Run("No secret", func(t *testing.T) {
+		assert.False(t, (&models.User{}).VerifyTOTP("050471", now))
+	})
+
+	t.Run("MFA disabled", func(t *testing.T) {
+		assert.False(t, (&models.User{MFASecret: _totpSecret}).VerifyMFA("050471", now))
+	})
+}
+
+func TestModel_MFA_RecoveryCodes(t *testing.T) {
+	user := &models.User{MFAEnabled: true}
+
+	codes, err := user.GenerateRecoveryCodes()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Len(t, codes, models.RecoveryCodeCount)
+	assert.NotContains(t, user.MFARecoveryCodes, codes[0], "only hashes are stored")
+
+	assert.True(t, user.VerifyMFA(strings.ToUpper(strings.Replace(codes[0], "-", "", 1)), time.Now()), "case and separator are ignored")
+	assert.False(t, user.UseRecoveryCode(codes[0]), "code works once")
+	assert.Len(t, user.MFARecoveryCodes, models.RecoveryCodeCount-1)
+
+	user.ResetMFA()
+	assert.False(t, user.UseRecoveryCode(codes[1]))
+	assert.Empty(t, user.MFASecret)
+}
+
+func TestModel_MFA_Token(t *testing.T) {
+	keys := models.HMACKeys("secret")
+	client := &models.AuthClient{ID: uuid.New()}
+	user := &models.User{ID: uuid.New(), Role: models.RoleUser}
+
+	token, err := models.NewMFAToken(client, user, "openid", keys)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	claims, err := models.ParseMFAToken(token, keys)
+	if assert.NoError(t, err) {
+		assert.Equal(t, user.ID, claims.UserID)
+		assert.Equal(t, client.ID, claims.ClientID)
+		assert.Equal(t, "openid", claims.Scope)
+	}
+
+	t.Run("Not an access token", func(t *testing.T) {
+		_, err := models.ParseAccessToken(token, keys)
+		assert.Equal(t, models.ErrInvalidAccessToken, err)
+	})
+
+	t.Run("Access token", func(t *testing.T) {
+		access, _ := models.NewAccessToken(client, user, "", 0, 60, keys)
+
+		_, err := models.ParseMFAToken(access.Token, keys)
+		assert.Equal(t, models.ErrInvalidMFAToken, err)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		expired, _ := keys.Sign(jwt.MapClaims{"typ": "mfa", "sub": user.ID, "azp": client.ID, "exp": time.Now().Add(-time.Minute).Unix()})
+
+		_, err := models.ParseMFAToken(expired, keys)
+		assert.Equal(t, models.ErrInvalidMFAToken, err)
+	})
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	// ScopeOpenID requests ID token and access to /userinfo
+	ScopeOpenID = "openid"
+	// ScopeProfile releases name claims
+	ScopeProfile = "profile"
+	// ScopeEmail releases email and email_verified claims
+	ScopeEmail = "email"
+)
+
+// IdentityScopes of OpenID Connect, any client may ask for them on behalf of a user
+var IdentityScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail}
+
+// HasScope reports whether space separated scope contains s
+func HasScope(scope string, s string) bool {
+	return hasScope(strings.Fields(scope), s)
+}
+
+// UserInfo holds standard claims of the user released by granted scope
+type UserInfo struct {
+	Subject       string `json:"sub"`
+	Name          string `json:"name,omitempty"`
+	GivenName     string `json:"given_name,omitempty"`
+	FamilyName    string `json:"family_name,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+}
+
+// NewUserInfo returns claims of user, profile and email claims are only
+// included when scope has them
+func NewUserInfo(user *User, scope string) *UserInfo {
+	info := &UserInfo{Subject: user.ID.String()}
+
+	if HasScope(scope, ScopeProfile) {
+		info.GivenName = user.FirstName
+		info.FamilyName = user.LastName
+		info.Name = strings.TrimSpace(user.FirstName + " " + user.LastName)
+	}
+
+	if HasScope(scope, ScopeEmail) {
+		verified := user.Verified
+
+		info.Email = user.Email
+		info.EmailVerified = &verified
+	}
+
+	return info
+}
+
+// claims adds user info to token claims
+func (u *UserInfo) claims(claims jwt.MapClaims) {
+	claims["sub"] = u.Subject
+
+	for k, v := range map[string]string{"name": u.Name, "given_name": u.GivenName, "family_name": u.FamilyName, "email": u.Email} {
+		if v != "" {
+			claims[k] = v
+		}
+	}
+
+	if u.EmailVerified != nil {
+		claims["email_verified"] = *u.EmailVerified
+	}
+}
+
+// NewIDToken issues OpenID Connect ID token of user for the client, audience
+// is client_id and nonce of authorization request is echoed when set.
+// auth_time is left out when authTime is unknown.
+func NewIDToken(issuer string, client *AuthClient, user *User, scope string, nonce string, authTime int64, expiresIn int, keys TokenKeys) (string, error) {
+	now := time.Now().UTC()
+
+	claims := make(jwt.MapClaims)
+	claims["iss"] = issuer
+	claims["aud"] = client.ClientID
+	claims["exp"] = now.Add(time.Duration(expiresIn) * time.Second).Unix()
+	claims["iat"] = now.Unix()
+
+	if authTime > 0 {
+		claims["auth_time"] = authTime
+	}
+
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+
+	NewUserInfo(user, scope).claims(claims)
+
+	return keys.Sign(claims)
+}
+
+// OpenIDConfiguration is the discovery document (OpenID Connect Discovery 1.0)
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint,omitempty"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// NewOpenIDConfiguration describes endpoints served under issuer, API routes
+// are mounted at /api. Authorization endpoint is sign-in page of the UI, not
+// served here, /api/auth/authorize is called by the UI for the signed in user.
+func NewOpenIDConfiguration(issuer string, authorizationEndpoint string, algorithm string) *OpenIDConfiguration {
+	issuer = strings.TrimSuffix(issuer, "/")
+
+	return &OpenIDConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             authorizationEndpoint,
+		TokenEndpoint:                     issuer + "/api/auth/token",
+		UserInfoEndpoint:                  issuer + "/api/auth/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		RevocationEndpoint:                issuer + "/api/auth/revoke",
+		IntrospectionEndpoint:             issuer + "/api/auth/introspect",
+		ScopesSupported:                   IdentityScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token", "password", "client_credentials"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{algorithm},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "name", "given_name", "family_name", "email", "email_verified"},
+	}
+}
@@ -0,0 +1,82 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/models"
+)
+
+func _oidcUser() *models.User {
+	return &models.User{
+		ID:        uuid.MustParse("775a5b37-1742-4e54-9439-0357e768b011"),
+		FirstName: "Apple",
+		LastName:  "Appleton",
+		Email:     "peter@test.com",
+	}
+}
+
+func TestModel_OIDC_NewUserInfo(t *testing.T) {
+	t.Run("Subject only", func(t *testing.T) {
+		info := models.NewUserInfo(_oidcUser(), "openid")
+
+		assert.Equal(t, &models.UserInfo{Subject: "775a5b37-1742-4e54-9439-0357e768b011"}, info)
+	})
+
+	t.Run("Profile and email", func(t *testing.T) {
+		info := models.NewUserInfo(_oidcUser(), "openid profile email")
+
+		assert.Equal(t, "Apple Appleton", info.Name)
+		assert.Equal(t, "Apple", info.GivenName)
+		assert.Equal(t, "Appleton", info.FamilyName)
+		assert.Equal(t, "peter@test.com", info.Email)
+		if assert.NotNil(t, info.EmailVerified) {
+			assert.False(t, *info.EmailVerified, "unverified is reported too")
+		}
+	})
+}
+
+func TestModel_OIDC_NewIDToken(t *testing.T) {
+	client := &models.AuthClient{ClientID: "zzZzz"}
+	keys := models.HMACKeys("secret")
+
+	token, err := models.NewIDToken("https://id.test", client, _oidcUser(), "openid email", "n-0S6_WzA2Mj", 1600000000, 60, keys)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	parsed, err := jwt.Parse(token, keys.Keyfunc)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	claims := parsed.Claims.(jwt.MapClaims)
+	assert.Equal(t, "https://id.test", claims["iss"])
+	assert.Equal(t, "zzZzz", claims["aud"])
+	assert.Equal(t, "775a5b37-1742-4e54-9439-0357e768b011", claims["sub"])
+	assert.Equal(t, "n-0S6_WzA2Mj", claims["nonce"])
+	assert.Equal(t, float64(1600000000), claims["auth_time"])
+	assert.Equal(t, "peter@test.com", claims["email"])
+	assert.Equal(t, false, claims["email_verified"])
+	assert.NotContains(t, claims, "given_name", "profile scope was not granted")
+}
+
+func TestModel_OIDC_NewOpenIDConfiguration(t *testing.T) {
+	cfg := models.NewOpenIDConfiguration("https://id.test/", "https://app.test/authorize", models.AlgorithmRS256)
+
+	assert.Equal(t, "https://id.test", cfg.Issuer)
+	assert.Equal(t, "https://app.test/authorize", cfg.AuthorizationEndpoint)
+	assert.Equal(t, "https://id.test/api/auth/token", cfg.TokenEndpoint)
+	assert.Equal(t, "https://id.test/.well-known/jwks.json", cfg.JWKSURI)
+	assert.Equal(t, []string{models.AlgorithmRS256}, cfg.IDTokenSigningAlgValuesSupported)
+	assert.Contains(t, cfg.ScopesSupported, models.ScopeOpenID)
+}
+
+func TestModel_OIDC_HasScope(t *testing.T) {
+	assert.True(t, models.HasScope("openid  email", "email"))
+	assert.False(t, models.HasScope("openid", "email"))
+	assert.False(t, models.HasScope("", "openid"))
+}
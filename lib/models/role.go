@@ -0,0 +1,143 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrPermissionDenied ...
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrRoleNotFound ...
+	ErrRoleNotFound = errors.New("role not found")
+	// ErrRoleNotEditable ...
+	ErrRoleNotEditable = errors.New("super user role cannot be changed")
+	// ErrUnknownPermission ...
+	ErrUnknownPermission = errors.New("unknown permission")
+)
+
+const (
+	// PermUsersView ...
+	PermUsersView = "users.view"
+	// PermUsersCreate ...
+	PermUsersCreate = "users.create"
+	// PermUsersUpdate ...
+	PermUsersUpdate = "users.update"
+	// PermUsersDelete ...
+	PermUsersDelete = "users.delete"
+	// PermClientsView ...
+	PermClientsView = "clients.view"
+	// PermClientsCreate ...
+	PermClientsCreate = "clients.create"
+	// PermClientsUpdate ...
+	PermClientsUpdate = "clients.update"
+	// PermClientsDelete ...
+	PermClientsDelete = "clients.delete"
+	// PermRolesAssign allows giving users a role other than RoleUser
+	PermRolesAssign = "roles.assign"
+	// PermRolesManage allows editing role definitions
+	PermRolesManage = "roles.manage"
+	// PermAuthClientsManage allows changing scopes of auth clients
+	PermAuthClientsManage = "auth_clients.manage"
+
+	// OwnSuffix limits permission to resources whose OwnerID is the user,
+	// such as "users.update:own"
+	OwnSuffix = ":own"
+)
+
+// Permissions known to the policy, each may be granted with OwnSuffix too
+var Permissions = []string{
+	PermUsersView, PermUsersCreate, PermUsersUpdate, PermUsersDelete,
+	PermClientsView, PermClientsCreate, PermClientsUpdate, PermClientsDelete,
+	PermRolesAssign, PermRolesManage, PermAuthClientsManage,
+}
+
+// Access is what a role may do with a permission
+type Access int
+
+const (
+	// AccessNone ...
+	AccessNone Access = iota
+	// AccessOwn is limited to resources the user owns
+	AccessOwn
+	// AccessAll ...
+	AccessAll
+)
+
+// Actor is the signed in user a permission is checked for
+type Actor struct {
+	ID   uuid.UUID
+	Role string
+}
+
+// Role maps role name to granted permissions
+type Role struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+	// MFARequired users of the role can't sign in without second factor
+	MFARequired bool      `json:"mfaRequired"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// DefaultRoles are used until a super user changes them
+func DefaultRoles() []Role {
+	return []Role{
+		{Name: RoleSuperUser, Permissions: append([]string(nil), Permissions...)},
+		{Name: RoleAdmin, Permissions: []string{
+			PermUsersView, PermUsersCreate, PermUsersUpdate, PermUsersDelete,
+			PermClientsView, PermClientsCreate, PermClientsUpdate, PermClientsDelete,
+			PermRolesAssign,
+		}},
+		{Name: RoleManager, Permissions: []string{
+			PermUsersView + OwnSuffix, PermUsersCreate, PermUsersUpdate + OwnSuffix, PermUsersDelete + OwnSuffix,
+			PermClientsView + OwnSuffix, PermClientsUpdate + OwnSuffix,
+		}},
+		{Name: RoleClient, Permissions: []string{
+			PermClientsView + OwnSuffix, PermClientsUpdate + OwnSuffix,
+		}},
+		{Name: RoleUser, Permissions: []string{}},
+	}
+}
+
+// Access returns what the role may do with permission
+func (r *Role) Access(permission string) Access {
+	if hasScope(r.Permissions, permission) {
+		return AccessAll
+	}
+
+	if hasScope(r.Permissions, permission+OwnSuffix) {
+		return AccessOwn
+	}
+
+	return AccessNone
+}
+
+// Validate ...
+func (r *Role) Validate() error {
+	return validation.ValidateStruct(r,
+		validation.Field(&r.Name, validation.Required, validation.In(RoleSuperUser, RoleAdmin, RoleManager, RoleClient, RoleUser)),
+		validation.Field(&r.Permissions, validation.By(func(value interface{}) error {
+			for _, p := range value.([]string) {
+				if !hasScope(Permissions, strings.TrimSuffix(p, OwnSuffix)) {
+					return ErrUnknownPermission
+				}
+			}
+
+			return nil
+		})),
+	)
+}
+
+// UpdateRole is a request to replace permissions of a role
+type UpdateRole struct {
+	Permissions []string `json:"permissions"`
+}
+
+// RoleMFA is a request to enforce MFA for users of a role
+type RoleMFA struct {
+	Required bool `json:"required"`
+}
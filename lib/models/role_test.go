@@ -0,0 +1,45 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/models"
+)
+
+func TestModel_Role_Access(t *testing.T) {
+	role := &models.Role{Name: models.RoleManager, Permissions: []string{models.PermUsersView, models.PermUsersUpdate + models.OwnSuffix}}
+
+	assert.Equal(t, models.AccessAll, role.Access(models.PermUsersView))
+	assert.Equal(t, models.AccessOwn, role.Access(models.PermUsersUpdate))
+	assert.Equal(t, models.AccessNone, role.Access(models.PermUsersDelete))
+}
+
+func TestModel_Role_Validate(t *testing.T) {
+	t.Run("Defaults are valid", func(t *testing.T) {
+		for _, role := range models.DefaultRoles() {
+			assert.NoError(t, role.Validate(), role.Name)
+		}
+	})
+
+	t.Run("Unknown role", func(t *testing.T) {
+		role := &models.Role{Name: "guest"}
+		assert.Error(t, role.Validate())
+	})
+
+	t.Run("Unknown permission", func(t *testing.T) {
+		role := &models.Role{Name: models.RoleUser, Permissions: []string{"users.fly:own"}}
+		assert.Error(t, role.Validate())
+	})
+}
+
+func TestModel_Role_DefaultRoles(t *testing.T) {
+	for _, role := range models.DefaultRoles() {
+		if role.Name == models.RoleSuperUser {
+			for _, p := range models.Permissions {
+				assert.Equal(t, models.AccessAll, role.Access(p), p)
+			}
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package models
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/labstack/gommon/random"
+)
+
+const (
+	// AlgorithmRS256 ...
+	AlgorithmRS256 = "RS256"
+	// AlgorithmEdDSA signs with Ed25519
+	AlgorithmEdDSA = "EdDSA"
+	// AlgorithmHS256 signs with shared AUTH_SECRET_KEY, no keys are published
+	AlgorithmHS256 = "HS256"
+)
+
+var (
+	// ErrSigningKeyNotFound ...
+	ErrSigningKeyNotFound = errors.New("signing key not found")
+	// ErrUnsupportedAlgorithm ...
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+)
+
+// SigningKey is an asymmetric key signing access tokens, after rotation the
+// key is retired and only verifies tokens until ExpiresAt
+type SigningKey struct {
+	ID         string    `json:"kid"`
+	Algorithm  string    `json:"alg"`
+	PrivateKey []byte    `json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+	RetiredAt  time.Time `json:"retired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// NewSigningKey generates key for algorithm, private key is kept PKCS #8 encoded
+func NewSigningKey(algorithm string) (*SigningKey, error) {
+	var (
+		private interface{}
+		err     error
+	)
+
+	switch algorithm {
+	case AlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		ID:         random.String(16, random.Alphanumeric),
+		Algorithm:  algorithm,
+		PrivateKey: der,
+		CreatedAt:  time.Now().UTC(),
+	}, nil
+}
+
+// Active reports whether the key signs new tokens
+func (k *SigningKey) Active() bool {
+	return k.RetiredAt.IsZero()
+}
+
+// Expired reports whether retired key no longer verifies tokens
+func (k *SigningKey) Expired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && now.After(k.ExpiresAt)
+}
+
+// Signer ...
+func (k *SigningKey) Signer() (crypto.Signer, error) {
+	private, err := x509.ParsePKCS8PrivateKey(k.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	return signer, nil
+}
+
+// JWK describes public part of the key (RFC 7517)
+func (k *SigningKey) JWK() (*JWK, error) {
+	signer, err := k.Signer()
+	if err != nil {
+		return nil, err
+	}
+
+	jwk := &JWK{Use: "sig", Alg: k.Algorithm, Kid: k.ID}
+
+	switch public := signer.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	return jwk, nil
+}
+
+// JWK is a public JSON Web Key
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
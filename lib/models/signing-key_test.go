@@ -0,0 +1,78 @@
+package models_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/models"
+)
+
+func TestModel_SigningKey_NewSigningKey(t *testing.T) {
+	t.Run("RS256", func(t *testing.T) {
+		key, err := models.NewSigningKey(models.AlgorithmRS256)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.Len(t, key.ID, 16)
+		assert.True(t, key.Active())
+
+		signer, err := key.Signer()
+		if assert.NoError(t, err) {
+			assert.IsType(t, &rsa.PublicKey{}, signer.Public())
+		}
+
+		jwk, err := key.JWK()
+		if assert.NoError(t, err) {
+			assert.Equal(t, "RSA", jwk.Kty)
+			assert.Equal(t, "sig", jwk.Use)
+			assert.Equal(t, key.ID, jwk.Kid)
+			assert.Equal(t, "AQAB", jwk.E)
+			assert.NotEmpty(t, jwk.N)
+		}
+	})
+
+	t.Run("EdDSA", func(t *testing.T) {
+		key, err := models.NewSigningKey(models.AlgorithmEdDSA)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		signer, err := key.Signer()
+		if assert.NoError(t, err) {
+			assert.IsType(t, ed25519.PublicKey{}, signer.Public())
+		}
+
+		jwk, err := key.JWK()
+		if assert.NoError(t, err) {
+			assert.Equal(t, "OKP", jwk.Kty)
+			assert.Equal(t, "Ed25519", jwk.Crv)
+			assert.Equal(t, models.AlgorithmEdDSA, jwk.Alg)
+			assert.Len(t, jwk.X, 43, "32 bytes base64url encoded")
+		}
+	})
+
+	t.Run("Unsupported algorithm", func(t *testing.T) {
+		_, err := models.NewSigningKey(models.AlgorithmHS256)
+
+		assert.Equal(t, models.ErrUnsupportedAlgorithm, err)
+	})
+}
+
+func TestModel_SigningKey_Expired(t *testing.T) {
+	now := time.Now().UTC()
+	key := &models.SigningKey{}
+
+	assert.False(t, key.Expired(now), "active key never expires")
+
+	key.RetiredAt = now
+	key.ExpiresAt = now.Add(time.Minute)
+
+	assert.False(t, key.Active())
+	assert.False(t, key.Expired(now))
+	assert.True(t, key.Expired(now.Add(2*time.Minute)))
+}
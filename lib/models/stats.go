@@ -6,4 +6,14 @@ type Stats struct {
 	Uptime       time.Time      `json:"uptime"`
 	RequestCount uint64         `json:"requestCount"`
 	Statuses     map[string]int `json:"statuses"`
+	Cache        *CacheStats    `json:"cache,omitempty"`
+}
+
+// CacheStats counts lookups of caches kept in the process
+type CacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Entries   int    `json:"entries"`
+	Bytes     int64  `json:"bytes"`
 }
@@ -2,9 +2,10 @@ package models
 
 import (
 	"errors"
+	"strings"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/golang-jwt/jwt"
 	"github.com/google/uuid"
 )
 
@@ -17,6 +18,8 @@ var (
 	ErrRefreshTokenExpired = errors.New("refresh token expired")
 	// ErrTokenNotFound ...
 	ErrTokenNotFound = errors.New("token not found")
+	// ErrInvalidAccessToken ...
+	ErrInvalidAccessToken = errors.New("access token is invalid or expired")
 )
 
 // Token ...
@@ -28,12 +31,53 @@ type Token struct {
 	User      *User       `json:"-"`
 	Token     string      `json:"token"`
 	ExpiresAt int64       `json:"expires_at"`
+	// Scope granted at login, refresh tokens never get more
+	Scope string `json:"scope"`
+	// AuthTime is unix time the user signed in with credentials, tokens got
+	// by refresh keep it, 0 when unknown
+	AuthTime int64 `json:"auth_time,omitempty"`
+}
+
+// GrantScope returns scope for a token issued with refresh token, requested
+// scope must be a subset of Scope, empty request gets all of it
+func (t *Token) GrantScope(requested string) (string, error) {
+	return grantScope(strings.Fields(t.Scope), requested)
+}
+
+// TokenKeys sign access tokens and resolve keys verifying them
+type TokenKeys interface {
+	Sign(claims jwt.MapClaims) (string, error)
+	Keyfunc(token *jwt.Token) (interface{}, error)
+	// Algorithm of new tokens
+	Algorithm() string
+}
+
+// HMACKeys sign with shared secret, tokens carry no kid
+type HMACKeys []byte
+
+// Sign ...
+func (k HMACKeys) Sign(claims jwt.MapClaims) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(k))
+}
+
+// Algorithm ...
+func (k HMACKeys) Algorithm() string {
+	return AlgorithmHS256
+}
+
+// Keyfunc ...
+func (k HMACKeys) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if token.Method != jwt.SigningMethodHS256 {
+		return nil, ErrInvalidAccessToken
+	}
+
+	return []byte(k), nil
 }
 
 // NewTokenResponse ...
 func NewTokenResponse(accessToken *Token, refreshToken *Token, lifetime int, theTokenType string) (*TokenResponse, error) {
 	response := &TokenResponse{
-		UserID:      accessToken.UserID,
+		UserID:      &accessToken.UserID,
 		User:        accessToken.User,
 		AccessToken: accessToken.Token,
 		ExpiresIn:   lifetime,
@@ -48,40 +92,90 @@ func NewTokenResponse(accessToken *Token, refreshToken *Token, lifetime int, the
 	return response, nil
 }
 
-// NewAccessToken creates new OauthAccessToken instance
-func NewAccessToken(client *AuthClient, user *User, expiresIn int, jwtSecret []byte) (*Token, error) {
-	token := jwt.New(jwt.SigningMethodHS256)
+// NewAccessToken creates new OauthAccessToken instance of user signed in at
+// authTime
+func NewAccessToken(client *AuthClient, user *User, scope string, authTime int64, expiresIn int, keys TokenKeys) (*Token, error) {
+	id := uuid.New()
 
 	claims := make(jwt.MapClaims)
+	claims["jti"] = id
 	claims["uid"] = user.ID
+	claims["cid"] = client.ID
+	claims["client_id"] = client.ClientID
 	claims["exp"] = time.Now().UTC().Add(time.Duration(expiresIn) * time.Second).Unix()
 	claims["iat"] = time.Now().UTC().Unix()
 	claims["auth"] = user.Role
+	claims["tid"] = user.TenantID
 	//	claims["iss"]     = "issuer"
 	//	claims["sub"]     = "issuer"
 
-	token.Claims = claims
+	if scope != "" {
+		claims["scope"] = scope
+	}
+
+	if authTime > 0 {
+		claims["auth_time"] = authTime
+	}
 
-	t, err := token.SignedString(jwtSecret)
+	t, err := keys.Sign(claims)
 	if err != nil {
 		return nil, err
 	}
 
 	accessToken := &Token{
+		ID:        id,
 		ClientID:  client.ID,
+		Client:    client,
 		Token:     t,
 		ExpiresAt: time.Now().UTC().Add(time.Duration(expiresIn) * time.Second).Unix(),
 		UserID:    user.ID,
 		User:      user,
+		AuthTime:  authTime,
 	}
 
 	return accessToken, nil
 }
 
-// NewRefreshToken creates new Token instance
-func NewRefreshToken(client *AuthClient, user *User, expiresIn int) *Token {
+// NewClientAccessToken creates access token whose subject is the client itself,
+// it has no user and carries client role and granted scope
+func NewClientAccessToken(client *AuthClient, scope string, expiresIn int, keys TokenKeys) (*Token, error) {
+	id := uuid.New()
+
+	claims := make(jwt.MapClaims)
+	claims["jti"] = id
+	claims["sub"] = client.ClientID
+	claims["cid"] = client.ID
+	claims["client_id"] = client.ClientID
+	claims["exp"] = time.Now().UTC().Add(time.Duration(expiresIn) * time.Second).Unix()
+	claims["iat"] = time.Now().UTC().Unix()
+	claims["auth"] = client.Role
+
+	if scope != "" {
+		claims["scope"] = scope
+	}
+
+	t, err := keys.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken := &Token{
+		ID:        id,
+		ClientID:  client.ID,
+		Client:    client,
+		Token:     t,
+		ExpiresAt: time.Now().UTC().Add(time.Duration(expiresIn) * time.Second).Unix(),
+	}
+
+	return accessToken, nil
+}
+
+// NewRefreshToken creates new Token instance of user signed in at authTime
+func NewRefreshToken(client *AuthClient, user *User, scope string, authTime int64, expiresIn int) *Token {
 	refreshToken := &Token{
 		ClientID:  client.ID,
+		Scope:     scope,
+		AuthTime:  authTime,
 		Token:     uuid.New().String(),
 		ExpiresAt: time.Now().UTC().Add(time.Duration(expiresIn) * time.Second).Unix(),
 		UserID:    user.ID,
@@ -90,3 +184,71 @@ func NewRefreshToken(client *AuthClient, user *User, expiresIn int) *Token {
 
 	return refreshToken
 }
+
+// AccessClaims are claims of access token issued by auth service
+type AccessClaims struct {
+	ID       uuid.UUID
+	UserID   *uuid.UUID
+	ClientID uuid.UUID
+	// Client is public client_id of ClientID
+	Client    string
+	Role      string
+	Scope     string
+	ExpiresAt int64
+	IssuedAt  int64
+	// AuthTime is when the user signed in, 0 for clients and older tokens
+	AuthTime int64
+}
+
+// ParseAccessToken verifies signature and expiry of access token
+func ParseAccessToken(token string, keys TokenKeys) (*AccessClaims, error) {
+	parsed, err := jwt.Parse(token, keys.Keyfunc)
+	if err != nil || !parsed.Valid {
+		return nil, ErrInvalidAccessToken
+	}
+
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidAccessToken
+	}
+
+	out := new(AccessClaims)
+
+	// tokens issued before jti was introduced can't be revoked nor introspected
+	if out.ID, err = uuid.Parse(claimString(claims, "jti")); err != nil {
+		return nil, ErrInvalidAccessToken
+	}
+
+	if out.ClientID, err = uuid.Parse(claimString(claims, "cid")); err != nil {
+		return nil, ErrInvalidAccessToken
+	}
+
+	if uid, err := uuid.Parse(claimString(claims, "uid")); err == nil {
+		out.UserID = &uid
+	}
+
+	out.Client = claimString(claims, "client_id")
+	out.Role = claimString(claims, "auth")
+	out.Scope = claimString(claims, "scope")
+
+	if exp, ok := claims["exp"].(float64); ok {
+		out.ExpiresAt = int64(exp)
+	}
+
+	if iat, ok := claims["iat"].(float64); ok {
+		out.IssuedAt = int64(iat)
+	}
+
+	if at, ok := claims["auth_time"].(float64); ok {
+		out.AuthTime = int64(at)
+	}
+
+	return out, nil
+}
+
+// claimString returns string claim or empty string
+func claimString(claims jwt.MapClaims, key string) string {
+	s, _ := claims[key].(string)
+
+	return s
+}
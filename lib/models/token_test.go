@@ -3,6 +3,7 @@ package models_test
 import (
 	"testing"
 
+	"github.com/golang-jwt/jwt"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 
@@ -31,7 +32,7 @@ func TestModel_Token_NewTokenResponse(t *testing.T) {
 			assert.Equal(t, "AccessToken", token.AccessToken)
 			assert.Equal(t, "RefreshTokenZzz", token.RefreshToken)
 			assert.Equal(t, 1, token.ExpiresIn)
-			assert.Equal(t, userID, token.UserID)
+			assert.Equal(t, &userID, token.UserID)
 			assert.Equal(t, models.RoleUser, token.Authority)
 		}
 	})
@@ -42,7 +43,7 @@ func TestModel_Token_NewTokenResponse(t *testing.T) {
 			assert.Equal(t, "AccessToken", token.AccessToken)
 			assert.Empty(t, token.RefreshToken)
 			assert.Equal(t, 1, token.ExpiresIn)
-			assert.Equal(t, userID, token.UserID)
+			assert.Equal(t, &userID, token.UserID)
 			assert.Equal(t, models.RoleUser, token.Authority)
 		}
 	})
@@ -58,13 +59,27 @@ func TestModel_Token_NewAccessToken(t *testing.T) {
 	}
 
 	t.Run("Good token", func(t *testing.T) {
-		token, err := models.NewAccessToken(client, user, 1, []byte("something"))
+		token, err := models.NewAccessToken(client, user, "", 0, 1, models.HMACKeys("something"))
 		if assert.NoError(t, err) {
 			assert.NotEmpty(t, token.Token)
 			assert.Equal(t, client.ID, token.ClientID)
 			assert.Equal(t, user.ID, token.UserID)
 		}
 	})
+
+	t.Run("Tenant claim", func(t *testing.T) {
+		tenant := &models.User{ID: uuid.New(), TenantID: uuid.New()}
+
+		token, err := models.NewAccessToken(client, tenant, "", 0, 1, models.HMACKeys("something"))
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		parsed, _, err := new(jwt.Parser).ParseUnverified(token.Token, jwt.MapClaims{})
+		if assert.NoError(t, err) {
+			assert.Equal(t, tenant.TenantID.String(), parsed.Claims.(jwt.MapClaims)["tid"])
+		}
+	})
 }
 
 func TestModel_Token_NewRefreshToken(t *testing.T) {
@@ -77,10 +92,89 @@ func TestModel_Token_NewRefreshToken(t *testing.T) {
 	}
 
 	t.Run("Good token", func(t *testing.T) {
-		token := models.NewRefreshToken(client, user, 1)
+		token := models.NewRefreshToken(client, user, "users:read", 0, 1)
 
 		assert.NotEmpty(t, token.Token)
 		assert.Equal(t, client.ID, token.ClientID)
 		assert.Equal(t, user.ID, token.UserID)
+		assert.Equal(t, "users:read", token.Scope)
+	})
+}
+
+func TestModel_Token_GrantScope(t *testing.T) {
+	token := &models.Token{Scope: "openid users:read clients:read"}
+
+	t.Run("Empty request gets scope of login", func(t *testing.T) {
+		scope, err := token.GrantScope("")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "openid users:read clients:read", scope)
+		}
+	})
+
+	t.Run("Narrower scope", func(t *testing.T) {
+		scope, err := token.GrantScope("users:read")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "users:read", scope)
+		}
+	})
+
+	t.Run("Wider scope", func(t *testing.T) {
+		_, err := token.GrantScope("users:read users:write")
+		assert.Equal(t, models.ErrInvalidScope, err)
+	})
+}
+
+func TestModel_Token_ParseAccessToken(t *testing.T) {
+	client := &models.AuthClient{ID: uuid.New(), ClientID: "zzZzz", Role: models.RoleClient}
+	user := &models.User{ID: uuid.New(), Role: models.RoleUser}
+
+	t.Run("User token", func(t *testing.T) {
+		token, err := models.NewAccessToken(client, user, "", 1600000000, 60, models.HMACKeys("secret"))
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		claims, err := models.ParseAccessToken(token.Token, models.HMACKeys("secret"))
+		if assert.NoError(t, err) {
+			assert.Equal(t, token.ID, claims.ID)
+			assert.Equal(t, &user.ID, claims.UserID)
+			assert.Equal(t, client.ID, claims.ClientID)
+			assert.Equal(t, "zzZzz", claims.Client)
+			assert.Equal(t, models.RoleUser, claims.Role)
+			assert.Equal(t, token.ExpiresAt, claims.ExpiresAt)
+			assert.Equal(t, int64(1600000000), claims.AuthTime)
+		}
+	})
+
+	t.Run("Client token", func(t *testing.T) {
+		token, err := models.NewClientAccessToken(client, "users:read", 60, models.HMACKeys("secret"))
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		claims, err := models.ParseAccessToken(token.Token, models.HMACKeys("secret"))
+		if assert.NoError(t, err) {
+			assert.Nil(t, claims.UserID)
+			assert.Equal(t, "users:read", claims.Scope)
+		}
+	})
+
+	t.Run("Wrong secret", func(t *testing.T) {
+		token, _ := models.NewAccessToken(client, user, "", 0, 60, models.HMACKeys("secret"))
+
+		_, err := models.ParseAccessToken(token.Token, models.HMACKeys("other"))
+		assert.Equal(t, models.ErrInvalidAccessToken, err)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		token, _ := models.NewAccessToken(client, user, "", 0, -60, models.HMACKeys("secret"))
+
+		_, err := models.ParseAccessToken(token.Token, models.HMACKeys("secret"))
+		assert.Equal(t, models.ErrInvalidAccessToken, err)
+	})
+
+	t.Run("Garbage", func(t *testing.T) {
+		_, err := models.ParseAccessToken("not-a-token", models.HMACKeys("secret"))
+		assert.Equal(t, models.ErrInvalidAccessToken, err)
 	})
 }
@@ -8,6 +8,7 @@ import (
 	"github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/go-ozzo/ozzo-validation/v4/is"
 	"github.com/google/uuid"
+	"github.com/labstack/gommon/random"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -28,6 +29,8 @@ var (
 	ErrInvalidUUID = errors.New("invalid UUID")
 	// ErrUserIsLocked ...
 	ErrUserIsLocked = errors.New("user account is locked")
+	// ErrUserIsInactive ...
+	ErrUserIsInactive = errors.New("user account is inactive")
 	// ErrEmailInvalidCode ...
 	ErrEmailInvalidCode = errors.New("invalid email confirmation code supplied")
 	// ErrEmailCodeIsEmpty ...
@@ -60,29 +63,41 @@ type UserQueryParams struct {
 	Role    string `query:"role"`
 	Status  *int   `query:"status"`
 	Query   string `query:"query"`
+	// OwnerID limits results to users owned by the user, set by policy
+	OwnerID *uuid.UUID `query:"-"`
 }
 
 // User model
 type User struct {
-	ID                uuid.UUID `json:"id"         sql:"type:uuid,pk"`
-	FirstName         string    `json:"firstName"  sql:"type:varchar(255)"`
-	LastName          string    `json:"lastName"   sql:"type:varchar(255)"`
-	Email             string    `json:"email"      sql:",unique,index"`
-	Verified          bool      `json:"verified"`
-	PasswordHash      []byte    `json:"-"          sql:",index"`
-	PasswordResetHash string    `json:"-"          sql:"type:varchar(128),index"`
-	ValidationHash    string    `json:"-"          sql:"type:varchar(128),index"`
-	Role              string    `json:"role"       sql:"type:varchar(128)"`
-	Status            int       `json:"status"`
-	IsDeleted         bool      `json:"-"`
-	OwnerID           uuid.UUID `json:"ownerId"    sql:",type:uuid"`
-	Owner             *User     `json:"owner"`
-	Locked            bool      `json:"locked"`
-	IsActive          bool      `json:"active"`
-	PasswordResetAt   time.Time `json:"-"`
-	CreatedAt         time.Time `json:"createdAt"  sql:"default:now()"`
-	UpdatedAt         time.Time `json:"updatedAt"  sql:"default:now()"`
-	LastLogin         time.Time `json:"lastLogin"`
+	ID                  uuid.UUID `json:"id"         sql:"type:uuid,pk"`
+	FirstName           string    `json:"firstName"  sql:"type:varchar(255)"`
+	LastName            string    `json:"lastName"   sql:"type:varchar(255)"`
+	Email               string    `json:"email"      sql:",unique,index"`
+	Verified            bool      `json:"verified"`
+	PasswordHash        []byte    `json:"-"          sql:",index"`
+	PasswordResetHash   string    `json:"-"          sql:"type:varchar(128),index"`
+	ValidationHash      string    `json:"-"          sql:"type:varchar(128),index"`
+	Role                string    `json:"role"       sql:"type:varchar(128)"`
+	Status              int       `json:"status"`
+	IsDeleted           bool      `json:"-"`
+	OwnerID             uuid.UUID `json:"ownerId"    sql:",type:uuid"`
+	Owner               *User     `json:"owner"`
+	TenantID            uuid.UUID `json:"tenantId"   sql:",type:uuid"`
+	Locked              bool      `json:"locked"`
+	IsActive            bool      `json:"active"`
+	PasswordResetAt     time.Time `json:"-"`
+	ValidationSentAt    time.Time `json:"-"`
+	ValidationExpiresAt time.Time `json:"-"`
+	CreatedAt           time.Time `json:"createdAt"  sql:"default:now()"`
+	UpdatedAt           time.Time `json:"updatedAt"  sql:"default:now()"`
+	LastLogin           time.Time `json:"lastLogin"`
+	// MFASecret is TOTP secret, set on enrollment before MFA gets enabled
+	MFASecret  string `json:"-"`
+	MFAEnabled bool   `json:"mfaEnabled"`
+	// MFARecoveryCodes are SHA-256 hashes of unused recovery codes
+	MFARecoveryCodes []string `json:"-"`
+	// MFALastStep is the last accepted TOTP time step, codes are not replayed
+	MFALastStep int64 `json:"-"`
 }
 
 // SetPassword will set users password
@@ -115,6 +130,19 @@ func (u *User) GeneratePasswordResetHash() {
 	u.PasswordResetHash = uuid.New().String()
 }
 
+// GenerateValidationHash issues a new email confirmation code valid for lifetime
+func (u *User) GenerateValidationHash(lifetime time.Duration) {
+	u.ValidationHash = random.String(32, random.Alphanumeric)
+	u.ValidationSentAt = time.Now()
+	u.ValidationExpiresAt = u.ValidationSentAt.Add(lifetime)
+}
+
+// ValidationExpired reports whether email confirmation code can no longer be
+// used, codes issued before expiry was recorded do not expire
+func (u *User) ValidationExpired() bool {
+	return !u.ValidationExpiresAt.IsZero() && time.Now().After(u.ValidationExpiresAt)
+}
+
 // Validate user model
 func (u *User) Validate() error {
 	return validation.ValidateStruct(u,
@@ -148,6 +176,18 @@ func (u *PasswordResetRequest) Validate() error {
 	)
 }
 
+// ResendConfirmation ...
+type ResendConfirmation struct {
+	Email string `json:"email" form:"email" query:"email"`
+}
+
+// Validate ...
+func (u *ResendConfirmation) Validate() error {
+	return validation.ValidateStruct(u,
+		validation.Field(&u.Email, validation.Required, validation.Match(regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$"))),
+	)
+}
+
 // CreateUser ...
 type CreateUser struct {
 	ID        uuid.UUID `json:"id"`
@@ -2,6 +2,7 @@ package models_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
@@ -45,6 +46,25 @@ func TestModel_User_GeneratePasswordResetHash(t *testing.T) {
 	assert.NotEmpty(t, user.PasswordResetHash)
 }
 
+func TestModel_User_GenerateValidationHash(t *testing.T) {
+	user := new(models.User)
+	user.GenerateValidationHash(time.Hour)
+
+	assert.Len(t, user.ValidationHash, 32)
+	assert.Equal(t, time.Hour, user.ValidationExpiresAt.Sub(user.ValidationSentAt))
+	assert.False(t, user.ValidationExpired())
+
+	previous := user.ValidationHash
+	user.GenerateValidationHash(-time.Second)
+
+	assert.NotEqual(t, previous, user.ValidationHash)
+	assert.True(t, user.ValidationExpired())
+}
+
+func TestModel_User_ValidationExpired(t *testing.T) {
+	assert.False(t, new(models.User).ValidationExpired(), "codes without expiry stay valid")
+}
+
 func TestModel_User_Validate(t *testing.T) {
 	t.Run("Good model", func(t *testing.T) {
 		user := models.User{
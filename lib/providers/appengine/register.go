@@ -0,0 +1,25 @@
+package appengine
+
+import (
+	"errors"
+
+	"google.golang.org/appengine"
+
+	"github.com/stiks/gobs/lib/providers/registry"
+	"github.com/stiks/gobs/lib/repositories"
+)
+
+func init() {
+	registry.Register("appengine", registry.Provider{
+		Validate: func(s *registry.Settings) error {
+			if !appengine.IsAppEngine() {
+				return errors.New("memcache is only available on App Engine")
+			}
+
+			return nil
+		},
+		Cache: func(s *registry.Settings) (repositories.CacheRepository, error) {
+			return NewCacheRepository(), nil
+		},
+	})
+}
@@ -0,0 +1,14 @@
+package dummy
+
+import (
+	"github.com/stiks/gobs/lib/providers/registry"
+	"github.com/stiks/gobs/lib/repositories"
+)
+
+func init() {
+	registry.Register("dummy", registry.Provider{
+		Cache: func(s *registry.Settings) (repositories.CacheRepository, error) {
+			return NewCacheRepository(), nil
+		},
+	})
+}
@@ -0,0 +1,202 @@
+// Package memory provides cache kept in the process, bounded by number of
+// entries or their size, evicting least recently used entries first. It suits
+// single replica deployments, every replica keeps a cache of its own.
+package memory
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/stiks/gobs/lib/models"
+)
+
+// Options of the cache, with both bounds 0 the cache grows without limit
+type Options struct {
+	// MaxEntries bounds number of entries, 0 means no bound
+	MaxEntries int
+	// MaxBytes bounds size of encoded entries and their keys, 0 means no bound
+	MaxBytes int64
+	// TTL applies to Create and Update, 0 keeps entries until evicted
+	TTL time.Duration
+	// Now returns current time, time.Now by default
+	Now func() time.Time
+}
+
+type entry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func (e *entry) size() int64 {
+	return int64(len(e.key) + len(e.value))
+}
+
+// Cache stores values gob encoded, as the redis and appengine providers do,
+// so every read decodes a copy which callers may change freely. Safe for
+// concurrent use.
+type Cache struct {
+	opts Options
+
+	mu    sync.Mutex
+	items map[string]*list.Element
+	// lru keeps recently used entries in front
+	lru   *list.List
+	bytes int64
+	stats models.CacheStats
+}
+
+// NewCacheRepository returns empty cache
+func NewCacheRepository(opts Options) *Cache {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+
+	return &Cache{
+		opts:  opts,
+		items: make(map[string]*list.Element),
+		lru:   list.New(),
+	}
+}
+
+// FindByKey decodes entry into obj, expired entry is a miss
+func (c *Cache) FindByKey(ctx context.Context, key string, obj interface{}) error {
+	_, err := c.FindWithTTL(ctx, key, obj)
+
+	return err
+}
+
+// FindWithTTL decodes entry into obj and returns time it has left
+func (c *Cache) FindWithTTL(ctx context.Context, key string, obj interface{}) (time.Duration, error) {
+	c.mu.Lock()
+
+	el, ok := c.items[key]
+	if ok && c.expired(el.Value.(*entry)) {
+		c.remove(el)
+
+		ok = false
+	}
+
+	if !ok {
+		c.stats.Misses++
+		c.mu.Unlock()
+
+		return 0, models.ErrMissCache
+	}
+
+	c.stats.Hits++
+	c.lru.MoveToFront(el)
+
+	// encoded value is never changed in place, so it is decoded unlocked
+	e := el.Value.(*entry)
+	c.mu.Unlock()
+
+	var ttl time.Duration
+	if !e.expires.IsZero() {
+		ttl = e.expires.Sub(c.opts.Now())
+	}
+
+	return ttl, gob.NewDecoder(bytes.NewReader(e.value)).Decode(obj)
+}
+
+func (c *Cache) Create(ctx context.Context, key string, data interface{}) error {
+	return c.SetWithTTL(ctx, key, data, c.opts.TTL)
+}
+
+func (c *Cache) Update(ctx context.Context, key string, data interface{}) error {
+	return c.SetWithTTL(ctx, key, data, c.opts.TTL)
+}
+
+// SetWithTTL stores entry evicting least recently used ones beyond bounds.
+// Entry larger than MaxBytes is not stored and replaces nothing.
+func (c *Cache) SetWithTTL(ctx context.Context, key string, data interface{}, ttl time.Duration) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(data); err != nil {
+		return fmt.Errorf("%w: %s", models.ErrCache, err.Error())
+	}
+
+	e := &entry{key: key, value: buf.Bytes()}
+	if ttl > 0 {
+		e.expires = c.opts.Now().Add(ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// stale value must not outlive the write
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+
+	if c.opts.MaxBytes > 0 && e.size() > c.opts.MaxBytes {
+		return nil
+	}
+
+	c.items[key] = c.lru.PushFront(e)
+	c.bytes += e.size()
+
+	for c.full() {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+
+	return nil
+}
+
+func (c *Cache) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+
+	return nil
+}
+
+// Flush drops every entry, counters are kept
+func (c *Cache) Flush(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = make(map[string]*list.Element)
+	c.lru.Init()
+	c.bytes = 0
+
+	return nil
+}
+
+// Stats returns counters since the cache was created
+func (c *Cache) Stats() models.CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	stats.Bytes = c.bytes
+
+	return stats
+}
+
+func (c *Cache) full() bool {
+	if c.opts.MaxEntries > 0 && c.lru.Len() > c.opts.MaxEntries {
+		return true
+	}
+
+	return c.opts.MaxBytes > 0 && c.bytes > c.opts.MaxBytes
+}
+
+func (c *Cache) expired(e *entry) bool {
+	return !e.expires.IsZero() && !c.opts.Now().Before(e.expires)
+}
+
+func (c *Cache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*entry)
+	delete(c.items, e.key)
+	c.bytes -= e.size()
+}
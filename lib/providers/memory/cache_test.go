@@ -0,0 +1,185 @@
+package memory_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/providers/memory"
+	"github.com/stiks/gobs/lib/repositories"
+	"github.com/stiks/gobs/lib/repositories/repotest"
+)
+
+// _clock is moved by tests instead of waiting
+type _clock struct {
+	now time.Time
+}
+
+func (c *_clock) Now() time.Time {
+	return c.now
+}
+
+func TestMemory_Cache_Contract(t *testing.T) {
+	repotest.CacheRepository(t, func(t *testing.T) repositories.CacheRepository {
+		return memory.NewCacheRepository(memory.Options{MaxEntries: 100})
+	})
+}
+
+func TestMemory_Cache_Copies(t *testing.T) {
+	r := memory.NewCacheRepository(memory.Options{})
+	ctx := context.Background()
+
+	user := &models.User{Email: "peter@test.com", PasswordHash: []byte("hash"), MFASecret: "secret"}
+	assert.NoError(t, r.Create(ctx, "user", user))
+
+	// neither the stored value nor a read copy reach the cache
+	user.Email = "changed@test.com"
+
+	found := new(models.User)
+	if assert.NoError(t, r.FindByKey(ctx, "user", found)) {
+		assert.Equal(t, "peter@test.com", found.Email)
+		assert.Equal(t, []byte("hash"), found.PasswordHash, "fields hidden from JSON are kept")
+		assert.Equal(t, "secret", found.MFASecret)
+
+		found.PasswordHash[0] = 'X'
+	}
+
+	again := new(models.User)
+	if assert.NoError(t, r.FindByKey(ctx, "user", again)) {
+		assert.Equal(t, []byte("hash"), again.PasswordHash)
+	}
+
+	assert.Error(t, r.Create(ctx, "nil", nil))
+}
+
+func TestMemory_Cache_TTL(t *testing.T) {
+	clock := &_clock{now: time.Now()}
+	r := memory.NewCacheRepository(memory.Options{TTL: time.Minute, Now: clock.Now})
+	ctx := context.Background()
+
+	assert.NoError(t, r.Create(ctx, "default", "value"))
+	assert.NoError(t, r.SetWithTTL(ctx, "short", "value", time.Second))
+	assert.NoError(t, r.SetWithTTL(ctx, "forever", "value", 0))
+
+	clock.now = clock.now.Add(2 * time.Second)
+
+	var v string
+	assert.Equal(t, models.ErrMissCache, r.FindByKey(ctx, "short", &v))
+	assert.NoError(t, r.FindByKey(ctx, "default", &v))
+
+	clock.now = clock.now.Add(time.Hour)
+
+	assert.Equal(t, models.ErrMissCache, r.FindByKey(ctx, "default", &v))
+	assert.NoError(t, r.FindByKey(ctx, "forever", &v))
+
+	assert.Equal(t, 1, r.Stats().Entries, "expired entries are dropped")
+}
+
+func TestMemory_Cache_Eviction(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Entries", func(t *testing.T) {
+		r := memory.NewCacheRepository(memory.Options{MaxEntries: 2})
+
+		assert.NoError(t, r.Create(ctx, "first", 1))
+		assert.NoError(t, r.Create(ctx, "second", 2))
+
+		// reading makes first recently used, so second goes
+		var v int
+		assert.NoError(t, r.FindByKey(ctx, "first", &v))
+		assert.NoError(t, r.Create(ctx, "third", 3))
+
+		assert.NoError(t, r.FindByKey(ctx, "first", &v))
+		assert.NoError(t, r.FindByKey(ctx, "third", &v))
+		assert.Equal(t, models.ErrMissCache, r.FindByKey(ctx, "second", &v))
+
+		stats := r.Stats()
+		assert.Equal(t, uint64(1), stats.Evictions)
+		assert.Equal(t, 2, stats.Entries)
+	})
+
+	t.Run("Bytes", func(t *testing.T) {
+		r := memory.NewCacheRepository(memory.Options{})
+		assert.NoError(t, r.Create(ctx, "key9", "0123456789"))
+		size := r.Stats().Bytes
+
+		// room for two entries of the same size
+		r = memory.NewCacheRepository(memory.Options{MaxBytes: 2*size + 1})
+		for i := 0; i < 3; i++ {
+			assert.NoError(t, r.Create(ctx, fmt.Sprintf("key%d", i), "0123456789"))
+		}
+
+		stats := r.Stats()
+		assert.Equal(t, 2, stats.Entries)
+		assert.Equal(t, 2*size, stats.Bytes)
+		assert.Equal(t, uint64(1), stats.Evictions)
+		assert.Equal(t, models.ErrMissCache, r.FindByKey(ctx, "key0", new(string)))
+
+		t.Run("Entry over the bound", func(t *testing.T) {
+			assert.NoError(t, r.Update(ctx, "key1", string(make([]byte, 3*size))))
+			assert.Equal(t, models.ErrMissCache, r.FindByKey(ctx, "key1", new(string)), "old value is dropped")
+			assert.NoError(t, r.FindByKey(ctx, "key2", new(string)), "other entries stay")
+		})
+	})
+}
+
+func TestMemory_Cache_Stats(t *testing.T) {
+	r := memory.NewCacheRepository(memory.Options{})
+	ctx := context.Background()
+
+	assert.NoError(t, r.Create(ctx, "key", "value"))
+
+	var v string
+	_ = r.FindByKey(ctx, "key", &v)
+	_ = r.FindByKey(ctx, "key", &v)
+	_ = r.FindByKey(ctx, "other", &v)
+
+	stats := r.Stats()
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, 1, stats.Entries)
+	assert.NotZero(t, stats.Bytes)
+
+	assert.NoError(t, r.Flush(ctx))
+
+	stats = r.Stats()
+	assert.Equal(t, uint64(2), stats.Hits, "counters survive flush")
+	assert.Zero(t, stats.Entries)
+	assert.Zero(t, stats.Bytes)
+}
+
+func TestMemory_Cache_Concurrent(t *testing.T) {
+	r := memory.NewCacheRepository(memory.Options{MaxEntries: 10})
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				key := fmt.Sprintf("key%d", j%20)
+
+				_ = r.Update(ctx, key, i)
+				_ = r.FindByKey(ctx, key, new(int))
+
+				if j%10 == 0 {
+					_ = r.Delete(ctx, key)
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	stats := r.Stats()
+	assert.True(t, stats.Entries <= 10)
+	assert.Equal(t, uint64(800), stats.Hits+stats.Misses)
+}
@@ -0,0 +1,76 @@
+package memory
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/stiks/gobs/lib/providers/registry"
+	"github.com/stiks/gobs/lib/repositories"
+)
+
+// DefaultMaxEntries bounds the cache when neither bound is configured
+const DefaultMaxEntries = 10000
+
+// config of memory cache provider, 0 leaves a bound or expiry off
+type config struct {
+	MaxEntries int           `env:"MEMORY_CACHE_MAX_ENTRIES"`
+	MaxBytes   int64         `env:"MEMORY_CACHE_MAX_BYTES"`
+	TTL        time.Duration `env:"MEMORY_CACHE_TTL"`
+}
+
+// Validate ...
+func (c *config) Validate() error {
+	var errs []string
+	if c.MaxEntries < 0 {
+		errs = append(errs, "MEMORY_CACHE_MAX_ENTRIES can't be negative")
+	}
+
+	if c.MaxBytes < 0 {
+		errs = append(errs, "MEMORY_CACHE_MAX_BYTES can't be negative")
+	}
+
+	if c.TTL < 0 {
+		errs = append(errs, "MEMORY_CACHE_TTL can't be negative")
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+func init() {
+	registry.Register("memory", registry.Provider{
+		Validate: validate,
+		Cache: func(s *registry.Settings) (repositories.CacheRepository, error) {
+			var cfg config
+			if err := s.Fill(&cfg); err != nil {
+				return nil, err
+			}
+
+			return NewCacheRepository(options(cfg)), nil
+		},
+	})
+}
+
+func validate(s *registry.Settings) error {
+	var cfg config
+
+	return s.Fill(&cfg)
+}
+
+func options(cfg config) Options {
+	opts := Options{
+		MaxEntries: cfg.MaxEntries,
+		MaxBytes:   cfg.MaxBytes,
+		TTL:        cfg.TTL,
+	}
+
+	if opts.MaxEntries == 0 && opts.MaxBytes == 0 {
+		opts.MaxEntries = DefaultMaxEntries
+	}
+
+	return opts
+}
@@ -0,0 +1,56 @@
+package memory_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	_ "github.com/stiks/gobs/lib/providers/memory"
+	_ "github.com/stiks/gobs/lib/providers/mock"
+	"github.com/stiks/gobs/lib/providers/registry"
+	"github.com/stiks/gobs/lib/repositories"
+)
+
+func TestMemory_Register(t *testing.T) {
+	selection := registry.Selection{
+		registry.KindData:  "mock",
+		registry.KindQueue: "mock",
+		registry.KindCache: "memory",
+		registry.KindEmail: "mock",
+	}
+
+	lookup := func(values map[string]string) func(string) string {
+		return func(key string) string { return values[key] }
+	}
+
+	t.Run("Invalid settings", func(t *testing.T) {
+		_, err := registry.Build(selection, lookup(map[string]string{"MEMORY_CACHE_MAX_ENTRIES": "-1"}), nil)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "MEMORY_CACHE_MAX_ENTRIES can't be negative")
+		}
+
+		_, err = registry.Build(selection, lookup(map[string]string{"MEMORY_CACHE_TTL": "soon"}), nil)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), `MEMORY_CACHE_TTL: invalid duration "soon"`)
+		}
+	})
+
+	t.Run("Cache", func(t *testing.T) {
+		providers, err := registry.Build(selection, lookup(map[string]string{
+			"MEMORY_CACHE_MAX_BYTES": "1048576",
+			"MEMORY_CACHE_TTL":       "5m",
+		}), nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.NoError(t, providers.Cache.Create(context.Background(), "key", "value"))
+
+		if assert.Implements(t, (*repositories.MeteredCacheRepository)(nil), providers.Cache) {
+			assert.Equal(t, 1, providers.Cache.(repositories.MeteredCacheRepository).Stats().Entries)
+		}
+
+		assert.Implements(t, (*repositories.ExpiringCacheRepository)(nil), providers.Cache)
+	})
+}
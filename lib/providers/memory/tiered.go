@@ -0,0 +1,167 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/repositories"
+	"github.com/stiks/gobs/pkg/xlog"
+)
+
+// Publish tells other replicas to drop key from their local tier, empty key
+// drops every entry
+type Publish func(ctx context.Context, key string) error
+
+// TieredCache keeps local copies of entries of a shared remote cache, so
+// repeated reads skip the network. Writes go through to both tiers and are
+// published, replicas receiving them call Drop, entries loaded on miss are
+// filled without publishing. Local entries expire with the remote ones, after
+// TTL of the local tier at the latest, which bounds staleness when a message
+// is lost or a read races a write of another replica.
+type TieredCache struct {
+	local   *Cache
+	remote  repositories.CacheRepository
+	publish Publish
+}
+
+// NewTieredCache returns cache reading local tier first, local should have TTL
+func NewTieredCache(local *Cache, remote repositories.CacheRepository, publish Publish) *TieredCache {
+	return &TieredCache{
+		local:   local,
+		remote:  remote,
+		publish: publish,
+	}
+}
+
+// FindByKey reads remote tier on local miss and keeps a copy of the entry
+// for time the remote one has left
+func (c *TieredCache) FindByKey(ctx context.Context, key string, obj interface{}) error {
+	if err := c.local.FindByKey(ctx, key, obj); err == nil {
+		return nil
+	}
+
+	var ttl time.Duration
+	if remote, ok := c.remote.(repositories.TTLCacheRepository); ok {
+		left, err := remote.FindWithTTL(ctx, key, obj)
+		if err != nil {
+			return err
+		}
+
+		ttl = left
+	} else if err := c.remote.FindByKey(ctx, key, obj); err != nil {
+		return err
+	}
+
+	c.keep(ctx, key, obj, ttl)
+
+	return nil
+}
+
+func (c *TieredCache) Create(ctx context.Context, key string, data interface{}) error {
+	return c.write(ctx, key, data, 0, c.remote.Create)
+}
+
+func (c *TieredCache) Update(ctx context.Context, key string, data interface{}) error {
+	return c.write(ctx, key, data, 0, c.remote.Update)
+}
+
+// SetWithTTL keeps local copy no longer than TTL of the local tier
+func (c *TieredCache) SetWithTTL(ctx context.Context, key string, data interface{}, ttl time.Duration) error {
+	remote, ok := c.remote.(repositories.ExpiringCacheRepository)
+	if !ok {
+		return c.Update(ctx, key, data)
+	}
+
+	return c.write(ctx, key, data, ttl, func(ctx context.Context, key string, data interface{}) error {
+		return remote.SetWithTTL(ctx, key, data, ttl)
+	})
+}
+
+// Fill stores entry loaded on miss, other replicas have no copy of a missing
+// entry, so nothing is published
+func (c *TieredCache) Fill(ctx context.Context, key string, data interface{}, ttl time.Duration) error {
+	var err error
+	if remote, ok := c.remote.(repositories.ExpiringCacheRepository); ok && ttl > 0 {
+		err = remote.SetWithTTL(ctx, key, data, ttl)
+	} else {
+		err = c.remote.Create(ctx, key, data)
+	}
+
+	if err != nil {
+		c.Drop(key)
+
+		return err
+	}
+
+	c.keep(ctx, key, data, ttl)
+
+	return nil
+}
+
+func (c *TieredCache) Delete(ctx context.Context, key string) error {
+	err := c.remote.Delete(ctx, key)
+
+	c.drop(ctx, key)
+
+	return err
+}
+
+func (c *TieredCache) Flush(ctx context.Context) error {
+	err := c.remote.Flush(ctx)
+
+	c.drop(ctx, "")
+
+	return err
+}
+
+// Drop removes key from the local tier only, empty key removes every entry
+func (c *TieredCache) Drop(key string) {
+	if key == "" {
+		_ = c.local.Flush(context.Background())
+
+		return
+	}
+
+	_ = c.local.Delete(context.Background(), key)
+}
+
+// Stats returns counters of the local tier
+func (c *TieredCache) Stats() models.CacheStats {
+	return c.local.Stats()
+}
+
+// write stores entry in the remote tier, local copy of other replicas is
+// dropped and this one keeps the new value
+func (c *TieredCache) write(ctx context.Context, key string, data interface{}, ttl time.Duration, set func(ctx context.Context, key string, data interface{}) error) error {
+	if err := set(ctx, key, data); err != nil {
+		c.drop(ctx, key)
+
+		return err
+	}
+
+	c.drop(ctx, key)
+	c.keep(ctx, key, data, ttl)
+
+	return nil
+}
+
+// keep stores local copy for ttl, when shorter than TTL of the local tier
+func (c *TieredCache) keep(ctx context.Context, key string, data interface{}, ttl time.Duration) {
+	if ttl <= 0 || (c.local.opts.TTL > 0 && c.local.opts.TTL < ttl) {
+		ttl = c.local.opts.TTL
+	}
+
+	if err := c.local.SetWithTTL(ctx, key, data, ttl); err != nil {
+		xlog.Errorf(ctx, "Unable to keep local copy of %s, err: %s", key, err.Error())
+	}
+}
+
+// drop removes local copy and publishes key
+func (c *TieredCache) drop(ctx context.Context, key string) {
+	c.Drop(key)
+
+	if err := c.publish(ctx, key); err != nil {
+		xlog.Errorf(ctx, "Unable to publish invalidation of %q, err: %s", key, err.Error())
+	}
+}
@@ -0,0 +1,170 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/providers/memory"
+	"github.com/stiks/gobs/lib/repositories"
+	"github.com/stiks/gobs/lib/repositories/repotest"
+)
+
+// _bus delivers published keys to every replica but the sender, as pub/sub
+// of a shared cache does
+type _bus struct {
+	replicas []*memory.TieredCache
+	keys     []string
+}
+
+func (b *_bus) replica(remote repositories.CacheRepository) *memory.TieredCache {
+	var self *memory.TieredCache
+
+	self = memory.NewTieredCache(memory.NewCacheRepository(memory.Options{TTL: time.Minute}), remote, func(ctx context.Context, key string) error {
+		b.keys = append(b.keys, key)
+
+		for _, r := range b.replicas {
+			if r != self {
+				r.Drop(key)
+			}
+		}
+
+		return nil
+	})
+
+	b.replicas = append(b.replicas, self)
+
+	return self
+}
+
+// _brokenCache fails every call
+type _brokenCache struct {
+	repositories.CacheRepository
+}
+
+func (c *_brokenCache) FindByKey(ctx context.Context, key string, obj interface{}) error {
+	return errors.New("connection refused")
+}
+
+func (c *_brokenCache) Update(ctx context.Context, key string, data interface{}) error {
+	return errors.New("connection refused")
+}
+
+func TestMemory_Tiered_Contract(t *testing.T) {
+	repotest.CacheRepository(t, func(t *testing.T) repositories.CacheRepository {
+		return new(_bus).replica(memory.NewCacheRepository(memory.Options{}))
+	})
+}
+
+func TestMemory_Tiered_Reads(t *testing.T) {
+	remote := memory.NewCacheRepository(memory.Options{})
+	bus := new(_bus)
+	first, second := bus.replica(remote), bus.replica(remote)
+	ctx := context.Background()
+
+	assert.NoError(t, first.Create(ctx, "user", &models.User{Email: "peter@test.com"}))
+	assert.Equal(t, 1, remote.Stats().Entries, "writes go through")
+
+	for i := 0; i < 3; i++ {
+		user := new(models.User)
+		if assert.NoError(t, second.FindByKey(ctx, "user", user)) {
+			assert.Equal(t, "peter@test.com", user.Email)
+		}
+	}
+
+	assert.Equal(t, uint64(1), remote.Stats().Hits, "remote tier is read once")
+	assert.Equal(t, uint64(2), second.Stats().Hits)
+
+	assert.Equal(t, models.ErrMissCache, second.FindByKey(ctx, "missing", new(models.User)))
+}
+
+func TestMemory_Tiered_Invalidation(t *testing.T) {
+	remote := memory.NewCacheRepository(memory.Options{})
+	bus := new(_bus)
+	first, second := bus.replica(remote), bus.replica(remote)
+	ctx := context.Background()
+
+	assert.NoError(t, first.Create(ctx, "user", "old"))
+
+	var v string
+	assert.NoError(t, second.FindByKey(ctx, "user", &v))
+
+	t.Run("Update", func(t *testing.T) {
+		assert.NoError(t, first.Update(ctx, "user", "new"))
+
+		assert.NoError(t, second.FindByKey(ctx, "user", &v))
+		assert.Equal(t, "new", v, "local copy of other replica is dropped")
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		assert.NoError(t, second.Delete(ctx, "user"))
+		assert.Equal(t, models.ErrMissCache, first.FindByKey(ctx, "user", &v))
+	})
+
+	t.Run("Flush", func(t *testing.T) {
+		assert.NoError(t, first.SetWithTTL(ctx, "user", "value", time.Hour))
+		assert.NoError(t, second.FindByKey(ctx, "user", &v))
+
+		assert.NoError(t, first.Flush(ctx))
+		assert.Equal(t, models.ErrMissCache, second.FindByKey(ctx, "user", &v))
+		assert.Equal(t, "", bus.keys[len(bus.keys)-1], "flush is published as empty key")
+	})
+}
+
+func TestMemory_Tiered_TTL(t *testing.T) {
+	now := time.Now()
+	remote := memory.NewCacheRepository(memory.Options{Now: func() time.Time { return now }})
+	local := memory.NewCacheRepository(memory.Options{TTL: time.Minute, Now: func() time.Time { return now }})
+	r := memory.NewTieredCache(local, remote, func(ctx context.Context, key string) error { return nil })
+	ctx := context.Background()
+
+	assert.NoError(t, r.SetWithTTL(ctx, "short", "value", time.Second))
+	assert.NoError(t, r.SetWithTTL(ctx, "long", "value", time.Hour))
+
+	now = now.Add(2 * time.Minute)
+
+	assert.Equal(t, models.ErrMissCache, local.FindByKey(ctx, "short", new(string)))
+	assert.Equal(t, models.ErrMissCache, local.FindByKey(ctx, "long", new(string)), "local copy is kept for local ttl at most")
+	assert.NoError(t, r.FindByKey(ctx, "long", new(string)))
+
+	t.Run("Copy of remote entry expires with it", func(t *testing.T) {
+		assert.NoError(t, remote.SetWithTTL(ctx, "remote", "value", 10*time.Second))
+		assert.NoError(t, r.FindByKey(ctx, "remote", new(string)))
+
+		now = now.Add(11 * time.Second)
+
+		assert.Equal(t, models.ErrMissCache, local.FindByKey(ctx, "remote", new(string)))
+	})
+}
+
+func TestMemory_Tiered_Fill(t *testing.T) {
+	remote := memory.NewCacheRepository(memory.Options{})
+	bus := new(_bus)
+	first, second := bus.replica(remote), bus.replica(remote)
+	ctx := context.Background()
+
+	assert.NoError(t, first.Fill(ctx, "user", "loaded", time.Hour))
+	assert.Empty(t, bus.keys, "fills are not published")
+
+	var v string
+	assert.NoError(t, second.FindByKey(ctx, "user", &v))
+	assert.Equal(t, "loaded", v)
+
+	assert.Equal(t, uint64(1), remote.Stats().Hits, "first replica keeps local copy")
+	assert.NoError(t, first.FindByKey(ctx, "user", &v))
+	assert.Equal(t, uint64(1), remote.Stats().Hits)
+}
+
+func TestMemory_Tiered_RemoteErrors(t *testing.T) {
+	bus := new(_bus)
+	r := bus.replica(&_brokenCache{})
+	ctx := context.Background()
+
+	assert.Error(t, r.Update(ctx, "user", "value"))
+	assert.Error(t, r.FindByKey(ctx, "user", new(string)), "failed write leaves no local copy")
+	assert.Equal(t, []string{"user"}, bus.keys, "other replicas drop the key anyway")
+}
@@ -2,6 +2,7 @@ package mock
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,9 +13,15 @@ import (
 )
 
 type authRepository struct {
-	db      []models.Token
-	clients []models.AuthClient
-	users   []models.User
+	db       []models.Token
+	clients  []models.AuthClient
+	users    []models.User
+	codes    []models.AuthorizationCode
+	consents []models.Consent
+	revoked  map[uuid.UUID]time.Time
+	attempts map[string]models.LoginAttempts
+	// mu guards attempts, failures are counted concurrently
+	mu sync.Mutex
 }
 
 // NewAuthRepository ...
@@ -27,6 +34,7 @@ func NewAuthRepository() repositories.AuthRepository {
 				UserID:    helpers.UUIDFromString(nil, "775a5b37-1742-4e54-9439-0357e768b011"),
 				Token:     "sdfsdf5K9QwC6mptVSJVvAuFvA4w245HsiXxfMpOtpzASJ4Rr6E",
 				ExpiresAt: time.Now().AddDate(0, 0, 1).Unix(),
+				Scope:     "users:read users:write clients:read clients:write",
 			},
 			{
 				ID:       uuid.New(),
@@ -47,6 +55,9 @@ func NewAuthRepository() repositories.AuthRepository {
 				ID:           helpers.UUIDFromString(nil, "775a5b37-1742-4e54-9439-0357e768b011"),
 				ClientID:     "SecRetAuthKey",
 				ClientSecret: "SecretSuper",
+				Role:         models.RoleClient,
+				Scope:        "users:read users:write clients:read clients:write",
+				RedirectURIs: []string{"https://app.test/callback"},
 			},
 			{
 				ID:           helpers.UUIDFromString(nil, "ceae6905-866d-42ad-90c5-5f06cd4b242f"),
@@ -58,8 +69,16 @@ func NewAuthRepository() repositories.AuthRepository {
 				ClientID:     "MegaKey",
 				ClientSecret: "MegaKeySecretSuper",
 			},
+			{
+				ID:           helpers.UUIDFromString(nil, "9a4c1e4e-5f0e-4f43-a3a4-2f8a3b0b6d11"),
+				ClientID:     "PublicSpa",
+				Scope:        "users:read",
+				RedirectURIs: []string{"https://spa.test/callback", "http://localhost:3000/callback"},
+			},
 		},
-		users: _usersList,
+		users:    append([]models.User(nil), _usersList...),
+		revoked:  make(map[uuid.UUID]time.Time),
+		attempts: make(map[string]models.LoginAttempts),
 	}
 }
 
@@ -74,6 +93,19 @@ func (r *authRepository) FindByClientID(ctx context.Context, id string) (*models
 	return nil, models.ErrAuthClientNotFound
 }
 
+// UpdateClientScope ...
+func (r *authRepository) UpdateClientScope(ctx context.Context, clientID string, scope string) (*models.AuthClient, error) {
+	for k, c := range r.clients {
+		if c.ClientID == clientID {
+			r.clients[k].Scope = scope
+
+			return r.FindByClientID(ctx, clientID)
+		}
+	}
+
+	return nil, models.ErrAuthClientNotFound
+}
+
 // FindUserByUsername ...
 func (r *authRepository) FindUserByUsername(ctx context.Context, username string) (*models.User, error) {
 	for _, key := range r.users {
@@ -144,6 +176,10 @@ func (r *authRepository) FindByID(ctx context.Context, id uuid.UUID) (*models.To
 
 // CreateToken ...
 func (r *authRepository) CreateToken(ctx context.Context, data *models.Token) (*models.Token, error) {
+	if data.ID == uuid.Nil {
+		data.ID = uuid.New()
+	}
+
 	r.db = append(r.db, *data)
 
 	return data, nil
@@ -167,3 +203,146 @@ func (r *authRepository) DeleteToken(ctx context.Context, id uuid.UUID) error {
 
 	return nil
 }
+
+// CreateAuthorizationCode ...
+func (r *authRepository) CreateAuthorizationCode(ctx context.Context, data *models.AuthorizationCode) (*models.AuthorizationCode, error) {
+	if data.ID == uuid.Nil {
+		data.ID = uuid.New()
+	}
+
+	r.codes = append(r.codes, *data)
+
+	return data, nil
+}
+
+// ConsumeAuthorizationCode ...
+func (r *authRepository) ConsumeAuthorizationCode(ctx context.Context, code string) (*models.AuthorizationCode, error) {
+	for k, key := range r.codes {
+		if key.Code == code {
+			r.codes = append(r.codes[:k], r.codes[k+1:]...)
+
+			return &key, nil
+		}
+	}
+
+	return nil, models.ErrAuthorizationCodeNotFound
+}
+
+// FindConsent ...
+func (r *authRepository) FindConsent(ctx context.Context, clientID uuid.UUID, userID uuid.UUID) (*models.Consent, error) {
+	for _, key := range r.consents {
+		if key.ClientID == clientID && key.UserID == userID {
+			return &key, nil
+		}
+	}
+
+	return nil, models.ErrConsentNotFound
+}
+
+// SaveConsent ...
+func (r *authRepository) SaveConsent(ctx context.Context, data *models.Consent) (*models.Consent, error) {
+	data.UpdatedAt = time.Now().UTC()
+
+	for k, key := range r.consents {
+		if key.ClientID == data.ClientID && key.UserID == data.UserID {
+			r.consents[k].Scope = data.Scope
+			r.consents[k].UpdatedAt = data.UpdatedAt
+
+			return r.FindConsent(ctx, data.ClientID, data.UserID)
+		}
+	}
+
+	if data.ID == uuid.Nil {
+		data.ID = uuid.New()
+	}
+
+	if data.CreatedAt.IsZero() {
+		data.CreatedAt = data.UpdatedAt
+	}
+
+	r.consents = append(r.consents, *data)
+
+	return data, nil
+}
+
+// RevokeAccessToken ...
+func (r *authRepository) RevokeAccessToken(ctx context.Context, id uuid.UUID, expiresAt time.Time) error {
+	r.revoked[id] = expiresAt
+
+	return nil
+}
+
+// IsAccessTokenRevoked ...
+func (r *authRepository) IsAccessTokenRevoked(ctx context.Context, id uuid.UUID) (bool, error) {
+	_, ok := r.revoked[id]
+
+	return ok, nil
+}
+
+// FindLoginAttempts ...
+func (r *authRepository) FindLoginAttempts(ctx context.Context, key string) (*models.LoginAttempts, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	a, ok := r.attempts[key]
+	if !ok {
+		return nil, models.ErrLoginAttemptsNotFound
+	}
+
+	return &a, nil
+}
+
+// SaveLoginAttempts ...
+func (r *authRepository) SaveLoginAttempts(ctx context.Context, data *models.LoginAttempts) (*models.LoginAttempts, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.attempts[data.Key] = *data
+
+	return data, nil
+}
+
+// FailLoginAttempt ...
+func (r *authRepository) FailLoginAttempt(ctx context.Context, key string, now time.Time, since time.Time) (*models.LoginAttempts, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	a := r.attempts[key]
+	a.Key = key
+
+	if !a.Locked(now) && a.LastFailure.Before(since) {
+		a.Failures = 0
+	}
+
+	a.Failures++
+	a.LastFailure = now
+	r.attempts[key] = a
+
+	return &a, nil
+}
+
+// LockLoginAttempts ...
+func (r *authRepository) LockLoginAttempts(ctx context.Context, key string, now time.Time, until time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	a, ok := r.attempts[key]
+	if !ok || a.Locked(now) {
+		return false, nil
+	}
+
+	a.LockedUntil = until
+	r.attempts[key] = a
+
+	return true, nil
+}
+
+// DeleteLoginAttempts ...
+func (r *authRepository) DeleteLoginAttempts(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.attempts, key)
+
+	return nil
+}
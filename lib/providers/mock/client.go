@@ -9,6 +9,7 @@ import (
 	"github.com/stiks/gobs/lib/models"
 	"github.com/stiks/gobs/lib/repositories"
 	"github.com/stiks/gobs/pkg/helpers"
+	"github.com/stiks/gobs/pkg/tenant"
 )
 
 var (
@@ -36,7 +37,7 @@ var (
 // NewClientRepository ...
 func NewClientRepository() repositories.ClientRepository {
 	return &clientRepository{
-		db: _clientsList,
+		db: append([]models.Client(nil), _clientsList...),
 	}
 }
 
@@ -44,20 +45,59 @@ type clientRepository struct {
 	db []models.Client
 }
 
+// filter returns clients matching params in insertion order
+func (r *clientRepository) filter(ctx context.Context, params *models.ClientQueryParams) []models.Client {
+	var clients []models.Client
+	for _, c := range r.db {
+		if !inTenant(ctx, c.TenantID) {
+			continue
+		}
+
+		if params == nil {
+			clients = append(clients, c)
+
+			continue
+		}
+
+		if params.Status != nil && c.Status != *params.Status {
+			continue
+		}
+
+		if params.OwnerID != nil && c.OwnerID != *params.OwnerID {
+			continue
+		}
+
+		if !matches(params.Query, c.Name, c.Email) {
+			continue
+		}
+
+		clients = append(clients, c)
+	}
+
+	return clients
+}
+
 // FindAll ...
 func (r *clientRepository) FindAll(ctx context.Context, params *models.ClientQueryParams) ([]models.Client, error) {
-	return r.db, nil
+	clients := r.filter(ctx, params)
+
+	if params != nil {
+		from, to := paginate(len(clients), params.Page, params.PerPage)
+		clients = clients[from:to]
+	}
+
+	return clients, nil
 }
 
 // CountAll ...
 func (r *clientRepository) CountAll(ctx context.Context, params *models.ClientQueryParams) (int, error) {
-	return len(r.db), nil
+	return len(r.filter(ctx, params)), nil
 }
 
 // FindByID ...
 func (r *clientRepository) FindByID(ctx context.Context, id uuid.UUID) (*models.Client, error) {
 	for _, key := range r.db {
-		if key.ID == id {
+		if key.ID == id && inTenant(ctx, key.TenantID) {
 			return &key, nil
 		}
 	}
@@ -73,6 +113,10 @@ func (r *clientRepository) Create(ctx context.Context, data *models.Client) (*mo
 		}
 	}
 
+	if id, ok := tenant.FromContext(ctx); ok {
+		data.TenantID = id
+	}
+
 	r.db = append(r.db, *data)
 
 	return data, nil
@@ -80,15 +124,25 @@ func (r *clientRepository) Create(ctx context.Context, data *models.Client) (*mo
 
 // Update ...
 func (r *clientRepository) Update(ctx context.Context, data *models.Client) (*models.Client, error) {
+	if _, err := r.FindByID(ctx, data.ID); err != nil {
+		return nil, err
+	}
+
+	for _, i := range r.db {
+		if i.ID != data.ID && i.Email == data.Email {
+			return nil, models.ErrClientNameTaken
+		}
+	}
+
+	// records never move between tenants
 	for k, i := range r.db {
 		if i.ID == data.ID {
 			r.db[k] = *data
-
-			return data, nil
+			r.db[k].TenantID = i.TenantID
 		}
 	}
 
-	return nil, models.ErrClientNotFound
+	return data, nil
 }
 
 // Delete ...
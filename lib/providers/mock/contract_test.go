@@ -0,0 +1,63 @@
+package mock_test
+
+import (
+	"testing"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/providers/mock"
+	"github.com/stiks/gobs/lib/repositories"
+	"github.com/stiks/gobs/lib/repositories/repotest"
+	"github.com/stiks/gobs/pkg/helpers"
+)
+
+func TestMock_User_Contract(t *testing.T) {
+	repotest.UserRepository(t, func(t *testing.T) repositories.UserRepository {
+		return mock.NewUserRepository()
+	})
+}
+
+func TestMock_Client_Contract(t *testing.T) {
+	repotest.ClientRepository(t, func(t *testing.T) repositories.ClientRepository {
+		return mock.NewClientRepository()
+	})
+}
+
+func TestMock_Key_Contract(t *testing.T) {
+	repotest.KeyRepository(t, func(t *testing.T) repositories.KeyRepository {
+		return mock.NewKeyRepository()
+	})
+}
+
+func TestMock_Role_Contract(t *testing.T) {
+	repotest.RoleRepository(t, func(t *testing.T) repositories.RoleRepository {
+		return mock.NewRoleRepository()
+	})
+}
+
+func TestMock_Auth_Contract(t *testing.T) {
+	repotest.AuthRepository(t, func(t *testing.T) (repositories.AuthRepository, repotest.AuthFixture) {
+		return mock.NewAuthRepository(), repotest.AuthFixture{
+			User: models.User{
+				ID:           helpers.UUIDFromString(t, "775a5b37-1742-4e54-9439-0357e768b011"),
+				Email:        "peter@test.com",
+				PasswordHash: []byte("$2a$10$kPrRofMm9VnE5w9ih6FwtuiuY/fIJ7/pcwvAmvL/3x3t2I144hyyq"),
+				Role:         models.RoleSuperUser,
+			},
+			Client: models.AuthClient{
+				ID:           helpers.UUIDFromString(t, "775a5b37-1742-4e54-9439-0357e768b011"),
+				ClientID:     "SecRetAuthKey",
+				ClientSecret: "SecretSuper",
+				Role:         models.RoleClient,
+				Scope:        "users:read users:write clients:read clients:write",
+				RedirectURIs: []string{"https://app.test/callback"},
+			},
+		}
+	})
+}
+
+func TestMock_Queue_Contract(t *testing.T) {
+	// mock queue only logs tasks, there is nothing to receive
+	repotest.QueueRepository(t, func(t *testing.T) (repositories.QueueRepository, func() []repotest.Task) {
+		return mock.NewQueueRepository(), nil
+	})
+}
@@ -0,0 +1,93 @@
+package mock
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/repositories"
+)
+
+type keyRepository struct {
+	mu sync.Mutex
+	db []models.SigningKey
+
+	// lock is held by Locked, one slot channel so waiting can be cancelled
+	lock chan struct{}
+}
+
+// NewKeyRepository ...
+func NewKeyRepository() repositories.KeyRepository {
+	return &keyRepository{
+		lock: make(chan struct{}, 1),
+	}
+}
+
+// Locked ...
+func (r *keyRepository) Locked(ctx context.Context, fn func(ctx context.Context) error) error {
+	select {
+	case r.lock <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	defer func() { <-r.lock }()
+
+	return fn(ctx)
+}
+
+// FindAll ...
+func (r *keyRepository) FindAll(ctx context.Context) ([]models.SigningKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := append([]models.SigningKey(nil), r.db...)
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+
+	return keys, nil
+}
+
+// Create ...
+func (r *keyRepository) Create(ctx context.Context, data *models.SigningKey) (*models.SigningKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.db = append(r.db, *data)
+
+	return data, nil
+}
+
+// Update ...
+func (r *keyRepository) Update(ctx context.Context, data *models.SigningKey) (*models.SigningKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for k, i := range r.db {
+		if i.ID == data.ID {
+			r.db[k] = *data
+
+			return data, nil
+		}
+	}
+
+	return nil, models.ErrSigningKeyNotFound
+}
+
+// Delete ...
+func (r *keyRepository) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for k, i := range r.db {
+		if i.ID == id {
+			r.db = append(r.db[:k], r.db[k+1:]...)
+
+			return nil
+		}
+	}
+
+	return models.ErrSigningKeyNotFound
+}
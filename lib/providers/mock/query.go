@@ -0,0 +1,54 @@
+package mock
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/stiks/gobs/pkg/tenant"
+)
+
+// inTenant reports whether record of tenant id is visible in ctx
+func inTenant(ctx context.Context, id uuid.UUID) bool {
+	return tenant.Allows(ctx, id)
+}
+
+// matches reports whether any of fields contains query, case insensitive
+func matches(query string, fields ...string) bool {
+	q := strings.ToLower(strings.TrimSpace(query))
+	if q == "" {
+		return true
+	}
+
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), q) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// paginate returns slice bounds of a 1-based page, everything when perPage is not set
+func paginate(total int, page int, perPage int) (int, int) {
+	if perPage <= 0 {
+		return 0, total
+	}
+
+	if page <= 0 {
+		page = 1
+	}
+
+	from := (page - 1) * perPage
+	if from > total {
+		from = total
+	}
+
+	to := from + perPage
+	if to > total {
+		to = total
+	}
+
+	return from, to
+}
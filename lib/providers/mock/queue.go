@@ -2,6 +2,7 @@ package mock
 
 import (
 	"context"
+	"encoding/json"
 	"log"
 	"net/url"
 
@@ -25,6 +26,10 @@ func (r *queueRepository) Add(ctx context.Context, queue string, data []byte) er
 
 // AddObject ...
 func (r *queueRepository) AddObject(ctx context.Context, queue string, data interface{}) error {
+	if _, err := json.Marshal(data); err != nil {
+		return err
+	}
+
 	log.Printf("Mock queue service")
 
 	return nil
@@ -0,0 +1,26 @@
+package mock
+
+import (
+	"github.com/stiks/gobs/lib/providers/registry"
+	"github.com/stiks/gobs/lib/repositories"
+)
+
+func init() {
+	registry.Register("mock", registry.Provider{
+		Data: func(s *registry.Settings) (*registry.Data, error) {
+			return &registry.Data{
+				Users:   NewUserRepository(),
+				Auth:    NewAuthRepository(),
+				Clients: NewClientRepository(),
+				Keys:    NewKeyRepository(),
+				Roles:   NewRoleRepository(),
+			}, nil
+		},
+		Queue: func(s *registry.Settings) (repositories.QueueRepository, error) {
+			return NewQueueRepository(), nil
+		},
+		Email: func(s *registry.Settings) (repositories.EmailRepository, error) {
+			return NewEmailRepository(), nil
+		},
+	})
+}
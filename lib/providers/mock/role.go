@@ -0,0 +1,64 @@
+package mock
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/repositories"
+)
+
+type roleRepository struct {
+	mu sync.Mutex
+	db map[string]models.Role
+}
+
+// NewRoleRepository ...
+func NewRoleRepository() repositories.RoleRepository {
+	return &roleRepository{
+		db: make(map[string]models.Role),
+	}
+}
+
+// FindAll returns roles ordered by name
+func (r *roleRepository) FindAll(ctx context.Context) ([]models.Role, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	roles := make([]models.Role, 0, len(r.db))
+	for _, role := range r.db {
+		roles = append(roles, role)
+	}
+
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].Name < roles[j].Name
+	})
+
+	return roles, nil
+}
+
+// FindByName ...
+func (r *roleRepository) FindByName(ctx context.Context, name string) (*models.Role, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	role, ok := r.db[name]
+	if !ok {
+		return nil, models.ErrRoleNotFound
+	}
+
+	return &role, nil
+}
+
+// Save ...
+func (r *roleRepository) Save(ctx context.Context, data *models.Role) (*models.Role, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	role := *data
+	role.Permissions = append([]string(nil), data.Permissions...)
+	r.db[data.Name] = role
+
+	return data, nil
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/stiks/gobs/lib/models"
 	"github.com/stiks/gobs/lib/repositories"
 	"github.com/stiks/gobs/pkg/helpers"
+	"github.com/stiks/gobs/pkg/tenant"
 )
 
 var (
@@ -73,7 +74,7 @@ var (
 // NewUserRepository ...
 func NewUserRepository() repositories.UserRepository {
 	return &userRepository{
-		db: _usersList,
+		db: append([]models.User(nil), _usersList...),
 	}
 }
 
@@ -84,7 +85,7 @@ type userRepository struct {
 // FindByUsername ...
 func (r *userRepository) FindByUsername(ctx context.Context, username string) (*models.User, error) {
 	for _, key := range r.db {
-		if key.Email == username {
+		if key.Email == username && inTenant(ctx, key.TenantID) {
 			return &key, nil
 		}
 	}
@@ -94,10 +95,14 @@ func (r *userRepository) FindByUsername(ctx context.Context, username string) (*
 
 // FindByResetHash ...
 func (r *userRepository) FindByResetHash(ctx context.Context, hash string) (*models.User, error) {
+	if hash == "" {
+		return nil, models.ErrUserNotFound
+	}
+
 	for _, key := range r.db {
 		log.Printf("PWD: %s HASH: %s", key.PasswordResetHash, hash)
 
-		if key.PasswordResetHash == hash {
+		if key.PasswordResetHash == hash && inTenant(ctx, key.TenantID) {
 			return &key, nil
 		}
 	}
@@ -105,20 +110,63 @@ func (r *userRepository) FindByResetHash(ctx context.Context, hash string) (*mod
 	return nil, models.ErrUserNotFound
 }
 
+// filter returns users matching params in insertion order
+func (r *userRepository) filter(ctx context.Context, params *models.UserQueryParams) []models.User {
+	var users []models.User
+	for _, u := range r.db {
+		if !inTenant(ctx, u.TenantID) {
+			continue
+		}
+
+		if params == nil {
+			users = append(users, u)
+
+			continue
+		}
+
+		if params.Role != "" && u.Role != params.Role {
+			continue
+		}
+
+		if params.Status != nil && u.Status != *params.Status {
+			continue
+		}
+
+		if params.OwnerID != nil && u.OwnerID != *params.OwnerID {
+			continue
+		}
+
+		if !matches(params.Query, u.Email, u.FirstName, u.LastName) {
+			continue
+		}
+
+		users = append(users, u)
+	}
+
+	return users
+}
+
 // FindAll ...
 func (r *userRepository) FindAll(ctx context.Context, params *models.UserQueryParams) ([]models.User, error) {
-	return r.db, nil
+	users := r.filter(ctx, params)
+
+	if params != nil {
+		from, to := paginate(len(users), params.Page, params.PerPage)
+		users = users[from:to]
+	}
+
+	return users, nil
 }
 
 // CountAll ...
 func (r *userRepository) CountAll(ctx context.Context, params *models.UserQueryParams) (int, error) {
-	return len(r.db), nil
+	return len(r.filter(ctx, params)), nil
 }
 
 // FindByID ...
 func (r *userRepository) FindByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
 	for _, key := range r.db {
-		if key.ID == id {
+		if key.ID == id && inTenant(ctx, key.TenantID) {
 			return &key, nil
 		}
 	}
@@ -134,6 +182,10 @@ func (r *userRepository) Create(ctx context.Context, data *models.User) (*models
 		}
 	}
 
+	if id, ok := tenant.FromContext(ctx); ok {
+		data.TenantID = id
+	}
+
 	r.db = append(r.db, *data)
 
 	return data, nil
@@ -141,15 +193,25 @@ func (r *userRepository) Create(ctx context.Context, data *models.User) (*models
 
 // Update ...
 func (r *userRepository) Update(ctx context.Context, data *models.User) (*models.User, error) {
+	if _, err := r.FindByID(ctx, data.ID); err != nil {
+		return nil, err
+	}
+
+	for _, i := range r.db {
+		if i.ID != data.ID && i.Email == data.Email {
+			return nil, models.ErrUsernameTaken
+		}
+	}
+
+	// records never move between tenants
 	for k, i := range r.db {
 		if i.ID == data.ID {
 			r.db[k] = *data
-
-			return data, nil
+			r.db[k].TenantID = i.TenantID
 		}
 	}
 
-	return nil, models.ErrUserNotFound
+	return data, nil
 }
 
 // Delete ...
@@ -0,0 +1,41 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+
+	"github.com/stiks/gobs/lib/providers/sqlstore"
+)
+
+// Open connects to the database described by dsn and checks that it is reachable
+func Open(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Dialect of the shared repositories, see sqlstore.New
+var Dialect = sqlstore.Dialect{
+	Numbered:          true,
+	SkipLocked:        true,
+	IsUniqueViolation: isUniqueViolation,
+}
+
+// isUniqueViolation reports whether err was caused by a unique constraint
+func isUniqueViolation(err error) bool {
+	if e, ok := err.(*pq.Error); ok {
+		return e.Code.Name() == "unique_violation"
+	}
+
+	return false
+}
@@ -0,0 +1,328 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/stiks/gobs/pkg/migrate"
+)
+
+// Migrations of the PostgreSQL schema, append new ones and never edit applied ones
+var Migrations = []migrate.Migration{
+	{
+		Version: 1,
+		Name:    "create users",
+		Up: `
+			CREATE TABLE users (
+				id                  UUID PRIMARY KEY,
+				first_name          VARCHAR(255) NOT NULL DEFAULT '',
+				last_name           VARCHAR(255) NOT NULL DEFAULT '',
+				email               VARCHAR(255) NOT NULL UNIQUE,
+				verified            BOOLEAN NOT NULL DEFAULT FALSE,
+				password_hash       BYTEA,
+				password_reset_hash VARCHAR(128) NOT NULL DEFAULT '',
+				validation_hash     VARCHAR(128) NOT NULL DEFAULT '',
+				role                VARCHAR(128) NOT NULL DEFAULT '',
+				status              INTEGER NOT NULL DEFAULT 0,
+				is_deleted          BOOLEAN NOT NULL DEFAULT FALSE,
+				owner_id            UUID,
+				locked              BOOLEAN NOT NULL DEFAULT FALSE,
+				is_active           BOOLEAN NOT NULL DEFAULT FALSE,
+				password_reset_at   TIMESTAMP,
+				created_at          TIMESTAMP,
+				updated_at          TIMESTAMP,
+				last_login          TIMESTAMP
+			);
+
+			CREATE INDEX users_password_reset_hash_idx ON users (password_reset_hash);
+
+			CREATE INDEX users_validation_hash_idx ON users (validation_hash);
+		`,
+		Down: `DROP TABLE users`,
+	},
+	{
+		Version: 2,
+		Name:    "create clients",
+		Up: `
+			CREATE TABLE clients (
+				id         UUID PRIMARY KEY,
+				name       VARCHAR(255) NOT NULL DEFAULT '',
+				email      VARCHAR(255) NOT NULL UNIQUE,
+				status     INTEGER NOT NULL DEFAULT 0,
+				owner_id   UUID,
+				created_at TIMESTAMP,
+				updated_at TIMESTAMP
+			);
+		`,
+		Down: `DROP TABLE clients`,
+	},
+	{
+		Version: 3,
+		Name:    "create auth clients",
+		Up: `
+			CREATE TABLE auth_clients (
+				id            UUID PRIMARY KEY,
+				client_id     VARCHAR(255) NOT NULL UNIQUE,
+				client_secret VARCHAR(255) NOT NULL
+			);
+		`,
+		Down: `DROP TABLE auth_clients`,
+	},
+	{
+		Version: 4,
+		Name:    "create tokens",
+		Up: `
+			CREATE TABLE tokens (
+				id         UUID PRIMARY KEY,
+				client_id  UUID NOT NULL,
+				user_id    UUID NOT NULL,
+				token      VARCHAR(255) NOT NULL,
+				expires_at BIGINT NOT NULL DEFAULT 0
+			);
+
+			CREATE INDEX tokens_client_user_idx ON tokens (client_id, user_id);
+
+			CREATE INDEX tokens_client_token_idx ON tokens (client_id, token);
+		`,
+		Down: `DROP TABLE tokens`,
+	},
+	{
+		Version: 5,
+		Name:    "add email confirmation expiry",
+		Up: `
+			ALTER TABLE users ADD COLUMN validation_sent_at TIMESTAMP NOT NULL DEFAULT '0001-01-01 00:00:00';
+
+			ALTER TABLE users ADD COLUMN validation_expires_at TIMESTAMP NOT NULL DEFAULT '0001-01-01 00:00:00';
+		`,
+		Down: `
+			ALTER TABLE users DROP COLUMN validation_expires_at;
+
+			ALTER TABLE users DROP COLUMN validation_sent_at;
+		`,
+	},
+	{
+		Version: 6,
+		Name:    "add auth client role and scope",
+		Up: `
+			ALTER TABLE auth_clients ADD COLUMN role VARCHAR(32) NOT NULL DEFAULT '';
+
+			ALTER TABLE auth_clients ADD COLUMN scope TEXT NOT NULL DEFAULT '';
+		`,
+		Down: `
+			ALTER TABLE auth_clients DROP COLUMN scope;
+
+			ALTER TABLE auth_clients DROP COLUMN role;
+		`,
+	},
+	{
+		Version: 7,
+		Name:    "create authorization codes and consents",
+		Up: `
+			ALTER TABLE auth_clients ADD COLUMN redirect_uris TEXT NOT NULL DEFAULT '';
+
+			CREATE TABLE authorization_codes (
+				id             UUID PRIMARY KEY,
+				code           VARCHAR(255) NOT NULL UNIQUE,
+				client_id      UUID NOT NULL,
+				user_id        UUID NOT NULL,
+				redirect_uri   TEXT NOT NULL,
+				scope          TEXT NOT NULL DEFAULT '',
+				code_challenge VARCHAR(128) NOT NULL,
+				expires_at     TIMESTAMP NOT NULL,
+				created_at     TIMESTAMP NOT NULL
+			);
+
+			CREATE TABLE consents (
+				id         UUID PRIMARY KEY,
+				client_id  UUID NOT NULL,
+				user_id    UUID NOT NULL,
+				scope      TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL,
+				UNIQUE (client_id, user_id)
+			);
+		`,
+		Down: `
+			DROP TABLE consents;
+
+			DROP TABLE authorization_codes;
+
+			ALTER TABLE auth_clients DROP COLUMN redirect_uris;
+		`,
+	},
+	{
+		Version: 8,
+		Name:    "create revoked tokens",
+		Up: `
+			CREATE TABLE revoked_tokens (
+				id         UUID PRIMARY KEY,
+				expires_at TIMESTAMP NOT NULL
+			);
+
+			CREATE INDEX revoked_tokens_expires_idx ON revoked_tokens (expires_at);
+		`,
+		Down: `DROP TABLE revoked_tokens`,
+	},
+	{
+		Version: 9,
+		Name:    "create signing keys",
+		Up: `
+			CREATE TABLE signing_keys (
+				id          VARCHAR(64) PRIMARY KEY,
+				algorithm   VARCHAR(16) NOT NULL,
+				private_key BYTEA NOT NULL,
+				created_at  TIMESTAMP NOT NULL,
+				retired_at  TIMESTAMP NOT NULL DEFAULT '0001-01-01 00:00:00',
+				expires_at  TIMESTAMP NOT NULL DEFAULT '0001-01-01 00:00:00'
+			);
+		`,
+		Down: `DROP TABLE signing_keys`,
+	},
+	{
+		Version: 10,
+		Name:    "add authorization code nonce",
+		Up:      `ALTER TABLE authorization_codes ADD COLUMN nonce VARCHAR(255) NOT NULL DEFAULT ''`,
+		Down:    `ALTER TABLE authorization_codes DROP COLUMN nonce`,
+	},
+	{
+		Version: 11,
+		Name:    "create roles",
+		Up: `
+			CREATE TABLE roles (
+				name        VARCHAR(32) PRIMARY KEY,
+				permissions TEXT NOT NULL DEFAULT '',
+				updated_at  TIMESTAMP NOT NULL
+			);
+		`,
+		Down: `DROP TABLE roles`,
+	},
+	{
+		Version: 12,
+		Name:    "add tenants",
+		Up: `
+			ALTER TABLE users ADD COLUMN tenant_id UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000000';
+			ALTER TABLE clients ADD COLUMN tenant_id UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000000';
+
+			CREATE INDEX users_tenant_idx ON users (tenant_id);
+			CREATE INDEX clients_tenant_idx ON clients (tenant_id);
+		`,
+		Down: `
+			DROP INDEX clients_tenant_idx;
+			DROP INDEX users_tenant_idx;
+
+			ALTER TABLE clients DROP COLUMN tenant_id;
+			ALTER TABLE users DROP COLUMN tenant_id;
+		`,
+	},
+	{
+		Version: 13,
+		Name:    "add mfa",
+		Up: `
+			ALTER TABLE users ADD COLUMN mfa_secret TEXT NOT NULL DEFAULT '';
+			ALTER TABLE users ADD COLUMN mfa_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+			ALTER TABLE users ADD COLUMN mfa_recovery_codes TEXT NOT NULL DEFAULT '';
+			ALTER TABLE users ADD COLUMN mfa_last_step BIGINT NOT NULL DEFAULT 0;
+			ALTER TABLE roles ADD COLUMN mfa_required BOOLEAN NOT NULL DEFAULT FALSE;
+		`,
+		Down: `
+			ALTER TABLE roles DROP COLUMN mfa_required;
+			ALTER TABLE users DROP COLUMN mfa_last_step;
+			ALTER TABLE users DROP COLUMN mfa_recovery_codes;
+			ALTER TABLE users DROP COLUMN mfa_enabled;
+			ALTER TABLE users DROP COLUMN mfa_secret;
+		`,
+	},
+	{
+		Version: 14,
+		Name:    "create login attempts",
+		Up: `
+			CREATE TABLE login_attempts (
+				key             VARCHAR(255) PRIMARY KEY,
+				failures        INTEGER NOT NULL DEFAULT 0,
+				last_failure_at TIMESTAMP NOT NULL,
+				locked_until    TIMESTAMP NOT NULL
+			);
+		`,
+		Down: `DROP TABLE login_attempts`,
+	},
+	{
+		Version: 15,
+		Name:    "create queue tasks",
+		Up: `
+			CREATE TABLE queue_tasks (
+				id           BIGSERIAL PRIMARY KEY,
+				queue        VARCHAR(255) NOT NULL,
+				payload      BYTEA,
+				content_type VARCHAR(255) NOT NULL,
+				attempts     INTEGER NOT NULL DEFAULT 0,
+				available_at BIGINT NOT NULL,
+				created_at   TIMESTAMP
+			);
+
+			CREATE INDEX queue_tasks_available_idx ON queue_tasks (available_at, id);
+		`,
+		Down: `DROP TABLE queue_tasks`,
+	},
+	{
+		Version: 16,
+		Name:    "add refresh token scope",
+		Up: `
+			ALTER TABLE tokens ADD COLUMN scope TEXT NOT NULL DEFAULT '';
+
+			UPDATE tokens SET scope = COALESCE((SELECT scope FROM auth_clients WHERE auth_clients.id = tokens.client_id), '');
+		`,
+		Down: `ALTER TABLE tokens DROP COLUMN scope`,
+	},
+	{
+		Version: 17,
+		Name:    "create locks",
+		Up: `
+			CREATE TABLE locks (
+				name       VARCHAR(64) PRIMARY KEY,
+				holder     VARCHAR(64) NOT NULL,
+				expires_at BIGINT NOT NULL
+			);
+		`,
+		Down: `DROP TABLE locks`,
+	},
+	{
+		Version: 18,
+		Name:    "grant resource scopes to existing auth clients",
+		// clients were not limited by scope before, so they keep their access
+		Up: `
+			UPDATE auth_clients SET scope = 'users:read users:write clients:read clients:write' WHERE scope = '';
+
+			UPDATE tokens SET scope = COALESCE((SELECT scope FROM auth_clients WHERE auth_clients.id = tokens.client_id), '') WHERE scope = '';
+		`,
+		Down: `UPDATE auth_clients SET scope = '' WHERE scope = 'users:read users:write clients:read clients:write'`,
+	},
+	{
+		Version: 19,
+		Name:    "add auth time",
+		Up: `
+			ALTER TABLE tokens ADD COLUMN auth_time BIGINT NOT NULL DEFAULT 0;
+			ALTER TABLE authorization_codes ADD COLUMN auth_time BIGINT NOT NULL DEFAULT 0;
+		`,
+		Down: `
+			ALTER TABLE authorization_codes DROP COLUMN auth_time;
+			ALTER TABLE tokens DROP COLUMN auth_time;
+		`,
+	},
+}
+
+// NewMigrator returns migrator for PostgreSQL schema
+func NewMigrator(db *sql.DB) (*migrate.Migrator, error) {
+	return migrate.New(db, migrate.Postgres{}, Migrations)
+}
+
+// Migrate applies pending migrations
+func Migrate(ctx context.Context, db *sql.DB) error {
+	m, err := NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.Up(ctx)
+
+	return err
+}
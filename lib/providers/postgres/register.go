@@ -0,0 +1,83 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/stiks/gobs/lib/providers/registry"
+	"github.com/stiks/gobs/lib/providers/sqlstore"
+	"github.com/stiks/gobs/lib/repositories"
+)
+
+func init() {
+	registry.Register("postgres", registry.Provider{
+		Validate: validate,
+		Data: func(s *registry.Settings) (*registry.Data, error) {
+			db, err := shared(s)
+			if err != nil {
+				return nil, err
+			}
+
+			return &registry.Data{
+				Users:   sqlstore.NewUserRepository(db),
+				Auth:    sqlstore.NewAuthRepository(db),
+				Clients: sqlstore.NewClientRepository(db),
+				Keys:    sqlstore.NewKeyRepository(db),
+				Roles:   sqlstore.NewRoleRepository(db),
+			}, nil
+		},
+		Queue: func(s *registry.Settings) (repositories.QueueRepository, error) {
+			db, err := shared(s)
+			if err != nil {
+				return nil, err
+			}
+
+			interval := sqlstore.QueueInterval
+			if v := s.Get("POSTGRES_QUEUE_INTERVAL"); v != "" {
+				interval, _ = time.ParseDuration(v)
+			}
+
+			s.Go("postgres queue worker", sqlstore.NewQueueWorker(db, s.Handler(), "/api", interval).Run)
+
+			return sqlstore.NewQueueRepository(db), nil
+		},
+	})
+}
+
+func validate(s *registry.Settings) error {
+	if err := s.Require("DATABASE_URL"); err != nil {
+		return err
+	}
+
+	if v := s.Get("POSTGRES_QUEUE_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err != nil || d <= 0 {
+			return fmt.Errorf("POSTGRES_QUEUE_INTERVAL must be a positive duration, got %q", v)
+		}
+	}
+
+	return nil
+}
+
+// shared opens and migrates the database once for data and queue providers
+func shared(s *registry.Settings) (*sqlstore.DB, error) {
+	v, err := s.Shared("postgres", func() (interface{}, error) {
+		db, err := Open(s.Get("DATABASE_URL"))
+		if err != nil {
+			return nil, err
+		}
+
+		s.OnClose("postgres", db.Close)
+
+		if err := Migrate(context.Background(), db); err != nil {
+			return nil, err
+		}
+
+		return sqlstore.New(db, Dialect), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*sqlstore.DB), nil
+}
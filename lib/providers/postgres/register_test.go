@@ -0,0 +1,40 @@
+package postgres_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	_ "github.com/stiks/gobs/lib/providers/dummy"
+	_ "github.com/stiks/gobs/lib/providers/mock"
+	"github.com/stiks/gobs/lib/providers/registry"
+)
+
+func TestPostgres_Register(t *testing.T) {
+	selection := registry.Selection{
+		registry.KindData:  "postgres",
+		registry.KindQueue: "postgres",
+		registry.KindCache: "dummy",
+		registry.KindEmail: "mock",
+	}
+
+	lookup := func(values map[string]string) func(string) string {
+		return func(key string) string { return values[key] }
+	}
+
+	t.Run("Invalid settings", func(t *testing.T) {
+		_, err := registry.Build(selection, lookup(map[string]string{
+			"DATABASE_URL":            "postgres://nobody@127.0.0.1:1/gobs?sslmode=disable",
+			"POSTGRES_QUEUE_INTERVAL": "often",
+		}), nil)
+
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "POSTGRES_QUEUE_INTERVAL must be a positive duration")
+		}
+
+		_, err = registry.Build(selection, lookup(map[string]string{}), nil)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "DATABASE_URL must be set")
+		}
+	})
+}
@@ -0,0 +1,116 @@
+package redis
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/repositories"
+	"github.com/stiks/gobs/pkg/xlog"
+)
+
+// cacheRepository stores values gob encoded, as memcache.Gob of appengine
+// provider does, so fields hidden from JSON such as password hash survive
+type cacheRepository struct {
+	client *Client
+	ttl    time.Duration
+}
+
+// NewCacheRepository returns cache, ttl applies to Create and Update and 0
+// keeps entries until the server evicts them
+func NewCacheRepository(client *Client, ttl time.Duration) repositories.ExpiringCacheRepository {
+	return &cacheRepository{
+		client: client,
+		ttl:    ttl,
+	}
+}
+
+func (r *cacheRepository) FindByKey(ctx context.Context, key string, obj interface{}) error {
+	reply, err := r.client.Do(ctx, "GET", key)
+	if err != nil {
+		xlog.Errorf(ctx, "Find by key error: %s", err.Error())
+
+		return err
+	}
+
+	data, ok := reply.(string)
+	if !ok {
+		return models.ErrMissCache
+	}
+
+	return gob.NewDecoder(strings.NewReader(data)).Decode(obj)
+}
+
+// FindWithTTL reads entry and time it has left, entry gone in between is a miss
+func (r *cacheRepository) FindWithTTL(ctx context.Context, key string, obj interface{}) (time.Duration, error) {
+	if err := r.FindByKey(ctx, key, obj); err != nil {
+		return 0, err
+	}
+
+	reply, err := r.client.Do(ctx, "PTTL", key)
+	if err != nil {
+		return 0, err
+	}
+
+	// -1 is entry without expiry, -2 is missing entry
+	ms, _ := reply.(int64)
+	if ms == -2 {
+		return 0, models.ErrMissCache
+	}
+
+	if ms < 0 {
+		return 0, nil
+	}
+
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+func (r *cacheRepository) Create(ctx context.Context, key string, data interface{}) error {
+	return r.SetWithTTL(ctx, key, data, r.ttl)
+}
+
+func (r *cacheRepository) Update(ctx context.Context, key string, data interface{}) error {
+	return r.SetWithTTL(ctx, key, data, r.ttl)
+}
+
+// SetWithTTL ...
+func (r *cacheRepository) SetWithTTL(ctx context.Context, key string, data interface{}, ttl time.Duration) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(data); err != nil {
+		return fmt.Errorf("%w: %s", models.ErrCache, err.Error())
+	}
+
+	args := []string{"SET", key, buf.String()}
+
+	// expiry below a millisecond would be rejected by the server
+	if ttl > 0 {
+		ms := ttl.Milliseconds()
+		if ms == 0 {
+			ms = 1
+		}
+
+		args = append(args, "PX", strconv.FormatInt(ms, 10))
+	}
+
+	_, err := r.client.Do(ctx, args...)
+
+	return err
+}
+
+func (r *cacheRepository) Delete(ctx context.Context, key string) error {
+	_, err := r.client.Do(ctx, "DEL", key)
+
+	return err
+}
+
+// Flush drops every key of the database, cache should have one of its own
+func (r *cacheRepository) Flush(ctx context.Context) error {
+	_, err := r.client.Do(ctx, "FLUSHDB")
+
+	return err
+}
@@ -0,0 +1,111 @@
+package redis_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/providers/redis"
+	"github.com/stiks/gobs/lib/providers/redis/redistest"
+	"github.com/stiks/gobs/lib/repositories"
+	"github.com/stiks/gobs/lib/repositories/repotest"
+)
+
+// _client returns client of fresh stand-in server
+func _client(t *testing.T) (*redis.Client, *redistest.Server) {
+	srv := redistest.NewServer(t)
+
+	opts, err := redis.ParseURL(srv.URL(1))
+	if err != nil {
+		t.Fatalf("Unable to parse URL: %s", err.Error())
+	}
+
+	client := redis.NewClient(opts)
+	t.Cleanup(func() { client.Close() })
+
+	return client, srv
+}
+
+func TestRedis_Cache_Contract(t *testing.T) {
+	repotest.CacheRepository(t, func(t *testing.T) repositories.CacheRepository {
+		client, _ := _client(t)
+
+		return redis.NewCacheRepository(client, time.Hour)
+	})
+}
+
+func TestRedis_Cache_Encoding(t *testing.T) {
+	client, _ := _client(t)
+	r := redis.NewCacheRepository(client, 0)
+
+	t.Run("Fields hidden from JSON are kept", func(t *testing.T) {
+		user := &models.User{Email: "peter@test.com", PasswordHash: []byte("hash"), MFASecret: "secret"}
+
+		found := new(models.User)
+		if assert.NoError(t, r.Create(context.Background(), "user", user)) && assert.NoError(t, r.FindByKey(context.Background(), "user", found)) {
+			assert.Equal(t, user.PasswordHash, found.PasswordHash)
+			assert.Equal(t, user.MFASecret, found.MFASecret)
+		}
+	})
+
+	t.Run("Value of other type", func(t *testing.T) {
+		_ = r.Create(context.Background(), "number", 42)
+		assert.Error(t, r.FindByKey(context.Background(), "number", new(models.User)))
+	})
+
+	t.Run("Nil value", func(t *testing.T) {
+		assert.Error(t, r.Create(context.Background(), "nil", nil))
+	})
+}
+
+func TestRedis_Cache_TTL(t *testing.T) {
+	client, srv := _client(t)
+	r := redis.NewCacheRepository(client, time.Minute)
+
+	ctx := context.Background()
+
+	assert.NoError(t, r.Create(ctx, "default", "value"))
+	assert.NoError(t, r.SetWithTTL(ctx, "short", "value", time.Second))
+	assert.NoError(t, r.SetWithTTL(ctx, "forever", "value", 0))
+
+	srv.FastForward(2 * time.Second)
+
+	var v string
+	assert.Equal(t, models.ErrMissCache, r.FindByKey(ctx, "short", &v))
+	assert.NoError(t, r.FindByKey(ctx, "default", &v))
+
+	if ttlRepo, ok := r.(repositories.TTLCacheRepository); assert.True(t, ok) {
+		left, err := ttlRepo.FindWithTTL(ctx, "default", &v)
+		if assert.NoError(t, err) {
+			assert.True(t, left > 50*time.Second && left <= 58*time.Second, "got %s", left)
+		}
+
+		left, err = ttlRepo.FindWithTTL(ctx, "forever", &v)
+		if assert.NoError(t, err) {
+			assert.Equal(t, time.Duration(0), left)
+		}
+
+		_, err = ttlRepo.FindWithTTL(ctx, "short", &v)
+		assert.Equal(t, models.ErrMissCache, err)
+	}
+
+	srv.FastForward(time.Hour)
+
+	assert.Equal(t, models.ErrMissCache, r.FindByKey(ctx, "default", &v))
+	assert.NoError(t, r.FindByKey(ctx, "forever", &v))
+}
+
+func TestRedis_Cache_Unavailable(t *testing.T) {
+	client, srv := _client(t)
+	r := redis.NewCacheRepository(client, 0)
+
+	srv.Close()
+
+	err := r.FindByKey(context.Background(), "key", new(string))
+	if assert.Error(t, err) {
+		assert.NotEqual(t, models.ErrMissCache, err, "outage is not a miss")
+	}
+}
@@ -0,0 +1,400 @@
+// Package redis provides cache backed by Redis or any server speaking RESP,
+// such as KeyDB or Dragonfly, so replicas of the application share one cache.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrPoolClosed is returned by commands issued after Close
+var ErrPoolClosed = errors.New("redis: client is closed")
+
+// Error is reply of the server to a failed command
+type Error string
+
+// Error ...
+func (e Error) Error() string {
+	return "redis: " + string(e)
+}
+
+// Options of connection, see ParseURL
+type Options struct {
+	Addr     string
+	Password string
+	DB       int
+	// PoolSize bounds number of open connections
+	PoolSize int
+	// Timeout of dial and of every command without context deadline
+	Timeout time.Duration
+}
+
+// ParseURL reads redis://[:password@]host[:port][/db] into options with
+// default pool size and timeout
+func ParseURL(raw string) (Options, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return Options{}, err
+	}
+
+	if u.Scheme != "redis" {
+		return Options{}, fmt.Errorf("unsupported scheme %q, expected redis", u.Scheme)
+	}
+
+	opts := Options{Addr: u.Host, PoolSize: 10, Timeout: 5 * time.Second}
+	if u.Port() == "" {
+		opts.Addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+
+	if u.User != nil {
+		opts.Password, _ = u.User.Password()
+	}
+
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if opts.DB, err = strconv.Atoi(db); err != nil || opts.DB < 0 {
+			return Options{}, fmt.Errorf("invalid database %q", db)
+		}
+	}
+
+	return opts, nil
+}
+
+// Client runs commands over pooled connections, safe for concurrent use
+type Client struct {
+	opts Options
+
+	// slots holds a token per connection which may be opened, idle keeps
+	// connections returned to the pool
+	slots  chan struct{}
+	idle   chan *conn
+	closed chan struct{}
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// NewClient returns client, connections are opened on demand
+func NewClient(opts Options) *Client {
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = 10
+	}
+
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+
+	c := &Client{
+		opts:   opts,
+		slots:  make(chan struct{}, opts.PoolSize),
+		idle:   make(chan *conn, opts.PoolSize),
+		closed: make(chan struct{}),
+	}
+
+	for i := 0; i < opts.PoolSize; i++ {
+		c.slots <- struct{}{}
+	}
+
+	return c
+}
+
+// Do runs command and returns its reply: string, int64, []interface{}, or nil
+// for missing value. Error replies are returned as Error.
+func (c *Client) Do(ctx context.Context, args ...string) (interface{}, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(c.opts.Timeout)
+	}
+
+	_ = cn.SetDeadline(deadline)
+
+	reply, err := cn.do(args...)
+
+	// error replies leave the connection usable, anything else may have left
+	// a reply unread
+	if _, ok := err.(Error); err != nil && !ok {
+		c.put(cn, true)
+
+		return nil, err
+	}
+
+	c.put(cn, false)
+
+	return reply, err
+}
+
+// Ping checks the server is reachable
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Do(ctx, "PING")
+
+	return err
+}
+
+// Subscribe listens to channel on connection of its own, outside of the pool.
+// It calls ready once subscribed and fn with payload of every message, and
+// returns when ctx is done, nil then, or when connection breaks.
+func (c *Client) Subscribe(ctx context.Context, channel string, ready func(), fn func(payload string)) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	select {
+	case <-c.closed:
+		return ErrPoolClosed
+	default:
+	}
+
+	cn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer cn.Close()
+
+	// blocked read is interrupted by closing the connection
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-c.closed:
+		case <-stop:
+		}
+
+		cn.Close()
+	}()
+
+	_ = cn.SetDeadline(time.Now().Add(c.opts.Timeout))
+
+	reply, err := cn.do("SUBSCRIBE", channel)
+	if err != nil {
+		return err
+	}
+
+	if v, ok := reply.([]interface{}); !ok || len(v) != 3 || v[0] != "subscribe" {
+		return fmt.Errorf("redis: unexpected reply %v", reply)
+	}
+
+	_ = cn.SetDeadline(time.Time{})
+
+	if ready != nil {
+		ready()
+	}
+
+	for {
+		reply, err := readReply(cn.r)
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-c.closed:
+				return ErrPoolClosed
+			default:
+				return err
+			}
+		}
+
+		if v, ok := reply.([]interface{}); ok && len(v) == 3 && v[0] == "message" {
+			if payload, ok := v[2].(string); ok {
+				fn(payload)
+			}
+		}
+	}
+}
+
+// Close closes idle connections, connections in use are closed once returned
+func (c *Client) Close() error {
+	select {
+	case <-c.closed:
+		return nil
+	default:
+	}
+
+	close(c.closed)
+
+	for {
+		select {
+		case cn := <-c.idle:
+			cn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// get returns idle connection or opens new one when pool is not full
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	select {
+	case <-c.closed:
+		return nil, ErrPoolClosed
+	default:
+	}
+
+	select {
+	case cn := <-c.idle:
+		return cn, nil
+	default:
+	}
+
+	select {
+	case cn := <-c.idle:
+		return cn, nil
+	case <-c.slots:
+	case <-c.closed:
+		return nil, ErrPoolClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	cn, err := c.dial(ctx)
+	if err != nil {
+		c.slots <- struct{}{}
+
+		return nil, err
+	}
+
+	return cn, nil
+}
+
+// put returns connection to the pool, broken one frees its slot
+func (c *Client) put(cn *conn, broken bool) {
+	select {
+	case <-c.closed:
+		broken = true
+	default:
+	}
+
+	if broken {
+		cn.Close()
+		c.slots <- struct{}{}
+
+		return
+	}
+
+	c.idle <- cn
+}
+
+// dial opens connection and selects database
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	d := net.Dialer{Timeout: c.opts.Timeout}
+
+	nc, err := d.DialContext(ctx, "tcp", c.opts.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	cn := &conn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+	_ = cn.SetDeadline(time.Now().Add(c.opts.Timeout))
+
+	if c.opts.Password != "" {
+		if _, err := cn.do("AUTH", c.opts.Password); err != nil {
+			cn.Close()
+
+			return nil, err
+		}
+	}
+
+	if c.opts.DB > 0 {
+		if _, err := cn.do("SELECT", strconv.Itoa(c.opts.DB)); err != nil {
+			cn.Close()
+
+			return nil, err
+		}
+	}
+
+	return cn, nil
+}
+
+// do writes command as array of bulk strings and reads reply
+func (cn *conn) do(args ...string) (interface{}, error) {
+	fmt.Fprintf(cn.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(cn.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	if err := cn.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	return readReply(cn.r)
+}
+
+// readReply reads one RESP value
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, Error(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+
+		return string(b[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = readReply(r); err != nil {
+				if _, ok := err.(Error); !ok {
+					return nil, err
+				}
+			}
+		}
+
+		return values, nil
+	}
+
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
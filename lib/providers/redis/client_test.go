@@ -0,0 +1,150 @@
+package redis_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/providers/redis"
+	"github.com/stiks/gobs/lib/providers/redis/redistest"
+)
+
+func TestRedis_ParseURL(t *testing.T) {
+	opts, err := redis.ParseURL("redis://:secret@cache:6380/2")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "cache:6380", opts.Addr)
+		assert.Equal(t, "secret", opts.Password)
+		assert.Equal(t, 2, opts.DB)
+		assert.Equal(t, 10, opts.PoolSize)
+	}
+
+	opts, err = redis.ParseURL("redis://cache")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "cache:6379", opts.Addr)
+		assert.Zero(t, opts.DB)
+	}
+
+	for _, raw := range []string{"http://cache", "redis://cache/db", "redis://cache/-1"} {
+		_, err := redis.ParseURL(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestRedis_Client_Do(t *testing.T) {
+	client, _ := _client(t)
+	ctx := context.Background()
+
+	reply, err := client.Do(ctx, "SET", "key", "line\r\nbreak")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "OK", reply)
+	}
+
+	reply, err = client.Do(ctx, "GET", "key")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "line\r\nbreak", reply)
+	}
+
+	reply, err = client.Do(ctx, "EXISTS", "key", "missing")
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(1), reply)
+	}
+
+	reply, err = client.Do(ctx, "GET", "missing")
+	if assert.NoError(t, err) {
+		assert.Nil(t, reply)
+	}
+
+	_, err = client.Do(ctx, "NOPE")
+	if assert.Error(t, err) {
+		assert.IsType(t, redis.Error(""), err)
+	}
+
+	assert.NoError(t, client.Ping(ctx), "connection survives error reply")
+}
+
+func TestRedis_Client_Auth(t *testing.T) {
+	srv := redistest.NewServer(t)
+	srv.RequirePassword("secret")
+
+	opts, _ := redis.ParseURL(srv.URL(3))
+	client := redis.NewClient(opts)
+	defer client.Close()
+
+	if assert.NoError(t, client.Ping(context.Background())) {
+		_, _ = client.Do(context.Background(), "SET", "key", "value")
+		assert.Equal(t, 1, srv.Keys(3), "database of URL is selected")
+	}
+
+	opts.Password = "wrong"
+	wrong := redis.NewClient(opts)
+	defer wrong.Close()
+
+	assert.Error(t, wrong.Ping(context.Background()))
+}
+
+func TestRedis_Client_Pool(t *testing.T) {
+	srv := redistest.NewServer(t)
+
+	opts, _ := redis.ParseURL(srv.URL(0))
+	opts.PoolSize = 2
+
+	client := redis.NewClient(opts)
+	defer client.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			assert.NoError(t, client.Ping(context.Background()))
+		}()
+	}
+
+	wg.Wait()
+
+	assert.True(t, srv.Accepted() <= 2, "pool opened %d connections", srv.Accepted())
+	assert.Equal(t, 20, srv.Commands("PING"))
+
+	t.Run("Closed", func(t *testing.T) {
+		assert.NoError(t, client.Close())
+		assert.Equal(t, redis.ErrPoolClosed, client.Ping(context.Background()))
+	})
+}
+
+func TestRedis_Client_Timeout(t *testing.T) {
+	// server accepting connections but never answering
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err.Error())
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	client := redis.NewClient(redis.Options{Addr: ln.Addr().String(), PoolSize: 1, Timeout: time.Second})
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	assert.Error(t, client.Ping(ctx))
+	assert.True(t, time.Since(start) < time.Second, "deadline of context is used")
+
+	assert.Error(t, client.Ping(context.Background()), "timed out connection is not reused")
+}
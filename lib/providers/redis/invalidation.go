@@ -0,0 +1,66 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/stiks/gobs/pkg/xlog"
+)
+
+// Invalidations fans out keys dropped from local cache tier of every replica
+// through pub/sub channel, see memory.TieredCache
+type Invalidations struct {
+	client  *Client
+	channel string
+	// id tells messages of this replica apart, it drops its own keys itself
+	id    string
+	retry time.Duration
+}
+
+// NewInvalidations returns fan-out over channel, replicas sharing a cache
+// must use the same one
+func NewInvalidations(client *Client, channel string) *Invalidations {
+	return &Invalidations{
+		client:  client,
+		channel: channel,
+		id:      uuid.New().String(),
+		retry:   time.Second,
+	}
+}
+
+// Publish sends key to other replicas, empty key drops every entry
+func (i *Invalidations) Publish(ctx context.Context, key string) error {
+	_, err := i.client.Do(ctx, "PUBLISH", i.channel, i.id+" "+key)
+
+	return err
+}
+
+// Listen calls drop with keys published by other replicas until ctx is done,
+// resubscribing when connection breaks. Messages sent meanwhile are lost, so
+// every entry is dropped once subscribed.
+func (i *Invalidations) Listen(ctx context.Context, drop func(key string)) error {
+	for {
+		err := i.client.Subscribe(ctx, i.channel, func() { drop("") }, func(payload string) {
+			parts := strings.SplitN(payload, " ", 2)
+			if len(parts) == 2 && parts[0] != i.id {
+				drop(parts[1])
+			}
+		})
+
+		switch {
+		case ctx.Err() != nil, err == ErrPoolClosed:
+			return nil
+		case err != nil:
+			xlog.Errorf(ctx, "Invalidation subscription error: %s", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(i.retry):
+		}
+	}
+}
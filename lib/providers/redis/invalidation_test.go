@@ -0,0 +1,110 @@
+package redis_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/providers/redis"
+	"github.com/stiks/gobs/lib/providers/redis/redistest"
+)
+
+// _dropped collects keys delivered to a replica
+type _dropped struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (d *_dropped) drop(key string) {
+	d.mu.Lock()
+	d.keys = append(d.keys, key)
+	d.mu.Unlock()
+}
+
+func (d *_dropped) get() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]string(nil), d.keys...)
+}
+
+// _listen runs Listen until the test ends and waits for subscription
+func _listen(t *testing.T, srv *redistest.Server, i *redis.Invalidations, subscribers int) *_dropped {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := new(_dropped)
+	done := make(chan struct{})
+
+	go func() {
+		_ = i.Listen(ctx, d.drop)
+		close(done)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	assert.Eventually(t, func() bool { return srv.Subscribers("invalidations") == subscribers }, time.Second, 5*time.Millisecond)
+
+	return d
+}
+
+func TestRedis_Client_Subscribe(t *testing.T) {
+	client, srv := _client(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	messages := make(chan string, 1)
+	done := make(chan error)
+
+	go func() {
+		done <- client.Subscribe(ctx, "channel", func() { messages <- "ready" }, func(payload string) { messages <- payload })
+	}()
+
+	assert.Equal(t, "ready", <-messages)
+
+	reply, err := client.Do(ctx, "PUBLISH", "channel", "hello")
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(1), reply)
+		assert.Equal(t, "hello", <-messages)
+	}
+
+	cancel()
+	assert.NoError(t, <-done, "cancelled subscription is not an error")
+
+	t.Run("Broken connection", func(t *testing.T) {
+		go func() { done <- client.Subscribe(context.Background(), "channel", nil, func(string) {}) }()
+
+		assert.Eventually(t, func() bool { return srv.Subscribers("channel") == 1 }, time.Second, 5*time.Millisecond)
+		srv.Disconnect()
+
+		assert.Error(t, <-done)
+	})
+}
+
+func TestRedis_Invalidations(t *testing.T) {
+	client, srv := _client(t)
+	ctx := context.Background()
+
+	first, second := redis.NewInvalidations(client, "invalidations"), redis.NewInvalidations(client, "invalidations")
+	firstDropped, secondDropped := _listen(t, srv, first, 1), _listen(t, srv, second, 2)
+
+	assert.NoError(t, first.Publish(ctx, "user_1"))
+	assert.NoError(t, second.Publish(ctx, "user 2"))
+
+	assert.Eventually(t, func() bool { return len(secondDropped.get()) == 2 }, time.Second, 5*time.Millisecond)
+	assert.Eventually(t, func() bool { return len(firstDropped.get()) == 2 }, time.Second, 5*time.Millisecond)
+
+	// both start with everything dropped on subscription, own keys are skipped
+	assert.Equal(t, []string{"", "user_1"}, secondDropped.get())
+	assert.Equal(t, []string{"", "user 2"}, firstDropped.get())
+
+	t.Run("Resubscribe", func(t *testing.T) {
+		srv.Disconnect()
+
+		assert.Eventually(t, func() bool { return len(firstDropped.get()) == 3 && srv.Subscribers("invalidations") == 2 }, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, "", firstDropped.get()[2], "messages may be lost meanwhile, so everything is dropped")
+	})
+}
@@ -0,0 +1,441 @@
+// Package redistest runs in-process stand-in for Redis, so providers speaking
+// RESP are tested without a server installed. It keeps data in memory and
+// knows only the commands the providers use.
+package redistest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type entry struct {
+	value   string
+	expires time.Time
+}
+
+// Server answers PING, AUTH, SELECT, GET, SET with EX or PX, DEL, EXISTS,
+// PTTL, FLUSHDB, PUBLISH and SUBSCRIBE
+type Server struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	dbs      map[int]map[string]entry
+	password string
+	offset   time.Duration
+	accepted int
+	commands map[string]int
+	sessions map[*session]bool
+}
+
+// NewServer starts server on random local port, it stops with the test
+func NewServer(t *testing.T) *Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to start RESP server: %s", err.Error())
+	}
+
+	s := &Server{
+		ln:       ln,
+		dbs:      make(map[int]map[string]entry),
+		commands: make(map[string]int),
+		sessions: make(map[*session]bool),
+	}
+
+	go s.serve()
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Addr returns host:port of the server
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// URL returns redis:// URL of database db
+func (s *Server) URL(db int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.password != "" {
+		return fmt.Sprintf("redis://:%s@%s/%d", s.password, s.Addr(), db)
+	}
+
+	return fmt.Sprintf("redis://%s/%d", s.Addr(), db)
+}
+
+// RequirePassword makes connections AUTH before other commands
+func (s *Server) RequirePassword(password string) {
+	s.mu.Lock()
+	s.password = password
+	s.mu.Unlock()
+}
+
+// FastForward moves clock of the server, so entries expire without waiting
+func (s *Server) FastForward(d time.Duration) {
+	s.mu.Lock()
+	s.offset += d
+	s.mu.Unlock()
+}
+
+// Accepted returns number of connections opened so far
+func (s *Server) Accepted() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.accepted
+}
+
+// Commands returns number of times command was received
+func (s *Server) Commands(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.commands[strings.ToUpper(name)]
+}
+
+// Keys returns number of live keys in database db
+func (s *Server) Keys(db int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for key := range s.dbs[db] {
+		if _, ok := s.lookup(db, key); ok {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Subscribers returns number of connections subscribed to channel
+func (s *Server) Subscribers(channel string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for sess := range s.sessions {
+		if sess.channels[channel] {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Disconnect closes open connections, server keeps accepting new ones
+func (s *Server) Disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for sess := range s.sessions {
+		sess.conn.Close()
+	}
+}
+
+// Close stops listening, open connections are dropped by clients
+func (s *Server) Close() {
+	s.ln.Close()
+}
+
+func (s *Server) serve() {
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.accepted++
+		s.mu.Unlock()
+
+		go s.handle(c)
+	}
+}
+
+// session is state of one connection. Replies are written under mutex of the
+// server and flushed under wmu, which publishing connections take after it.
+type session struct {
+	conn     net.Conn
+	db       int
+	authed   bool
+	channels map[string]bool
+
+	wmu sync.Mutex
+	w   *bufio.Writer
+}
+
+func (s *Server) handle(c net.Conn) {
+	defer c.Close()
+
+	r := bufio.NewReader(c)
+	sess := &session{conn: c, w: bufio.NewWriter(c), channels: make(map[string]bool)}
+
+	s.mu.Lock()
+	s.sessions[sess] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.sessions, sess)
+		s.mu.Unlock()
+	}()
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			if err != io.EOF {
+				sess.wmu.Lock()
+				fmt.Fprintf(sess.w, "-ERR %s\r\n", err.Error())
+				sess.w.Flush()
+				sess.wmu.Unlock()
+			}
+
+			return
+		}
+
+		s.exec(sess.w, sess, args)
+
+		sess.wmu.Lock()
+		err = sess.w.Flush()
+		sess.wmu.Unlock()
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readCommand reads array of bulk strings sent by clients
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	line = strings.TrimSuffix(line, "\r\n")
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("Protocol error: expected '*', got %q", line)
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("Protocol error: invalid multibulk length")
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		line = strings.TrimSuffix(line, "\r\n")
+		if !strings.HasPrefix(line, "$") {
+			return nil, fmt.Errorf("Protocol error: expected '$', got %q", line)
+		}
+
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("Protocol error: invalid bulk length")
+		}
+
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+
+		args[i] = string(b[:size])
+	}
+
+	return args, nil
+}
+
+func (s *Server) exec(w *bufio.Writer, sess *session, args []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := strings.ToUpper(args[0])
+	s.commands[name]++
+
+	if s.password != "" && !sess.authed && name != "AUTH" {
+		w.WriteString("-NOAUTH Authentication required.\r\n")
+
+		return
+	}
+
+	switch name {
+	case "PING":
+		w.WriteString("+PONG\r\n")
+	case "AUTH":
+		if len(args) != 2 || args[1] != s.password {
+			w.WriteString("-WRONGPASS invalid username-password pair\r\n")
+
+			return
+		}
+
+		sess.authed = true
+		w.WriteString("+OK\r\n")
+	case "SELECT":
+		db, err := strconv.Atoi(arg(args, 1))
+		if err != nil || db < 0 || db > 15 {
+			w.WriteString("-ERR DB index is out of range\r\n")
+
+			return
+		}
+
+		sess.db = db
+		w.WriteString("+OK\r\n")
+	case "GET":
+		e, ok := s.lookup(sess.db, arg(args, 1))
+		if !ok {
+			w.WriteString("$-1\r\n")
+
+			return
+		}
+
+		bulk(w, e.value)
+	case "SET":
+		s.set(w, sess, args)
+	case "DEL", "EXISTS":
+		n := 0
+		for _, key := range args[1:] {
+			if _, ok := s.lookup(sess.db, key); ok {
+				n++
+
+				if name == "DEL" {
+					delete(s.dbs[sess.db], key)
+				}
+			}
+		}
+
+		fmt.Fprintf(w, ":%d\r\n", n)
+	case "PTTL":
+		e, ok := s.lookup(sess.db, arg(args, 1))
+		switch {
+		case !ok:
+			w.WriteString(":-2\r\n")
+		case e.expires.IsZero():
+			w.WriteString(":-1\r\n")
+		default:
+			fmt.Fprintf(w, ":%d\r\n", e.expires.Sub(s.now()).Milliseconds())
+		}
+	case "FLUSHDB":
+		delete(s.dbs, sess.db)
+		w.WriteString("+OK\r\n")
+	case "SUBSCRIBE":
+		for _, channel := range args[1:] {
+			sess.channels[channel] = true
+			fmt.Fprintf(w, "*3\r\n$9\r\nsubscribe\r\n")
+			bulk(w, channel)
+			fmt.Fprintf(w, ":%d\r\n", len(sess.channels))
+		}
+	case "PUBLISH":
+		s.publish(w, sess, arg(args, 1), arg(args, 2))
+	default:
+		fmt.Fprintf(w, "-ERR unknown command '%s'\r\n", args[0])
+	}
+}
+
+// set handles SET key value [EX seconds|PX milliseconds]
+func (s *Server) set(w *bufio.Writer, sess *session, args []string) {
+	if len(args) != 3 && len(args) != 5 {
+		w.WriteString("-ERR syntax error\r\n")
+
+		return
+	}
+
+	e := entry{value: args[2]}
+
+	if len(args) == 5 {
+		n, err := strconv.ParseInt(args[4], 10, 64)
+		if err != nil || n <= 0 {
+			w.WriteString("-ERR invalid expire time in 'set' command\r\n")
+
+			return
+		}
+
+		switch strings.ToUpper(args[3]) {
+		case "EX":
+			e.expires = s.now().Add(time.Duration(n) * time.Second)
+		case "PX":
+			e.expires = s.now().Add(time.Duration(n) * time.Millisecond)
+		default:
+			w.WriteString("-ERR syntax error\r\n")
+
+			return
+		}
+	}
+
+	if s.dbs[sess.db] == nil {
+		s.dbs[sess.db] = make(map[string]entry)
+	}
+
+	s.dbs[sess.db][args[1]] = e
+	w.WriteString("+OK\r\n")
+}
+
+// publish delivers message to every subscribed connection, reply to the
+// publishing one is flushed by its own loop
+func (s *Server) publish(w *bufio.Writer, from *session, channel, message string) {
+	n := 0
+	for sess := range s.sessions {
+		if !sess.channels[channel] {
+			continue
+		}
+
+		if sess != from {
+			sess.wmu.Lock()
+		}
+
+		sess.w.WriteString("*3\r\n$7\r\nmessage\r\n")
+		bulk(sess.w, channel)
+		bulk(sess.w, message)
+
+		if sess != from {
+			sess.w.Flush()
+			sess.wmu.Unlock()
+		}
+
+		n++
+	}
+
+	fmt.Fprintf(w, ":%d\r\n", n)
+}
+
+// lookup returns live entry, expired one is removed
+func (s *Server) lookup(db int, key string) (entry, bool) {
+	e, ok := s.dbs[db][key]
+	if ok && !e.expires.IsZero() && !s.now().Before(e.expires) {
+		delete(s.dbs[db], key)
+
+		return entry{}, false
+	}
+
+	return e, ok
+}
+
+func (s *Server) now() time.Time {
+	return time.Now().Add(s.offset)
+}
+
+func arg(args []string, i int) string {
+	if i < len(args) {
+		return args[i]
+	}
+
+	return ""
+}
+
+func bulk(w *bufio.Writer, v string) {
+	fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+}
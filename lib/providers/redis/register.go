@@ -0,0 +1,131 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/stiks/gobs/lib/providers/memory"
+	"github.com/stiks/gobs/lib/providers/registry"
+	"github.com/stiks/gobs/lib/repositories"
+)
+
+// config of redis cache provider, 0 keeps client defaults and turns local
+// tier off
+type config struct {
+	URL      string        `env:"REDIS_URL" required:"true"`
+	PoolSize int           `env:"REDIS_POOL_SIZE"`
+	Timeout  time.Duration `env:"REDIS_TIMEOUT"`
+	CacheTTL time.Duration `env:"REDIS_CACHE_TTL"`
+	// LocalCacheTTL keeps local copies of entries, see memory.TieredCache
+	LocalCacheTTL        time.Duration `env:"REDIS_LOCAL_CACHE_TTL"`
+	LocalCacheMaxEntries int           `env:"REDIS_LOCAL_CACHE_MAX_ENTRIES"`
+}
+
+// Validate ...
+func (c *config) Validate() error {
+	var errs []string
+	if _, err := ParseURL(c.URL); err != nil {
+		errs = append(errs, fmt.Sprintf("REDIS_URL: %s", err.Error()))
+	}
+
+	if c.PoolSize < 0 {
+		errs = append(errs, "REDIS_POOL_SIZE can't be negative")
+	}
+
+	if c.LocalCacheMaxEntries < 0 {
+		errs = append(errs, "REDIS_LOCAL_CACHE_MAX_ENTRIES can't be negative")
+	}
+
+	if c.Timeout < 0 || c.CacheTTL < 0 || c.LocalCacheTTL < 0 {
+		errs = append(errs, "REDIS_TIMEOUT, REDIS_CACHE_TTL and REDIS_LOCAL_CACHE_TTL can't be negative")
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+func init() {
+	registry.Register("redis", registry.Provider{
+		Validate: validate,
+		Cache: func(s *registry.Settings) (repositories.CacheRepository, error) {
+			var cfg config
+			if err := s.Fill(&cfg); err != nil {
+				return nil, err
+			}
+
+			client, err := shared(s, cfg)
+			if err != nil {
+				return nil, err
+			}
+
+			cache := NewCacheRepository(client, cfg.CacheTTL)
+			if cfg.LocalCacheTTL == 0 {
+				return cache, nil
+			}
+
+			return tiered(s, cfg, client, cache), nil
+		},
+	})
+}
+
+// tiered keeps local copies of entries, replicas tell each other to drop them
+// through channel of the database
+func tiered(s *registry.Settings, cfg config, client *Client, remote repositories.CacheRepository) repositories.CacheRepository {
+	max := cfg.LocalCacheMaxEntries
+	if max == 0 {
+		max = memory.DefaultMaxEntries
+	}
+
+	opts, _ := ParseURL(cfg.URL)
+	invalidations := NewInvalidations(client, fmt.Sprintf("gobs:cache:%d", opts.DB))
+
+	local := memory.NewCacheRepository(memory.Options{MaxEntries: max, TTL: cfg.LocalCacheTTL})
+	cache := memory.NewTieredCache(local, remote, invalidations.Publish)
+
+	s.Go("redis cache invalidations", func(ctx context.Context) error {
+		return invalidations.Listen(ctx, cache.Drop)
+	})
+
+	return cache
+}
+
+func validate(s *registry.Settings) error {
+	var cfg config
+
+	return s.Fill(&cfg)
+}
+
+// shared opens one client for every kind using redis
+func shared(s *registry.Settings, cfg config) (*Client, error) {
+	v, err := s.Shared("redis", func() (interface{}, error) {
+		opts, _ := ParseURL(cfg.URL)
+
+		if cfg.PoolSize > 0 {
+			opts.PoolSize = cfg.PoolSize
+		}
+
+		if cfg.Timeout > 0 {
+			opts.Timeout = cfg.Timeout
+		}
+
+		client := NewClient(opts)
+		s.OnClose("redis", client.Close)
+
+		if err := client.Ping(context.Background()); err != nil {
+			return nil, err
+		}
+
+		return client, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*Client), nil
+}
@@ -0,0 +1,136 @@
+package redis_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	_ "github.com/stiks/gobs/lib/providers/mock"
+	"github.com/stiks/gobs/lib/providers/redis/redistest"
+	"github.com/stiks/gobs/lib/providers/registry"
+)
+
+func TestRedis_Register(t *testing.T) {
+	selection := registry.Selection{
+		registry.KindData:  "mock",
+		registry.KindQueue: "mock",
+		registry.KindCache: "redis",
+		registry.KindEmail: "mock",
+	}
+
+	lookup := func(values map[string]string) func(string) string {
+		return func(key string) string { return values[key] }
+	}
+
+	t.Run("Invalid settings", func(t *testing.T) {
+		_, err := registry.Build(selection, lookup(nil), nil)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "REDIS_URL must be set")
+		}
+
+		_, err = registry.Build(selection, lookup(map[string]string{
+			"REDIS_URL":       "redis://cache/0",
+			"REDIS_POOL_SIZE": "none",
+			"REDIS_CACHE_TTL": "soon",
+		}), nil)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), `REDIS_POOL_SIZE: invalid integer "none"`)
+		}
+
+		_, err = registry.Build(selection, lookup(map[string]string{"REDIS_URL": "redis://cache/0", "REDIS_CACHE_TTL": "soon"}), nil)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), `REDIS_CACHE_TTL: invalid duration "soon"`)
+		}
+	})
+
+	t.Run("Unreachable server", func(t *testing.T) {
+		srv := redistest.NewServer(t)
+		url := srv.URL(0)
+		srv.Close()
+
+		_, err := registry.Build(selection, lookup(map[string]string{"REDIS_URL": url, "REDIS_TIMEOUT": "1s"}), nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("Cache", func(t *testing.T) {
+		srv := redistest.NewServer(t)
+
+		providers, err := registry.Build(selection, lookup(map[string]string{
+			"REDIS_URL":       srv.URL(2),
+			"REDIS_POOL_SIZE": "4",
+			"REDIS_CACHE_TTL": "60",
+		}), nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.NoError(t, providers.Cache.Create(context.Background(), "key", "value"))
+		assert.Equal(t, 1, srv.Keys(2))
+
+		assert.NoError(t, providers.Close())
+	})
+	t.Run("Local tier", func(t *testing.T) {
+		srv := redistest.NewServer(t)
+		ctx := context.Background()
+
+		settings := lookup(map[string]string{
+			"REDIS_URL":             srv.URL(3),
+			"REDIS_LOCAL_CACHE_TTL": "1m",
+		})
+
+		// replicas of the application share the server
+		replicas := make([]*registry.Providers, 2)
+		for i := range replicas {
+			providers, err := registry.Build(selection, settings, nil)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			if assert.Len(t, providers.Workers(), 1) {
+				workerCtx, cancel := context.WithCancel(ctx)
+				done := make(chan struct{})
+
+				go func() {
+					_ = providers.Workers()[0].Run(workerCtx)
+					close(done)
+				}()
+
+				t.Cleanup(func() {
+					cancel()
+					<-done
+					providers.Close()
+				})
+			}
+
+			replicas[i] = providers
+		}
+
+		assert.Eventually(t, func() bool { return srv.Subscribers("gobs:cache:3") == 2 }, time.Second, 5*time.Millisecond)
+
+		first, second := replicas[0].Cache, replicas[1].Cache
+
+		var v string
+		assert.NoError(t, first.Create(ctx, "key", "old"))
+
+		// message of the write may drop the first copy, a later one stays
+		assert.Eventually(t, func() bool {
+			gets := srv.Commands("GET")
+
+			return second.FindByKey(ctx, "key", &v) == nil && srv.Commands("GET") == gets
+		}, time.Second, 5*time.Millisecond, "local copy is read")
+
+		assert.NoError(t, first.Update(ctx, "key", "new"))
+		assert.Eventually(t, func() bool {
+			return second.FindByKey(ctx, "key", &v) == nil && v == "new"
+		}, time.Second, 5*time.Millisecond, "local copy of other replica is dropped")
+	})
+
+	t.Run("Invalid local tier", func(t *testing.T) {
+		_, err := registry.Build(selection, lookup(map[string]string{"REDIS_URL": "redis://cache/0", "REDIS_LOCAL_CACHE_MAX_ENTRIES": "many"}), nil)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), `REDIS_LOCAL_CACHE_MAX_ENTRIES: invalid integer "many"`)
+		}
+	})
+}
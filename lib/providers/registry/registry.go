@@ -0,0 +1,190 @@
+// Package registry lets backends register under a name, so the application
+// picks them with configuration such as DB_PROVIDER=postgres instead of code.
+// Provider packages register themselves from init, the same way database/sql
+// drivers do, and main imports the ones it wants compiled in.
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/stiks/gobs/lib/repositories"
+)
+
+// Kinds of providers selected by configuration
+const (
+	KindData  = "DB_PROVIDER"
+	KindCache = "CACHE_PROVIDER"
+	KindQueue = "QUEUE_PROVIDER"
+	KindEmail = "EMAIL_PROVIDER"
+)
+
+// Data repositories backed by the same store
+type Data struct {
+	Users   repositories.UserRepository
+	Auth    repositories.AuthRepository
+	Clients repositories.ClientRepository
+	Keys    repositories.KeyRepository
+	Roles   repositories.RoleRepository
+}
+
+// Provider is a named backend, it implements one or more kinds
+type Provider struct {
+	// Validate checks settings of the provider before anything is opened, optional
+	Validate func(s *Settings) error
+
+	Data  func(s *Settings) (*Data, error)
+	Cache func(s *Settings) (repositories.CacheRepository, error)
+	Queue func(s *Settings) (repositories.QueueRepository, error)
+	Email func(s *Settings) (repositories.EmailRepository, error)
+}
+
+// implements reports whether provider can be used for kind
+func (p Provider) implements(kind string) bool {
+	switch kind {
+	case KindData:
+		return p.Data != nil
+	case KindCache:
+		return p.Cache != nil
+	case KindQueue:
+		return p.Queue != nil
+	case KindEmail:
+		return p.Email != nil
+	}
+
+	return false
+}
+
+var (
+	mu        sync.RWMutex
+	providers = make(map[string]Provider)
+)
+
+// Register makes provider available under name, it panics when name is
+// taken, which is a programming error
+func Register(name string, p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := providers[name]; ok {
+		panic("registry: provider " + name + " registered twice")
+	}
+
+	providers[name] = p
+}
+
+// Names returns providers implementing kind in alphabetical order
+func Names(kind string) []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	var names []string
+	for name, p := range providers {
+		if p.implements(kind) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Selection names provider for every kind
+type Selection map[string]string
+
+// Providers built from selection
+type Providers struct {
+	Data  *Data
+	Cache repositories.CacheRepository
+	Queue repositories.QueueRepository
+	Email repositories.EmailRepository
+
+	settings *Settings
+}
+
+// Workers started by providers, such as queue consumers, to run in background
+func (p *Providers) Workers() []Worker {
+	return p.settings.workers
+}
+
+// Close releases everything opened by providers in reverse order
+func (p *Providers) Close() error {
+	return p.settings.close()
+}
+
+// kinds in build order, data store first so queues may share it
+var kinds = []string{KindData, KindCache, KindQueue, KindEmail}
+
+// Build validates every selected provider, reporting all problems at once,
+// then opens them. lookup returns configuration values, e.g. os.Getenv, and
+// handler receives tasks delivered by embedded queues.
+func Build(selection Selection, lookup func(key string) string, handler http.Handler) (*Providers, error) {
+	settings := newSettings(lookup, handler)
+
+	selected := make(map[string]Provider)
+	var errs []string
+
+	mu.RLock()
+	for _, kind := range kinds {
+		if p, ok := providers[selection[kind]]; ok && p.implements(kind) {
+			selected[kind] = p
+		}
+	}
+	mu.RUnlock()
+
+	for _, kind := range kinds {
+		if _, ok := selected[kind]; !ok {
+			errs = append(errs, fmt.Sprintf("%s: unknown provider %q, available: %s", kind, selection[kind], strings.Join(Names(kind), ", ")))
+		}
+	}
+
+	// a provider selected for several kinds is validated once
+	validated := make(map[string]bool)
+	for _, kind := range kinds {
+		p, ok := selected[kind]
+		if !ok || p.Validate == nil || validated[selection[kind]] {
+			continue
+		}
+
+		validated[selection[kind]] = true
+
+		if err := p.Validate(settings); err != nil {
+			errs = append(errs, fmt.Sprintf("%s %s: %s", kind, selection[kind], err.Error()))
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.New(strings.Join(errs, "; "))
+	}
+
+	built := &Providers{settings: settings}
+
+	var err error
+	for _, kind := range kinds {
+		p := selected[kind]
+
+		switch kind {
+		case KindData:
+			built.Data, err = p.Data(settings)
+		case KindCache:
+			built.Cache, err = p.Cache(settings)
+		case KindQueue:
+			built.Queue, err = p.Queue(settings)
+		case KindEmail:
+			built.Email, err = p.Email(settings)
+		}
+
+		if err != nil {
+			settings.close()
+
+			return nil, fmt.Errorf("%s %s: %w", kind, selection[kind], err)
+		}
+	}
+
+	return built, nil
+}
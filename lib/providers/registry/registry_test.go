@@ -0,0 +1,151 @@
+package registry_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/providers/mock"
+	"github.com/stiks/gobs/lib/providers/registry"
+	"github.com/stiks/gobs/lib/repositories"
+)
+
+// _lookup returns configuration backed by map
+func _lookup(values map[string]string) func(string) string {
+	return func(key string) string {
+		return values[key]
+	}
+}
+
+func _selection(data, cache string) registry.Selection {
+	return registry.Selection{
+		registry.KindData:  data,
+		registry.KindCache: cache,
+		registry.KindQueue: "mock",
+		registry.KindEmail: "mock",
+	}
+}
+
+var _events []string
+
+func init() {
+	// shares one connection between data and cache, like sqlite does
+	connect := func(s *registry.Settings) (interface{}, error) {
+		return s.Shared("conn", func() (interface{}, error) {
+			_events = append(_events, "open")
+			s.OnClose("conn", func() error {
+				_events = append(_events, "close conn")
+
+				return nil
+			})
+
+			return s.Get("TEST_DSN"), nil
+		})
+	}
+
+	registry.Register("test", registry.Provider{
+		Validate: func(s *registry.Settings) error {
+			_events = append(_events, "validate")
+
+			return s.Require("TEST_DSN", "TEST_USER")
+		},
+		Data: func(s *registry.Settings) (*registry.Data, error) {
+			if _, err := connect(s); err != nil {
+				return nil, err
+			}
+
+			s.Go("test worker", func(ctx context.Context) error { return nil })
+
+			return &registry.Data{Users: mock.NewUserRepository()}, nil
+		},
+		Cache: func(s *registry.Settings) (repositories.CacheRepository, error) {
+			if _, err := connect(s); err != nil {
+				return nil, err
+			}
+
+			s.OnClose("cache", func() error {
+				_events = append(_events, "close cache")
+
+				return errors.New("already closed")
+			})
+
+			return mock.NewCacheRepository(), nil
+		},
+	})
+
+	registry.Register("broken", registry.Provider{
+		Cache: func(s *registry.Settings) (repositories.CacheRepository, error) {
+			return nil, errors.New("unreachable")
+		},
+	})
+}
+
+func TestRegistry_Register(t *testing.T) {
+	assert.Panics(t, func() {
+		registry.Register("test", registry.Provider{})
+	})
+}
+
+func TestRegistry_Names(t *testing.T) {
+	assert.Equal(t, []string{"broken", "test"}, registry.Names(registry.KindCache))
+	assert.Contains(t, registry.Names(registry.KindData), "mock")
+	assert.NotContains(t, registry.Names(registry.KindData), "broken")
+}
+
+func TestRegistry_Build(t *testing.T) {
+	t.Run("Every error is reported", func(t *testing.T) {
+		_, err := registry.Build(registry.Selection{
+			registry.KindData:  "test",
+			registry.KindCache: "redis",
+			registry.KindQueue: "dummy",
+			registry.KindEmail: "mock",
+		}, _lookup(nil), nil)
+
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), `CACHE_PROVIDER: unknown provider "redis", available: broken, test`)
+			assert.Contains(t, err.Error(), `QUEUE_PROVIDER: unknown provider "dummy"`)
+			assert.Contains(t, err.Error(), "DB_PROVIDER test: TEST_DSN, TEST_USER must be set")
+		}
+	})
+
+	t.Run("Shared resources", func(t *testing.T) {
+		_events = nil
+
+		providers, err := registry.Build(_selection("test", "test"), _lookup(map[string]string{"TEST_DSN": "dsn", "TEST_USER": "user"}), nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.NotNil(t, providers.Data.Users)
+		assert.NotNil(t, providers.Cache)
+		assert.NotNil(t, providers.Queue)
+		assert.NotNil(t, providers.Email)
+
+		if assert.Len(t, providers.Workers(), 1) {
+			assert.Equal(t, "test worker", providers.Workers()[0].Name)
+		}
+
+		err = providers.Close()
+		if assert.Error(t, err) {
+			assert.Equal(t, "cache: already closed", err.Error())
+		}
+
+		// validated and opened once although selected twice, closed in reverse order
+		assert.Equal(t, []string{"validate", "open", "close cache", "close conn"}, _events)
+
+		assert.NoError(t, providers.Close(), "second close is a no-op")
+	})
+
+	t.Run("Failed build closes opened providers", func(t *testing.T) {
+		_events = nil
+
+		_, err := registry.Build(_selection("test", "broken"), _lookup(map[string]string{"TEST_DSN": "dsn", "TEST_USER": "user"}), nil)
+		if assert.Error(t, err) {
+			assert.Equal(t, "CACHE_PROVIDER broken: unreachable", err.Error())
+		}
+
+		assert.Equal(t, []string{"validate", "open", "close conn"}, _events)
+	})
+}
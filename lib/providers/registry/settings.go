@@ -0,0 +1,126 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/stiks/gobs/pkg/config"
+)
+
+// Worker runs in background until ctx is cancelled
+type Worker struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+type closer struct {
+	name string
+	fn   func() error
+}
+
+// Settings gives providers access to configuration and lets them share
+// resources, e.g. sqlite data and queue providers use the same database file
+type Settings struct {
+	lookup  func(key string) string
+	handler http.Handler
+
+	shared  map[string]interface{}
+	closers []closer
+	workers []Worker
+}
+
+func newSettings(lookup func(key string) string, handler http.Handler) *Settings {
+	return &Settings{
+		lookup:  lookup,
+		handler: handler,
+		shared:  make(map[string]interface{}),
+	}
+}
+
+// Get returns configuration value or empty string
+func (s *Settings) Get(key string) string {
+	return strings.TrimSpace(s.lookup(key))
+}
+
+// Require returns single error naming every key which is not set
+func (s *Settings) Require(keys ...string) error {
+	var missing []string
+	for _, key := range keys {
+		if s.Get(key) == "" {
+			missing = append(missing, key)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%s must be set", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// Fill sets tagged fields of the struct dst points to like application config
+// does, see config.Source.Fill, empty values count as not set
+func (s *Settings) Fill(dst interface{}) error {
+	src, err := config.New(config.Options{Lookup: func(key string) (string, bool) {
+		v := s.Get(key)
+
+		return v, v != ""
+	}})
+	if err != nil {
+		return err
+	}
+
+	return src.Fill(dst)
+}
+
+// Handler receives tasks delivered by embedded queues, it serves task routes
+// only and is never exposed to clients
+func (s *Settings) Handler() http.Handler {
+	return s.handler
+}
+
+// Shared returns resource stored under key, open is called only the first time
+func (s *Settings) Shared(key string, open func() (interface{}, error)) (interface{}, error) {
+	if v, ok := s.shared[key]; ok {
+		return v, nil
+	}
+
+	v, err := open()
+	if err != nil {
+		return nil, err
+	}
+
+	s.shared[key] = v
+
+	return v, nil
+}
+
+// OnClose registers fn to release a resource, closers run in reverse order
+func (s *Settings) OnClose(name string, fn func() error) {
+	s.closers = append(s.closers, closer{name: name, fn: fn})
+}
+
+// Go registers background worker, the application starts it once it is ready to serve
+func (s *Settings) Go(name string, run func(ctx context.Context) error) {
+	s.workers = append(s.workers, Worker{Name: name, Run: run})
+}
+
+func (s *Settings) close() error {
+	var errs []string
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		if err := s.closers[i].fn(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", s.closers[i].name, err.Error()))
+		}
+	}
+
+	s.closers = nil
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package sqlite_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/providers/sqlite"
+	"github.com/stiks/gobs/lib/providers/sqlstore"
+	"github.com/stiks/gobs/lib/repositories"
+	"github.com/stiks/gobs/lib/repositories/repotest"
+	"github.com/stiks/gobs/pkg/helpers"
+)
+
+// _store returns shared repositories in sqlite dialect over _db
+func _store(t *testing.T) *sqlstore.DB {
+	return sqlstore.New(_db(t), sqlite.Dialect)
+}
+
+func TestSqlite_User_Contract(t *testing.T) {
+	repotest.UserRepository(t, func(t *testing.T) repositories.UserRepository {
+		return sqlstore.NewUserRepository(_store(t))
+	})
+}
+
+func TestSqlite_Client_Contract(t *testing.T) {
+	repotest.ClientRepository(t, func(t *testing.T) repositories.ClientRepository {
+		return sqlstore.NewClientRepository(_store(t))
+	})
+}
+
+func TestSqlite_Key_Contract(t *testing.T) {
+	repotest.KeyRepository(t, func(t *testing.T) repositories.KeyRepository {
+		return sqlstore.NewKeyRepository(_store(t))
+	})
+}
+
+func TestSqlite_Role_Contract(t *testing.T) {
+	repotest.RoleRepository(t, func(t *testing.T) repositories.RoleRepository {
+		return sqlstore.NewRoleRepository(_store(t))
+	})
+}
+
+func TestSqlite_Auth_Contract(t *testing.T) {
+	repotest.AuthRepository(t, func(t *testing.T) (repositories.AuthRepository, repotest.AuthFixture) {
+		return sqlstore.NewAuthRepository(_store(t)), repotest.AuthFixture{
+			User: models.User{
+				ID:           helpers.UUIDFromString(t, "775a5b37-1742-4e54-9439-0357e768b011"),
+				Email:        "peter@test.com",
+				PasswordHash: []byte("$2a$10$kPrRofMm9VnE5w9ih6FwtuiuY/fIJ7/pcwvAmvL/3x3t2I144hyyq"),
+				Role:         models.RoleSuperUser,
+			},
+			Client: models.AuthClient{
+				ID:           helpers.UUIDFromString(t, "775a5b37-1742-4e54-9439-0357e768b011"),
+				ClientID:     "SecRetAuthKey",
+				ClientSecret: "SecretSuper",
+				Role:         models.RoleClient,
+				Scope:        "users:read clients:read",
+				RedirectURIs: []string{"https://app.test/callback"},
+			},
+		}
+	})
+}
+
+func TestSqlite_Queue_Contract(t *testing.T) {
+	repotest.QueueRepository(t, func(t *testing.T) (repositories.QueueRepository, func() []repotest.Task) {
+		db := _store(t)
+
+		var tasks []repotest.Task
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+
+			tasks = append(tasks, repotest.Task{
+				Queue:       r.Header.Get("X-AppEngine-QueueName"),
+				ContentType: r.Header.Get(echo.HeaderContentType),
+				Body:        body,
+			})
+		})
+
+		worker := sqlstore.NewQueueWorker(db, handler, "/api", time.Second)
+
+		return sqlstore.NewQueueRepository(db), func() []repotest.Task {
+			tasks = nil
+
+			if _, err := worker.Process(context.Background()); err != nil {
+				t.Fatalf("Unable to process queue: %s", err.Error())
+			}
+
+			return tasks
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package sqlite
+
+import (
+	"database/sql"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/stiks/gobs/lib/providers/sqlstore"
+)
+
+// Open opens the database file at path, use ":memory:" for a throwaway database
+func Open(path string) (*sql.DB, error) {
+	dsn := path
+	if path != ":memory:" {
+		dsn = "file:" + path + "?_foreign_keys=1&_busy_timeout=5000&_journal_mode=WAL"
+	}
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer, a single connection avoids "database is locked"
+	// errors and keeps in-memory databases alive between queries
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Dialect of the shared repositories, see sqlstore.New
+var Dialect = sqlstore.Dialect{
+	IsUniqueViolation: isUniqueViolation,
+}
+
+// isUniqueViolation reports whether err was caused by a unique constraint
+func isUniqueViolation(err error) bool {
+	if e, ok := err.(sqlite3.Error); ok {
+		return e.ExtendedCode == sqlite3.ErrConstraintUnique || e.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+
+	return false
+}
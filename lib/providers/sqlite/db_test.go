@@ -0,0 +1,124 @@
+package sqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/providers/sqlite"
+	"github.com/stiks/gobs/lib/providers/sqlstore"
+	"github.com/stiks/gobs/pkg/helpers"
+)
+
+// _db returns an empty in-memory database with fixtures loaded
+func _db(t *testing.T) *sql.DB {
+	db, err := sqlite.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Unable to open database: %s", err.Error())
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	if err := sqlite.Migrate(context.Background(), db); err != nil {
+		t.Fatalf("Unable to create schema: %s", err.Error())
+	}
+
+	_fixtures(t, db)
+
+	return db
+}
+
+// _fixtures seeds records named by the auth contract, see contract_test.go
+func _fixtures(t *testing.T, db *sql.DB) {
+	_, err := sqlstore.NewUserRepository(sqlstore.New(db, sqlite.Dialect)).Create(context.Background(), &models.User{
+		ID:           helpers.UUIDFromString(t, "775a5b37-1742-4e54-9439-0357e768b011"),
+		Email:        "peter@test.com",
+		PasswordHash: []byte("$2a$10$kPrRofMm9VnE5w9ih6FwtuiuY/fIJ7/pcwvAmvL/3x3t2I144hyyq"),
+		IsActive:     true,
+		Verified:     true,
+		Role:         models.RoleSuperUser,
+		Status:       models.StatusActive,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("Unable to create user fixture: %s", err.Error())
+	}
+
+	_, err = db.Exec("INSERT INTO auth_clients (id, client_id, client_secret, role, scope, redirect_uris) VALUES (?, ?, ?, ?, ?, ?)",
+		helpers.UUIDFromString(t, "775a5b37-1742-4e54-9439-0357e768b011"), "SecRetAuthKey", "SecretSuper", models.RoleClient, "users:read clients:read",
+		"https://app.test/callback")
+	if err != nil {
+		t.Fatalf("Unable to create auth client fixture: %s", err.Error())
+	}
+}
+
+func TestSqlite_Migrations(t *testing.T) {
+	db := _db(t)
+
+	t.Run("Applying twice is a no-op", func(t *testing.T) {
+		assert.NoError(t, sqlite.Migrate(context.Background(), db))
+	})
+
+	t.Run("Clients created before scopes keep their access", func(t *testing.T) {
+		m, err := sqlite.NewMigrator(db)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		// back to before the scope backfill, version 18
+		if _, err := m.Down(context.Background(), len(sqlite.Migrations)-17); !assert.NoError(t, err) {
+			return
+		}
+
+		_, err = db.Exec("UPDATE auth_clients SET scope = ''")
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		if !assert.NoError(t, sqlite.Migrate(context.Background(), db)) {
+			return
+		}
+
+		var scope string
+		if assert.NoError(t, db.QueryRow("SELECT scope FROM auth_clients WHERE client_id = 'SecRetAuthKey'").Scan(&scope)) {
+			assert.Equal(t, "users:read users:write clients:read clients:write", scope)
+		}
+	})
+
+	t.Run("Revert everything", func(t *testing.T) {
+		m, err := sqlite.NewMigrator(db)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		reverted, err := m.Down(context.Background(), len(sqlite.Migrations))
+		if assert.NoError(t, err) {
+			assert.Len(t, reverted, len(sqlite.Migrations))
+		}
+
+		var tables int
+		if assert.NoError(t, db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'users'").Scan(&tables)) {
+			assert.Equal(t, 0, tables)
+		}
+	})
+}
+
+func TestSqlite_Open(t *testing.T) {
+	t.Run("Database file", func(t *testing.T) {
+		db, err := sqlite.Open(filepath.Join(t.TempDir(), "gobs.db"))
+		if assert.NoError(t, err) {
+			assert.NoError(t, db.Close())
+		}
+	})
+
+	t.Run("Missing directory", func(t *testing.T) {
+		_, err := sqlite.Open(filepath.Join(t.TempDir(), "missing", "gobs.db"))
+		assert.Error(t, err)
+	})
+}
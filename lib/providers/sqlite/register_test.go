@@ -0,0 +1,62 @@
+package sqlite_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	_ "github.com/stiks/gobs/lib/providers/dummy"
+	_ "github.com/stiks/gobs/lib/providers/mock"
+	"github.com/stiks/gobs/lib/providers/registry"
+)
+
+func TestSqlite_Register(t *testing.T) {
+	selection := registry.Selection{
+		registry.KindData:  "sqlite",
+		registry.KindQueue: "sqlite",
+		registry.KindCache: "dummy",
+		registry.KindEmail: "mock",
+	}
+
+	lookup := func(values map[string]string) func(string) string {
+		return func(key string) string { return values[key] }
+	}
+
+	t.Run("Invalid settings", func(t *testing.T) {
+		_, err := registry.Build(selection, lookup(map[string]string{
+			"SQLITE_DATABASE":       filepath.Join(t.TempDir(), "missing", "gobs.db"),
+			"SQLITE_QUEUE_INTERVAL": "often",
+		}), nil)
+
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "SQLITE_DATABASE directory is not accessible")
+		}
+
+		_, err = registry.Build(selection, lookup(map[string]string{"SQLITE_QUEUE_INTERVAL": "often"}), nil)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "SQLITE_DATABASE must be set")
+		}
+	})
+
+	t.Run("Data and queue share database", func(t *testing.T) {
+		providers, err := registry.Build(selection, lookup(map[string]string{
+			"SQLITE_DATABASE":       filepath.Join(t.TempDir(), "gobs.db"),
+			"SQLITE_QUEUE_INTERVAL": "1s",
+		}), nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		_, err = providers.Data.Users.FindByUsername(context.Background(), "nobody@test.com")
+		assert.Error(t, err)
+		assert.NoError(t, providers.Queue.Add(context.Background(), "test", []byte("data")))
+
+		if assert.Len(t, providers.Workers(), 1) {
+			assert.Equal(t, "sqlite queue worker", providers.Workers()[0].Name)
+		}
+
+		assert.NoError(t, providers.Close())
+	})
+}
@@ -0,0 +1,320 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/repositories"
+)
+
+const (
+	tokenColumns             = `id, client_id, user_id, token, expires_at, scope, auth_time`
+	authorizationCodeColumns = `id, code, client_id, user_id, redirect_uri, scope, code_challenge, nonce, auth_time, expires_at, created_at`
+	consentColumns           = `id, client_id, user_id, scope, created_at, updated_at`
+)
+
+type authRepository struct {
+	db *DB
+}
+
+// NewAuthRepository ...
+func NewAuthRepository(db *DB) repositories.AuthRepository {
+	return &authRepository{
+		db: db,
+	}
+}
+
+// scanToken reads a single tokens row selected with tokenColumns
+func scanToken(row scanner) (*models.Token, error) {
+	t := new(models.Token)
+
+	err := row.Scan(&t.ID, &t.ClientID, &t.UserID, &t.Token, &t.ExpiresAt, &t.Scope, &t.AuthTime)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrTokenNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// FindByClientID ...
+func (r *authRepository) FindByClientID(ctx context.Context, clientID string) (*models.AuthClient, error) {
+	c := new(models.AuthClient)
+
+	var redirectURIs string
+
+	err := r.db.QueryRowContext(ctx, "SELECT id, client_id, client_secret, role, scope, redirect_uris FROM auth_clients WHERE client_id = ?", clientID).
+		Scan(&c.ID, &c.ClientID, &c.ClientSecret, &c.Role, &c.Scope, &redirectURIs)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrAuthClientNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// stored space separated, URIs cannot contain spaces
+	c.RedirectURIs = strings.Fields(redirectURIs)
+
+	return c, nil
+}
+
+// UpdateClientScope ...
+func (r *authRepository) UpdateClientScope(ctx context.Context, clientID string, scope string) (*models.AuthClient, error) {
+	res, err := r.db.ExecContext(ctx, "UPDATE auth_clients SET scope = ? WHERE client_id = ?", scope, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return nil, models.ErrAuthClientNotFound
+	}
+
+	return r.FindByClientID(ctx, clientID)
+}
+
+// FindUserByUsername ...
+func (r *authRepository) FindUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	return findUser(ctx, r.db, "email = ?", username)
+}
+
+// FindUserByID ...
+func (r *authRepository) FindUserByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	return findUser(ctx, r.db, "id = ?", id)
+}
+
+// UpdateLastLogin ...
+func (r *authRepository) UpdateLastLogin(ctx context.Context, id uuid.UUID) error {
+	res, err := r.db.ExecContext(ctx, "UPDATE users SET last_login = ? WHERE id = ?", time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return models.ErrUserNotFound
+	}
+
+	return nil
+}
+
+// FindByClientUser ...
+func (r *authRepository) FindByClientUser(ctx context.Context, clientID uuid.UUID, userID uuid.UUID) (*models.Token, error) {
+	return scanToken(r.db.QueryRowContext(ctx, "SELECT "+tokenColumns+" FROM tokens WHERE client_id = ? AND user_id = ? LIMIT 1", clientID, userID))
+}
+
+// FindByHashClient ...
+func (r *authRepository) FindByHashClient(ctx context.Context, clientID uuid.UUID, token string) (*models.Token, error) {
+	return scanToken(r.db.QueryRowContext(ctx, "SELECT "+tokenColumns+" FROM tokens WHERE client_id = ? AND token = ? LIMIT 1", clientID, token))
+}
+
+// CreateToken ...
+func (r *authRepository) CreateToken(ctx context.Context, data *models.Token) (*models.Token, error) {
+	if data.ID == uuid.Nil {
+		data.ID = uuid.New()
+	}
+
+	_, err := r.db.ExecContext(ctx, "INSERT INTO tokens ("+tokenColumns+") VALUES (?, ?, ?, ?, ?, ?, ?)",
+		data.ID, data.ClientID, data.UserID, data.Token, data.ExpiresAt, data.Scope, data.AuthTime,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// DeleteToken ...
+func (r *authRepository) DeleteToken(ctx context.Context, id uuid.UUID) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM tokens WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return models.ErrTokenNotFound
+	}
+
+	return nil
+}
+
+// CreateAuthorizationCode ...
+func (r *authRepository) CreateAuthorizationCode(ctx context.Context, data *models.AuthorizationCode) (*models.AuthorizationCode, error) {
+	if data.ID == uuid.Nil {
+		data.ID = uuid.New()
+	}
+
+	_, err := r.db.ExecContext(ctx, "INSERT INTO authorization_codes ("+authorizationCodeColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		data.ID, data.Code, data.ClientID, data.UserID, data.RedirectURI, data.Scope, data.CodeChallenge, data.Nonce, data.AuthTime, data.ExpiresAt, data.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// ConsumeAuthorizationCode ...
+func (r *authRepository) ConsumeAuthorizationCode(ctx context.Context, code string) (*models.AuthorizationCode, error) {
+	a := new(models.AuthorizationCode)
+
+	err := r.db.QueryRowContext(ctx, "SELECT "+authorizationCodeColumns+" FROM authorization_codes WHERE code = ?", code).
+		Scan(&a.ID, &a.Code, &a.ClientID, &a.UserID, &a.RedirectURI, &a.Scope, &a.CodeChallenge, &a.Nonce, &a.AuthTime, &a.ExpiresAt, &a.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrAuthorizationCodeNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// whoever deletes the row owns the code, a concurrent exchange loses
+	res, err := r.db.ExecContext(ctx, "DELETE FROM authorization_codes WHERE id = ?", a.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return nil, models.ErrAuthorizationCodeNotFound
+	}
+
+	return a, nil
+}
+
+// FindConsent ...
+func (r *authRepository) FindConsent(ctx context.Context, clientID uuid.UUID, userID uuid.UUID) (*models.Consent, error) {
+	c := new(models.Consent)
+
+	err := r.db.QueryRowContext(ctx, "SELECT "+consentColumns+" FROM consents WHERE client_id = ? AND user_id = ?", clientID, userID).
+		Scan(&c.ID, &c.ClientID, &c.UserID, &c.Scope, &c.CreatedAt, &c.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrConsentNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// SaveConsent creates consent or replaces scope of the existing one
+func (r *authRepository) SaveConsent(ctx context.Context, data *models.Consent) (*models.Consent, error) {
+	if data.ID == uuid.Nil {
+		data.ID = uuid.New()
+	}
+
+	now := time.Now().UTC()
+	if data.CreatedAt.IsZero() {
+		data.CreatedAt = now
+	}
+
+	data.UpdatedAt = now
+
+	_, err := r.db.ExecContext(ctx, "INSERT INTO consents ("+consentColumns+") VALUES (?, ?, ?, ?, ?, ?) "+
+		"ON CONFLICT (client_id, user_id) DO UPDATE SET scope = excluded.scope, updated_at = excluded.updated_at",
+		data.ID, data.ClientID, data.UserID, data.Scope, data.CreatedAt, data.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.FindConsent(ctx, data.ClientID, data.UserID)
+}
+
+// RevokeAccessToken ...
+func (r *authRepository) RevokeAccessToken(ctx context.Context, id uuid.UUID, expiresAt time.Time) error {
+	// expired entries are useless, tokens are rejected on exp anyway
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM revoked_tokens WHERE expires_at < ?", time.Now().UTC()); err != nil {
+		return err
+	}
+
+	_, err := r.db.ExecContext(ctx, "INSERT INTO revoked_tokens (id, expires_at) VALUES (?, ?) ON CONFLICT (id) DO NOTHING", id, expiresAt.UTC())
+
+	return err
+}
+
+// IsAccessTokenRevoked ...
+func (r *authRepository) IsAccessTokenRevoked(ctx context.Context, id uuid.UUID) (bool, error) {
+	var n int
+
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM revoked_tokens WHERE id = ?", id).Scan(&n); err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// FindLoginAttempts ...
+func (r *authRepository) FindLoginAttempts(ctx context.Context, key string) (*models.LoginAttempts, error) {
+	a := new(models.LoginAttempts)
+
+	err := r.db.QueryRowContext(ctx, "SELECT key, failures, last_failure_at, locked_until FROM login_attempts WHERE key = ?", key).
+		Scan(&a.Key, &a.Failures, &a.LastFailure, &a.LockedUntil)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrLoginAttemptsNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// SaveLoginAttempts ...
+func (r *authRepository) SaveLoginAttempts(ctx context.Context, data *models.LoginAttempts) (*models.LoginAttempts, error) {
+	_, err := r.db.ExecContext(ctx, `INSERT INTO login_attempts (key, failures, last_failure_at, locked_until) VALUES (?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET failures = excluded.failures, last_failure_at = excluded.last_failure_at,
+			locked_until = excluded.locked_until`,
+		data.Key, data.Failures, data.LastFailure.UTC(), data.LockedUntil.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// FailLoginAttempt ...
+func (r *authRepository) FailLoginAttempt(ctx context.Context, key string, now time.Time, since time.Time) (*models.LoginAttempts, error) {
+	a := new(models.LoginAttempts)
+
+	err := r.db.QueryRowContext(ctx, `INSERT INTO login_attempts (key, failures, last_failure_at, locked_until) VALUES (?, 1, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET last_failure_at = excluded.last_failure_at,
+			failures = CASE WHEN login_attempts.locked_until <= ? AND login_attempts.last_failure_at < ? THEN 1 ELSE login_attempts.failures + 1 END
+		RETURNING key, failures, last_failure_at, locked_until`,
+		key, now.UTC(), time.Time{}.UTC(), now.UTC(), since.UTC(),
+	).Scan(&a.Key, &a.Failures, &a.LastFailure, &a.LockedUntil)
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// LockLoginAttempts ...
+func (r *authRepository) LockLoginAttempts(ctx context.Context, key string, now time.Time, until time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx, "UPDATE login_attempts SET locked_until = ? WHERE key = ? AND locked_until <= ?", until.UTC(), key, now.UTC())
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+
+	return n > 0, err
+}
+
+// DeleteLoginAttempts ...
+func (r *authRepository) DeleteLoginAttempts(ctx context.Context, key string) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM login_attempts WHERE key = ?", key)
+
+	return err
+}
@@ -0,0 +1,187 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/repositories"
+	"github.com/stiks/gobs/pkg/tenant"
+)
+
+const clientColumns = `id, name, email, status, owner_id, created_at, updated_at, tenant_id`
+
+type clientRepository struct {
+	db *DB
+}
+
+// NewClientRepository ...
+func NewClientRepository(db *DB) repositories.ClientRepository {
+	return &clientRepository{
+		db: db,
+	}
+}
+
+// scanClient reads a single clients row selected with clientColumns
+func scanClient(row scanner) (*models.Client, error) {
+	c := new(models.Client)
+
+	err := row.Scan(&c.ID, &c.Name, &c.Email, &c.Status, &c.OwnerID, &c.CreatedAt, &c.UpdatedAt, &c.TenantID)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrClientNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// clientFilter converts query params into WHERE conditions
+func clientFilter(ctx context.Context, params *models.ClientQueryParams) *where {
+	w := new(where)
+	w.scope(ctx)
+
+	if params == nil {
+		return w
+	}
+
+	if params.Status != nil {
+		w.add("status = ?", *params.Status)
+	}
+
+	if params.OwnerID != nil {
+		w.add("owner_id = ?", *params.OwnerID)
+	}
+
+	if q := strings.TrimSpace(params.Query); q != "" {
+		q = "%" + strings.ToLower(q) + "%"
+
+		w.add("(LOWER(name) LIKE ? OR LOWER(email) LIKE ?)", q, q)
+	}
+
+	return w
+}
+
+// CountAll ...
+func (r *clientRepository) CountAll(ctx context.Context, params *models.ClientQueryParams) (int, error) {
+	w := clientFilter(ctx, params)
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM clients"+w.String(), w.args...).Scan(&total); err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+// FindAll ...
+func (r *clientRepository) FindAll(ctx context.Context, params *models.ClientQueryParams) ([]models.Client, error) {
+	w := clientFilter(ctx, params)
+
+	query := "SELECT " + clientColumns + " FROM clients" + w.String() + " ORDER BY created_at, id"
+	if params != nil {
+		query += w.paginate(params.Page, params.PerPage)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, w.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clients []models.Client
+	for rows.Next() {
+		c, err := scanClient(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		clients = append(clients, *c)
+	}
+
+	return clients, rows.Err()
+}
+
+// FindByID ...
+func (r *clientRepository) FindByID(ctx context.Context, id uuid.UUID) (*models.Client, error) {
+	query, args := scoped(ctx, "SELECT "+clientColumns+" FROM clients WHERE id = ?", id)
+
+	return scanClient(r.db.QueryRowContext(ctx, query, args...))
+}
+
+// findByEmail ...
+func (r *clientRepository) findByEmail(ctx context.Context, email string) (*models.Client, error) {
+	return scanClient(r.db.QueryRowContext(ctx, "SELECT "+clientColumns+" FROM clients WHERE email = ?", email))
+}
+
+// Create ...
+func (r *clientRepository) Create(ctx context.Context, data *models.Client) (*models.Client, error) {
+	if _, err := r.findByEmail(ctx, data.Email); err == nil {
+		return nil, models.ErrClientNameTaken
+	}
+
+	if id, ok := tenant.FromContext(ctx); ok {
+		data.TenantID = id
+	}
+
+	_, err := r.db.ExecContext(ctx, "INSERT INTO clients ("+clientColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		data.ID, data.Name, data.Email, data.Status, data.OwnerID, data.CreatedAt.UTC(), data.UpdatedAt.UTC(), data.TenantID,
+	)
+	if r.db.isUniqueViolation(err) {
+		return nil, models.ErrClientNameTaken
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// Update ...
+func (r *clientRepository) Update(ctx context.Context, data *models.Client) (*models.Client, error) {
+	if c, err := r.findByEmail(ctx, data.Email); err == nil && c.ID != data.ID {
+		return nil, models.ErrClientNameTaken
+	}
+
+	query, args := scoped(ctx, `UPDATE clients SET name = ?, email = ?, status = ?, owner_id = ?, created_at = ?,
+		updated_at = ? WHERE id = ?`,
+		data.Name, data.Email, data.Status, data.OwnerID, data.CreatedAt.UTC(), data.UpdatedAt.UTC(), data.ID,
+	)
+
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if r.db.isUniqueViolation(err) {
+		return nil, models.ErrClientNameTaken
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return nil, models.ErrClientNotFound
+	}
+
+	return data, nil
+}
+
+// Delete ...
+func (r *clientRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	query, args := scoped(ctx, "DELETE FROM clients WHERE id = ?", id)
+
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return models.ErrClientNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,194 @@
+// Package sqlstore implements data repositories on top of database/sql, shared
+// by the postgres and sqlite providers. Queries are written with '?'
+// placeholders and rewritten by Dialect of the database.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/stiks/gobs/pkg/tenant"
+	"github.com/stiks/gobs/pkg/xlog"
+)
+
+const (
+	// lockLease is how long a lock of crashed replica blocks the others
+	lockLease = time.Minute
+	// lockRetry is how often a waiting replica tries the lock again
+	lockRetry = 100 * time.Millisecond
+)
+
+// Dialect describes what differs between supported databases
+type Dialect struct {
+	// Numbered replaces every '?' by $1, $2 and so on
+	Numbered bool
+	// SkipLocked claims queue tasks with FOR UPDATE SKIP LOCKED, so workers
+	// of several replicas don't wait for each other
+	SkipLocked bool
+	// IsUniqueViolation reports whether err was caused by a unique constraint
+	IsUniqueViolation func(err error) bool
+}
+
+// DB runs queries of the repositories in its dialect
+type DB struct {
+	*sql.DB
+
+	dialect Dialect
+}
+
+// New wraps db opened by the provider
+func New(db *sql.DB, dialect Dialect) *DB {
+	return &DB{
+		DB:      db,
+		dialect: dialect,
+	}
+}
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.ExecContext(ctx, db.rebind(query), args...)
+}
+
+func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.QueryContext(ctx, db.rebind(query), args...)
+}
+
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRowContext(ctx, db.rebind(query), args...)
+}
+
+// rebind rewrites placeholders of query, queries hold no literal '?'
+func (db *DB) rebind(query string) string {
+	if !db.dialect.Numbered {
+		return query
+	}
+
+	var (
+		b strings.Builder
+		n int
+	)
+
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+
+			continue
+		}
+
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+
+	return b.String()
+}
+
+func (db *DB) isUniqueViolation(err error) bool {
+	return err != nil && db.dialect.IsUniqueViolation != nil && db.dialect.IsUniqueViolation(err)
+}
+
+// locked runs fn holding named lock shared by every replica. Locks are rows
+// of locks table which expire after lockLease, fn must finish well within it.
+func (db *DB) locked(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	holder := uuid.New().String()
+
+	for {
+		ok, err := db.lock(ctx, name, holder)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockRetry):
+		}
+	}
+
+	defer func() {
+		if _, err := db.ExecContext(context.Background(), "DELETE FROM locks WHERE name = ? AND holder = ?", name, holder); err != nil {
+			xlog.Errorf(ctx, "Unable to release lock %s, err: %s", name, err.Error())
+		}
+	}()
+
+	return fn(ctx)
+}
+
+// lock takes named lock unless another holder has it
+func (db *DB) lock(ctx context.Context, name string, holder string) (bool, error) {
+	now := time.Now()
+
+	if _, err := db.ExecContext(ctx, "DELETE FROM locks WHERE name = ? AND expires_at < ?", name, now.Unix()); err != nil {
+		return false, err
+	}
+
+	_, err := db.ExecContext(ctx, "INSERT INTO locks (name, holder, expires_at) VALUES (?, ?, ?)", name, holder, now.Add(lockLease).Unix())
+	if db.isUniqueViolation(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scoped appends tenant condition to cond when ctx is scoped to a tenant
+func scoped(ctx context.Context, cond string, args ...interface{}) (string, []interface{}) {
+	if id, ok := tenant.FromContext(ctx); ok {
+		return cond + " AND tenant_id = ?", append(args, id)
+	}
+
+	return cond, args
+}
+
+// where collects filter conditions and their arguments
+type where struct {
+	conds []string
+	args  []interface{}
+}
+
+// add appends condition with one argument per '?'
+func (w *where) add(cond string, args ...interface{}) {
+	w.conds = append(w.conds, cond)
+	w.args = append(w.args, args...)
+}
+
+// scope limits rows to tenant of ctx
+func (w *where) scope(ctx context.Context) {
+	if id, ok := tenant.FromContext(ctx); ok {
+		w.add("tenant_id = ?", id)
+	}
+}
+
+// String returns WHERE clause or empty string when there is nothing to filter
+func (w *where) String() string {
+	if len(w.conds) == 0 {
+		return ""
+	}
+
+	return " WHERE " + strings.Join(w.conds, " AND ")
+}
+
+// paginate returns LIMIT and OFFSET clause for 1-based page numbers
+func (w *where) paginate(page int, perPage int) string {
+	if perPage <= 0 {
+		return ""
+	}
+
+	if page <= 0 {
+		page = 1
+	}
+
+	w.args = append(w.args, perPage, (page-1)*perPage)
+
+	return " LIMIT ? OFFSET ?"
+}
@@ -0,0 +1,59 @@
+package sqlstore_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stiks/gobs/lib/providers/sqlite"
+	"github.com/stiks/gobs/lib/providers/sqlstore"
+	"github.com/stiks/gobs/lib/repositories"
+	"github.com/stiks/gobs/lib/repositories/repotest"
+)
+
+// _db returns empty in-memory SQLite database
+func _db(t *testing.T) *sqlstore.DB {
+	return sqlstore.New(_sqlite(t), sqlite.Dialect)
+}
+
+// _numbered returns in-memory SQLite database queried with numbered
+// placeholders, as postgres is, so they are covered without a postgres server
+func _numbered(t *testing.T) *sqlstore.DB {
+	return sqlstore.New(_sqlite(t), sqlstore.Dialect{
+		Numbered:          true,
+		IsUniqueViolation: sqlite.Dialect.IsUniqueViolation,
+	})
+}
+
+func _sqlite(t *testing.T) *sql.DB {
+	db, err := sqlite.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Unable to open database: %s", err.Error())
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	if err := sqlite.Migrate(context.Background(), db); err != nil {
+		t.Fatalf("Unable to create schema: %s", err.Error())
+	}
+
+	return db
+}
+
+func TestSqlstore_Numbered_User_Contract(t *testing.T) {
+	repotest.UserRepository(t, func(t *testing.T) repositories.UserRepository {
+		return sqlstore.NewUserRepository(_numbered(t))
+	})
+}
+
+func TestSqlstore_Numbered_Client_Contract(t *testing.T) {
+	repotest.ClientRepository(t, func(t *testing.T) repositories.ClientRepository {
+		return sqlstore.NewClientRepository(_numbered(t))
+	})
+}
+
+func TestSqlstore_Numbered_Role_Contract(t *testing.T) {
+	repotest.RoleRepository(t, func(t *testing.T) repositories.RoleRepository {
+		return sqlstore.NewRoleRepository(_numbered(t))
+	})
+}
@@ -0,0 +1,89 @@
+package sqlstore
+
+import (
+	"context"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/repositories"
+)
+
+const keyColumns = `id, algorithm, private_key, created_at, retired_at, expires_at`
+
+type keyRepository struct {
+	db *DB
+}
+
+// NewKeyRepository ...
+func NewKeyRepository(db *DB) repositories.KeyRepository {
+	return &keyRepository{
+		db: db,
+	}
+}
+
+// FindAll returns keys oldest first
+func (r *keyRepository) FindAll(ctx context.Context) ([]models.SigningKey, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+keyColumns+" FROM signing_keys ORDER BY created_at")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []models.SigningKey
+	for rows.Next() {
+		var k models.SigningKey
+		if err := rows.Scan(&k.ID, &k.Algorithm, &k.PrivateKey, &k.CreatedAt, &k.RetiredAt, &k.ExpiresAt); err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, k)
+	}
+
+	return keys, rows.Err()
+}
+
+// Create ...
+func (r *keyRepository) Create(ctx context.Context, data *models.SigningKey) (*models.SigningKey, error) {
+	_, err := r.db.ExecContext(ctx, "INSERT INTO signing_keys ("+keyColumns+") VALUES (?, ?, ?, ?, ?, ?)",
+		data.ID, data.Algorithm, data.PrivateKey, data.CreatedAt, data.RetiredAt, data.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// Update stores retirement of the key, key material never changes
+func (r *keyRepository) Update(ctx context.Context, data *models.SigningKey) (*models.SigningKey, error) {
+	res, err := r.db.ExecContext(ctx, "UPDATE signing_keys SET retired_at = ?, expires_at = ? WHERE id = ?",
+		data.RetiredAt, data.ExpiresAt, data.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return nil, models.ErrSigningKeyNotFound
+	}
+
+	return data, nil
+}
+
+// Delete ...
+func (r *keyRepository) Delete(ctx context.Context, id string) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM signing_keys WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return models.ErrSigningKeyNotFound
+	}
+
+	return nil
+}
+
+// Locked ...
+func (r *keyRepository) Locked(ctx context.Context, fn func(ctx context.Context) error) error {
+	return r.db.locked(ctx, "signing_keys", fn)
+}
@@ -0,0 +1,218 @@
+package sqlstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/stiks/gobs/lib/repositories"
+	"github.com/stiks/gobs/pkg/xlog"
+)
+
+const (
+	// QueueInterval is how often the queue worker polls for due tasks by default
+	QueueInterval = 5 * time.Second
+	// QueueMaxAttempts is how many times a task is delivered before it is dropped
+	QueueMaxAttempts = 10
+	// QueueBatchSize is how many tasks are fetched per poll
+	QueueBatchSize = 20
+	// QueueLease is how long claimed tasks are hidden from other workers, a
+	// task of a worker which stopped mid batch is delivered again after it
+	QueueLease = 5 * time.Minute
+)
+
+// QueueTask is a task waiting for delivery
+type QueueTask struct {
+	ID          int64
+	Queue       string
+	Payload     []byte
+	ContentType string
+	Attempts    int
+}
+
+type queueRepository struct {
+	db *DB
+}
+
+// NewQueueRepository returns queue which stores tasks in the database until
+// they are delivered by QueueWorker
+func NewQueueRepository(db *DB) repositories.QueueRepository {
+	return &queueRepository{
+		db: db,
+	}
+}
+
+func (r *queueRepository) insert(ctx context.Context, queue string, data []byte, contentType string) error {
+	_, err := r.db.ExecContext(ctx, "INSERT INTO queue_tasks (queue, payload, content_type, available_at, created_at) VALUES (?, ?, ?, ?, ?)",
+		queue, data, contentType, time.Now().Unix(), time.Now().UTC(),
+	)
+
+	return err
+}
+
+// Add ...
+func (r *queueRepository) Add(ctx context.Context, queue string, data []byte) error {
+	return r.insert(ctx, queue, data, echo.MIMEOctetStream)
+}
+
+// AddObject ...
+func (r *queueRepository) AddObject(ctx context.Context, queue string, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return r.insert(ctx, queue, b, echo.MIMEApplicationJSON)
+}
+
+// AddToURL ...
+func (r *queueRepository) AddToURL(ctx context.Context, queue string, data url.Values) error {
+	return r.insert(ctx, queue, []byte(data.Encode()), echo.MIMEApplicationForm)
+}
+
+// QueueWorker delivers stored tasks as POST requests to handler, the same way
+// App Engine push queues call worker endpoints
+type QueueWorker struct {
+	db       *DB
+	handler  http.Handler
+	prefix   string
+	interval time.Duration
+}
+
+// NewQueueWorker returns worker posting tasks to prefix + queue name on handler
+func NewQueueWorker(db *DB, handler http.Handler, prefix string, interval time.Duration) *QueueWorker {
+	return &QueueWorker{
+		db:       db,
+		handler:  handler,
+		prefix:   strings.TrimSuffix(prefix, "/"),
+		interval: interval,
+	}
+}
+
+// Run processes tasks until ctx is cancelled, a task which is being delivered
+// is always finished before Run returns
+func (w *QueueWorker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.Process(ctx); err != nil {
+			xlog.Errorf(ctx, "Queue processing error: %s", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Process delivers a batch of due tasks and returns how many were delivered successfully
+func (w *QueueWorker) Process(ctx context.Context) (int, error) {
+	tasks, err := w.due(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	done := 0
+	for _, task := range tasks {
+		if ctx.Err() != nil {
+			break
+		}
+
+		if w.deliver(task) {
+			_, err = w.db.ExecContext(context.Background(), "DELETE FROM queue_tasks WHERE id = ?", task.ID)
+			done++
+		} else {
+			err = w.retry(task)
+		}
+
+		if err != nil {
+			return done, err
+		}
+	}
+
+	return done, nil
+}
+
+// due claims tasks which are ready for delivery for QueueLease, so workers
+// of other replicas skip them
+func (w *QueueWorker) due(ctx context.Context) ([]QueueTask, error) {
+	lock := ""
+	if w.db.dialect.SkipLocked {
+		lock = " FOR UPDATE SKIP LOCKED"
+	}
+
+	rows, err := w.db.QueryContext(ctx, `UPDATE queue_tasks SET available_at = ? WHERE id IN (
+		SELECT id FROM queue_tasks WHERE available_at <= ? ORDER BY available_at, id LIMIT ?`+lock+`
+	) RETURNING id, queue, payload, content_type, attempts`,
+		time.Now().Add(QueueLease).Unix(), time.Now().Unix(), QueueBatchSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []QueueTask
+	for rows.Next() {
+		var t QueueTask
+		if err := rows.Scan(&t.ID, &t.Queue, &t.Payload, &t.ContentType, &t.Attempts); err != nil {
+			return nil, err
+		}
+
+		tasks = append(tasks, t)
+	}
+
+	return tasks, rows.Err()
+}
+
+// deliver posts task to the handler, any 2xx response acknowledges the task
+func (w *QueueWorker) deliver(task QueueTask) bool {
+	req, err := http.NewRequest(http.MethodPost, w.prefix+"/"+url.PathEscape(task.Queue), bytes.NewReader(task.Payload))
+	if err != nil {
+		xlog.Errorf(context.Background(), "Unable to create request for task %d, err: %s", task.ID, err.Error())
+
+		return false
+	}
+
+	req.Header.Set(echo.HeaderContentType, task.ContentType)
+	req.Header.Set("X-AppEngine-QueueName", task.Queue)
+
+	rec := httptest.NewRecorder()
+	w.handler.ServeHTTP(rec, req)
+
+	if rec.Code >= 200 && rec.Code < 300 {
+		return true
+	}
+
+	xlog.Warningf(req.Context(), "Task %d in '%s' queue failed with status %d", task.ID, task.Queue, rec.Code)
+
+	return false
+}
+
+// retry postpones task with exponential backoff, task is dropped after QueueMaxAttempts
+func (w *QueueWorker) retry(task QueueTask) error {
+	task.Attempts++
+
+	if task.Attempts >= QueueMaxAttempts {
+		xlog.Errorf(context.Background(), "Task %d in '%s' queue dropped after %d attempts", task.ID, task.Queue, task.Attempts)
+
+		_, err := w.db.ExecContext(context.Background(), "DELETE FROM queue_tasks WHERE id = ?", task.ID)
+
+		return err
+	}
+
+	delay := time.Duration(1<<uint(task.Attempts)) * time.Second
+
+	_, err := w.db.ExecContext(context.Background(), "UPDATE queue_tasks SET attempts = ?, available_at = ? WHERE id = ?", task.Attempts, time.Now().Add(delay).Unix(), task.ID)
+
+	return err
+}
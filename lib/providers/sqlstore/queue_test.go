@@ -0,0 +1,120 @@
+package sqlstore_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/providers/sqlstore"
+	"github.com/stiks/gobs/lib/repositories"
+)
+
+func TestSqlstore_Queue_NewQueueRepository(t *testing.T) {
+	r := sqlstore.NewQueueRepository(_db(t))
+
+	assert.Implements(t, (*repositories.QueueRepository)(nil), r)
+}
+
+func TestSqlstore_Queue_Add(t *testing.T) {
+	db := _db(t)
+	r := sqlstore.NewQueueRepository(db)
+
+	assert.NoError(t, r.Add(context.Background(), "test", []byte("data")))
+	assert.NoError(t, r.AddObject(context.Background(), "test", echo.Map{"id": "775a5b37-1742-4e54-9439-0357e768b011"}))
+	assert.NoError(t, r.AddToURL(context.Background(), "test", url.Values{"id": {"775a5b37-1742-4e54-9439-0357e768b011"}}))
+
+	var total int
+	if assert.NoError(t, db.QueryRow("SELECT COUNT(*) FROM queue_tasks WHERE queue = 'test'").Scan(&total)) {
+		assert.Equal(t, 3, total)
+	}
+
+	t.Run("Unsupported object", func(t *testing.T) {
+		assert.Error(t, r.AddObject(context.Background(), "test", make(chan int)))
+	})
+}
+
+func TestSqlstore_QueueWorker_Process(t *testing.T) {
+	db := _db(t)
+	r := sqlstore.NewQueueRepository(db)
+
+	e := echo.New()
+
+	var received []string
+	e.POST("/api/user-confirm-email", func(c echo.Context) error {
+		body, _ := ioutil.ReadAll(c.Request().Body)
+		received = append(received, c.Request().Header.Get(echo.HeaderContentType)+" "+string(body))
+
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	worker := sqlstore.NewQueueWorker(db, e, "/api/", time.Second)
+
+	t.Run("Delivered tasks are removed", func(t *testing.T) {
+		assert.NoError(t, r.AddObject(context.Background(), "user-confirm-email", echo.Map{"code": "123"}))
+
+		done, err := worker.Process(context.Background())
+		if assert.NoError(t, err) {
+			assert.Equal(t, 1, done)
+			assert.Equal(t, []string{`application/json {"code":"123"}`}, received)
+		}
+
+		var total int
+		if assert.NoError(t, db.QueryRow("SELECT COUNT(*) FROM queue_tasks").Scan(&total)) {
+			assert.Equal(t, 0, total)
+		}
+	})
+
+	t.Run("Failed tasks are postponed", func(t *testing.T) {
+		assert.NoError(t, r.Add(context.Background(), "missing-handler", []byte("data")))
+
+		done, err := worker.Process(context.Background())
+		if assert.NoError(t, err) {
+			assert.Equal(t, 0, done)
+		}
+
+		var attempts int
+		var availableAt int64
+		if assert.NoError(t, db.QueryRow("SELECT attempts, available_at FROM queue_tasks WHERE queue = 'missing-handler'").Scan(&attempts, &availableAt)) {
+			assert.Equal(t, 1, attempts)
+			assert.True(t, availableAt > time.Now().Unix())
+		}
+
+		// postponed task is not delivered again straight away
+		done, err = worker.Process(context.Background())
+		if assert.NoError(t, err) {
+			assert.Equal(t, 0, done)
+		}
+	})
+
+	t.Run("Claimed tasks are skipped by other workers", func(t *testing.T) {
+		other := sqlstore.NewQueueWorker(db, e, "/api/", time.Second)
+
+		var nested int
+		e.POST("/api/claimed", func(c echo.Context) error {
+			nested, _ = other.Process(context.Background())
+
+			return c.NoContent(http.StatusNoContent)
+		})
+
+		assert.NoError(t, r.Add(context.Background(), "claimed", []byte("data")))
+
+		done, err := worker.Process(context.Background())
+		if assert.NoError(t, err) {
+			assert.Equal(t, 1, done)
+			assert.Equal(t, 0, nested)
+		}
+	})
+
+	t.Run("Run stops with context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		assert.NoError(t, worker.Run(ctx))
+	})
+}
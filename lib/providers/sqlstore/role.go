@@ -0,0 +1,82 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/repositories"
+)
+
+type roleRepository struct {
+	db *DB
+}
+
+// NewRoleRepository ...
+func NewRoleRepository(db *DB) repositories.RoleRepository {
+	return &roleRepository{
+		db: db,
+	}
+}
+
+// scanRole reads a single roles row, permissions are stored space separated
+func scanRole(row scanner) (*models.Role, error) {
+	var (
+		role        models.Role
+		permissions string
+	)
+
+	err := row.Scan(&role.Name, &permissions, &role.MFARequired, &role.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrRoleNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	role.Permissions = strings.Fields(permissions)
+
+	return &role, nil
+}
+
+// FindAll returns roles ordered by name
+func (r *roleRepository) FindAll(ctx context.Context) ([]models.Role, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT name, permissions, mfa_required, updated_at FROM roles ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []models.Role
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		roles = append(roles, *role)
+	}
+
+	return roles, rows.Err()
+}
+
+// FindByName ...
+func (r *roleRepository) FindByName(ctx context.Context, name string) (*models.Role, error) {
+	return scanRole(r.db.QueryRowContext(ctx, "SELECT name, permissions, mfa_required, updated_at FROM roles WHERE name = ?", name))
+}
+
+// Save ...
+func (r *roleRepository) Save(ctx context.Context, data *models.Role) (*models.Role, error) {
+	_, err := r.db.ExecContext(ctx, `INSERT INTO roles (name, permissions, mfa_required, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET permissions = excluded.permissions, mfa_required = excluded.mfa_required,
+			updated_at = excluded.updated_at`,
+		data.Name, strings.Join(data.Permissions, " "), data.MFARequired, data.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
@@ -0,0 +1,231 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/repositories"
+	"github.com/stiks/gobs/pkg/tenant"
+)
+
+const userColumns = `id, first_name, last_name, email, verified, password_hash, password_reset_hash, validation_hash,
+	role, status, is_deleted, owner_id, locked, is_active, password_reset_at, created_at, updated_at, last_login,
+	validation_sent_at, validation_expires_at, tenant_id, mfa_secret, mfa_enabled, mfa_recovery_codes, mfa_last_step`
+
+type userRepository struct {
+	db *DB
+}
+
+// NewUserRepository ...
+func NewUserRepository(db *DB) repositories.UserRepository {
+	return &userRepository{
+		db: db,
+	}
+}
+
+// scanUser reads a single users row selected with userColumns, recovery
+// codes are stored space separated
+func scanUser(row scanner) (*models.User, error) {
+	var (
+		u             = new(models.User)
+		recoveryCodes string
+	)
+
+	err := row.Scan(&u.ID, &u.FirstName, &u.LastName, &u.Email, &u.Verified, &u.PasswordHash, &u.PasswordResetHash, &u.ValidationHash,
+		&u.Role, &u.Status, &u.IsDeleted, &u.OwnerID, &u.Locked, &u.IsActive, &u.PasswordResetAt, &u.CreatedAt, &u.UpdatedAt, &u.LastLogin,
+		&u.ValidationSentAt, &u.ValidationExpiresAt, &u.TenantID, &u.MFASecret, &u.MFAEnabled, &recoveryCodes, &u.MFALastStep)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrUserNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	u.MFARecoveryCodes = strings.Fields(recoveryCodes)
+
+	return u, nil
+}
+
+// findUser returns first user matching cond
+func findUser(ctx context.Context, db *DB, cond string, args ...interface{}) (*models.User, error) {
+	cond, args = scoped(ctx, cond, args...)
+
+	return scanUser(db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE "+cond+" LIMIT 1", args...))
+}
+
+// findByEmail looks user up in every tenant, emails are unique across tenants
+func (r *userRepository) findByEmail(ctx context.Context, email string) (*models.User, error) {
+	return scanUser(r.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE email = ? LIMIT 1", email))
+}
+
+// userFilter converts query params into WHERE conditions
+func userFilter(ctx context.Context, params *models.UserQueryParams) *where {
+	w := new(where)
+	w.scope(ctx)
+
+	if params == nil {
+		return w
+	}
+
+	if params.Role != "" {
+		w.add("role = ?", params.Role)
+	}
+
+	if params.Status != nil {
+		w.add("status = ?", *params.Status)
+	}
+
+	if params.OwnerID != nil {
+		w.add("owner_id = ?", *params.OwnerID)
+	}
+
+	if q := strings.TrimSpace(params.Query); q != "" {
+		q = "%" + strings.ToLower(q) + "%"
+
+		w.add("(LOWER(email) LIKE ? OR LOWER(first_name) LIKE ? OR LOWER(last_name) LIKE ?)", q, q, q)
+	}
+
+	return w
+}
+
+// FindByUsername ...
+func (r *userRepository) FindByUsername(ctx context.Context, username string) (*models.User, error) {
+	return findUser(ctx, r.db, "email = ?", username)
+}
+
+// FindByResetHash ...
+func (r *userRepository) FindByResetHash(ctx context.Context, hash string) (*models.User, error) {
+	if hash == "" {
+		return nil, models.ErrUserNotFound
+	}
+
+	return findUser(ctx, r.db, "password_reset_hash = ?", hash)
+}
+
+// CountAll ...
+func (r *userRepository) CountAll(ctx context.Context, params *models.UserQueryParams) (int, error) {
+	w := userFilter(ctx, params)
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users"+w.String(), w.args...).Scan(&total); err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+// FindAll ...
+func (r *userRepository) FindAll(ctx context.Context, params *models.UserQueryParams) ([]models.User, error) {
+	w := userFilter(ctx, params)
+
+	query := "SELECT " + userColumns + " FROM users" + w.String() + " ORDER BY created_at, id"
+	if params != nil {
+		query += w.paginate(params.Page, params.PerPage)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, w.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, *u)
+	}
+
+	return users, rows.Err()
+}
+
+// FindByID ...
+func (r *userRepository) FindByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	return findUser(ctx, r.db, "id = ?", id)
+}
+
+// Create ...
+func (r *userRepository) Create(ctx context.Context, data *models.User) (*models.User, error) {
+	if _, err := r.findByEmail(ctx, data.Email); err == nil {
+		return nil, models.ErrUsernameTaken
+	}
+
+	if id, ok := tenant.FromContext(ctx); ok {
+		data.TenantID = id
+	}
+
+	_, err := r.db.ExecContext(ctx, `INSERT INTO users (`+userColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		data.ID, data.FirstName, data.LastName, data.Email, data.Verified, data.PasswordHash, data.PasswordResetHash, data.ValidationHash,
+		data.Role, data.Status, data.IsDeleted, data.OwnerID, data.Locked, data.IsActive,
+		data.PasswordResetAt.UTC(), data.CreatedAt.UTC(), data.UpdatedAt.UTC(), data.LastLogin.UTC(),
+		data.ValidationSentAt.UTC(), data.ValidationExpiresAt.UTC(), data.TenantID,
+		data.MFASecret, data.MFAEnabled, strings.Join(data.MFARecoveryCodes, " "), data.MFALastStep,
+	)
+	if r.db.isUniqueViolation(err) {
+		return nil, models.ErrUsernameTaken
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// Update ...
+func (r *userRepository) Update(ctx context.Context, data *models.User) (*models.User, error) {
+	if u, err := r.findByEmail(ctx, data.Email); err == nil && u.ID != data.ID {
+		return nil, models.ErrUsernameTaken
+	}
+
+	query, args := scoped(ctx, `UPDATE users SET first_name = ?, last_name = ?, email = ?, verified = ?, password_hash = ?,
+		password_reset_hash = ?, validation_hash = ?, role = ?, status = ?, is_deleted = ?, owner_id = ?, locked = ?,
+		is_active = ?, password_reset_at = ?, created_at = ?, updated_at = ?, last_login = ?, validation_sent_at = ?,
+		validation_expires_at = ?, mfa_secret = ?, mfa_enabled = ?, mfa_recovery_codes = ?, mfa_last_step = ? WHERE id = ?`,
+		data.FirstName, data.LastName, data.Email, data.Verified, data.PasswordHash,
+		data.PasswordResetHash, data.ValidationHash, data.Role, data.Status, data.IsDeleted, data.OwnerID, data.Locked,
+		data.IsActive, data.PasswordResetAt.UTC(), data.CreatedAt.UTC(), data.UpdatedAt.UTC(), data.LastLogin.UTC(),
+		data.ValidationSentAt.UTC(), data.ValidationExpiresAt.UTC(),
+		data.MFASecret, data.MFAEnabled, strings.Join(data.MFARecoveryCodes, " "), data.MFALastStep, data.ID,
+	)
+
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if r.db.isUniqueViolation(err) {
+		return nil, models.ErrUsernameTaken
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return nil, models.ErrUserNotFound
+	}
+
+	return data, nil
+}
+
+// Delete ...
+func (r *userRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	query, args := scoped(ctx, "DELETE FROM users WHERE id = ?", id)
+
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return models.ErrUserNotFound
+	}
+
+	return nil
+}
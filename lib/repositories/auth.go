@@ -2,6 +2,7 @@ package repositories
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -12,10 +13,31 @@ import (
 type AuthRepository interface {
 	FindByClientUser(ctx context.Context, clientID uuid.UUID, userID uuid.UUID) (*models.Token, error)
 	FindByClientID(ctx context.Context, clientID string) (*models.AuthClient, error)
+	// UpdateClientScope replaces scopes allowed to the auth client
+	UpdateClientScope(ctx context.Context, clientID string, scope string) (*models.AuthClient, error)
 	FindByHashClient(ctx context.Context, clientID uuid.UUID, token string) (*models.Token, error)
 	FindUserByUsername(ctx context.Context, username string) (*models.User, error)
 	FindUserByID(ctx context.Context, id uuid.UUID) (*models.User, error)
 	UpdateLastLogin(ctx context.Context, id uuid.UUID) error
 	CreateToken(ctx context.Context, data *models.Token) (*models.Token, error)
 	DeleteToken(ctx context.Context, id uuid.UUID) error
+	CreateAuthorizationCode(ctx context.Context, data *models.AuthorizationCode) (*models.AuthorizationCode, error)
+	// ConsumeAuthorizationCode returns the code and removes it, so every code
+	// is exchanged at most once even with concurrent requests
+	ConsumeAuthorizationCode(ctx context.Context, code string) (*models.AuthorizationCode, error)
+	FindConsent(ctx context.Context, clientID uuid.UUID, userID uuid.UUID) (*models.Consent, error)
+	SaveConsent(ctx context.Context, data *models.Consent) (*models.Consent, error)
+	// RevokeAccessToken puts access token jti on denylist until it expires
+	RevokeAccessToken(ctx context.Context, id uuid.UUID, expiresAt time.Time) error
+	IsAccessTokenRevoked(ctx context.Context, id uuid.UUID) (bool, error)
+	FindLoginAttempts(ctx context.Context, key string) (*models.LoginAttempts, error)
+	// SaveLoginAttempts creates or replaces failures of the key
+	SaveLoginAttempts(ctx context.Context, data *models.LoginAttempts) (*models.LoginAttempts, error)
+	// FailLoginAttempt atomically counts failure of the key at now, failures
+	// before since are forgotten unless the key is locked
+	FailLoginAttempt(ctx context.Context, key string, now time.Time, since time.Time) (*models.LoginAttempts, error)
+	// LockLoginAttempts locks the key until then, false is returned when it
+	// is locked already, so a lockout starts once
+	LockLoginAttempts(ctx context.Context, key string, now time.Time, until time.Time) (bool, error)
+	DeleteLoginAttempts(ctx context.Context, key string) error
 }
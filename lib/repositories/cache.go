@@ -1,6 +1,11 @@
 package repositories
 
-import "context"
+import (
+	"context"
+	"time"
+
+	"github.com/stiks/gobs/lib/models"
+)
 
 // CacheRepository ...
 type CacheRepository interface {
@@ -10,3 +15,31 @@ type CacheRepository interface {
 	Delete(ctx context.Context, key string) error
 	Flush(ctx context.Context) error
 }
+
+// ExpiringCacheRepository is implemented by caches able to expire entries,
+// ttl 0 keeps entry until it is evicted
+type ExpiringCacheRepository interface {
+	CacheRepository
+	SetWithTTL(ctx context.Context, key string, data interface{}, ttl time.Duration) error
+}
+
+// TTLCacheRepository is implemented by caches telling time entries have left,
+// 0 when entry doesn't expire
+type TTLCacheRepository interface {
+	CacheRepository
+	FindWithTTL(ctx context.Context, key string, obj interface{}) (time.Duration, error)
+}
+
+// FillingCacheRepository is implemented by caches telling entries loaded on
+// miss from writes, fills don't invalidate copies kept elsewhere
+type FillingCacheRepository interface {
+	ExpiringCacheRepository
+	Fill(ctx context.Context, key string, data interface{}, ttl time.Duration) error
+}
+
+// MeteredCacheRepository is implemented by caches counting their own lookups,
+// the counters are reported by StatsService
+type MeteredCacheRepository interface {
+	CacheRepository
+	Stats() models.CacheStats
+}
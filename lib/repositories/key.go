@@ -0,0 +1,18 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/stiks/gobs/lib/models"
+)
+
+// KeyRepository stores keys signing access tokens
+type KeyRepository interface {
+	FindAll(ctx context.Context) ([]models.SigningKey, error)
+	Create(ctx context.Context, data *models.SigningKey) (*models.SigningKey, error)
+	Update(ctx context.Context, data *models.SigningKey) (*models.SigningKey, error)
+	Delete(ctx context.Context, id string) error
+	// Locked runs fn while no other replica runs fn of its own, it waits for
+	// the lock until ctx is done
+	Locked(ctx context.Context, fn func(ctx context.Context) error) error
+}
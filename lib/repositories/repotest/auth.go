@@ -0,0 +1,351 @@
+package repotest
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/repositories"
+)
+
+// AuthFixture names records which must exist in the store, AuthRepository
+// has no way to create users or auth clients itself
+type AuthFixture struct {
+	User   models.User
+	Client models.AuthClient
+}
+
+// AuthFactory returns repository under test and records it was seeded with,
+// called once per subtest
+type AuthFactory func(t *testing.T) (repositories.AuthRepository, AuthFixture)
+
+// AuthRepository runs behavioural spec of repositories.AuthRepository
+func AuthRepository(t *testing.T, factory AuthFactory) {
+	t.Run("Auth client", func(t *testing.T) {
+		r, fixture := factory(t)
+
+		client, err := r.FindByClientID(ctx(), fixture.Client.ClientID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, fixture.Client.ID, client.ID)
+			assert.Equal(t, fixture.Client.ClientSecret, client.ClientSecret)
+			assert.Equal(t, fixture.Client.Role, client.Role)
+			assert.Equal(t, fixture.Client.Scope, client.Scope)
+			assert.Equal(t, fixture.Client.RedirectURIs, client.RedirectURIs)
+		}
+
+		_, err = r.FindByClientID(ctx(), unique())
+		assert.Equal(t, models.ErrAuthClientNotFound, err)
+	})
+
+	t.Run("Update client scope", func(t *testing.T) {
+		r, fixture := factory(t)
+
+		client, err := r.UpdateClientScope(ctx(), fixture.Client.ClientID, "users:read")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "users:read", client.Scope)
+			assert.Equal(t, fixture.Client.ClientSecret, client.ClientSecret)
+		}
+
+		client, err = r.FindByClientID(ctx(), fixture.Client.ClientID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "users:read", client.Scope)
+		}
+
+		_, err = r.UpdateClientScope(ctx(), unique(), "users:read")
+		assert.Equal(t, models.ErrAuthClientNotFound, err)
+	})
+
+	t.Run("User lookup", func(t *testing.T) {
+		r, fixture := factory(t)
+
+		user, err := r.FindUserByUsername(ctx(), fixture.User.Email)
+		if assert.NoError(t, err) {
+			assert.Equal(t, fixture.User.ID, user.ID)
+			assert.Equal(t, fixture.User.PasswordHash, user.PasswordHash)
+			assert.Equal(t, fixture.User.Role, user.Role)
+		}
+
+		user, err = r.FindUserByID(ctx(), fixture.User.ID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, fixture.User.Email, user.Email)
+		}
+
+		_, err = r.FindUserByUsername(ctx(), unique()+"@example.com")
+		assert.Equal(t, models.ErrUserNotFound, err)
+
+		_, err = r.FindUserByID(ctx(), uuid.New())
+		assert.Equal(t, models.ErrUserNotFound, err)
+	})
+
+	t.Run("Last login", func(t *testing.T) {
+		r, fixture := factory(t)
+
+		if !assert.NoError(t, r.UpdateLastLogin(ctx(), fixture.User.ID)) {
+			return
+		}
+
+		user, err := r.FindUserByID(ctx(), fixture.User.ID)
+		if assert.NoError(t, err) {
+			assert.WithinDuration(t, time.Now(), user.LastLogin, time.Minute)
+		}
+
+		assert.Equal(t, models.ErrUserNotFound, r.UpdateLastLogin(ctx(), uuid.New()))
+	})
+
+	t.Run("Create then find token", func(t *testing.T) {
+		r, fixture := factory(t)
+
+		// fresh user so tokens seeded for the fixture user do not match
+		token := &models.Token{
+			ClientID:  fixture.Client.ID,
+			UserID:    uuid.New(),
+			Token:     unique(),
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+			Scope:     "openid users:read",
+			AuthTime:  time.Now().Add(-time.Hour).Unix(),
+		}
+
+		created, err := r.CreateToken(ctx(), token)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.NotEqual(t, uuid.Nil, created.ID, "ID must be assigned")
+
+		found, err := r.FindByHashClient(ctx(), token.ClientID, token.Token)
+		if assert.NoError(t, err) {
+			assert.Equal(t, created.ID, found.ID)
+			assert.Equal(t, token.UserID, found.UserID)
+			assert.Equal(t, token.ExpiresAt, found.ExpiresAt)
+			assert.Equal(t, token.Scope, found.Scope)
+			assert.Equal(t, token.AuthTime, found.AuthTime)
+		}
+
+		found, err = r.FindByClientUser(ctx(), token.ClientID, token.UserID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, created.ID, found.ID)
+		}
+
+		// token is bound to its client
+		_, err = r.FindByHashClient(ctx(), uuid.New(), token.Token)
+		assert.Equal(t, models.ErrTokenNotFound, err)
+
+		_, err = r.FindByClientUser(ctx(), uuid.New(), token.UserID)
+		assert.Equal(t, models.ErrTokenNotFound, err)
+	})
+
+	t.Run("Delete token", func(t *testing.T) {
+		r, fixture := factory(t)
+
+		token, err := r.CreateToken(ctx(), &models.Token{
+			ID:       uuid.New(),
+			ClientID: fixture.Client.ID,
+			UserID:   uuid.New(),
+			Token:    unique(),
+		})
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.NoError(t, r.DeleteToken(ctx(), token.ID))
+
+		_, err = r.FindByHashClient(ctx(), token.ClientID, token.Token)
+		assert.Equal(t, models.ErrTokenNotFound, err)
+
+		assert.Equal(t, models.ErrTokenNotFound, r.DeleteToken(ctx(), token.ID), "second delete")
+		assert.Equal(t, models.ErrTokenNotFound, r.DeleteToken(ctx(), uuid.New()))
+	})
+
+	t.Run("Authorization code is single-use", func(t *testing.T) {
+		r, fixture := factory(t)
+
+		code := &models.AuthorizationCode{
+			Code:          unique(),
+			ClientID:      fixture.Client.ID,
+			UserID:        fixture.User.ID,
+			RedirectURI:   "https://app.test/callback",
+			Scope:         "users:read",
+			CodeChallenge: "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+			Nonce:         "n-0S6_WzA2Mj",
+			AuthTime:      time.Now().Add(-time.Hour).Unix(),
+			ExpiresAt:     time.Now().Add(time.Minute).UTC().Truncate(time.Second),
+			CreatedAt:     time.Now().UTC().Truncate(time.Second),
+		}
+
+		created, err := r.CreateAuthorizationCode(ctx(), code)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.NotEqual(t, uuid.Nil, created.ID, "ID must be assigned")
+
+		found, err := r.ConsumeAuthorizationCode(ctx(), code.Code)
+		if assert.NoError(t, err) {
+			assert.Equal(t, created.ID, found.ID)
+			assert.Equal(t, code.ClientID, found.ClientID)
+			assert.Equal(t, code.UserID, found.UserID)
+			assert.Equal(t, code.RedirectURI, found.RedirectURI)
+			assert.Equal(t, code.Scope, found.Scope)
+			assert.Equal(t, code.CodeChallenge, found.CodeChallenge)
+			assert.Equal(t, code.Nonce, found.Nonce)
+			assert.Equal(t, code.AuthTime, found.AuthTime)
+			assert.True(t, code.ExpiresAt.Equal(found.ExpiresAt))
+		}
+
+		_, err = r.ConsumeAuthorizationCode(ctx(), code.Code)
+		assert.Equal(t, models.ErrAuthorizationCodeNotFound, err, "second exchange")
+
+		_, err = r.ConsumeAuthorizationCode(ctx(), unique())
+		assert.Equal(t, models.ErrAuthorizationCodeNotFound, err)
+	})
+
+	t.Run("Consent", func(t *testing.T) {
+		r, fixture := factory(t)
+
+		_, err := r.FindConsent(ctx(), fixture.Client.ID, fixture.User.ID)
+		assert.Equal(t, models.ErrConsentNotFound, err)
+
+		saved, err := r.SaveConsent(ctx(), &models.Consent{ClientID: fixture.Client.ID, UserID: fixture.User.ID, Scope: "users:read"})
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		// saving again replaces scope of the same record
+		updated, err := r.SaveConsent(ctx(), &models.Consent{ClientID: fixture.Client.ID, UserID: fixture.User.ID, Scope: "users:read clients:read"})
+		if assert.NoError(t, err) {
+			assert.Equal(t, saved.ID, updated.ID)
+		}
+
+		found, err := r.FindConsent(ctx(), fixture.Client.ID, fixture.User.ID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, saved.ID, found.ID)
+			assert.Equal(t, "users:read clients:read", found.Scope)
+		}
+
+		_, err = r.FindConsent(ctx(), fixture.Client.ID, uuid.New())
+		assert.Equal(t, models.ErrConsentNotFound, err)
+	})
+
+	t.Run("Revoked access token", func(t *testing.T) {
+		r, _ := factory(t)
+
+		id := uuid.New()
+
+		revoked, err := r.IsAccessTokenRevoked(ctx(), id)
+		if assert.NoError(t, err) {
+			assert.False(t, revoked)
+		}
+
+		assert.NoError(t, r.RevokeAccessToken(ctx(), id, time.Now().Add(time.Hour)))
+		assert.NoError(t, r.RevokeAccessToken(ctx(), id, time.Now().Add(time.Hour)), "second revoke")
+
+		revoked, err = r.IsAccessTokenRevoked(ctx(), id)
+		if assert.NoError(t, err) {
+			assert.True(t, revoked)
+		}
+
+		revoked, err = r.IsAccessTokenRevoked(ctx(), uuid.New())
+		if assert.NoError(t, err) {
+			assert.False(t, revoked)
+		}
+	})
+
+	t.Run("Login attempts", func(t *testing.T) {
+		r, _ := factory(t)
+		key := models.IPAttemptsKey(unique())
+
+		_, err := r.FindLoginAttempts(ctx(), key)
+		assert.Equal(t, models.ErrLoginAttemptsNotFound, err)
+
+		attempts := &models.LoginAttempts{Key: key, Failures: 1, LastFailure: time.Now().UTC()}
+		if _, err := r.SaveLoginAttempts(ctx(), attempts); !assert.NoError(t, err) {
+			return
+		}
+
+		attempts.Failures = 5
+		attempts.LockedUntil = time.Now().Add(time.Minute).UTC()
+		if _, err := r.SaveLoginAttempts(ctx(), attempts); !assert.NoError(t, err) {
+			return
+		}
+
+		found, err := r.FindLoginAttempts(ctx(), key)
+		if assert.NoError(t, err) {
+			assert.Equal(t, 5, found.Failures)
+			assert.WithinDuration(t, attempts.LastFailure, found.LastFailure, time.Second)
+			assert.WithinDuration(t, attempts.LockedUntil, found.LockedUntil, time.Second)
+		}
+
+		assert.NoError(t, r.DeleteLoginAttempts(ctx(), key))
+		assert.NoError(t, r.DeleteLoginAttempts(ctx(), key), "second delete")
+
+		_, err = r.FindLoginAttempts(ctx(), key)
+		assert.Equal(t, models.ErrLoginAttemptsNotFound, err)
+	})
+
+	t.Run("Failed login attempts", func(t *testing.T) {
+		r, _ := factory(t)
+		key := models.UserAttemptsKey(unique())
+		now := time.Now().UTC().Truncate(time.Second)
+
+		for i := 1; i <= 3; i++ {
+			a, err := r.FailLoginAttempt(ctx(), key, now, now.Add(-time.Hour))
+			if assert.NoError(t, err) {
+				assert.Equal(t, i, a.Failures)
+				assert.WithinDuration(t, now, a.LastFailure, time.Second)
+			}
+		}
+
+		locked, err := r.LockLoginAttempts(ctx(), key, now, now.Add(15*time.Minute))
+		if assert.NoError(t, err) {
+			assert.True(t, locked)
+		}
+
+		locked, err = r.LockLoginAttempts(ctx(), key, now, now.Add(30*time.Minute))
+		if assert.NoError(t, err) {
+			assert.False(t, locked, "lockout starts once")
+		}
+
+		later := now.Add(2 * time.Hour)
+
+		a, err := r.FailLoginAttempt(ctx(), key, now.Add(time.Minute), now.Add(-time.Hour))
+		if assert.NoError(t, err) {
+			assert.Equal(t, 4, a.Failures, "failures of locked key are kept")
+			assert.True(t, a.Locked(now))
+		}
+
+		a, err = r.FailLoginAttempt(ctx(), key, later, later.Add(-time.Hour))
+		if assert.NoError(t, err) {
+			assert.Equal(t, 1, a.Failures, "window expired")
+			assert.False(t, a.Locked(later))
+		}
+	})
+
+	t.Run("Concurrent failed login attempts", func(t *testing.T) {
+		r, _ := factory(t)
+		key := models.IPAttemptsKey(unique())
+		now := time.Now().UTC()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				_, err := r.FailLoginAttempt(ctx(), key, now, now.Add(-time.Hour))
+				assert.NoError(t, err)
+			}()
+		}
+
+		wg.Wait()
+
+		a, err := r.FindLoginAttempts(ctx(), key)
+		if assert.NoError(t, err) {
+			assert.Equal(t, 10, a.Failures, "every failure is counted")
+		}
+	})
+}
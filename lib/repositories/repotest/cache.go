@@ -0,0 +1,138 @@
+package repotest
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/models"
+)
+
+// cacheItem mixes the kinds of fields services keep in cache
+type cacheItem struct {
+	ID    uuid.UUID
+	Name  string
+	Count int
+	Tags  []string
+	Attrs map[string]string
+}
+
+func newCacheItem() *cacheItem {
+	return &cacheItem{
+		ID:    uuid.New(),
+		Name:  unique(),
+		Count: 42,
+		Tags:  []string{"a", "b"},
+		Attrs: map[string]string{"key": "value"},
+	}
+}
+
+// CacheRepository runs behavioural spec of repositories.CacheRepository for
+// caches which store values, no-op caches such as dummy never pass it
+func CacheRepository(t *testing.T, factory CacheFactory) {
+	t.Run("Miss", func(t *testing.T) {
+		r := factory(t)
+
+		assert.Equal(t, models.ErrMissCache, r.FindByKey(ctx(), "repotest_"+unique(), new(cacheItem)))
+	})
+
+	t.Run("Create then read", func(t *testing.T) {
+		r := factory(t)
+		key, item := "repotest_"+unique(), newCacheItem()
+
+		if !assert.NoError(t, r.Create(ctx(), key, item)) {
+			return
+		}
+
+		found := new(cacheItem)
+		if assert.NoError(t, r.FindByKey(ctx(), key, found)) {
+			assert.Equal(t, item, found)
+		}
+	})
+
+	t.Run("Stores models", func(t *testing.T) {
+		r := factory(t)
+		key := "repotest_" + unique()
+		user := newUser(unique(), 1)
+
+		if !assert.NoError(t, r.Create(ctx(), key, user)) {
+			return
+		}
+
+		found := new(models.User)
+		if assert.NoError(t, r.FindByKey(ctx(), key, found)) {
+			assertUser(t, user, found)
+		}
+	})
+
+	t.Run("Stored value is a copy", func(t *testing.T) {
+		r := factory(t)
+		key, item := "repotest_"+unique(), newCacheItem()
+
+		_ = r.Create(ctx(), key, item)
+
+		item.Name = "changed"
+		item.Tags[0] = "changed"
+
+		found := new(cacheItem)
+		if assert.NoError(t, r.FindByKey(ctx(), key, found)) {
+			assert.NotEqual(t, "changed", found.Name)
+			assert.Equal(t, "a", found.Tags[0])
+
+			// nor is the value handed out shared between readers
+			found.Attrs["key"] = "changed"
+
+			again := new(cacheItem)
+			if assert.NoError(t, r.FindByKey(ctx(), key, again)) {
+				assert.Equal(t, "value", again.Attrs["key"])
+			}
+		}
+	})
+
+	t.Run("Update overwrites", func(t *testing.T) {
+		r := factory(t)
+		key, item := "repotest_"+unique(), newCacheItem()
+
+		_ = r.Create(ctx(), key, item)
+
+		updated := newCacheItem()
+		if !assert.NoError(t, r.Update(ctx(), key, updated)) {
+			return
+		}
+
+		found := new(cacheItem)
+		if assert.NoError(t, r.FindByKey(ctx(), key, found)) {
+			assert.Equal(t, updated, found)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		r := factory(t)
+		key, other := "repotest_"+unique(), "repotest_"+unique()
+
+		_ = r.Create(ctx(), key, newCacheItem())
+		_ = r.Create(ctx(), other, newCacheItem())
+
+		assert.NoError(t, r.Delete(ctx(), key))
+		assert.Equal(t, models.ErrMissCache, r.FindByKey(ctx(), key, new(cacheItem)))
+		assert.NoError(t, r.FindByKey(ctx(), other, new(cacheItem)), "other keys must stay")
+	})
+
+	t.Run("Flush", func(t *testing.T) {
+		r := factory(t)
+		keys := []string{"repotest_" + unique(), "repotest_" + unique()}
+
+		for _, key := range keys {
+			_ = r.Create(ctx(), key, newCacheItem())
+		}
+
+		if !assert.NoError(t, r.Flush(ctx())) {
+			return
+		}
+
+		for _, key := range keys {
+			assert.Equal(t, models.ErrMissCache, r.FindByKey(ctx(), key, new(cacheItem)))
+		}
+	})
+}
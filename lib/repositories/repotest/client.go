@@ -0,0 +1,261 @@
+package repotest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/pkg/tenant"
+)
+
+// newClient returns valid client, tag is used in email and name so the
+// client can be found with a query
+func newClient(tag string, n int) *models.Client {
+	return &models.Client{
+		ID:        uuid.New(),
+		Name:      fmt.Sprintf("Contract %s %d", tag, n),
+		Email:     fmt.Sprintf("%s-%d@example.com", tag, n),
+		OwnerID:   uuid.New(),
+		Status:    models.StatusActive,
+		CreatedAt: time.Now().Add(time.Duration(n) * time.Second).Truncate(time.Millisecond),
+		UpdatedAt: time.Now().Truncate(time.Millisecond),
+	}
+}
+
+func assertClient(t *testing.T, expected *models.Client, actual *models.Client) {
+	assert.Equal(t, expected.ID, actual.ID)
+	assert.Equal(t, expected.Name, actual.Name)
+	assert.Equal(t, expected.Email, actual.Email)
+	assert.Equal(t, expected.OwnerID, actual.OwnerID)
+	assert.Equal(t, expected.Status, actual.Status)
+	assert.WithinDuration(t, expected.CreatedAt, actual.CreatedAt, time.Second)
+	assert.WithinDuration(t, expected.UpdatedAt, actual.UpdatedAt, time.Second)
+}
+
+// ClientRepository runs behavioural spec of repositories.ClientRepository
+func ClientRepository(t *testing.T, factory ClientFactory) {
+	t.Run("Not found", func(t *testing.T) {
+		r := factory(t)
+
+		_, err := r.FindByID(ctx(), uuid.New())
+		assert.Equal(t, models.ErrClientNotFound, err)
+	})
+
+	t.Run("Create then read", func(t *testing.T) {
+		r := factory(t)
+		client := newClient(unique(), 1)
+
+		if _, err := r.Create(ctx(), client); !assert.NoError(t, err) {
+			return
+		}
+
+		found, err := r.FindByID(ctx(), client.ID)
+		if assert.NoError(t, err) {
+			assertClient(t, client, found)
+		}
+	})
+
+	t.Run("Email is unique", func(t *testing.T) {
+		r := factory(t)
+		tag := unique()
+
+		first, second := newClient(tag, 1), newClient(tag, 2)
+		second.Email = first.Email
+
+		_, err := r.Create(ctx(), first)
+		assert.NoError(t, err)
+
+		_, err = r.Create(ctx(), second)
+		assert.Equal(t, models.ErrClientNameTaken, err)
+
+		_, err = r.FindByID(ctx(), second.ID)
+		assert.Equal(t, models.ErrClientNotFound, err, "rejected client must not be stored")
+	})
+
+	t.Run("Update then read", func(t *testing.T) {
+		r := factory(t)
+		client := newClient(unique(), 1)
+
+		_, err := r.Create(ctx(), client)
+		assert.NoError(t, err)
+
+		client.Name = "Updated " + unique()
+		client.Email = unique() + "@example.com"
+		client.Status = models.StatusDraft
+		client.UpdatedAt = time.Now().Add(time.Hour).Truncate(time.Millisecond)
+
+		if _, err := r.Update(ctx(), client); !assert.NoError(t, err) {
+			return
+		}
+
+		found, err := r.FindByID(ctx(), client.ID)
+		if assert.NoError(t, err) {
+			assertClient(t, client, found)
+		}
+	})
+
+	t.Run("Update unknown client", func(t *testing.T) {
+		r := factory(t)
+
+		_, err := r.Update(ctx(), newClient(unique(), 1))
+		assert.Equal(t, models.ErrClientNotFound, err)
+	})
+
+	t.Run("Update to taken email", func(t *testing.T) {
+		r := factory(t)
+		tag := unique()
+
+		first, second := newClient(tag, 1), newClient(tag, 2)
+		_, _ = r.Create(ctx(), first)
+		_, _ = r.Create(ctx(), second)
+
+		changed := *second
+		changed.Email = first.Email
+
+		_, err := r.Update(ctx(), &changed)
+		assert.Equal(t, models.ErrClientNameTaken, err)
+
+		found, err := r.FindByID(ctx(), second.ID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, second.Email, found.Email)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		r := factory(t)
+		tag := unique()
+
+		client, other := newClient(tag, 1), newClient(tag, 2)
+		_, _ = r.Create(ctx(), client)
+		_, _ = r.Create(ctx(), other)
+
+		assert.NoError(t, r.Delete(ctx(), client.ID))
+
+		_, err := r.FindByID(ctx(), client.ID)
+		assert.Equal(t, models.ErrClientNotFound, err)
+
+		_, err = r.FindByID(ctx(), other.ID)
+		assert.NoError(t, err, "other clients must stay")
+
+		assert.Equal(t, models.ErrClientNotFound, r.Delete(ctx(), client.ID), "second delete")
+		assert.Equal(t, models.ErrClientNotFound, r.Delete(ctx(), uuid.New()))
+
+		// email is free again
+		_, err = r.Create(ctx(), newClient(tag, 1))
+		assert.NoError(t, err)
+	})
+
+	t.Run("Filter and paginate", func(t *testing.T) {
+		r := factory(t)
+		tag := unique()
+
+		var created []*models.Client
+		for i := 1; i <= 5; i++ {
+			client := newClient(tag, i)
+			if i%2 == 0 {
+				client.Status = models.StatusDraft
+			}
+
+			if _, err := r.Create(ctx(), client); !assert.NoError(t, err) {
+				return
+			}
+
+			created = append(created, client)
+		}
+
+		total, err := r.CountAll(ctx(), &models.ClientQueryParams{Query: tag})
+		if assert.NoError(t, err) {
+			assert.Equal(t, 5, total)
+		}
+
+		// query is case insensitive
+		total, err = r.CountAll(ctx(), &models.ClientQueryParams{Query: "  " + strings.ToUpper(tag) + " "})
+		if assert.NoError(t, err) {
+			assert.Equal(t, 5, total)
+		}
+
+		draft := models.StatusDraft
+		total, err = r.CountAll(ctx(), &models.ClientQueryParams{Query: tag, Status: &draft})
+		if assert.NoError(t, err) {
+			assert.Equal(t, 2, total)
+		}
+
+		owned, err := r.FindAll(ctx(), &models.ClientQueryParams{Query: tag, OwnerID: &created[0].OwnerID})
+		if assert.NoError(t, err) && assert.Len(t, owned, 1) {
+			assert.Equal(t, created[0].ID, owned[0].ID)
+		}
+
+		// pages are disjoint, ordered by creation time and do not change the count
+		var seen []uuid.UUID
+		for page := 1; page <= 3; page++ {
+			params := &models.ClientQueryParams{Query: tag, Page: page, PerPage: 2}
+
+			clients, err := r.FindAll(ctx(), params)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			assert.Len(t, clients, []int{2, 2, 1}[page-1], "page %d", page)
+
+			for _, c := range clients {
+				seen = append(seen, c.ID)
+			}
+
+			total, err := r.CountAll(ctx(), params)
+			if assert.NoError(t, err) {
+				assert.Equal(t, 5, total, "page %d", page)
+			}
+		}
+
+		if assert.Len(t, seen, 5) {
+			for i, c := range created {
+				assert.Equal(t, c.ID, seen[i])
+			}
+		}
+
+		clients, err := r.FindAll(ctx(), &models.ClientQueryParams{Query: tag, Page: 4, PerPage: 2})
+		assert.NoError(t, err)
+		assert.Empty(t, clients)
+	})
+
+	t.Run("Tenant isolation", func(t *testing.T) {
+		r := factory(t)
+		tag := unique()
+
+		first, second := tenant.NewContext(ctx(), uuid.New()), tenant.NewContext(ctx(), uuid.New())
+
+		client := newClient(tag, 1)
+		if _, err := r.Create(first, client); !assert.NoError(t, err) {
+			return
+		}
+
+		found, err := r.FindByID(ctx(), client.ID)
+		if assert.NoError(t, err, "unscoped context sees every tenant") {
+			tid, _ := tenant.FromContext(first)
+			assert.Equal(t, tid, found.TenantID, "tenant is stamped on create")
+		}
+
+		_, err = r.FindByID(second, client.ID)
+		assert.Equal(t, models.ErrClientNotFound, err)
+
+		total, err := r.CountAll(second, &models.ClientQueryParams{Query: tag})
+		if assert.NoError(t, err) {
+			assert.Equal(t, 0, total)
+		}
+
+		clients, err := r.FindAll(first, &models.ClientQueryParams{Query: tag})
+		if assert.NoError(t, err) {
+			assert.Len(t, clients, 1)
+		}
+
+		_, err = r.Update(second, client)
+		assert.Equal(t, models.ErrClientNotFound, err)
+
+		assert.Equal(t, models.ErrClientNotFound, r.Delete(second, client.ID))
+	})
+}
@@ -0,0 +1,128 @@
+package repotest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/models"
+)
+
+// newKey returns key with random material, generating real keys is slow
+func newKey(n int) *models.SigningKey {
+	return &models.SigningKey{
+		ID:         unique(),
+		Algorithm:  models.AlgorithmEdDSA,
+		PrivateKey: []byte(unique()),
+		CreatedAt:  time.Now().Add(time.Duration(n) * time.Second).UTC().Truncate(time.Second),
+	}
+}
+
+// KeyRepository runs behavioural spec of repositories.KeyRepository
+func KeyRepository(t *testing.T, factory KeyFactory) {
+	t.Run("Create then find", func(t *testing.T) {
+		r := factory(t)
+
+		first, second := newKey(1), newKey(2)
+
+		for _, k := range []*models.SigningKey{second, first} {
+			if _, err := r.Create(ctx(), k); !assert.NoError(t, err) {
+				return
+			}
+		}
+
+		keys, err := r.FindAll(ctx())
+		if assert.NoError(t, err) && assert.Len(t, keys, 2) {
+			assert.Equal(t, first.ID, keys[0].ID, "oldest first")
+			assert.Equal(t, first.Algorithm, keys[0].Algorithm)
+			assert.Equal(t, first.PrivateKey, keys[0].PrivateKey)
+			assert.True(t, first.CreatedAt.Equal(keys[0].CreatedAt))
+			assert.True(t, keys[0].Active())
+			assert.Equal(t, second.ID, keys[1].ID)
+		}
+	})
+
+	t.Run("Retire", func(t *testing.T) {
+		r := factory(t)
+
+		key := newKey(0)
+		if _, err := r.Create(ctx(), key); !assert.NoError(t, err) {
+			return
+		}
+
+		key.RetiredAt = time.Now().UTC().Truncate(time.Second)
+		key.ExpiresAt = key.RetiredAt.Add(time.Hour)
+
+		if _, err := r.Update(ctx(), key); !assert.NoError(t, err) {
+			return
+		}
+
+		keys, err := r.FindAll(ctx())
+		if assert.NoError(t, err) && assert.Len(t, keys, 1) {
+			assert.False(t, keys[0].Active())
+			assert.True(t, key.ExpiresAt.Equal(keys[0].ExpiresAt))
+		}
+
+		_, err = r.Update(ctx(), newKey(0))
+		assert.Equal(t, models.ErrSigningKeyNotFound, err)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		r := factory(t)
+
+		key := newKey(0)
+		if _, err := r.Create(ctx(), key); !assert.NoError(t, err) {
+			return
+		}
+
+		assert.NoError(t, r.Delete(ctx(), key.ID))
+		assert.Equal(t, models.ErrSigningKeyNotFound, r.Delete(ctx(), key.ID), "second delete")
+
+		keys, err := r.FindAll(ctx())
+		if assert.NoError(t, err) {
+			assert.Empty(t, keys)
+		}
+	})
+
+	t.Run("Locked", func(t *testing.T) {
+		r := factory(t)
+
+		held, release := make(chan struct{}), make(chan struct{})
+		done := make(chan error, 1)
+
+		go func() {
+			done <- r.Locked(ctx(), func(ctx context.Context) error {
+				close(held)
+				<-release
+
+				return nil
+			})
+		}()
+
+		<-held
+
+		waiting, cancel := context.WithTimeout(ctx(), 300*time.Millisecond)
+		defer cancel()
+
+		ran := false
+		err := r.Locked(waiting, func(ctx context.Context) error {
+			ran = true
+
+			return nil
+		})
+		assert.Equal(t, context.DeadlineExceeded, err, "lock is held")
+		assert.False(t, ran)
+
+		close(release)
+		assert.NoError(t, <-done)
+
+		assert.NoError(t, r.Locked(ctx(), func(ctx context.Context) error {
+			ran = true
+
+			return nil
+		}))
+		assert.True(t, ran, "released lock is taken")
+	})
+}
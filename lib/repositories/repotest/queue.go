@@ -0,0 +1,112 @@
+package repotest
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/repositories"
+)
+
+// Task as received by a worker endpoint
+type Task struct {
+	Queue       string
+	ContentType string
+	Body        []byte
+}
+
+// QueueFactory returns repository under test and function delivering tasks
+// queued so far, received is nil for queues which cannot be observed in
+// tests, then only enqueueing is checked
+type QueueFactory func(t *testing.T) (repo repositories.QueueRepository, received func() []Task)
+
+// QueueRepository runs behavioural spec of repositories.QueueRepository
+func QueueRepository(t *testing.T, factory QueueFactory) {
+	t.Run("Raw payload", func(t *testing.T) {
+		r, received := factory(t)
+		queue, body := "repotest-"+unique(), []byte{0, 1, 2, 'x'}
+
+		if !assert.NoError(t, r.Add(ctx(), queue, body)) || received == nil {
+			return
+		}
+
+		if tasks := received(); assert.Len(t, tasks, 1) {
+			assert.Equal(t, queue, tasks[0].Queue)
+			assert.Equal(t, echo.MIMEOctetStream, tasks[0].ContentType)
+			assert.Equal(t, body, tasks[0].Body)
+		}
+	})
+
+	t.Run("Object payload", func(t *testing.T) {
+		r, received := factory(t)
+		queue, item := "repotest-"+unique(), newCacheItem()
+
+		if !assert.NoError(t, r.AddObject(ctx(), queue, item)) || received == nil {
+			return
+		}
+
+		if tasks := received(); assert.Len(t, tasks, 1) {
+			assert.Equal(t, queue, tasks[0].Queue)
+			assert.Contains(t, tasks[0].ContentType, echo.MIMEApplicationJSON)
+
+			found := new(cacheItem)
+			if assert.NoError(t, json.Unmarshal(tasks[0].Body, found)) {
+				assert.Equal(t, item, found)
+			}
+		}
+	})
+
+	t.Run("Object which cannot be encoded", func(t *testing.T) {
+		r, received := factory(t)
+
+		assert.Error(t, r.AddObject(ctx(), "repotest-"+unique(), make(chan int)))
+
+		if received != nil {
+			assert.Empty(t, received(), "nothing must be queued")
+		}
+	})
+
+	t.Run("Form payload", func(t *testing.T) {
+		r, received := factory(t)
+		queue := "repotest-" + unique()
+		values := url.Values{"id": {unique()}, "code": {"a b&c"}}
+
+		if !assert.NoError(t, r.AddToURL(ctx(), queue, values)) || received == nil {
+			return
+		}
+
+		if tasks := received(); assert.Len(t, tasks, 1) {
+			assert.Equal(t, queue, tasks[0].Queue)
+			assert.Contains(t, tasks[0].ContentType, echo.MIMEApplicationForm)
+
+			found, err := url.ParseQuery(string(tasks[0].Body))
+			if assert.NoError(t, err) {
+				assert.Equal(t, values, found)
+			}
+		}
+	})
+
+	t.Run("Delivered once in order", func(t *testing.T) {
+		r, received := factory(t)
+		queue := "repotest-" + unique()
+
+		for _, body := range []string{"first", "second", "third"} {
+			assert.NoError(t, r.Add(ctx(), queue, []byte(body)))
+		}
+
+		if received == nil {
+			return
+		}
+
+		tasks := received()
+		if assert.Len(t, tasks, 3) {
+			assert.Equal(t, "first", string(tasks[0].Body))
+			assert.Equal(t, "third", string(tasks[2].Body))
+		}
+
+		assert.Empty(t, received(), "delivered tasks must not come back")
+	})
+}
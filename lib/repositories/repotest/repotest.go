@@ -0,0 +1,49 @@
+// Package repotest contains behavioural specification shared by every
+// repository provider. A provider proves it is compliant by calling the
+// matching function from its own tests:
+//
+//	func TestSqlite_User_Contract(t *testing.T) {
+//		repotest.UserRepository(t, func(t *testing.T) repositories.UserRepository {
+//			return sqlstore.NewUserRepository(sqlstore.New(_db(t), sqlite.Dialect))
+//		})
+//	}
+//
+// Repositories returned by factories may already contain data, the specs
+// only rely on records they create themselves.
+package repotest
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/stiks/gobs/lib/repositories"
+)
+
+// UserFactory returns repository under test, called once per subtest
+type UserFactory func(t *testing.T) repositories.UserRepository
+
+// ClientFactory returns repository under test, called once per subtest
+type ClientFactory func(t *testing.T) repositories.ClientRepository
+
+// KeyFactory returns empty repository under test, called once per subtest
+type KeyFactory func(t *testing.T) repositories.KeyRepository
+
+// RoleFactory returns empty repository under test, called once per subtest
+type RoleFactory func(t *testing.T) repositories.RoleRepository
+
+// CacheFactory returns repository under test, called once per subtest
+type CacheFactory func(t *testing.T) repositories.CacheRepository
+
+// ctx used by every spec
+func ctx() context.Context {
+	return context.Background()
+}
+
+// unique returns lower case token not used by anything else in the store,
+// specs use it to tell their records apart from existing data
+func unique() string {
+	return strings.Replace(uuid.New().String(), "-", "", -1)[:12]
+}
@@ -0,0 +1,71 @@
+package repotest_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"sync"
+	"testing"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/repositories"
+	"github.com/stiks/gobs/lib/repositories/repotest"
+)
+
+// memoryCache is the smallest cache passing the spec, it keeps the spec
+// itself honest until real providers run it
+type memoryCache struct {
+	mu    sync.Mutex
+	items map[string][]byte
+}
+
+func (c *memoryCache) FindByKey(ctx context.Context, key string, obj interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.items[key]
+	if !ok {
+		return models.ErrMissCache
+	}
+
+	return gob.NewDecoder(bytes.NewReader(b)).Decode(obj)
+}
+
+func (c *memoryCache) Create(ctx context.Context, key string, data interface{}) error {
+	return c.Update(ctx, key, data)
+}
+
+func (c *memoryCache) Update(ctx context.Context, key string, data interface{}) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(data); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.items[key] = buf.Bytes()
+	c.mu.Unlock()
+
+	return nil
+}
+
+func (c *memoryCache) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	delete(c.items, key)
+	c.mu.Unlock()
+
+	return nil
+}
+
+func (c *memoryCache) Flush(ctx context.Context) error {
+	c.mu.Lock()
+	c.items = make(map[string][]byte)
+	c.mu.Unlock()
+
+	return nil
+}
+
+func TestRepotest_Cache(t *testing.T) {
+	repotest.CacheRepository(t, func(t *testing.T) repositories.CacheRepository {
+		return &memoryCache{items: make(map[string][]byte)}
+	})
+}
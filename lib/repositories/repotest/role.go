@@ -0,0 +1,63 @@
+package repotest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/models"
+)
+
+// RoleRepository runs behavioural spec of repositories.RoleRepository
+func RoleRepository(t *testing.T, factory RoleFactory) {
+	t.Run("Not found", func(t *testing.T) {
+		r := factory(t)
+
+		_, err := r.FindByName(ctx(), models.RoleManager)
+		assert.Equal(t, models.ErrRoleNotFound, err)
+	})
+
+	t.Run("Save then read", func(t *testing.T) {
+		r := factory(t)
+
+		role := &models.Role{
+			Name:        models.RoleManager,
+			Permissions: []string{models.PermUsersView, models.PermUsersUpdate + models.OwnSuffix},
+			MFARequired: true,
+			UpdatedAt:   time.Now().UTC().Truncate(time.Second),
+		}
+
+		if _, err := r.Save(ctx(), role); !assert.NoError(t, err) {
+			return
+		}
+
+		found, err := r.FindByName(ctx(), models.RoleManager)
+		if assert.NoError(t, err) {
+			assert.Equal(t, role.Permissions, found.Permissions)
+			assert.True(t, found.MFARequired)
+			assert.True(t, role.UpdatedAt.Equal(found.UpdatedAt))
+		}
+	})
+
+	t.Run("Save replaces", func(t *testing.T) {
+		r := factory(t)
+
+		for _, role := range []*models.Role{
+			{Name: models.RoleUser, Permissions: []string{models.PermUsersView}, UpdatedAt: time.Now().UTC()},
+			{Name: models.RoleClient, Permissions: []string{models.PermClientsView}, UpdatedAt: time.Now().UTC()},
+			{Name: models.RoleClient, Permissions: []string{}, UpdatedAt: time.Now().UTC()},
+		} {
+			if _, err := r.Save(ctx(), role); !assert.NoError(t, err) {
+				return
+			}
+		}
+
+		roles, err := r.FindAll(ctx())
+		if assert.NoError(t, err) && assert.Len(t, roles, 2) {
+			assert.Equal(t, models.RoleClient, roles[0].Name, "ordered by name")
+			assert.Empty(t, roles[0].Permissions)
+			assert.Equal(t, models.RoleUser, roles[1].Name)
+		}
+	})
+}
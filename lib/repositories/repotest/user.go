@@ -0,0 +1,331 @@
+package repotest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/pkg/tenant"
+)
+
+// newUser returns valid user, tag is used in email and last name so the
+// user can be found with a query
+func newUser(tag string, n int) *models.User {
+	return &models.User{
+		ID:                  uuid.New(),
+		Email:               fmt.Sprintf("%s-%d@example.com", tag, n),
+		FirstName:           "Contract",
+		LastName:            fmt.Sprintf("%s %d", tag, n),
+		PasswordHash:        []byte("$2a$10$kPrRofMm9VnE5w9ih6FwtuiuY/fIJ7/pcwvAmvL/3x3t2I144hyyq"),
+		PasswordResetHash:   "reset-" + tag + fmt.Sprint(n),
+		ValidationHash:      "validate-" + tag + fmt.Sprint(n),
+		ValidationSentAt:    time.Now().Truncate(time.Millisecond),
+		ValidationExpiresAt: time.Now().Add(24 * time.Hour).Truncate(time.Millisecond),
+		OwnerID:             uuid.New(),
+		Role:                models.RoleUser,
+		Status:              models.StatusActive,
+		IsActive:            true,
+		CreatedAt:           time.Now().Add(time.Duration(n) * time.Second).Truncate(time.Millisecond),
+		UpdatedAt:           time.Now().Truncate(time.Millisecond),
+	}
+}
+
+// assertUser compares stored fields, timestamps only to a second because
+// databases differ in precision
+func assertUser(t *testing.T, expected *models.User, actual *models.User) {
+	assert.Equal(t, expected.ID, actual.ID)
+	assert.Equal(t, expected.Email, actual.Email)
+	assert.Equal(t, expected.FirstName, actual.FirstName)
+	assert.Equal(t, expected.LastName, actual.LastName)
+	assert.Equal(t, expected.PasswordHash, actual.PasswordHash)
+	assert.Equal(t, expected.PasswordResetHash, actual.PasswordResetHash)
+	assert.Equal(t, expected.ValidationHash, actual.ValidationHash)
+	assert.Equal(t, expected.OwnerID, actual.OwnerID)
+	assert.Equal(t, expected.Role, actual.Role)
+	assert.Equal(t, expected.Status, actual.Status)
+	assert.Equal(t, expected.Verified, actual.Verified)
+	assert.Equal(t, expected.Locked, actual.Locked)
+	assert.Equal(t, expected.IsActive, actual.IsActive)
+	assert.Equal(t, expected.MFASecret, actual.MFASecret)
+	assert.Equal(t, expected.MFAEnabled, actual.MFAEnabled)
+	assert.Equal(t, len(expected.MFARecoveryCodes), len(actual.MFARecoveryCodes))
+	assert.Equal(t, expected.MFALastStep, actual.MFALastStep)
+	assert.WithinDuration(t, expected.ValidationSentAt, actual.ValidationSentAt, time.Second)
+	assert.WithinDuration(t, expected.ValidationExpiresAt, actual.ValidationExpiresAt, time.Second)
+	assert.WithinDuration(t, expected.CreatedAt, actual.CreatedAt, time.Second)
+	assert.WithinDuration(t, expected.UpdatedAt, actual.UpdatedAt, time.Second)
+}
+
+// UserRepository runs behavioural spec of repositories.UserRepository
+func UserRepository(t *testing.T, factory UserFactory) {
+	t.Run("Not found", func(t *testing.T) {
+		r := factory(t)
+
+		_, err := r.FindByID(ctx(), uuid.New())
+		assert.Equal(t, models.ErrUserNotFound, err)
+
+		_, err = r.FindByUsername(ctx(), unique()+"@example.com")
+		assert.Equal(t, models.ErrUserNotFound, err)
+
+		_, err = r.FindByResetHash(ctx(), unique())
+		assert.Equal(t, models.ErrUserNotFound, err)
+
+		_, err = r.FindByResetHash(ctx(), "")
+		assert.Equal(t, models.ErrUserNotFound, err, "empty hash must never match")
+	})
+
+	t.Run("Create then read", func(t *testing.T) {
+		r := factory(t)
+		user := newUser(unique(), 1)
+
+		if _, err := r.Create(ctx(), user); !assert.NoError(t, err) {
+			return
+		}
+
+		found, err := r.FindByID(ctx(), user.ID)
+		if assert.NoError(t, err) {
+			assertUser(t, user, found)
+		}
+
+		found, err = r.FindByUsername(ctx(), user.Email)
+		if assert.NoError(t, err) {
+			assert.Equal(t, user.ID, found.ID)
+		}
+
+		found, err = r.FindByResetHash(ctx(), user.PasswordResetHash)
+		if assert.NoError(t, err) {
+			assert.Equal(t, user.ID, found.ID)
+		}
+	})
+
+	t.Run("Email is unique", func(t *testing.T) {
+		r := factory(t)
+		tag := unique()
+
+		first, second := newUser(tag, 1), newUser(tag, 2)
+		second.Email = first.Email
+
+		_, err := r.Create(ctx(), first)
+		assert.NoError(t, err)
+
+		_, err = r.Create(ctx(), second)
+		assert.Equal(t, models.ErrUsernameTaken, err)
+
+		_, err = r.FindByID(ctx(), second.ID)
+		assert.Equal(t, models.ErrUserNotFound, err, "rejected user must not be stored")
+	})
+
+	t.Run("Update then read", func(t *testing.T) {
+		r := factory(t)
+		user := newUser(unique(), 1)
+
+		_, err := r.Create(ctx(), user)
+		assert.NoError(t, err)
+
+		user.Email = unique() + "@example.com"
+		user.FirstName = "Updated"
+		user.Role = models.RoleAdmin
+		user.Status = models.StatusDraft
+		user.Locked = true
+		user.Verified = true
+		user.MFASecret = "JBSWY3DPEHPK3PXP"
+		user.MFAEnabled = true
+		user.MFARecoveryCodes = []string{"hash-one", "hash-two"}
+		user.MFALastStep = 56666666
+		user.UpdatedAt = time.Now().Add(time.Hour).Truncate(time.Millisecond)
+
+		if _, err := r.Update(ctx(), user); !assert.NoError(t, err) {
+			return
+		}
+
+		found, err := r.FindByID(ctx(), user.ID)
+		if assert.NoError(t, err) {
+			assertUser(t, user, found)
+		}
+
+		found, err = r.FindByUsername(ctx(), user.Email)
+		if assert.NoError(t, err) {
+			assert.Equal(t, user.ID, found.ID)
+		}
+	})
+
+	t.Run("Update unknown user", func(t *testing.T) {
+		r := factory(t)
+
+		_, err := r.Update(ctx(), newUser(unique(), 1))
+		assert.Equal(t, models.ErrUserNotFound, err)
+	})
+
+	t.Run("Update to taken email", func(t *testing.T) {
+		r := factory(t)
+		tag := unique()
+
+		first, second := newUser(tag, 1), newUser(tag, 2)
+		_, _ = r.Create(ctx(), first)
+		_, _ = r.Create(ctx(), second)
+
+		changed := *second
+		changed.Email = first.Email
+
+		_, err := r.Update(ctx(), &changed)
+		assert.Equal(t, models.ErrUsernameTaken, err)
+
+		found, err := r.FindByID(ctx(), second.ID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, second.Email, found.Email)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		r := factory(t)
+		tag := unique()
+
+		user, other := newUser(tag, 1), newUser(tag, 2)
+		_, _ = r.Create(ctx(), user)
+		_, _ = r.Create(ctx(), other)
+
+		assert.NoError(t, r.Delete(ctx(), user.ID))
+
+		_, err := r.FindByID(ctx(), user.ID)
+		assert.Equal(t, models.ErrUserNotFound, err)
+
+		_, err = r.FindByID(ctx(), other.ID)
+		assert.NoError(t, err, "other users must stay")
+
+		assert.Equal(t, models.ErrUserNotFound, r.Delete(ctx(), user.ID), "second delete")
+		assert.Equal(t, models.ErrUserNotFound, r.Delete(ctx(), uuid.New()))
+
+		// email is free again
+		_, err = r.Create(ctx(), newUser(tag, 1))
+		assert.NoError(t, err)
+	})
+
+	t.Run("Filter and paginate", func(t *testing.T) {
+		r := factory(t)
+		tag := unique()
+
+		var created []*models.User
+		for i := 1; i <= 5; i++ {
+			user := newUser(tag, i)
+			if i%2 == 0 {
+				user.Role = models.RoleManager
+				user.Status = models.StatusDraft
+			}
+
+			if _, err := r.Create(ctx(), user); !assert.NoError(t, err) {
+				return
+			}
+
+			created = append(created, user)
+		}
+
+		total, err := r.CountAll(ctx(), &models.UserQueryParams{Query: tag})
+		if assert.NoError(t, err) {
+			assert.Equal(t, 5, total)
+		}
+
+		// query is case insensitive
+		total, err = r.CountAll(ctx(), &models.UserQueryParams{Query: "  " + strings.ToUpper(tag) + " "})
+		if assert.NoError(t, err) {
+			assert.Equal(t, 5, total)
+		}
+
+		draft := models.StatusDraft
+		total, err = r.CountAll(ctx(), &models.UserQueryParams{Query: tag, Role: models.RoleManager, Status: &draft})
+		if assert.NoError(t, err) {
+			assert.Equal(t, 2, total)
+		}
+
+		owned, err := r.FindAll(ctx(), &models.UserQueryParams{Query: tag, OwnerID: &created[0].OwnerID})
+		if assert.NoError(t, err) && assert.Len(t, owned, 1) {
+			assert.Equal(t, created[0].ID, owned[0].ID)
+		}
+
+		// pages are disjoint, ordered by creation time and do not change the count
+		var seen []uuid.UUID
+		for page := 1; page <= 3; page++ {
+			params := &models.UserQueryParams{Query: tag, Page: page, PerPage: 2}
+
+			users, err := r.FindAll(ctx(), params)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			assert.Len(t, users, []int{2, 2, 1}[page-1], "page %d", page)
+
+			for _, u := range users {
+				seen = append(seen, u.ID)
+			}
+
+			total, err := r.CountAll(ctx(), params)
+			if assert.NoError(t, err) {
+				assert.Equal(t, 5, total, "page %d", page)
+			}
+		}
+
+		if assert.Len(t, seen, 5) {
+			for i, u := range created {
+				assert.Equal(t, u.ID, seen[i])
+			}
+		}
+
+		users, err := r.FindAll(ctx(), &models.UserQueryParams{Query: tag, Page: 4, PerPage: 2})
+		assert.NoError(t, err)
+		assert.Empty(t, users)
+
+		users, err = r.FindAll(ctx(), &models.UserQueryParams{Query: unique()})
+		assert.NoError(t, err)
+		assert.Empty(t, users)
+	})
+
+	t.Run("Tenant isolation", func(t *testing.T) {
+		r := factory(t)
+		tag := unique()
+
+		first, second := tenant.NewContext(ctx(), uuid.New()), tenant.NewContext(ctx(), uuid.New())
+
+		user, other := newUser(tag, 1), newUser(tag, 2)
+		if _, err := r.Create(first, user); !assert.NoError(t, err) {
+			return
+		}
+
+		if _, err := r.Create(second, other); !assert.NoError(t, err) {
+			return
+		}
+
+		found, err := r.FindByID(ctx(), user.ID)
+		if assert.NoError(t, err, "unscoped context sees every tenant") {
+			tid, _ := tenant.FromContext(first)
+			assert.Equal(t, tid, found.TenantID, "tenant is stamped on create")
+		}
+
+		_, err = r.FindByID(second, user.ID)
+		assert.Equal(t, models.ErrUserNotFound, err)
+
+		_, err = r.FindByUsername(second, user.Email)
+		assert.Equal(t, models.ErrUserNotFound, err)
+
+		users, err := r.FindAll(first, &models.UserQueryParams{Query: tag})
+		if assert.NoError(t, err) && assert.Len(t, users, 1) {
+			assert.Equal(t, user.ID, users[0].ID)
+		}
+
+		total, err := r.CountAll(ctx(), &models.UserQueryParams{Query: tag})
+		if assert.NoError(t, err) {
+			assert.Equal(t, 2, total)
+		}
+
+		_, err = r.Update(second, user)
+		assert.Equal(t, models.ErrUserNotFound, err)
+
+		assert.Equal(t, models.ErrUserNotFound, r.Delete(second, user.ID))
+
+		_, err = r.Create(second, newUser(tag, 1))
+		assert.Equal(t, models.ErrUsernameTaken, err, "emails are unique across tenants")
+	})
+}
@@ -0,0 +1,15 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/stiks/gobs/lib/models"
+)
+
+// RoleRepository stores permissions of roles changed from defaults
+type RoleRepository interface {
+	FindAll(ctx context.Context) ([]models.Role, error)
+	FindByName(ctx context.Context, name string) (*models.Role, error)
+	// Save creates or replaces the role
+	Save(ctx context.Context, data *models.Role) (*models.Role, error)
+}
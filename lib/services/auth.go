@@ -2,13 +2,15 @@ package services
 
 import (
 	"context"
+	"errors"
+	"net/url"
+	"strings"
 	"time"
 
-	"github.com/labstack/gommon/log"
+	"github.com/google/uuid"
 
 	"github.com/stiks/gobs/lib/models"
 	"github.com/stiks/gobs/lib/repositories"
-	"github.com/stiks/gobs/pkg/env"
 	"github.com/stiks/gobs/pkg/xlog"
 )
 
@@ -16,45 +18,135 @@ type authService struct {
 	repo                 repositories.AuthRepository
 	AccessTokenLifetime  int
 	RefreshTokenLifetime int
-	JWTSecretCode        []byte
+	CodeLifetime         time.Duration
+	Issuer               string
+	authorizationURL     string
+	keys                 models.TokenKeys
+	mfa                  MFAService
+	lockout              LockoutService
 }
 
 // AuthService ...
 type AuthService interface {
 	GetValidRefreshToken(ctx context.Context, token string, client *models.AuthClient) (*models.Token, error)
-	GenerateNewRefreshToken(ctx context.Context, client *models.AuthClient, user *models.User) (*models.Token, error)
-	GetOrCreateRefreshToken(ctx context.Context, client *models.AuthClient, user *models.User) (*models.Token, error)
+	GenerateNewRefreshToken(ctx context.Context, client *models.AuthClient, user *models.User, scope string, authTime int64) (*models.Token, error)
+	GetOrCreateRefreshToken(ctx context.Context, client *models.AuthClient, user *models.User, scope string, authTime int64) (*models.Token, error)
 	RefreshTokenGrant(ctx context.Context, r *models.AuthRequest, client *models.AuthClient) (*models.TokenResponse, error)
 	PasswordGrant(ctx context.Context, r *models.AuthRequest, client *models.AuthClient) (*models.TokenResponse, error)
+	// MFAGrant completes password login challenged for second factor
+	MFAGrant(ctx context.Context, r *models.AuthRequest, client *models.AuthClient) (*models.TokenResponse, error)
+	// EnrollMFA starts enrollment of user whose role requires MFA before the
+	// user is able to sign in
+	EnrollMFA(ctx context.Context, token string, client *models.AuthClient) (*models.MFAEnrollment, error)
+	ClientCredentialsGrant(ctx context.Context, r *models.AuthRequest, client *models.AuthClient) (*models.TokenResponse, error)
+	AuthorizationCodeGrant(ctx context.Context, r *models.AuthRequest, client *models.AuthClient) (*models.TokenResponse, error)
+	Authorize(ctx context.Context, r *models.AuthorizeRequest, userID uuid.UUID) (*models.AuthorizeResponse, error)
+	Consent(ctx context.Context, r *models.AuthorizeRequest, userID uuid.UUID) (*models.AuthorizeResponse, error)
+	AuthenticateClient(ctx context.Context, clientID string, secret string) (*models.AuthClient, error)
+	RevokeToken(ctx context.Context, r *models.TokenRequest, client *models.AuthClient) error
+	IntrospectToken(ctx context.Context, r *models.TokenRequest, client *models.AuthClient) (*models.IntrospectionResponse, error)
+	Revoked(ctx context.Context, jti string) (bool, error)
 	GetClient(ctx context.Context, r *models.AuthRequest) (*models.AuthClient, error)
+	// UpdateClientScope replaces scopes the auth client may request
+	UpdateClientScope(ctx context.Context, clientID string, r *models.ClientScope) (*models.AuthClient, error)
+	UserInfo(ctx context.Context, userID uuid.UUID, scope string) (*models.UserInfo, error)
+	Discovery() *models.OpenIDConfiguration
 }
 
-// NewAuthService ...
-func NewAuthService(repo repositories.AuthRepository) AuthService {
-	if !env.MustPresent("AUTH_SECRET_KEY") {
-		log.Panicf("'AUTH_SECRET_KEY' must be set")
+// AuthConfig of token issuing, lifetimes accept "8h" or seconds
+type AuthConfig struct {
+	SecretKey            string        `env:"AUTH_SECRET_KEY" required:"true"`
+	AccessTokenLifetime  time.Duration `env:"AUTH_ACCESS_TOKEN_LIFETIME" required:"true"`
+	RefreshTokenLifetime time.Duration `env:"AUTH_REFRESH_TOKEN_LIFETIME" required:"true"`
+	// CodeLifetime of authorization codes, one minute when zero
+	CodeLifetime time.Duration `env:"AUTH_CODE_LIFETIME" default:"60s"`
+	// Issuer of ID tokens, public URL the server is reached at
+	Issuer string `env:"AUTH_ISSUER" default:"http://localhost:8080"`
+	// AuthorizationEndpoint is sign-in page of the UI starting authorization
+	// code flow, discovery leaves it out when empty
+	AuthorizationEndpoint string `env:"AUTH_AUTHORIZATION_ENDPOINT"`
+	// Keys sign access tokens, HS256 with SecretKey when nil
+	Keys models.TokenKeys
+	// MFA challenges password logins for second factor, disabled when nil
+	MFA MFAService
+	// Lockout throttles failed password logins, disabled when nil
+	Lockout LockoutService
+}
+
+// Validate ...
+func (c *AuthConfig) Validate() error {
+	var errs []string
+	if c.SecretKey == "" {
+		errs = append(errs, "AUTH_SECRET_KEY must be set")
+	}
+
+	if c.AccessTokenLifetime < time.Second {
+		errs = append(errs, "AUTH_ACCESS_TOKEN_LIFETIME must be at least 1s")
+	}
+
+	if c.RefreshTokenLifetime < time.Second {
+		errs = append(errs, "AUTH_REFRESH_TOKEN_LIFETIME must be at least 1s")
+	}
+
+	if c.CodeLifetime < 0 || c.CodeLifetime > 10*time.Minute {
+		errs = append(errs, "AUTH_CODE_LIFETIME must be at most 10m")
+	}
+
+	if c.Issuer != "" {
+		if u, err := url.Parse(c.Issuer); err != nil || u.Scheme == "" || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+			errs = append(errs, "AUTH_ISSUER must be an absolute URL without query")
+		}
 	}
 
-	if !env.MustPresent("AUTH_ACCESS_TOKEN_LIFETIME") {
-		log.Panicf("'AUTH_ACCESS_TOKEN_LIFETIME' must be set")
+	if c.AuthorizationEndpoint != "" {
+		if u, err := url.Parse(c.AuthorizationEndpoint); err != nil || u.Scheme == "" || u.Host == "" || u.Fragment != "" {
+			errs = append(errs, "AUTH_AUTHORIZATION_ENDPOINT must be an absolute URL without fragment")
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
 	}
 
-	if !env.MustPresent("AUTH_REFRESH_TOKEN_LIFETIME") {
-		log.Panicf("'AUTH_REFRESH_TOKEN_LIFETIME' must be set")
+	return nil
+}
+
+// NewAuthService returns error of invalid config
+func NewAuthService(repo repositories.AuthRepository, cfg AuthConfig) (AuthService, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.CodeLifetime == 0 {
+		cfg.CodeLifetime = time.Minute
+	}
+
+	if cfg.Issuer == "" {
+		cfg.Issuer = "http://localhost:8080"
+	}
+
+	if cfg.Keys == nil {
+		cfg.Keys = models.HMACKeys(cfg.SecretKey)
 	}
 
 	return &authService{
-		JWTSecretCode:        []byte(env.MustGetString("AUTH_SECRET_KEY")),
-		AccessTokenLifetime:  env.MustGetInt("AUTH_ACCESS_TOKEN_LIFETIME"),
-		RefreshTokenLifetime: env.MustGetInt("AUTH_REFRESH_TOKEN_LIFETIME"),
+		keys:                 cfg.Keys,
+		mfa:                  cfg.MFA,
+		lockout:              cfg.Lockout,
+		AccessTokenLifetime:  int(cfg.AccessTokenLifetime / time.Second),
+		RefreshTokenLifetime: int(cfg.RefreshTokenLifetime / time.Second),
+		CodeLifetime:         cfg.CodeLifetime,
+		Issuer:               strings.TrimSuffix(cfg.Issuer, "/"),
+		authorizationURL:     cfg.AuthorizationEndpoint,
 		repo:                 repo,
-	}
+	}, nil
 }
 
 // GetClient from request
 func (s *authService) GetClient(ctx context.Context, r *models.AuthRequest) (*models.AuthClient, error) {
-	// Get client credentials from request
-	if r.ClientID == "" || r.ClientSecret == "" {
+	// Get client credentials from request, public clients exchange
+	// authorization codes without secret
+	if r.ClientID == "" || (r.ClientSecret == "" && r.GrantType != "authorization_code") {
 		return nil, models.ErrEmptyClientOrSecret
 	}
 
@@ -67,6 +159,13 @@ func (s *authService) GetClient(ctx context.Context, r *models.AuthRequest) (*mo
 		return nil, models.ErrInvalidClientOrSecret
 	}
 
+	// Public clients can't keep a secret, PKCE proves the exchange instead
+	if client.IsPublic() && r.GrantType != "authorization_code" {
+		xlog.Errorf(ctx, "Public client %s used %s grant", client.ClientID, r.GrantType)
+
+		return nil, models.ErrInvalidClientOrSecret
+	}
+
 	// Validate client secret
 	if !client.ValidateSecret(r.ClientSecret) {
 		xlog.Errorf(ctx, "Client secret is invalid")
@@ -80,9 +179,20 @@ func (s *authService) GetClient(ctx context.Context, r *models.AuthRequest) (*mo
 
 // PasswordGrant login using password
 func (s *authService) PasswordGrant(ctx context.Context, req *models.AuthRequest, client *models.AuthClient) (*models.TokenResponse, error) {
+	// Throttled logins don't get to check the password at all
+	if s.lockout != nil {
+		if err := s.lockout.Check(ctx, req.Username, req.ClientIP); err != nil {
+			xlog.Infof(ctx, "Password login of %s from %s throttled, err: %s", req.Username, req.ClientIP, err.Error())
+
+			return nil, err
+		}
+	}
+
 	// Find user by username
 	user, err := s.repo.FindUserByUsername(ctx, req.Username)
 	if err != nil && err == models.ErrUserNotFound {
+		s.loginFailed(ctx, req, nil)
+
 		// For security reason
 		return nil, models.ErrInvalidUsernameOrPassword
 	}
@@ -105,11 +215,158 @@ func (s *authService) PasswordGrant(ctx context.Context, req *models.AuthRequest
 	if !user.ValidatePassword(req.Password) {
 		xlog.Errorf(ctx, "User password is wrong")
 
+		s.loginFailed(ctx, req, user)
+
+		return nil, models.ErrInvalidUsernameOrPassword
+	}
+
+	// Inactive users, not confirmed yet or deactivated, fail as a wrong
+	// password does, so the response doesn't tell their accounts apart.
+	// Verified is not required, users created by admins are active without it.
+	if !user.IsActive {
+		xlog.Infof(ctx, "User %s is inactive", user.ID)
+
+		s.loginFailed(ctx, req, user)
+
 		return nil, models.ErrInvalidUsernameOrPassword
 	}
 
+	// Locked account is reported only with valid password, so it tells
+	// nothing to somebody guessing
+	if user.Locked {
+		xlog.Infof(ctx, "User %s is locked", user.ID)
+
+		return nil, models.ErrUserIsLocked
+	}
+
+	scope, err := client.GrantUserScope(req.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.mfa != nil {
+		required, err := s.mfa.Required(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+
+		if required {
+			token, err := models.NewMFAToken(client, user, scope, s.keys)
+			if err != nil {
+				return nil, err
+			}
+
+			// failures are forgotten once the second factor passes too
+			return nil, &models.MFAChallenge{Token: token, EnrollmentRequired: !user.MFAEnabled}
+		}
+	}
+
+	s.loginSucceeded(ctx, req.Username)
+
+	return s.login(ctx, client, user, scope)
+}
+
+// loginFailed counts failed password login, errors are logged only so the
+// client gets the same answer
+func (s *authService) loginFailed(ctx context.Context, req *models.AuthRequest, user *models.User) {
+	if s.lockout == nil {
+		return
+	}
+
+	if err := s.lockout.Failed(ctx, req.Username, req.ClientIP, user); err != nil {
+		xlog.Errorf(ctx, "Unable to record failed login, err: %s", err.Error())
+	}
+}
+
+// loginSucceeded forgets failed logins of username once every factor passed
+func (s *authService) loginSucceeded(ctx context.Context, username string) {
+	if s.lockout == nil {
+		return
+	}
+
+	if err := s.lockout.Succeeded(ctx, username); err != nil {
+		xlog.Errorf(ctx, "Unable to reset failed logins, err: %s", err.Error())
+	}
+}
+
+// MFAGrant login using MFA token of password grant and TOTP or recovery code
+func (s *authService) MFAGrant(ctx context.Context, req *models.AuthRequest, client *models.AuthClient) (*models.TokenResponse, error) {
+	claims, err := s.mfaClaims(req.MFAToken, client)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.FindUserByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// codes are guessed the way passwords are, so they share the lockout
+	if s.lockout != nil {
+		if err := s.lockout.Check(ctx, user.Email, req.ClientIP); err != nil {
+			xlog.Infof(ctx, "Second factor of user %s from %s throttled, err: %s", user.ID, req.ClientIP, err.Error())
+
+			return nil, err
+		}
+	}
+
+	authenticated, codes, err := s.mfa.Authenticate(ctx, claims.UserID, req.Code)
+	if err != nil {
+		xlog.Errorf(ctx, "Second factor of user %s failed, err: %s", claims.UserID, err.Error())
+
+		if err == models.ErrInvalidMFACode {
+			s.loginFailed(ctx, &models.AuthRequest{Username: user.Email, ClientIP: req.ClientIP}, user)
+		}
+
+		return nil, err
+	}
+
+	s.loginSucceeded(ctx, user.Email)
+
+	resp, err := s.login(ctx, client, authenticated, claims.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.RecoveryCodes = codes
+
+	return resp, nil
+}
+
+// EnrollMFA ...
+func (s *authService) EnrollMFA(ctx context.Context, token string, client *models.AuthClient) (*models.MFAEnrollment, error) {
+	claims, err := s.mfaClaims(token, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.mfa.Enroll(ctx, claims.UserID)
+}
+
+// mfaClaims verifies MFA token was issued to the client
+func (s *authService) mfaClaims(token string, client *models.AuthClient) (*models.MFAClaims, error) {
+	if s.mfa == nil {
+		return nil, models.ErrInvalidGrantType
+	}
+
+	claims, err := models.ParseMFAToken(token, s.keys)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.ClientID != client.ID {
+		return nil, models.ErrInvalidMFAToken
+	}
+
+	return claims, nil
+}
+
+// login issues tokens of user who has just authenticated
+func (s *authService) login(ctx context.Context, client *models.AuthClient, user *models.User, scope string) (*models.TokenResponse, error) {
+	authTime := time.Now().UTC().Unix()
+
 	// create a new access token
-	accessToken, err := models.NewAccessToken(client, user, s.AccessTokenLifetime, s.JWTSecretCode)
+	accessToken, err := models.NewAccessToken(client, user, scope, authTime, s.AccessTokenLifetime, s.keys)
 	if err != nil {
 		xlog.Errorf(ctx, "Unable to create access token, err: %s", err.Error())
 
@@ -117,7 +374,7 @@ func (s *authService) PasswordGrant(ctx context.Context, req *models.AuthRequest
 	}
 
 	// create or retrieve a refresh token
-	refreshToken, err := s.GetOrCreateRefreshToken(ctx, client, user)
+	refreshToken, err := s.GetOrCreateRefreshToken(ctx, client, user, scope, authTime)
 	if err != nil {
 		xlog.Errorf(ctx, "Unable to create or get refresh token, err: %s", err.Error())
 
@@ -129,29 +386,396 @@ func (s *authService) PasswordGrant(ctx context.Context, req *models.AuthRequest
 	}
 
 	// create response
-	return models.NewTokenResponse(accessToken, refreshToken, s.AccessTokenLifetime, "Bearer")
+	return s.userTokenResponse(accessToken, refreshToken, scope, "")
+}
+
+// userTokenResponse returns token response of a user, ID token is added when
+// openid scope was granted
+func (s *authService) userTokenResponse(accessToken *models.Token, refreshToken *models.Token, scope string, nonce string) (*models.TokenResponse, error) {
+	resp, err := models.NewTokenResponse(accessToken, refreshToken, s.AccessTokenLifetime, "Bearer")
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Scope = scope
+
+	if models.HasScope(scope, models.ScopeOpenID) {
+		if resp.IDToken, err = models.NewIDToken(s.Issuer, accessToken.Client, accessToken.User, scope, nonce, accessToken.AuthTime, s.AccessTokenLifetime, s.keys); err != nil {
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+// ClientCredentialsGrant issues token to the client acting on its own behalf,
+// there is no user involved so no refresh token is issued
+func (s *authService) ClientCredentialsGrant(ctx context.Context, req *models.AuthRequest, client *models.AuthClient) (*models.TokenResponse, error) {
+	if client.Role == "" {
+		xlog.Errorf(ctx, "Client %s has no role for client credentials", client.ClientID)
+
+		return nil, models.ErrUnauthorizedClient
+	}
+
+	scope, err := client.GrantScope(req.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := models.NewClientAccessToken(client, scope, s.AccessTokenLifetime, s.keys)
+	if err != nil {
+		xlog.Errorf(ctx, "Unable to create access token, err: %s", err.Error())
+
+		return nil, err
+	}
+
+	return &models.TokenResponse{
+		AccessToken: accessToken.Token,
+		ExpiresIn:   s.AccessTokenLifetime,
+		TokenType:   "Bearer",
+		Scope:       scope,
+		Authority:   client.Role,
+	}, nil
+}
+
+// authorizeClient checks client, redirect URI and scope of authorization request
+func (s *authService) authorizeClient(ctx context.Context, r *models.AuthorizeRequest) (*models.AuthClient, string, error) {
+	client, err := s.repo.FindByClientID(ctx, r.ClientID)
+	if err != nil {
+		xlog.Errorf(ctx, "Error getting Client ID: %s", err.Error())
+
+		return nil, "", models.ErrAuthClientNotFound
+	}
+
+	if !client.ValidRedirectURI(r.RedirectURI) {
+		return nil, "", models.ErrInvalidRedirectURI
+	}
+
+	scope, err := client.GrantUserScope(r.Scope)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return client, scope, nil
+}
+
+// issueCode stores new authorization code and returns redirect carrying it
+func (s *authService) issueCode(ctx context.Context, r *models.AuthorizeRequest, client *models.AuthClient, userID uuid.UUID, scope string) (*models.AuthorizeResponse, error) {
+	code, err := s.repo.CreateAuthorizationCode(ctx, models.NewAuthorizationCode(client, userID, r, scope, s.CodeLifetime))
+	if err != nil {
+		xlog.Errorf(ctx, "Unable to create authorization code, err: %s", err.Error())
+
+		return nil, err
+	}
+
+	return &models.AuthorizeResponse{RedirectTo: r.RedirectWith(url.Values{"code": {code.Code}})}, nil
 }
 
-// GetOrCreateRefreshToken retrieves an existing refresh token, if expired,
-// the token gets deleted and new refresh token is created
-func (s *authService) GetOrCreateRefreshToken(ctx context.Context, client *models.AuthClient, user *models.User) (*models.Token, error) {
+// Authorize issues authorization code when user already approved requested
+// scope for the client, otherwise asks for consent
+func (s *authService) Authorize(ctx context.Context, r *models.AuthorizeRequest, userID uuid.UUID) (*models.AuthorizeResponse, error) {
+	client, scope, err := s.authorizeClient(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	consent, err := s.repo.FindConsent(ctx, client.ID, userID)
+	if err != nil && err != models.ErrConsentNotFound {
+		xlog.Errorf(ctx, "Unable to find consent, err: %s", err.Error())
+
+		return nil, err
+	}
+
+	if consent == nil || !consent.Covers(scope) {
+		return &models.AuthorizeResponse{ConsentRequired: true, ClientID: client.ClientID, Scope: scope}, nil
+	}
+
+	return s.issueCode(ctx, r, client, userID, scope)
+}
+
+// Consent records user's answer, approval is remembered and code issued,
+// denial is sent back to the client as access_denied
+func (s *authService) Consent(ctx context.Context, r *models.AuthorizeRequest, userID uuid.UUID) (*models.AuthorizeResponse, error) {
+	client, scope, err := s.authorizeClient(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	if !r.Approve {
+		return &models.AuthorizeResponse{RedirectTo: r.RedirectWith(url.Values{"error": {"access_denied"}})}, nil
+	}
+
+	consent, err := s.repo.FindConsent(ctx, client.ID, userID)
+	if err == models.ErrConsentNotFound {
+		consent, err = &models.Consent{ClientID: client.ID, UserID: userID}, nil
+	}
+
+	if err != nil {
+		xlog.Errorf(ctx, "Unable to find consent, err: %s", err.Error())
+
+		return nil, err
+	}
+
+	consent.Add(scope)
+
+	if _, err := s.repo.SaveConsent(ctx, consent); err != nil {
+		xlog.Errorf(ctx, "Unable to save consent, err: %s", err.Error())
+
+		return nil, err
+	}
+
+	return s.issueCode(ctx, r, client, userID, scope)
+}
+
+// AuthorizationCodeGrant exchanges authorization code for tokens
+func (s *authService) AuthorizationCodeGrant(ctx context.Context, r *models.AuthRequest, client *models.AuthClient) (*models.TokenResponse, error) {
+	if r.Code == "" {
+		return nil, models.ErrAuthorizationCodeNotFound
+	}
+
+	// the code is gone from now on, whatever the outcome
+	code, err := s.repo.ConsumeAuthorizationCode(ctx, r.Code)
+	if err != nil {
+		xlog.Errorf(ctx, "Unable to find authorization code, err: %s", err.Error())
+
+		return nil, models.ErrAuthorizationCodeNotFound
+	}
+
+	if code.ClientID != client.ID {
+		xlog.Errorf(ctx, "Authorization code belongs to another client")
+
+		return nil, models.ErrAuthorizationCodeNotFound
+	}
+
+	if code.Expired() {
+		return nil, models.ErrAuthorizationCodeExpired
+	}
+
+	if code.RedirectURI != r.RedirectURI {
+		return nil, models.ErrInvalidRedirectURI
+	}
+
+	if !code.VerifyChallenge(r.CodeVerifier) {
+		return nil, models.ErrInvalidCodeVerifier
+	}
+
+	user, err := s.repo.FindUserByID(ctx, code.UserID)
+	if err != nil {
+		xlog.Errorf(ctx, "User not found, err: %s", err.Error())
+
+		return nil, err
+	}
+
+	if err := s.checkUser(ctx, user); err != nil {
+		return nil, err
+	}
+
+	accessToken, err := models.NewAccessToken(client, user, code.Scope, code.AuthTime, s.AccessTokenLifetime, s.keys)
+	if err != nil {
+		xlog.Errorf(ctx, "Unable to create access token, err: %s", err.Error())
+
+		return nil, err
+	}
+
+	refreshToken, err := s.GetOrCreateRefreshToken(ctx, client, user, code.Scope, code.AuthTime)
+	if err != nil {
+		xlog.Errorf(ctx, "Unable to create or get refresh token, err: %s", err.Error())
+
+		return nil, err
+	}
+
+	if err := s.repo.UpdateLastLogin(ctx, user.ID); err != nil {
+		xlog.Errorf(ctx, "Unable to set users last login, err: %s", err.Error())
+	}
+
+	return s.userTokenResponse(accessToken, refreshToken, code.Scope, code.Nonce)
+}
+
+// AuthenticateClient checks credentials of revocation and introspection
+// requests, public clients present their client ID only
+func (s *authService) AuthenticateClient(ctx context.Context, clientID string, secret string) (*models.AuthClient, error) {
+	if clientID == "" {
+		return nil, models.ErrEmptyClientOrSecret
+	}
+
+	client, err := s.repo.FindByClientID(ctx, clientID)
+	if err != nil {
+		xlog.Errorf(ctx, "Error getting Client ID: %s", err.Error())
+
+		return nil, models.ErrInvalidClientOrSecret
+	}
+
+	if !client.ValidateSecret(secret) {
+		xlog.Errorf(ctx, "Client secret is invalid")
+
+		return nil, models.ErrInvalidClientOrSecret
+	}
+
+	return client, nil
+}
+
+// UpdateClientScope ...
+func (s *authService) UpdateClientScope(ctx context.Context, clientID string, r *models.ClientScope) (*models.AuthClient, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+
+	var scopes []string
+	for _, scope := range strings.Fields(r.Scope) {
+		if !contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return s.repo.UpdateClientScope(ctx, clientID, strings.Join(scopes, " "))
+}
+
+// RevokeToken revokes refresh token of the client or puts access token issued
+// to the client on denylist, unknown tokens are not an error (RFC 7009)
+func (s *authService) RevokeToken(ctx context.Context, r *models.TokenRequest, client *models.AuthClient) error {
+	if r.TokenTypeHint != "access_token" {
+		if token, err := s.repo.FindByHashClient(ctx, client.ID, r.Token); err == nil {
+			if err := s.repo.DeleteToken(ctx, token.ID); err != nil && err != models.ErrTokenNotFound {
+				xlog.Errorf(ctx, "Unable delete token %s, err: %s", token.ID.String(), err.Error())
+
+				return err
+			}
+
+			return nil
+		}
+	}
+
+	claims, err := models.ParseAccessToken(r.Token, s.keys)
+	if err != nil {
+		return nil
+	}
+
+	if claims.ClientID != client.ID {
+		xlog.Errorf(ctx, "Client %s tried to revoke token of another client", client.ClientID)
+
+		return models.ErrUnauthorizedClient
+	}
+
+	if err := s.repo.RevokeAccessToken(ctx, claims.ID, time.Unix(claims.ExpiresAt, 0)); err != nil {
+		xlog.Errorf(ctx, "Unable to revoke access token %s, err: %s", claims.ID.String(), err.Error())
+
+		return err
+	}
+
+	return nil
+}
+
+// IntrospectToken describes token state (RFC 7662), only confidential clients
+// may introspect, refresh tokens are looked up among tokens of the client
+func (s *authService) IntrospectToken(ctx context.Context, r *models.TokenRequest, client *models.AuthClient) (*models.IntrospectionResponse, error) {
+	if client.IsPublic() {
+		return nil, models.ErrUnauthorizedClient
+	}
+
+	inactive := &models.IntrospectionResponse{Active: false}
+
+	if r.TokenTypeHint != "access_token" {
+		if token, err := s.repo.FindByHashClient(ctx, client.ID, r.Token); err == nil {
+			if time.Now().UTC().After(time.Unix(token.ExpiresAt, 0)) {
+				return inactive, nil
+			}
+
+			resp := &models.IntrospectionResponse{
+				Active:    true,
+				ClientID:  client.ClientID,
+				TokenType: "refresh_token",
+				ExpiresAt: token.ExpiresAt,
+				Subject:   token.UserID.String(),
+			}
+
+			if user, err := s.repo.FindUserByID(ctx, token.UserID); err == nil {
+				resp.Username = user.Email
+			}
+
+			return resp, nil
+		}
+	}
+
+	claims, err := models.ParseAccessToken(r.Token, s.keys)
+	if err != nil {
+		return inactive, nil
+	}
+
+	revoked, err := s.repo.IsAccessTokenRevoked(ctx, claims.ID)
+	if err != nil {
+		xlog.Errorf(ctx, "Unable to check access token %s, err: %s", claims.ID.String(), err.Error())
+
+		return nil, err
+	}
+
+	if revoked {
+		return inactive, nil
+	}
+
+	resp := &models.IntrospectionResponse{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  claims.Client,
+		TokenType: "Bearer",
+		ExpiresAt: claims.ExpiresAt,
+		IssuedAt:  claims.IssuedAt,
+		Subject:   claims.Client,
+		ID:        claims.ID.String(),
+	}
+
+	if claims.UserID != nil {
+		resp.Subject = claims.UserID.String()
+
+		if user, err := s.repo.FindUserByID(ctx, *claims.UserID); err == nil {
+			resp.Username = user.Email
+		}
+	}
+
+	return resp, nil
+}
+
+// Revoked tells whether access token was revoked, used as auth.Denylist
+func (s *authService) Revoked(ctx context.Context, jti string) (bool, error) {
+	id, err := uuid.Parse(jti)
+	if err != nil {
+		return false, nil
+	}
+
+	return s.repo.IsAccessTokenRevoked(ctx, id)
+}
+
+// GetOrCreateRefreshToken retrieves an existing refresh token, if expired or
+// granted another scope, the token gets deleted and new refresh token is created.
+// Existing token keeps time of the sign in it was created by, so later ID
+// tokens may report an earlier auth_time, never a later one.
+func (s *authService) GetOrCreateRefreshToken(ctx context.Context, client *models.AuthClient, user *models.User, scope string, authTime int64) (*models.Token, error) {
 	// Try to fetch an existing refresh token first
 	refreshToken, err := s.repo.FindByClientUser(ctx, client.ID, user.ID)
 	if err != nil {
 		xlog.Errorf(ctx, "Unable to find token, err: %s", err.Error())
 
-		return s.GenerateNewRefreshToken(ctx, client, user)
+		return s.GenerateNewRefreshToken(ctx, client, user, scope, authTime)
 	}
 
 	// If the refresh token has expired, delete it
 	if time.Now().UTC().After(time.Unix(int64(refreshToken.ExpiresAt), 0)) {
-		xlog.Errorf(ctx, "Token %d expired, deleting", refreshToken.ID.String())
+		xlog.Errorf(ctx, "Token %s expired, deleting", refreshToken.ID.String())
+
+		if err := s.repo.DeleteToken(ctx, refreshToken.ID); err != nil {
+			xlog.Errorf(ctx, "Unable delete token %s, err: %s", refreshToken.ID.String(), err.Error())
+		}
+
+		return s.GenerateNewRefreshToken(ctx, client, user, scope, authTime)
+	}
 
+	// The token is shared by every login of the user on the client, keeping it
+	// would hand scope of this login to the others or take it away from this one
+	if refreshToken.Scope != scope {
 		if err := s.repo.DeleteToken(ctx, refreshToken.ID); err != nil {
-			xlog.Errorf(ctx, "Unable delete token %d, err: %s", refreshToken.ID.String(), err.Error())
+			xlog.Errorf(ctx, "Unable delete token %s, err: %s", refreshToken.ID.String(), err.Error())
 		}
 
-		return s.GenerateNewRefreshToken(ctx, client, user)
+		return s.GenerateNewRefreshToken(ctx, client, user, scope, authTime)
 	}
 
 	// All other cases, we just return token
@@ -159,9 +783,9 @@ func (s *authService) GetOrCreateRefreshToken(ctx context.Context, client *model
 }
 
 // GenerateNewRefreshToken generates new token
-func (s *authService) GenerateNewRefreshToken(ctx context.Context, client *models.AuthClient, user *models.User) (*models.Token, error) {
+func (s *authService) GenerateNewRefreshToken(ctx context.Context, client *models.AuthClient, user *models.User, scope string, authTime int64) (*models.Token, error) {
 	// We assume token already expired
-	refreshToken, err := s.repo.CreateToken(ctx, models.NewRefreshToken(client, user, s.RefreshTokenLifetime))
+	refreshToken, err := s.repo.CreateToken(ctx, models.NewRefreshToken(client, user, scope, authTime, s.RefreshTokenLifetime))
 	if err != nil {
 		xlog.Errorf(ctx, "Unable to create token, err: %s", err.Error())
 
@@ -194,8 +818,22 @@ func (s *authService) RefreshTokenGrant(ctx context.Context, r *models.AuthReque
 		return nil, err
 	}
 
-	// create a new access token
-	accessToken, err := models.NewAccessToken(client, user, s.AccessTokenLifetime, s.JWTSecretCode)
+	if err := s.checkUser(ctx, user); err != nil {
+		return nil, err
+	}
+
+	// scope granted at login bounds every refresh, the client must still have it
+	scope, err := refreshToken.GrantScope(r.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := client.GrantUserScope(scope); err != nil {
+		return nil, err
+	}
+
+	// the user signed in when the refresh token was issued, not now
+	accessToken, err := models.NewAccessToken(client, user, scope, refreshToken.AuthTime, s.AccessTokenLifetime, s.keys)
 	if err != nil {
 		xlog.Errorf(ctx, "Unable to create access token, err: %s", err.Error())
 
@@ -203,7 +841,25 @@ func (s *authService) RefreshTokenGrant(ctx context.Context, r *models.AuthReque
 	}
 
 	// create response
-	return models.NewTokenResponse(accessToken, refreshToken, s.AccessTokenLifetime, "Bearer")
+	return s.userTokenResponse(accessToken, refreshToken, scope, "")
+}
+
+// checkUser rejects users locked or deactivated since they signed in, so
+// codes and refresh tokens issued before don't outlive the account
+func (s *authService) checkUser(ctx context.Context, user *models.User) error {
+	if user.Locked {
+		xlog.Infof(ctx, "User %s is locked", user.ID)
+
+		return models.ErrUserIsLocked
+	}
+
+	if !user.IsActive {
+		xlog.Infof(ctx, "User %s is inactive", user.ID)
+
+		return models.ErrUserIsInactive
+	}
+
+	return nil
 }
 
 // GetValidRefreshToken returns a valid non expired refresh token
@@ -225,3 +881,24 @@ func (s *authService) GetValidRefreshToken(ctx context.Context, token string, cl
 
 	return refreshToken, nil
 }
+
+// UserInfo returns claims of the user released by scope of the access token
+func (s *authService) UserInfo(ctx context.Context, userID uuid.UUID, scope string) (*models.UserInfo, error) {
+	if !models.HasScope(scope, models.ScopeOpenID) {
+		return nil, models.ErrInsufficientScope
+	}
+
+	user, err := s.repo.FindUserByID(ctx, userID)
+	if err != nil {
+		xlog.Errorf(ctx, "User not found, err: %s", err.Error())
+
+		return nil, err
+	}
+
+	return models.NewUserInfo(user, scope), nil
+}
+
+// Discovery ...
+func (s *authService) Discovery() *models.OpenIDConfiguration {
+	return models.NewOpenIDConfiguration(s.Issuer, s.authorizationURL, s.keys.Algorithm())
+}
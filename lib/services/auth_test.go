@@ -1,10 +1,12 @@
 package services_test
 
 import (
-	"os"
+	"context"
+	"net/url"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 
@@ -14,46 +16,72 @@ import (
 	"github.com/stiks/gobs/pkg/helpers"
 )
 
-func _authSrv() services.AuthService {
-	os.Setenv("AUTH_SECRET_KEY", "123")
-	os.Setenv("AUTH_ACCESS_TOKEN_LIFETIME", "123")
-	os.Setenv("AUTH_REFRESH_TOKEN_LIFETIME", "123")
+var _authCfg = services.AuthConfig{
+	SecretKey:            "123",
+	AccessTokenLifetime:  123 * time.Second,
+	RefreshTokenLifetime: 123 * time.Second,
+}
+
+// _mustAuth panics on invalid config of test service
+func _mustAuth(srv services.AuthService, err error) services.AuthService {
+	if err != nil {
+		panic(err)
+	}
+
+	return srv
+}
 
-	return services.NewAuthService(mock.NewAuthRepository())
+func _authSrv() services.AuthService {
+	return _mustAuth(services.NewAuthService(mock.NewAuthRepository(), _authCfg))
 }
 
 func TestService_Auth_NewAuthRepository(t *testing.T) {
 	t.Run("AUTH_SECRET_KEY, not set", func(t *testing.T) {
-		os.Unsetenv("AUTH_SECRET_KEY")
-		os.Unsetenv("AUTH_ACCESS_TOKEN_LIFETIME")
-		os.Unsetenv("AUTH_REFRESH_TOKEN_LIFETIME")
-
-		os.Setenv("AUTH_ACCESS_TOKEN_LIFETIME", "123")
-		os.Setenv("AUTH_REFRESH_TOKEN_LIFETIME", "123")
+		cfg := _authCfg
+		cfg.SecretKey = ""
 
-		assert.Panics(t, func() { services.NewAuthService(mock.NewAuthRepository()) })
+		_, err := services.NewAuthService(mock.NewAuthRepository(), cfg)
+		assert.Error(t, err)
 	})
 
 	t.Run("AUTH_ACCESS_TOKEN_LIFETIME", func(t *testing.T) {
-		os.Unsetenv("AUTH_SECRET_KEY")
-		os.Unsetenv("AUTH_ACCESS_TOKEN_LIFETIME")
-		os.Unsetenv("AUTH_REFRESH_TOKEN_LIFETIME")
-
-		os.Setenv("AUTH_SECRET_KEY", "123")
-		os.Setenv("AUTH_REFRESH_TOKEN_LIFETIME", "123")
+		cfg := _authCfg
+		cfg.AccessTokenLifetime = 0
 
-		assert.Panics(t, func() { services.NewAuthService(mock.NewAuthRepository()) })
+		_, err := services.NewAuthService(mock.NewAuthRepository(), cfg)
+		assert.Error(t, err)
 	})
 
 	t.Run("AUTH_REFRESH_TOKEN_LIFETIME", func(t *testing.T) {
-		os.Unsetenv("AUTH_SECRET_KEY")
-		os.Unsetenv("AUTH_ACCESS_TOKEN_LIFETIME")
-		os.Unsetenv("AUTH_REFRESH_TOKEN_LIFETIME")
+		cfg := _authCfg
+		cfg.RefreshTokenLifetime = 500 * time.Millisecond
+
+		_, err := services.NewAuthService(mock.NewAuthRepository(), cfg)
+		assert.Error(t, err)
+	})
 
-		os.Setenv("AUTH_SECRET_KEY", "123")
-		os.Setenv("AUTH_ACCESS_TOKEN_LIFETIME", "123")
+	t.Run("AUTH_CODE_LIFETIME", func(t *testing.T) {
+		cfg := _authCfg
+		cfg.CodeLifetime = time.Hour
 
-		assert.Panics(t, func() { services.NewAuthService(mock.NewAuthRepository()) })
+		_, err := services.NewAuthService(mock.NewAuthRepository(), cfg)
+		assert.Error(t, err)
+	})
+
+	t.Run("AUTH_ISSUER", func(t *testing.T) {
+		cfg := _authCfg
+		cfg.Issuer = "id.test/?tenant=1"
+
+		_, err := services.NewAuthService(mock.NewAuthRepository(), cfg)
+		assert.Error(t, err)
+	})
+
+	t.Run("AUTH_AUTHORIZATION_ENDPOINT", func(t *testing.T) {
+		cfg := _authCfg
+		cfg.AuthorizationEndpoint = "/authorize"
+
+		_, err := services.NewAuthService(mock.NewAuthRepository(), cfg)
+		assert.Error(t, err)
 	})
 
 	t.Run("All set", func(t *testing.T) {
@@ -123,6 +151,200 @@ func TestService_Auth_GetClient(t *testing.T) {
 			assert.EqualError(t, err, "invalid client ID or secret", "error message %s", "formatted")
 		}
 	})
+
+	t.Run("Public client exchanges code", func(t *testing.T) {
+		client, err := srv.GetClient(nil, &models.AuthRequest{GrantType: "authorization_code", ClientID: "PublicSpa"})
+		if assert.NoError(t, err) {
+			assert.True(t, client.IsPublic())
+		}
+	})
+
+	t.Run("Public client can't use other grants", func(t *testing.T) {
+		_, err := srv.GetClient(nil, &models.AuthRequest{GrantType: "password", ClientID: "PublicSpa", ClientSecret: "guess"})
+		assert.Equal(t, models.ErrInvalidClientOrSecret, err)
+	})
+
+	t.Run("Confidential client needs secret for code", func(t *testing.T) {
+		_, err := srv.GetClient(nil, &models.AuthRequest{GrantType: "authorization_code", ClientID: "SecRetAuthKey"})
+		assert.Equal(t, models.ErrInvalidClientOrSecret, err)
+	})
+}
+
+// _authorizeRequest for PublicSpa, verifier and challenge from RFC 7636
+func _authorizeRequest() *models.AuthorizeRequest {
+	return &models.AuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            "PublicSpa",
+		RedirectURI:         "https://spa.test/callback",
+		Scope:               "users:read",
+		State:               "xyz",
+		CodeChallenge:       "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+		CodeChallengeMethod: "S256",
+	}
+}
+
+// _code returns authorization code from redirect of authorize response
+func _code(t *testing.T, resp *models.AuthorizeResponse) string {
+	u, err := url.Parse(resp.RedirectTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return u.Query().Get("code")
+}
+
+func TestService_Auth_Authorize(t *testing.T) {
+	srv := _authSrv()
+	userID := helpers.UUIDFromString(nil, "775a5b37-1742-4e54-9439-0357e768b011")
+
+	t.Run("Consent required", func(t *testing.T) {
+		resp, err := srv.Authorize(nil, _authorizeRequest(), userID)
+		if assert.NoError(t, err) {
+			assert.True(t, resp.ConsentRequired)
+			assert.Equal(t, "users:read", resp.Scope)
+			assert.Empty(t, resp.RedirectTo)
+		}
+	})
+
+	t.Run("Denied", func(t *testing.T) {
+		resp, err := srv.Consent(nil, _authorizeRequest(), userID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "https://spa.test/callback?error=access_denied&state=xyz", resp.RedirectTo)
+		}
+	})
+
+	t.Run("Approved", func(t *testing.T) {
+		req := _authorizeRequest()
+		req.Approve = true
+
+		resp, err := srv.Consent(nil, req, userID)
+		if assert.NoError(t, err) {
+			assert.Contains(t, resp.RedirectTo, "https://spa.test/callback?code=")
+			assert.Contains(t, resp.RedirectTo, "state=xyz")
+			assert.Len(t, _code(t, resp), 48)
+		}
+
+		// consent is remembered
+		resp, err = srv.Authorize(nil, _authorizeRequest(), userID)
+		if assert.NoError(t, err) {
+			assert.False(t, resp.ConsentRequired)
+			assert.Len(t, _code(t, resp), 48)
+		}
+	})
+
+	t.Run("Unregistered redirect URI", func(t *testing.T) {
+		req := _authorizeRequest()
+		req.RedirectURI = "https://evil.test/callback"
+
+		_, err := srv.Authorize(nil, req, userID)
+		assert.Equal(t, models.ErrInvalidRedirectURI, err)
+	})
+
+	t.Run("Scope exceeds client", func(t *testing.T) {
+		req := _authorizeRequest()
+		req.Scope = "clients:read"
+
+		_, err := srv.Authorize(nil, req, userID)
+		assert.Equal(t, models.ErrInvalidScope, err)
+	})
+
+	t.Run("Unknown client", func(t *testing.T) {
+		req := _authorizeRequest()
+		req.ClientID = "Nonexisting"
+
+		_, err := srv.Authorize(nil, req, userID)
+		assert.Equal(t, models.ErrAuthClientNotFound, err)
+	})
+}
+
+func TestService_Auth_AuthorizationCodeGrant(t *testing.T) {
+	srv := _authSrv()
+	userID := helpers.UUIDFromString(nil, "775a5b37-1742-4e54-9439-0357e768b011")
+
+	issue := func() string {
+		req := _authorizeRequest()
+		req.Approve = true
+
+		resp, err := srv.Consent(nil, req, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return _code(t, resp)
+	}
+
+	client, err := srv.GetClient(nil, &models.AuthRequest{GrantType: "authorization_code", ClientID: "PublicSpa"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	exchange := func(code, redirectURI, verifier string) (*models.TokenResponse, error) {
+		return srv.AuthorizationCodeGrant(nil, &models.AuthRequest{
+			GrantType:    "authorization_code",
+			ClientID:     "PublicSpa",
+			Code:         code,
+			RedirectURI:  redirectURI,
+			CodeVerifier: verifier,
+		}, client)
+	}
+
+	t.Run("All good, code is single-use", func(t *testing.T) {
+		code := issue()
+
+		token, err := exchange(code, "https://spa.test/callback", "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+		if assert.NoError(t, err) {
+			assert.Equal(t, userID, *token.UserID)
+			assert.NotEmpty(t, token.AccessToken)
+			assert.NotEmpty(t, token.RefreshToken)
+			assert.Equal(t, "users:read", token.Scope)
+		}
+
+		_, err = exchange(code, "https://spa.test/callback", "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+		assert.Equal(t, models.ErrAuthorizationCodeNotFound, err)
+	})
+
+	t.Run("Wrong verifier burns the code", func(t *testing.T) {
+		code := issue()
+
+		_, err := exchange(code, "https://spa.test/callback", "wrong-verifier")
+		assert.Equal(t, models.ErrInvalidCodeVerifier, err)
+
+		_, err = exchange(code, "https://spa.test/callback", "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+		assert.Equal(t, models.ErrAuthorizationCodeNotFound, err)
+	})
+
+	t.Run("Redirect URI must match", func(t *testing.T) {
+		_, err := exchange(issue(), "http://localhost:3000/callback", "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+		assert.Equal(t, models.ErrInvalidRedirectURI, err)
+	})
+
+	t.Run("Code of another client", func(t *testing.T) {
+		_, err := srv.AuthorizationCodeGrant(nil, &models.AuthRequest{
+			GrantType:    "authorization_code",
+			Code:         issue(),
+			RedirectURI:  "https://spa.test/callback",
+			CodeVerifier: "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk",
+		}, &models.AuthClient{ID: uuid.New()})
+		assert.Equal(t, models.ErrAuthorizationCodeNotFound, err)
+	})
+
+	t.Run("Empty code", func(t *testing.T) {
+		_, err := exchange("", "https://spa.test/callback", "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+		assert.Equal(t, models.ErrAuthorizationCodeNotFound, err)
+	})
+
+	t.Run("User deactivated after consent", func(t *testing.T) {
+		req := _authorizeRequest()
+		req.Approve = true
+
+		resp, err := srv.Consent(nil, req, helpers.UUIDFromString(nil, "3ab1ba2a-6031-4e34-aae3-dcd43a987775"))
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		_, err = exchange(_code(t, resp), "https://spa.test/callback", "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+		assert.Equal(t, models.ErrUserIsInactive, err)
+	})
 }
 
 func TestService_Auth_PasswordGrant(t *testing.T) {
@@ -190,6 +412,180 @@ func TestService_Auth_PasswordGrant(t *testing.T) {
 			assert.EqualError(t, err, "invalid username or password", "error message %s", "formatted")
 		}
 	})
+
+	t.Run("Inactive user", func(t *testing.T) {
+		auth := models.AuthRequest{
+			GrantType:    "password",
+			ClientID:     "SecRetAuthKey",
+			ClientSecret: "SecretSuper",
+			Username:     "user@test.com",
+			Password:     "testpass",
+		}
+
+		client := models.AuthClient{
+			ID:           helpers.UUIDFromString(nil, "775a5b37-1742-4e54-9439-0357e768b011"),
+			ClientID:     "SecRetAuthKey",
+			ClientSecret: "SecretSuper",
+		}
+
+		_, err := srv.PasswordGrant(nil, &auth, &client)
+		assert.Equal(t, models.ErrInvalidUsernameOrPassword, err, "same as wrong password")
+	})
+}
+
+func TestService_Auth_MFAGrant(t *testing.T) {
+	policy := services.NewPolicyService(mock.NewRoleRepository(), _cacheSrv())
+	_, _ = policy.RequireMFA(context.Background(), models.RoleSuperUser, true)
+
+	cfg := _authCfg
+	cfg.MFA = services.NewMFAService(mock.NewUserRepository(), policy, _cacheSrv(), nil, "GOBS")
+	srv := _mustAuth(services.NewAuthService(mock.NewAuthRepository(), cfg))
+
+	client := &models.AuthClient{ID: helpers.UUIDFromString(nil, "775a5b37-1742-4e54-9439-0357e768b011"), ClientID: "SecRetAuthKey", Scope: "users:read"}
+	password := &models.AuthRequest{GrantType: "password", Username: "peter@test.com", Password: "testpass", Scope: "users:read"}
+
+	t.Run("MFA disabled", func(t *testing.T) {
+		_, err := _authSrv().MFAGrant(context.Background(), &models.AuthRequest{GrantType: "mfa", MFAToken: "x"}, client)
+		assert.Equal(t, models.ErrInvalidGrantType, err)
+	})
+
+	_, err := srv.PasswordGrant(context.Background(), password, client)
+
+	challenge, ok := err.(*models.MFAChallenge)
+	if !assert.True(t, ok, "password grant is challenged") {
+		return
+	}
+
+	assert.True(t, challenge.EnrollmentRequired)
+
+	t.Run("Token of other client", func(t *testing.T) {
+		_, err := srv.EnrollMFA(context.Background(), challenge.Token, &models.AuthClient{ID: uuid.New()})
+		assert.Equal(t, models.ErrInvalidMFAToken, err)
+	})
+
+	t.Run("Access token is not MFA token", func(t *testing.T) {
+		token, _ := _authSrv().ClientCredentialsGrant(context.Background(), &models.AuthRequest{}, &models.AuthClient{ID: client.ID, ClientID: "SecRetAuthKey", Role: models.RoleClient})
+
+		_, err := srv.EnrollMFA(context.Background(), token.AccessToken, client)
+		assert.Equal(t, models.ErrInvalidMFAToken, err)
+	})
+
+	enrollment, err := srv.EnrollMFA(context.Background(), challenge.Token, client)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	resp, err := srv.MFAGrant(context.Background(), &models.AuthRequest{GrantType: "mfa", MFAToken: challenge.Token, Code: _totp(t, enrollment.Secret)}, client)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "775a5b37-1742-4e54-9439-0357e768b011", resp.UserID.String())
+		assert.Equal(t, "users:read", resp.Scope, "scope of password grant is kept")
+		assert.Len(t, resp.RecoveryCodes, models.RecoveryCodeCount)
+		assert.NotEmpty(t, resp.RefreshToken)
+	}
+}
+
+func TestService_Auth_MFAGrant_Lockout(t *testing.T) {
+	policy := services.NewPolicyService(mock.NewRoleRepository(), _cacheSrv())
+	_, _ = policy.RequireMFA(context.Background(), models.RoleSuperUser, true)
+
+	repo := mock.NewAuthRepository()
+	users := mock.NewUserRepository()
+
+	cfg := _authCfg
+	cfg.MFA = services.NewMFAService(users, policy, _cacheSrv(), nil, "GOBS")
+	cfg.Lockout = services.NewLockoutService(repo, users, services.NewQueueService(new(_eventQueue)), _cacheSrv(), _lockoutCfg)
+	srv := _mustAuth(services.NewAuthService(repo, cfg))
+
+	client := &models.AuthClient{ID: helpers.UUIDFromString(nil, "775a5b37-1742-4e54-9439-0357e768b011"), ClientID: "SecRetAuthKey", Scope: "users:read"}
+	password := &models.AuthRequest{GrantType: "password", Username: "peter@test.com", Password: "testpass", ClientIP: "10.0.0.1"}
+	key := models.UserAttemptsKey(password.Username)
+
+	_, err := srv.PasswordGrant(context.Background(), &models.AuthRequest{GrantType: "password", Username: "peter@test.com", Password: "wrong"}, client)
+	assert.Equal(t, models.ErrInvalidUsernameOrPassword, err)
+
+	// backoff of the failure above is over at once, _lockoutCfg has none
+	_, err = srv.PasswordGrant(context.Background(), password, client)
+
+	challenge, ok := err.(*models.MFAChallenge)
+	if !assert.True(t, ok, "password grant is challenged") {
+		return
+	}
+
+	a, err := repo.FindLoginAttempts(context.Background(), key)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, a.Failures, "password alone doesn't reset failures")
+	}
+
+	enrollment, err := srv.EnrollMFA(context.Background(), challenge.Token, client)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	mfa := &models.AuthRequest{GrantType: "mfa", MFAToken: challenge.Token, Code: "000000", ClientIP: "10.0.0.1"}
+
+	t.Run("Wrong code is a failure", func(t *testing.T) {
+		_, err := srv.MFAGrant(context.Background(), mfa, client)
+		assert.Equal(t, models.ErrInvalidMFACode, err)
+
+		a, err := repo.FindLoginAttempts(context.Background(), key)
+		if assert.NoError(t, err) {
+			assert.Equal(t, 2, a.Failures)
+		}
+	})
+
+	t.Run("Right code resets failures", func(t *testing.T) {
+		mfa.Code = _totp(t, enrollment.Secret)
+
+		_, err := srv.MFAGrant(context.Background(), mfa, client)
+		if assert.NoError(t, err) {
+			_, err = repo.FindLoginAttempts(context.Background(), key)
+			assert.Equal(t, models.ErrLoginAttemptsNotFound, err)
+		}
+	})
+
+	t.Run("Locked user can't try codes", func(t *testing.T) {
+		_, err := repo.SaveLoginAttempts(context.Background(), &models.LoginAttempts{Key: key, Failures: 3, LastFailure: time.Now(), LockedUntil: time.Now().Add(time.Minute)})
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		_, err = srv.MFAGrant(context.Background(), mfa, client)
+		_, ok := err.(*models.LoginThrottledError)
+		assert.True(t, ok, "got %v", err)
+	})
+}
+
+func TestService_Auth_ClientCredentialsGrant(t *testing.T) {
+	srv := _authSrv()
+
+	client := models.AuthClient{
+		ID:           helpers.UUIDFromString(nil, "775a5b37-1742-4e54-9439-0357e768b011"),
+		ClientID:     "SecRetAuthKey",
+		ClientSecret: "SecretSuper",
+		Role:         models.RoleClient,
+		Scope:        "users:read clients:read",
+	}
+
+	t.Run("All good", func(t *testing.T) {
+		token, err := srv.ClientCredentialsGrant(nil, &models.AuthRequest{GrantType: "client_credentials", Scope: "users:read"}, &client)
+		if assert.NoError(t, err) {
+			assert.Nil(t, token.UserID)
+			assert.NotEmpty(t, token.AccessToken)
+			assert.Empty(t, token.RefreshToken, "clients get no refresh token")
+			assert.Equal(t, "users:read", token.Scope)
+			assert.Equal(t, models.RoleClient, token.Authority)
+		}
+	})
+
+	t.Run("Scope exceeds client", func(t *testing.T) {
+		_, err := srv.ClientCredentialsGrant(nil, &models.AuthRequest{GrantType: "client_credentials", Scope: "users:write"}, &client)
+		assert.Equal(t, models.ErrInvalidScope, err)
+	})
+
+	t.Run("Client without role", func(t *testing.T) {
+		_, err := srv.ClientCredentialsGrant(nil, &models.AuthRequest{GrantType: "client_credentials"}, &models.AuthClient{ClientID: "RandomStuffHere"})
+		assert.Equal(t, models.ErrUnauthorizedClient, err)
+	})
 }
 
 func TestService_Auth_RefreshTokenGrant(t *testing.T) {
@@ -207,12 +603,29 @@ func TestService_Auth_RefreshTokenGrant(t *testing.T) {
 			ID:           helpers.UUIDFromString(nil, "775a5b37-1742-4e54-9439-0357e768b011"),
 			ClientID:     "SecRetAuthKey",
 			ClientSecret: "SecretSuper",
+			Scope:        "users:read users:write clients:read clients:write",
 		}
 
 		token, err := srv.RefreshTokenGrant(nil, &auth, &client)
 		if assert.NoError(t, err) {
 			assert.Equal(t, "775a5b37-1742-4e54-9439-0357e768b011", token.UserID.String())
+			assert.Equal(t, "users:read users:write clients:read clients:write", token.Scope)
+		}
+	})
+
+	t.Run("Client lost scope granted at login", func(t *testing.T) {
+		auth := models.AuthRequest{
+			GrantType:    "refresh_token",
+			RefreshToken: "sdfsdf5K9QwC6mptVSJVvAuFvA4w245HsiXxfMpOtpzASJ4Rr6E",
+		}
+
+		client := models.AuthClient{
+			ID:    helpers.UUIDFromString(nil, "775a5b37-1742-4e54-9439-0357e768b011"),
+			Scope: "users:read",
 		}
+
+		_, err := srv.RefreshTokenGrant(nil, &auth, &client)
+		assert.Equal(t, models.ErrInvalidScope, err)
 	})
 
 	t.Run("Empty refresh token", func(t *testing.T) {
@@ -273,6 +686,26 @@ func TestService_Auth_RefreshTokenGrant(t *testing.T) {
 			assert.EqualError(t, err, "refresh token expired", "error message %s", "formatted")
 		}
 	})
+
+	t.Run("User locked after login", func(t *testing.T) {
+		repo := mock.NewAuthRepository()
+		srv := _mustAuth(services.NewAuthService(repo, _authCfg))
+
+		user, err := repo.FindUserByUsername(nil, "root@test.com")
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		client := models.AuthClient{ID: helpers.UUIDFromString(nil, "775a5b37-1742-4e54-9439-0357e768b011"), Scope: "users:read"}
+
+		token, err := srv.GenerateNewRefreshToken(nil, &client, user, "users:read", time.Now().Unix())
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		_, err = srv.RefreshTokenGrant(nil, &models.AuthRequest{GrantType: "refresh_token", RefreshToken: token.Token}, &client)
+		assert.Equal(t, models.ErrUserIsLocked, err)
+	})
 }
 
 func TestService_Auth_GetValidRefreshToken(t *testing.T) {
@@ -334,7 +767,7 @@ func TestService_Auth_GenerateNewRefreshToken(t *testing.T) {
 			ClientSecret: "SecretSuper",
 		}
 
-		token, err := srv.GenerateNewRefreshToken(nil, &client, &user)
+		token, err := srv.GenerateNewRefreshToken(nil, &client, &user, "", 0)
 		if assert.NoError(t, err) {
 			assert.Equal(t, id.String(), token.UserID.String())
 		}
@@ -357,7 +790,7 @@ func TestService_Auth_GetOrCreateRefreshToken(t *testing.T) {
 			ClientSecret: "SecretSuper",
 		}
 
-		token, err := srv.GetOrCreateRefreshToken(nil, &client, &user)
+		token, err := srv.GetOrCreateRefreshToken(nil, &client, &user, "", 0)
 		if assert.NoError(t, err) {
 			assert.Equal(t, id.String(), token.UserID.String())
 		}
@@ -374,7 +807,7 @@ func TestService_Auth_GetOrCreateRefreshToken(t *testing.T) {
 			ClientSecret: "SecretSuper",
 		}
 
-		token, err := srv.GetOrCreateRefreshToken(nil, &client, &user)
+		token, err := srv.GetOrCreateRefreshToken(nil, &client, &user, "users:read users:write clients:read clients:write", 0)
 		if assert.NoError(t, err) {
 			assert.Equal(t, "775a5b37-1742-4e54-9439-0357e768b011", token.UserID.String())
 			assert.Equal(t, "775a5b37-1742-4e54-9439-0357e768b011", token.ClientID.String())
@@ -382,6 +815,27 @@ func TestService_Auth_GetOrCreateRefreshToken(t *testing.T) {
 		}
 	})
 
+	t.Run("Another scope replaces token", func(t *testing.T) {
+		srv := _authSrv()
+
+		user := models.User{
+			ID: helpers.UUIDFromString(nil, "775a5b37-1742-4e54-9439-0357e768b011"),
+		}
+
+		client := models.AuthClient{
+			ID: helpers.UUIDFromString(nil, "775a5b37-1742-4e54-9439-0357e768b011"),
+		}
+
+		token, err := srv.GetOrCreateRefreshToken(nil, &client, &user, "users:read", 0)
+		if assert.NoError(t, err) {
+			assert.NotEqual(t, "sdfsdf5K9QwC6mptVSJVvAuFvA4w245HsiXxfMpOtpzASJ4Rr6E", token.Token)
+			assert.Equal(t, "users:read", token.Scope)
+		}
+
+		_, err = srv.GetValidRefreshToken(nil, "sdfsdf5K9QwC6mptVSJVvAuFvA4w245HsiXxfMpOtpzASJ4Rr6E", &client)
+		assert.Equal(t, models.ErrRefreshTokenNotFound, err)
+	})
+
 	t.Run("Existing refresh token", func(t *testing.T) {
 		user := models.User{
 			ID:                helpers.UUIDFromString(nil, "775a5b37-1742-4e54-9439-0357e768b011"),
@@ -404,9 +858,322 @@ func TestService_Auth_GetOrCreateRefreshToken(t *testing.T) {
 			ClientSecret: "RandomKeySecret",
 		}
 
-		token, err := srv.GetOrCreateRefreshToken(nil, &client, &user)
+		token, err := srv.GetOrCreateRefreshToken(nil, &client, &user, "", 0)
 		if assert.NoError(t, err) {
 			assert.NotEqual(t, "sdfsdf5K9QwC6mptVSJVvAuFvA4w245HsiXxfMpOtpzASJ4Rr6E", token.Token)
 		}
 	})
 }
+
+func TestService_Auth_AuthenticateClient(t *testing.T) {
+	srv := _authSrv()
+
+	client, err := srv.AuthenticateClient(nil, "SecRetAuthKey", "SecretSuper")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "775a5b37-1742-4e54-9439-0357e768b011", client.ID.String())
+	}
+
+	_, err = srv.AuthenticateClient(nil, "SecRetAuthKey", "")
+	assert.Equal(t, models.ErrInvalidClientOrSecret, err)
+
+	_, err = srv.AuthenticateClient(nil, "", "")
+	assert.Equal(t, models.ErrEmptyClientOrSecret, err)
+
+	_, err = srv.AuthenticateClient(nil, "PublicSpa", "")
+	assert.NoError(t, err, "public client has no secret")
+}
+
+func TestService_Auth_RevokeToken(t *testing.T) {
+	client := &models.AuthClient{
+		ID:       helpers.UUIDFromString(nil, "775a5b37-1742-4e54-9439-0357e768b011"),
+		ClientID: "SecRetAuthKey",
+	}
+
+	login := func(srv services.AuthService) *models.TokenResponse {
+		resp, err := srv.PasswordGrant(nil, &models.AuthRequest{Username: "peter@test.com", Password: "testpass"}, client)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return resp
+	}
+
+	t.Run("Refresh token", func(t *testing.T) {
+		srv := _authSrv()
+		resp := login(srv)
+
+		assert.NoError(t, srv.RevokeToken(nil, &models.TokenRequest{Token: resp.RefreshToken}, client))
+
+		_, err := srv.GetValidRefreshToken(nil, resp.RefreshToken, client)
+		assert.Equal(t, models.ErrRefreshTokenNotFound, err)
+	})
+
+	t.Run("Access token", func(t *testing.T) {
+		srv := _authSrv()
+		resp := login(srv)
+
+		claims, err := models.ParseAccessToken(resp.AccessToken, models.HMACKeys(_authCfg.SecretKey))
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		revoked, _ := srv.Revoked(nil, claims.ID.String())
+		assert.False(t, revoked)
+
+		assert.NoError(t, srv.RevokeToken(nil, &models.TokenRequest{Token: resp.AccessToken, TokenTypeHint: "access_token"}, client))
+
+		revoked, err = srv.Revoked(nil, claims.ID.String())
+		if assert.NoError(t, err) {
+			assert.True(t, revoked)
+		}
+	})
+
+	t.Run("Token of another client", func(t *testing.T) {
+		srv := _authSrv()
+		resp := login(srv)
+
+		other := &models.AuthClient{ID: helpers.UUIDFromString(nil, "ceae6905-866d-42ad-90c5-5f06cd4b242f"), ClientID: "RandomStuffHere"}
+
+		assert.Equal(t, models.ErrUnauthorizedClient, srv.RevokeToken(nil, &models.TokenRequest{Token: resp.AccessToken}, other))
+
+		// refresh tokens are looked up among tokens of the client only
+		assert.NoError(t, srv.RevokeToken(nil, &models.TokenRequest{Token: resp.RefreshToken}, other))
+
+		_, err := srv.GetValidRefreshToken(nil, resp.RefreshToken, client)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Unknown token", func(t *testing.T) {
+		assert.NoError(t, _authSrv().RevokeToken(nil, &models.TokenRequest{Token: "unknown"}, client))
+	})
+}
+
+func TestService_Auth_IntrospectToken(t *testing.T) {
+	srv := _authSrv()
+
+	client := &models.AuthClient{
+		ID:           helpers.UUIDFromString(nil, "775a5b37-1742-4e54-9439-0357e768b011"),
+		ClientID:     "SecRetAuthKey",
+		ClientSecret: "SecretSuper",
+	}
+
+	resp, err := srv.PasswordGrant(nil, &models.AuthRequest{Username: "peter@test.com", Password: "testpass"}, client)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	t.Run("Access token", func(t *testing.T) {
+		info, err := srv.IntrospectToken(nil, &models.TokenRequest{Token: resp.AccessToken}, client)
+		if assert.NoError(t, err) {
+			assert.True(t, info.Active)
+			assert.Equal(t, "Bearer", info.TokenType)
+			assert.Equal(t, "SecRetAuthKey", info.ClientID)
+			assert.Equal(t, "775a5b37-1742-4e54-9439-0357e768b011", info.Subject)
+			assert.Equal(t, "peter@test.com", info.Username)
+			assert.NotEmpty(t, info.ID)
+		}
+	})
+
+	t.Run("Refresh token", func(t *testing.T) {
+		info, err := srv.IntrospectToken(nil, &models.TokenRequest{Token: resp.RefreshToken, TokenTypeHint: "refresh_token"}, client)
+		if assert.NoError(t, err) {
+			assert.True(t, info.Active)
+			assert.Equal(t, "refresh_token", info.TokenType)
+			assert.Equal(t, "peter@test.com", info.Username)
+		}
+	})
+
+	t.Run("Revoked access token", func(t *testing.T) {
+		assert.NoError(t, srv.RevokeToken(nil, &models.TokenRequest{Token: resp.AccessToken}, client))
+
+		info, err := srv.IntrospectToken(nil, &models.TokenRequest{Token: resp.AccessToken}, client)
+		if assert.NoError(t, err) {
+			assert.Equal(t, &models.IntrospectionResponse{Active: false}, info)
+		}
+	})
+
+	t.Run("Unknown token", func(t *testing.T) {
+		info, err := srv.IntrospectToken(nil, &models.TokenRequest{Token: "unknown"}, client)
+		if assert.NoError(t, err) {
+			assert.False(t, info.Active)
+		}
+	})
+
+	t.Run("Public client", func(t *testing.T) {
+		_, err := srv.IntrospectToken(nil, &models.TokenRequest{Token: resp.AccessToken}, &models.AuthClient{ClientID: "PublicSpa"})
+		assert.Equal(t, models.ErrUnauthorizedClient, err)
+	})
+}
+
+// _idClaims verifies ID token signed by test config and returns its claims
+func _idClaims(t *testing.T, token string) jwt.MapClaims {
+	parsed, err := jwt.Parse(token, models.HMACKeys(_authCfg.SecretKey).Keyfunc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return parsed.Claims.(jwt.MapClaims)
+}
+
+func TestService_Auth_OpenIDConnect(t *testing.T) {
+	srv := _authSrv()
+	userID := helpers.UUIDFromString(nil, "775a5b37-1742-4e54-9439-0357e768b011")
+
+	client := &models.AuthClient{
+		ID:           userID,
+		ClientID:     "SecRetAuthKey",
+		ClientSecret: "SecretSuper",
+		Scope:        "users:read clients:read",
+	}
+
+	password := func(scope string) (*models.TokenResponse, error) {
+		return srv.PasswordGrant(nil, &models.AuthRequest{
+			GrantType: "password",
+			Username:  "peter@test.com",
+			Password:  "testpass",
+			Scope:     scope,
+		}, client)
+	}
+
+	t.Run("Password grant", func(t *testing.T) {
+		token, err := password("openid profile email")
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.Equal(t, "openid profile email", token.Scope)
+
+		claims := _idClaims(t, token.IDToken)
+		assert.Equal(t, "http://localhost:8080", claims["iss"])
+		assert.Equal(t, "SecRetAuthKey", claims["aud"])
+		assert.Equal(t, userID.String(), claims["sub"])
+		assert.Equal(t, "Apple", claims["given_name"])
+		assert.Equal(t, true, claims["email_verified"])
+		assert.InDelta(t, time.Now().Unix(), claims["auth_time"], 5, "user has just signed in")
+	})
+
+	t.Run("No openid scope", func(t *testing.T) {
+		token, err := password("")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "users:read clients:read", token.Scope)
+			assert.Empty(t, token.IDToken)
+		}
+	})
+
+	t.Run("Scope exceeds client scope", func(t *testing.T) {
+		_, err := password("openid users:write")
+		assert.Equal(t, models.ErrInvalidScope, err)
+	})
+
+	t.Run("Refresh token grant", func(t *testing.T) {
+		login, err := password("openid email")
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		refresh := func(scope string) (*models.TokenResponse, error) {
+			return srv.RefreshTokenGrant(nil, &models.AuthRequest{
+				GrantType:    "refresh_token",
+				RefreshToken: login.RefreshToken,
+				Scope:        scope,
+			}, client)
+		}
+
+		token, err := refresh("openid")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "openid", token.Scope)
+			assert.NotContains(t, _idClaims(t, token.IDToken), "email")
+		}
+
+		token, err = refresh("")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "openid email", token.Scope, "scope of login by default")
+		}
+
+		_, err = refresh("openid email users:read")
+		assert.Equal(t, models.ErrInvalidScope, err, "client scope not granted at login")
+	})
+
+	t.Run("Refresh keeps auth time", func(t *testing.T) {
+		user := &models.User{ID: userID}
+
+		refreshToken, err := srv.GenerateNewRefreshToken(nil, client, user, "openid", 1600000000)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		token, err := srv.RefreshTokenGrant(nil, &models.AuthRequest{GrantType: "refresh_token", RefreshToken: refreshToken.Token}, client)
+		if assert.NoError(t, err) {
+			assert.Equal(t, float64(1600000000), _idClaims(t, token.IDToken)["auth_time"], "time of sign in, not of refresh")
+		}
+	})
+
+	t.Run("Authorization code grant echoes nonce", func(t *testing.T) {
+		req := _authorizeRequest()
+		req.Scope = "openid email"
+		req.Nonce = "n-0S6_WzA2Mj"
+		req.Approve = true
+		req.AuthTime = 1600000000
+
+		resp, err := srv.Consent(nil, req, userID)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		spa, _ := srv.GetClient(nil, &models.AuthRequest{GrantType: "authorization_code", ClientID: "PublicSpa"})
+
+		token, err := srv.AuthorizationCodeGrant(nil, &models.AuthRequest{
+			GrantType:    "authorization_code",
+			ClientID:     "PublicSpa",
+			Code:         _code(t, resp),
+			RedirectURI:  req.RedirectURI,
+			CodeVerifier: "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk",
+		}, spa)
+		if assert.NoError(t, err) {
+			claims := _idClaims(t, token.IDToken)
+			assert.Equal(t, "PublicSpa", claims["aud"])
+			assert.Equal(t, "n-0S6_WzA2Mj", claims["nonce"])
+			assert.Equal(t, "peter@test.com", claims["email"])
+			assert.Equal(t, float64(1600000000), claims["auth_time"], "sign in before authorization request")
+		}
+	})
+}
+
+func TestService_Auth_UserInfo(t *testing.T) {
+	srv := _authSrv()
+	userID := helpers.UUIDFromString(nil, "775a5b37-1742-4e54-9439-0357e768b011")
+
+	t.Run("All good", func(t *testing.T) {
+		info, err := srv.UserInfo(nil, userID, "openid email")
+		if assert.NoError(t, err) {
+			assert.Equal(t, userID.String(), info.Subject)
+			assert.Equal(t, "peter@test.com", info.Email)
+			assert.Empty(t, info.Name)
+		}
+	})
+
+	t.Run("Insufficient scope", func(t *testing.T) {
+		_, err := srv.UserInfo(nil, userID, "users:read email")
+		assert.Equal(t, models.ErrInsufficientScope, err)
+	})
+
+	t.Run("Unknown user", func(t *testing.T) {
+		_, err := srv.UserInfo(nil, uuid.New(), "openid")
+		assert.Equal(t, models.ErrUserNotFound, err)
+	})
+}
+
+func TestService_Auth_Discovery(t *testing.T) {
+	cfg := _authCfg
+	cfg.Issuer = "https://id.test/"
+
+	discovery := _mustAuth(services.NewAuthService(mock.NewAuthRepository(), cfg)).Discovery()
+	assert.Equal(t, "https://id.test", discovery.Issuer)
+	assert.Empty(t, discovery.AuthorizationEndpoint, "no sign-in page configured")
+	assert.Equal(t, "https://id.test/api/auth/userinfo", discovery.UserInfoEndpoint)
+	assert.Equal(t, []string{models.AlgorithmHS256}, discovery.IDTokenSigningAlgValuesSupported)
+
+	cfg.AuthorizationEndpoint = "https://app.test/authorize"
+	discovery = _mustAuth(services.NewAuthService(mock.NewAuthRepository(), cfg)).Discovery()
+	assert.Equal(t, "https://app.test/authorize", discovery.AuthorizationEndpoint)
+}
@@ -1,28 +1,83 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
 
+	"github.com/stiks/gobs/lib/models"
 	"github.com/stiks/gobs/lib/repositories"
+	"github.com/stiks/gobs/pkg/xlog"
 )
 
+// CacheConfig of entries loaded by GetOrLoad, durations accept "1h" or seconds
+type CacheConfig struct {
+	// TTL of loaded entries when caller passes 0
+	TTL time.Duration `env:"CACHE_TTL" default:"1h"`
+	// Jitter shortens expiry of every entry by random part up to this fraction
+	// of its ttl, so entries loaded together don't expire together
+	Jitter float64 `env:"CACHE_TTL_JITTER" default:"0.1"`
+	// NegativeTTL keeps not found results of loaders, 0 turns it off
+	NegativeTTL time.Duration `env:"CACHE_NEGATIVE_TTL" default:"30s"`
+}
+
+// Validate ...
+func (c *CacheConfig) Validate() error {
+	if c.TTL < 0 || c.NegativeTTL < 0 {
+		return errors.New("CACHE_TTL and CACHE_NEGATIVE_TTL can't be negative")
+	}
+
+	if c.Jitter < 0 || c.Jitter >= 1 {
+		return errors.New("CACHE_TTL_JITTER must be at least 0 and below 1")
+	}
+
+	return nil
+}
+
+// negativeErrors are results of loaders cached for CacheConfig.NegativeTTL
+var negativeErrors = []error{models.ErrUserNotFound}
+
+// CacheLoader returns value to cache on miss together with tags to store it
+// with, see CacheService.CreateTagged
+type CacheLoader func(ctx context.Context) (value interface{}, tags []string, err error)
+
 type cacheService struct {
 	repo repositories.CacheRepository
+	cfg  CacheConfig
+
+	loads flight
 }
 
-// CacheService ...
+// CacheService shares entries by all tenants, so invalidation from any context
+// drops them. Keys name entities by their ID or other unique field, callers
+// check tenant of the loaded value.
 type CacheService interface {
 	GetByKey(ctx context.Context, key string, obj interface{}) error
 	Create(ctx context.Context, key string, data interface{}) error
 	Update(ctx context.Context, key string, data interface{}) error
 	Delete(ctx context.Context, key string) error
 	Flush(ctx context.Context) error
+
+	// CreateTagged stores entry dropped by InvalidateTags of any of its tags
+	CreateTagged(ctx context.Context, key string, data interface{}, tags ...string) error
+	// InvalidateTags drops every entry stored with any of tags
+	InvalidateTags(ctx context.Context, tags ...string) error
+
+	// GetOrLoad decodes cached entry into dest, on miss it calls loader once
+	// for all concurrent callers and caches the result for ttl
+	GetOrLoad(ctx context.Context, key string, ttl time.Duration, dest interface{}, loader CacheLoader) error
 }
 
 // NewCacheService ...
-func NewCacheService(repo repositories.CacheRepository) CacheService {
+func NewCacheService(repo repositories.CacheRepository, cfg CacheConfig) CacheService {
 	return &cacheService{
 		repo: repo,
+		cfg:  cfg,
 	}
 }
 
@@ -45,3 +100,225 @@ func (s *cacheService) Delete(ctx context.Context, key string) error {
 func (s *cacheService) Flush(ctx context.Context) error {
 	return s.repo.Flush(ctx)
 }
+
+// CreateTagged adds key to index kept under every tag. Indexes are updated
+// without locking, so writers racing on one tag may lose a key, callers
+// knowing their keys should delete them as well.
+func (s *cacheService) CreateTagged(ctx context.Context, key string, data interface{}, tags ...string) error {
+	return s.store(ctx, key, data, 0, tags, false)
+}
+
+func (s *cacheService) InvalidateTags(ctx context.Context, tags ...string) error {
+	for _, tag := range tags {
+		for _, key := range s.tagged(ctx, tag) {
+			if err := s.Delete(ctx, key); err != nil {
+				return err
+			}
+		}
+
+		if err := s.repo.Delete(ctx, tagKey(tag)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadedEntry is stored by GetOrLoad, encoded value or error of loader
+type loadedEntry struct {
+	Value []byte
+	Err   string
+}
+
+// result decodes value into dest, so every caller gets a copy of its own
+func (e *loadedEntry) result(dest interface{}) error {
+	if e.Err != "" {
+		for _, err := range negativeErrors {
+			if err.Error() == e.Err {
+				return err
+			}
+		}
+
+		return errors.New(e.Err)
+	}
+
+	return gob.NewDecoder(bytes.NewReader(e.Value)).Decode(dest)
+}
+
+// GetOrLoad caches loaded values with expiry shortened by CacheConfig.Jitter,
+// ttl 0 uses CacheConfig.TTL. Entries unreadable as written by GetOrLoad,
+// e.g. stored by older release, are loaded again.
+func (s *cacheService) GetOrLoad(ctx context.Context, key string, ttl time.Duration, dest interface{}, loader CacheLoader) error {
+	entry := new(loadedEntry)
+
+	err := s.GetByKey(ctx, key, entry)
+	if err == nil {
+		return entry.result(dest)
+	}
+
+	if err != models.ErrMissCache {
+		xlog.Errorf(ctx, "Unable to read cache %s, err: %s", key, err.Error())
+	}
+
+	if ttl == 0 {
+		ttl = s.cfg.TTL
+	}
+
+	// waiters share entry of the first caller, which loads it with own ctx
+	entry, err = s.loads.do(key, func() (*loadedEntry, error) {
+		return s.load(ctx, key, ttl, loader)
+	})
+	if err != nil {
+		return err
+	}
+
+	return entry.result(dest)
+}
+
+// load calls loader and caches its value, or error when it is negative one
+func (s *cacheService) load(ctx context.Context, key string, ttl time.Duration, loader CacheLoader) (*loadedEntry, error) {
+	value, tags, err := loader(ctx)
+	if err != nil {
+		if s.cfg.NegativeTTL > 0 && negative(err) {
+			if err := s.store(ctx, key, &loadedEntry{Err: err.Error()}, s.cfg.NegativeTTL, nil, true); err != nil {
+				xlog.Errorf(ctx, "Unable to cache %s, err: %s", key, err.Error())
+			}
+		}
+
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
+		return nil, fmt.Errorf("%w: %s", models.ErrCache, err.Error())
+	}
+
+	entry := &loadedEntry{Value: buf.Bytes()}
+
+	if err := s.store(ctx, key, entry, s.jitter(ttl), tags, true); err != nil {
+		xlog.Errorf(ctx, "Unable to cache %s, err: %s", key, err.Error())
+	}
+
+	return entry, nil
+}
+
+// store writes entry, with ttl when repository is able to expire entries,
+// and adds key to index of every tag. fill tells entry loaded on miss, which
+// repositories may store without invalidating copies kept elsewhere.
+func (s *cacheService) store(ctx context.Context, key string, data interface{}, ttl time.Duration, tags []string, fill bool) error {
+	var err error
+	if repo, ok := s.repo.(repositories.FillingCacheRepository); ok && fill {
+		err = repo.Fill(ctx, key, data, ttl)
+	} else if repo, ok := s.repo.(repositories.ExpiringCacheRepository); ok && ttl > 0 {
+		err = repo.SetWithTTL(ctx, key, data, ttl)
+	} else {
+		err = s.Create(ctx, key, data)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		keys := s.tagged(ctx, tag)
+		if contains(keys, key) {
+			continue
+		}
+
+		// entry which can't be indexed must not outlive its tag
+		if err := s.repo.Update(ctx, tagKey(tag), append(keys, key)); err != nil {
+			_ = s.Delete(ctx, key)
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *cacheService) jitter(ttl time.Duration) time.Duration {
+	if n := int64(float64(ttl) * s.cfg.Jitter); n > 0 {
+		return ttl - time.Duration(rand.Int63n(n))
+	}
+
+	return ttl
+}
+
+// tagged returns keys stored with tag, missing index has none
+func (s *cacheService) tagged(ctx context.Context, tag string) []string {
+	var keys []string
+	if err := s.repo.FindByKey(ctx, tagKey(tag), &keys); err != nil && err != models.ErrMissCache {
+		xlog.Errorf(ctx, "Unable to read tag %s, err: %s", tag, err.Error())
+	}
+
+	return keys
+}
+
+// tagKey keeps index of tag apart from entries
+func tagKey(tag string) string {
+	return "tag_" + tag
+}
+
+func negative(err error) bool {
+	for _, e := range negativeErrors {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// flight runs one load per key at a time, callers arriving meanwhile wait
+// for its result
+type flight struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done  chan struct{}
+	entry *loadedEntry
+	err   error
+}
+
+func (f *flight) do(key string, fn func() (*loadedEntry, error)) (*loadedEntry, error) {
+	f.mu.Lock()
+	if f.calls == nil {
+		f.calls = make(map[string]*flightCall)
+	}
+
+	if c, ok := f.calls[key]; ok {
+		f.mu.Unlock()
+		<-c.done
+
+		return c.entry, c.err
+	}
+
+	// waiters of panicking load get an error, not nil entry
+	c := &flightCall{done: make(chan struct{}), err: models.ErrCache}
+	f.calls[key] = c
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		delete(f.calls, key)
+		f.mu.Unlock()
+
+		close(c.done)
+	}()
+
+	c.entry, c.err = fn()
+
+	return c.entry, c.err
+}
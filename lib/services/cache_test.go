@@ -1,16 +1,26 @@
 package services_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/providers/memory"
 	"github.com/stiks/gobs/lib/providers/mock"
+	"github.com/stiks/gobs/lib/repositories"
 	"github.com/stiks/gobs/lib/services"
+	"github.com/stiks/gobs/pkg/tenant"
 )
 
 func _cacheSrv() services.CacheService {
-	return services.NewCacheService(mock.NewCacheRepository())
+	return services.NewCacheService(mock.NewCacheRepository(), services.CacheConfig{})
 }
 
 func TestService_Cache_NewCacheService(t *testing.T) {
@@ -55,3 +65,225 @@ func TestService_Cache_Flush(t *testing.T) {
 
 	assert.NoError(t, srv.Flush(nil))
 }
+
+// keyRecorder remembers keys it was asked for
+type keyRecorder struct {
+	repositories.CacheRepository
+	keys []string
+}
+
+func (r *keyRecorder) Create(ctx context.Context, key string, data interface{}) error {
+	r.keys = append(r.keys, key)
+
+	return nil
+}
+
+// fillRecorder remembers keys filled on miss
+type fillRecorder struct {
+	repositories.ExpiringCacheRepository
+	fills []string
+}
+
+func (r *fillRecorder) Fill(ctx context.Context, key string, data interface{}, ttl time.Duration) error {
+	r.fills = append(r.fills, key)
+
+	return r.SetWithTTL(ctx, key, data, ttl)
+}
+
+func TestService_Cache_Tenant(t *testing.T) {
+	repo := &keyRecorder{CacheRepository: mock.NewCacheRepository()}
+	srv := services.NewCacheService(repo, services.CacheConfig{})
+
+	assert.NoError(t, srv.Create(tenant.NewContext(context.Background(), uuid.New()), "user_1", nil))
+	assert.NoError(t, srv.Create(context.Background(), "user_1", nil))
+
+	assert.Equal(t, []string{"user_1", "user_1"}, repo.keys, "tenants share entries")
+}
+
+func TestService_Cache_Tags(t *testing.T) {
+	srv := services.NewCacheService(memory.NewCacheRepository(memory.Options{}), services.CacheConfig{})
+	ctx := context.Background()
+
+	assert.NoError(t, srv.CreateTagged(ctx, "user_1", "by id", "user"))
+	assert.NoError(t, srv.CreateTagged(ctx, "user_peter", "by email", "user", "email"))
+	assert.NoError(t, srv.Create(ctx, "other", "untagged"))
+
+	t.Run("Invalidate", func(t *testing.T) {
+		assert.NoError(t, srv.InvalidateTags(tenant.NewContext(ctx, uuid.New()), "user", "unknown"))
+
+		assert.Equal(t, models.ErrMissCache, srv.GetByKey(ctx, "user_1", new(string)))
+		assert.Equal(t, models.ErrMissCache, srv.GetByKey(ctx, "user_peter", new(string)))
+		assert.NoError(t, srv.GetByKey(ctx, "other", new(string)), "untagged entries stay")
+	})
+
+	t.Run("Entry stored again", func(t *testing.T) {
+		assert.NoError(t, srv.CreateTagged(ctx, "user_1", "again", "user"))
+		assert.NoError(t, srv.GetByKey(ctx, "user_1", new(string)), "invalidated tag is reused")
+
+		assert.NoError(t, srv.InvalidateTags(ctx, "email"))
+		assert.NoError(t, srv.GetByKey(ctx, "user_1", new(string)), "tag was dropped with its entries")
+	})
+}
+
+func TestService_Cache_GetOrLoad(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Loads once", func(t *testing.T) {
+		srv := services.NewCacheService(memory.NewCacheRepository(memory.Options{}), services.CacheConfig{TTL: time.Hour})
+
+		loads := 0
+		loader := func(ctx context.Context) (interface{}, []string, error) {
+			loads++
+
+			return &models.User{Email: "peter@test.com", PasswordHash: []byte("hash")}, []string{"user"}, nil
+		}
+
+		for i := 0; i < 2; i++ {
+			user := new(models.User)
+			if assert.NoError(t, srv.GetOrLoad(ctx, "user_1", 0, user, loader)) {
+				assert.Equal(t, "peter@test.com", user.Email)
+				assert.Equal(t, []byte("hash"), user.PasswordHash)
+			}
+		}
+
+		assert.Equal(t, 1, loads)
+
+		assert.NoError(t, srv.InvalidateTags(ctx, "user"))
+		assert.NoError(t, srv.GetOrLoad(ctx, "user_1", 0, new(models.User), loader))
+		assert.Equal(t, 2, loads, "entry is tagged")
+	})
+
+	t.Run("Fills on miss", func(t *testing.T) {
+		repo := &fillRecorder{ExpiringCacheRepository: memory.NewCacheRepository(memory.Options{})}
+		srv := services.NewCacheService(repo, services.CacheConfig{TTL: time.Hour})
+
+		loader := func(ctx context.Context) (interface{}, []string, error) {
+			return "value", nil, nil
+		}
+
+		assert.NoError(t, srv.GetOrLoad(ctx, "user_1", 0, new(string), loader))
+		assert.NoError(t, srv.Create(ctx, "user_2", "value"))
+
+		assert.Equal(t, []string{"user_1"}, repo.fills, "only loaded entries are fills")
+	})
+
+	t.Run("Concurrent misses", func(t *testing.T) {
+		srv := services.NewCacheService(mock.NewCacheRepository(), services.CacheConfig{})
+
+		var (
+			mu      sync.Mutex
+			loads   int
+			release = make(chan struct{})
+			wg      sync.WaitGroup
+		)
+
+		loader := func(ctx context.Context) (interface{}, []string, error) {
+			mu.Lock()
+			loads++
+			mu.Unlock()
+
+			<-release
+
+			return &models.User{Email: "peter@test.com"}, nil, nil
+		}
+
+		users := make([]*models.User, 8)
+		for i := range users {
+			users[i] = new(models.User)
+			wg.Add(1)
+
+			go func(user *models.User) {
+				defer wg.Done()
+
+				assert.NoError(t, srv.GetOrLoad(ctx, "user_1", time.Hour, user, loader))
+			}(users[i])
+		}
+
+		// waiters can't be observed, give them time to join the load
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		assert.Equal(t, 1, loads)
+		for _, user := range users {
+			assert.Equal(t, "peter@test.com", user.Email)
+		}
+
+		assert.NotSame(t, users[0], users[1])
+	})
+
+	t.Run("Negative results", func(t *testing.T) {
+		srv := services.NewCacheService(memory.NewCacheRepository(memory.Options{}), services.CacheConfig{NegativeTTL: time.Minute})
+
+		loads := 0
+		loader := func(err error) services.CacheLoader {
+			return func(ctx context.Context) (interface{}, []string, error) {
+				loads++
+
+				return nil, nil, err
+			}
+		}
+
+		for i := 0; i < 2; i++ {
+			assert.Equal(t, models.ErrUserNotFound, srv.GetOrLoad(ctx, "user_missing", 0, new(models.User), loader(models.ErrUserNotFound)))
+		}
+
+		assert.Equal(t, 1, loads)
+
+		boom := errors.New("database is down")
+		for i := 0; i < 2; i++ {
+			assert.Equal(t, boom, srv.GetOrLoad(ctx, "user_broken", 0, new(models.User), loader(boom)))
+		}
+
+		assert.Equal(t, 3, loads, "other errors are not cached")
+
+		disabled := services.NewCacheService(memory.NewCacheRepository(memory.Options{}), services.CacheConfig{})
+		for i := 0; i < 2; i++ {
+			_ = disabled.GetOrLoad(ctx, "user_missing", 0, new(models.User), loader(models.ErrUserNotFound))
+		}
+
+		assert.Equal(t, 5, loads, "negative caching is off")
+	})
+
+	t.Run("Jittered expiry", func(t *testing.T) {
+		now := time.Now()
+		srv := services.NewCacheService(memory.NewCacheRepository(memory.Options{Now: func() time.Time { return now }}), services.CacheConfig{Jitter: 0.5})
+
+		loads := 0
+		load := func() {
+			for i := 0; i < 20; i++ {
+				_ = srv.GetOrLoad(ctx, fmt.Sprintf("key%d", i), time.Hour, new(string), func(ctx context.Context) (interface{}, []string, error) {
+					loads++
+
+					return "value", nil, nil
+				})
+			}
+		}
+
+		load()
+		assert.Equal(t, 20, loads)
+
+		now = now.Add(29 * time.Minute)
+		load()
+		assert.Equal(t, 20, loads, "no entry expires before half of ttl")
+
+		// expiry is spread over (30m, 1h], all 20 entries on one side of 45m
+		// is as likely as 2 in million
+		now = now.Add(16 * time.Minute)
+		load()
+		assert.True(t, loads > 20 && loads < 40, "entries expire apart, %d loads", loads)
+	})
+
+	t.Run("Entry of older release", func(t *testing.T) {
+		srv := services.NewCacheService(memory.NewCacheRepository(memory.Options{}), services.CacheConfig{})
+		assert.NoError(t, srv.Create(ctx, "user_1", &models.User{Email: "old@test.com"}))
+
+		user := new(models.User)
+		err := srv.GetOrLoad(ctx, "user_1", 0, user, func(ctx context.Context) (interface{}, []string, error) {
+			return &models.User{Email: "peter@test.com"}, nil, nil
+		})
+		if assert.NoError(t, err) {
+			assert.Equal(t, "peter@test.com", user.Email)
+		}
+	})
+}
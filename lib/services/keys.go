@@ -0,0 +1,389 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/repositories"
+	"github.com/stiks/gobs/pkg/xlog"
+)
+
+// reloadBackoff limits reloads triggered by tokens with unknown kid
+const reloadBackoff = 5 * time.Second
+
+// KeyConfig of access token signing keys
+type KeyConfig struct {
+	// Algorithm of new keys, HS256 keeps signing with AUTH_SECRET_KEY
+	Algorithm string `env:"AUTH_SIGNING_ALGORITHM" default:"RS256"`
+	// RotationPeriod after which active key is replaced
+	RotationPeriod time.Duration `env:"AUTH_KEY_ROTATION_PERIOD" default:"720h"`
+	// RetentionPeriod retired key keeps verifying tokens, must outlive access tokens
+	RetentionPeriod time.Duration `env:"AUTH_KEY_RETENTION_PERIOD" default:"24h"`
+	// ReloadInterval picks up keys rotated by other instances
+	ReloadInterval time.Duration `env:"AUTH_KEY_RELOAD_INTERVAL" default:"1m"`
+	// LegacyUntil accepts tokens without kid, signed with AUTH_SECRET_KEY
+	// before keys were introduced, until then. Set it past the last HS256
+	// token when switching algorithm, with HS256 they are always accepted.
+	LegacyUntil time.Time `env:"AUTH_LEGACY_TOKENS_UNTIL"`
+}
+
+// Validate ...
+func (c *KeyConfig) Validate() error {
+	var errs []string
+
+	switch c.Algorithm {
+	case models.AlgorithmRS256, models.AlgorithmEdDSA, models.AlgorithmHS256:
+	default:
+		errs = append(errs, "AUTH_SIGNING_ALGORITHM must be RS256, EdDSA or HS256")
+	}
+
+	if c.RotationPeriod < time.Minute {
+		errs = append(errs, "AUTH_KEY_ROTATION_PERIOD must be at least 1m")
+	}
+
+	if c.RetentionPeriod < time.Second {
+		errs = append(errs, "AUTH_KEY_RETENTION_PERIOD must be at least 1s")
+	}
+
+	if c.ReloadInterval < time.Second {
+		errs = append(errs, "AUTH_KEY_RELOAD_INTERVAL must be at least 1s")
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// KeyService signs access tokens with the active key and verifies them by
+// kid against every key which has not expired yet
+type KeyService interface {
+	models.TokenKeys
+	// JWKS publishes public keys, empty with HS256
+	JWKS() *models.JWKS
+	// Load reads keys from repository, the first key is created when none is active
+	Load(ctx context.Context) error
+	// Rotate creates new active key, retires the previous ones and prunes
+	// expired keys, replicas rotate one at a time
+	Rotate(ctx context.Context) error
+	// Run reloads and rotates keys until ctx is cancelled
+	Run(ctx context.Context) error
+}
+
+type loadedKey struct {
+	models.SigningKey
+	signer crypto.Signer
+}
+
+type keyService struct {
+	repo   repositories.KeyRepository
+	cfg    KeyConfig
+	legacy models.HMACKeys
+
+	mu       sync.RWMutex
+	keys     []loadedKey
+	loadedAt time.Time
+}
+
+// NewKeyService returns key service, tokens without kid are verified with
+// legacySecret until KeyConfig.LegacyUntil, error of invalid config is returned
+func NewKeyService(repo repositories.KeyRepository, cfg KeyConfig, legacySecret []byte) (KeyService, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &keyService{
+		repo:   repo,
+		cfg:    cfg,
+		legacy: models.HMACKeys(legacySecret),
+	}, nil
+}
+
+// signingMethod ...
+func signingMethod(algorithm string) jwt.SigningMethod {
+	switch algorithm {
+	case models.AlgorithmRS256:
+		return jwt.SigningMethodRS256
+	case models.AlgorithmEdDSA:
+		return jwt.SigningMethodEdDSA
+	}
+
+	return nil
+}
+
+// active returns the newest active key
+func (s *keyService) active() *loadedKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i := len(s.keys) - 1; i >= 0; i-- {
+		if s.keys[i].Active() {
+			return &s.keys[i]
+		}
+	}
+
+	return nil
+}
+
+// find returns key by kid
+func (s *keyService) find(kid string) *loadedKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now().UTC()
+	for i := range s.keys {
+		if s.keys[i].ID == kid && !s.keys[i].Expired(now) {
+			return &s.keys[i]
+		}
+	}
+
+	return nil
+}
+
+// Sign ...
+func (s *keyService) Sign(claims jwt.MapClaims) (string, error) {
+	if s.cfg.Algorithm == models.AlgorithmHS256 {
+		return s.legacy.Sign(claims)
+	}
+
+	key := s.active()
+	if key == nil {
+		return "", models.ErrSigningKeyNotFound
+	}
+
+	token := jwt.NewWithClaims(signingMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.signer)
+}
+
+// Algorithm ...
+func (s *keyService) Algorithm() string {
+	return s.cfg.Algorithm
+}
+
+// Keyfunc ...
+func (s *keyService) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if !s.legacyAccepted() {
+			return nil, models.ErrInvalidAccessToken
+		}
+
+		return s.legacy.Keyfunc(token)
+	}
+
+	key := s.find(kid)
+	if key == nil && s.reloadAllowed() {
+		// key may have been rotated by another instance
+		if err := s.reload(context.Background()); err != nil {
+			xlog.Errorf(context.Background(), "Unable to reload signing keys, err: %s", err.Error())
+		}
+
+		key = s.find(kid)
+	}
+
+	if key == nil {
+		return nil, models.ErrSigningKeyNotFound
+	}
+
+	if token.Method.Alg() != key.Algorithm {
+		return nil, models.ErrInvalidAccessToken
+	}
+
+	return key.signer.Public(), nil
+}
+
+// legacyAccepted reports whether tokens without kid are still verified
+func (s *keyService) legacyAccepted() bool {
+	if len(s.legacy) == 0 {
+		return false
+	}
+
+	return s.cfg.Algorithm == models.AlgorithmHS256 || time.Now().Before(s.cfg.LegacyUntil)
+}
+
+// JWKS ...
+func (s *keyService) JWKS() *models.JWKS {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	set := &models.JWKS{Keys: []models.JWK{}}
+
+	now := time.Now().UTC()
+	for _, key := range s.keys {
+		if key.Expired(now) {
+			continue
+		}
+
+		jwk, err := key.JWK()
+		if err != nil {
+			continue
+		}
+
+		set.Keys = append(set.Keys, *jwk)
+	}
+
+	return set
+}
+
+// reloadAllowed reports whether enough time passed since last reload
+func (s *keyService) reloadAllowed() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return time.Since(s.loadedAt) > reloadBackoff
+}
+
+// reload replaces loaded keys with keys from repository
+func (s *keyService) reload(ctx context.Context) error {
+	keys, err := s.repo.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	loaded := make([]loadedKey, 0, len(keys))
+	for _, key := range keys {
+		signer, err := key.Signer()
+		if err != nil {
+			xlog.Errorf(ctx, "Unable to decode signing key %s, err: %s", key.ID, err.Error())
+
+			continue
+		}
+
+		loaded = append(loaded, loadedKey{SigningKey: key, signer: signer})
+	}
+
+	s.mu.Lock()
+	s.keys = loaded
+	s.loadedAt = time.Now()
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Load ...
+func (s *keyService) Load(ctx context.Context) error {
+	if err := s.reload(ctx); err != nil {
+		return err
+	}
+
+	if s.cfg.Algorithm == models.AlgorithmHS256 {
+		return nil
+	}
+
+	if s.due() {
+		return s.rotateDue(ctx)
+	}
+
+	return nil
+}
+
+// due reports whether loaded keys need rotation, a changed algorithm is
+// applied by rotation too, old keys still verify
+func (s *keyService) due() bool {
+	key := s.active()
+
+	return key == nil || key.Algorithm != s.cfg.Algorithm || time.Since(key.CreatedAt) >= s.cfg.RotationPeriod
+}
+
+// rotateDue rotates keys unless another replica did it while we waited for the lock
+func (s *keyService) rotateDue(ctx context.Context) error {
+	return s.repo.Locked(ctx, func(ctx context.Context) error {
+		if err := s.reload(ctx); err != nil {
+			return err
+		}
+
+		if !s.due() {
+			return nil
+		}
+
+		return s.rotate(ctx)
+	})
+}
+
+// Rotate ...
+func (s *keyService) Rotate(ctx context.Context) error {
+	if s.cfg.Algorithm == models.AlgorithmHS256 {
+		return nil
+	}
+
+	return s.repo.Locked(ctx, s.rotate)
+}
+
+// rotate replaces active key, the caller holds rotation lock
+func (s *keyService) rotate(ctx context.Context) error {
+	key, err := models.NewSigningKey(s.cfg.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.repo.Create(ctx, key); err != nil {
+		return err
+	}
+
+	keys, err := s.repo.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for i := range keys {
+		k := &keys[i]
+
+		switch {
+		case k.ID == key.ID:
+		case k.Active():
+			k.RetiredAt = now
+			k.ExpiresAt = now.Add(s.cfg.RetentionPeriod)
+
+			if _, err := s.repo.Update(ctx, k); err != nil {
+				return err
+			}
+		case k.Expired(now):
+			if err := s.repo.Delete(ctx, k.ID); err != nil && err != models.ErrSigningKeyNotFound {
+				return err
+			}
+		}
+	}
+
+	xlog.Infof(ctx, "Signing key rotated, kid: %s", key.ID)
+
+	return s.reload(ctx)
+}
+
+// Run ...
+func (s *keyService) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.cfg.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		if err := s.reload(ctx); err != nil {
+			xlog.Errorf(ctx, "Unable to reload signing keys, err: %s", err.Error())
+
+			continue
+		}
+
+		if s.cfg.Algorithm == models.AlgorithmHS256 || !s.due() {
+			continue
+		}
+
+		if err := s.rotateDue(ctx); err != nil {
+			xlog.Errorf(ctx, "Unable to rotate signing key, err: %s", err.Error())
+		}
+	}
+}
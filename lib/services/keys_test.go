@@ -0,0 +1,309 @@
+package services_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/providers/mock"
+	"github.com/stiks/gobs/lib/repositories"
+	"github.com/stiks/gobs/lib/services"
+)
+
+var _keyCfg = services.KeyConfig{
+	Algorithm:       models.AlgorithmEdDSA,
+	RotationPeriod:  time.Hour,
+	RetentionPeriod: time.Hour,
+	ReloadInterval:  time.Minute,
+}
+
+// _mustKeys panics on invalid config of test service
+func _mustKeys(srv services.KeyService, err error) services.KeyService {
+	if err != nil {
+		panic(err)
+	}
+
+	return srv
+}
+
+func _keySrv(t *testing.T, repo repositories.KeyRepository, algorithm string) services.KeyService {
+	cfg := _keyCfg
+	cfg.Algorithm = algorithm
+
+	srv := _mustKeys(services.NewKeyService(repo, cfg, []byte(_authCfg.SecretKey)))
+	if err := srv.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return srv
+}
+
+// _accessToken issues token the way auth service does
+func _accessToken(t *testing.T, keys models.TokenKeys) string {
+	client := &models.AuthClient{ID: uuid.New(), ClientID: "zzZzz"}
+	user := &models.User{ID: uuid.New(), Role: models.RoleUser}
+
+	token, err := models.NewAccessToken(client, user, "", 0, 60, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token.Token
+}
+
+// _kid returns kid header of token without verifying it
+func _kid(t *testing.T, token string) string {
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kid, _ := parsed.Header["kid"].(string)
+
+	return kid
+}
+
+func TestService_Keys_NewKeyService(t *testing.T) {
+	t.Run("Unknown algorithm", func(t *testing.T) {
+		cfg := _keyCfg
+		cfg.Algorithm = "none"
+
+		_, err := services.NewKeyService(mock.NewKeyRepository(), cfg, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("Rotation period", func(t *testing.T) {
+		cfg := _keyCfg
+		cfg.RotationPeriod = time.Second
+
+		_, err := services.NewKeyService(mock.NewKeyRepository(), cfg, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("All set", func(t *testing.T) {
+		assert.Implements(t, (*services.KeyService)(nil), _mustKeys(services.NewKeyService(mock.NewKeyRepository(), _keyCfg, nil)))
+	})
+}
+
+func TestService_Keys_Load(t *testing.T) {
+	repo := mock.NewKeyRepository()
+	srv := _keySrv(t, repo, models.AlgorithmEdDSA)
+
+	keys, _ := repo.FindAll(context.Background())
+	if assert.Len(t, keys, 1, "first key is created") {
+		assert.True(t, keys[0].Active())
+	}
+
+	assert.NoError(t, srv.Load(context.Background()))
+
+	keys, _ = repo.FindAll(context.Background())
+	assert.Len(t, keys, 1, "active key is reused")
+
+	t.Run("Changed algorithm rotates", func(t *testing.T) {
+		_keySrv(t, repo, models.AlgorithmRS256)
+
+		keys, _ := repo.FindAll(context.Background())
+		if assert.Len(t, keys, 2) {
+			assert.False(t, keys[0].Active())
+			assert.Equal(t, models.AlgorithmRS256, keys[1].Algorithm)
+		}
+	})
+
+	t.Run("Replicas starting at once", func(t *testing.T) {
+		repo := mock.NewKeyRepository()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				assert.NoError(t, _mustKeys(services.NewKeyService(repo, _keyCfg, nil)).Load(context.Background()))
+			}()
+		}
+
+		wg.Wait()
+
+		keys, _ := repo.FindAll(context.Background())
+		if assert.Len(t, keys, 1, "only the first replica rotates") {
+			assert.True(t, keys[0].Active())
+		}
+	})
+}
+
+func TestService_Keys_SignAndVerify(t *testing.T) {
+	for _, algorithm := range []string{models.AlgorithmRS256, models.AlgorithmEdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			srv := _keySrv(t, mock.NewKeyRepository(), algorithm)
+			token := _accessToken(t, srv)
+
+			assert.Equal(t, srv.JWKS().Keys[0].Kid, _kid(t, token))
+
+			claims, err := models.ParseAccessToken(token, srv)
+			if assert.NoError(t, err) {
+				assert.Equal(t, models.RoleUser, claims.Role)
+			}
+		})
+	}
+
+	t.Run("Legacy HS256 token", func(t *testing.T) {
+		legacy := _accessToken(t, models.HMACKeys(_authCfg.SecretKey))
+
+		srv := _keySrv(t, mock.NewKeyRepository(), models.AlgorithmHS256)
+		_, err := models.ParseAccessToken(legacy, srv)
+		assert.NoError(t, err, "always accepted with HS256")
+
+		srv = _keySrv(t, mock.NewKeyRepository(), models.AlgorithmEdDSA)
+		_, err = models.ParseAccessToken(legacy, srv)
+		assert.Equal(t, models.ErrInvalidAccessToken, err, "no cutoff configured")
+
+		cfg := _keyCfg
+		cfg.LegacyUntil = time.Now().Add(time.Hour)
+
+		srv = _mustKeys(services.NewKeyService(mock.NewKeyRepository(), cfg, []byte(_authCfg.SecretKey)))
+		if assert.NoError(t, srv.Load(context.Background())) {
+			_, err = models.ParseAccessToken(legacy, srv)
+			assert.NoError(t, err, "before cutoff")
+		}
+
+		cfg.LegacyUntil = time.Now().Add(-time.Second)
+
+		srv = _mustKeys(services.NewKeyService(mock.NewKeyRepository(), cfg, []byte(_authCfg.SecretKey)))
+		if assert.NoError(t, srv.Load(context.Background())) {
+			_, err = models.ParseAccessToken(legacy, srv)
+			assert.Equal(t, models.ErrInvalidAccessToken, err, "after cutoff")
+		}
+	})
+
+	t.Run("HS256 token with kid", func(t *testing.T) {
+		srv := _keySrv(t, mock.NewKeyRepository(), models.AlgorithmEdDSA)
+
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"jti": uuid.New(), "cid": uuid.New()})
+		token.Header["kid"] = srv.JWKS().Keys[0].Kid
+
+		signed, _ := token.SignedString([]byte(_authCfg.SecretKey))
+
+		_, err := models.ParseAccessToken(signed, srv)
+		assert.Equal(t, models.ErrInvalidAccessToken, err, "algorithm has to match the key")
+	})
+
+	t.Run("Unknown kid", func(t *testing.T) {
+		srv := _keySrv(t, mock.NewKeyRepository(), models.AlgorithmEdDSA)
+		other := _keySrv(t, mock.NewKeyRepository(), models.AlgorithmEdDSA)
+
+		_, err := models.ParseAccessToken(_accessToken(t, other), srv)
+		assert.Equal(t, models.ErrInvalidAccessToken, err)
+	})
+
+	t.Run("Key rotated by another instance", func(t *testing.T) {
+		repo := mock.NewKeyRepository()
+		issuer := _keySrv(t, repo, models.AlgorithmEdDSA)
+		verifier := _mustKeys(services.NewKeyService(repo, _keyCfg, nil))
+
+		_, err := models.ParseAccessToken(_accessToken(t, issuer), verifier)
+		assert.NoError(t, err, "unknown kid reloads keys")
+	})
+}
+
+func TestService_Keys_Rotate(t *testing.T) {
+	repo := mock.NewKeyRepository()
+	srv := _keySrv(t, repo, models.AlgorithmEdDSA)
+
+	before := _accessToken(t, srv)
+
+	if !assert.NoError(t, srv.Rotate(context.Background())) {
+		return
+	}
+
+	after := _accessToken(t, srv)
+	assert.NotEqual(t, _kid(t, before), _kid(t, after))
+
+	t.Run("Retired key still verifies", func(t *testing.T) {
+		_, err := models.ParseAccessToken(before, srv)
+		assert.NoError(t, err)
+
+		_, err = models.ParseAccessToken(after, srv)
+		assert.NoError(t, err)
+
+		assert.Len(t, srv.JWKS().Keys, 2)
+	})
+
+	t.Run("Expired key is pruned", func(t *testing.T) {
+		keys, _ := repo.FindAll(context.Background())
+
+		retired := keys[0]
+		retired.ExpiresAt = time.Now().UTC().Add(-time.Second)
+		_, _ = repo.Update(context.Background(), &retired)
+
+		if !assert.NoError(t, srv.Rotate(context.Background())) {
+			return
+		}
+
+		keys, _ = repo.FindAll(context.Background())
+		assert.Len(t, keys, 2)
+		assert.Len(t, srv.JWKS().Keys, 2)
+
+		_, err := models.ParseAccessToken(before, srv)
+		assert.Equal(t, models.ErrInvalidAccessToken, err)
+	})
+}
+
+func TestService_Keys_HS256(t *testing.T) {
+	repo := mock.NewKeyRepository()
+	srv := _keySrv(t, repo, models.AlgorithmHS256)
+
+	keys, _ := repo.FindAll(context.Background())
+	assert.Empty(t, keys, "no keys are created")
+	assert.Empty(t, srv.JWKS().Keys)
+
+	token := _accessToken(t, srv)
+	assert.Empty(t, _kid(t, token))
+
+	_, err := models.ParseAccessToken(token, models.HMACKeys(_authCfg.SecretKey))
+	assert.NoError(t, err)
+}
+
+func TestService_Keys_Run(t *testing.T) {
+	srv := _keySrv(t, mock.NewKeyRepository(), models.AlgorithmEdDSA)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.NoError(t, srv.Run(ctx))
+
+	t.Run("No active key", func(t *testing.T) {
+		repo := mock.NewKeyRepository()
+
+		cfg := _keyCfg
+		cfg.ReloadInterval = time.Second
+
+		srv := _mustKeys(services.NewKeyService(repo, cfg, nil))
+		if !assert.NoError(t, srv.Load(context.Background())) {
+			return
+		}
+
+		// another replica retired the key and died before creating new one
+		keys, _ := repo.FindAll(context.Background())
+		keys[0].RetiredAt = time.Now().UTC()
+		keys[0].ExpiresAt = keys[0].RetiredAt.Add(time.Hour)
+		_, _ = repo.Update(context.Background(), &keys[0])
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		go func() { _ = srv.Run(ctx) }()
+
+		assert.Eventually(t, func() bool {
+			_, err := srv.Sign(jwt.MapClaims{})
+
+			return err == nil
+		}, 3*time.Second, 50*time.Millisecond, "new key is created")
+	})
+}
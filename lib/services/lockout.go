@@ -0,0 +1,228 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/repositories"
+	"github.com/stiks/gobs/pkg/xlog"
+)
+
+// LockoutConfig of brute-force protection of password grant, durations
+// accept "15m" or seconds
+type LockoutConfig struct {
+	// MaxAttempts failures of a user before temporary lockout
+	MaxAttempts int `env:"AUTH_LOCKOUT_MAX_ATTEMPTS" default:"5"`
+	// MaxIPAttempts failures from a client IP before temporary lockout, IPs
+	// are shared by many users behind NAT
+	MaxIPAttempts int `env:"AUTH_LOCKOUT_MAX_IP_ATTEMPTS" default:"20"`
+	// Duration of temporary lockout
+	Duration time.Duration `env:"AUTH_LOCKOUT_DURATION" default:"15m"`
+	// Backoff after first failure, doubled by every next one
+	Backoff time.Duration `env:"AUTH_LOCKOUT_BACKOFF" default:"1s"`
+	// Window after which failures are forgotten
+	Window time.Duration `env:"AUTH_LOCKOUT_WINDOW" default:"1h"`
+}
+
+// Validate ...
+func (c *LockoutConfig) Validate() error {
+	var errs []string
+	if c.MaxAttempts < 1 {
+		errs = append(errs, "AUTH_LOCKOUT_MAX_ATTEMPTS must be at least 1")
+	}
+
+	if c.MaxIPAttempts < 1 {
+		errs = append(errs, "AUTH_LOCKOUT_MAX_IP_ATTEMPTS must be at least 1")
+	}
+
+	if c.Duration < time.Second {
+		errs = append(errs, "AUTH_LOCKOUT_DURATION must be at least 1s")
+	}
+
+	if c.Backoff < 0 || c.Backoff > c.Duration {
+		errs = append(errs, "AUTH_LOCKOUT_BACKOFF must be between 0 and AUTH_LOCKOUT_DURATION")
+	}
+
+	if c.Window < c.Duration {
+		errs = append(errs, "AUTH_LOCKOUT_WINDOW must be at least AUTH_LOCKOUT_DURATION")
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// LockoutService tracks failed password logins per user and client IP
+type LockoutService interface {
+	// Check returns *models.LoginThrottledError while username or client IP
+	// has to wait because of backoff or lockout
+	Check(ctx context.Context, username string, ip string) error
+	// Failed records failed login, user is nil when username is unknown,
+	// lockout of a user is queued for email
+	Failed(ctx context.Context, username string, ip string, user *models.User) error
+	// LockedUntil returns end of temporary lockout of user, zero when the
+	// user is not locked out
+	LockedUntil(ctx context.Context, user *models.User) (time.Time, error)
+	// Succeeded forgets failures of username
+	Succeeded(ctx context.Context, username string) error
+	// Unlock lifts temporary lockout and lock set by admin, the user is
+	// notified by email
+	Unlock(ctx context.Context, id uuid.UUID) (*models.User, error)
+}
+
+type lockoutService struct {
+	repo  repositories.AuthRepository
+	users repositories.UserRepository
+	queue QueueService
+	cache CacheService
+	cfg   LockoutConfig
+}
+
+// NewLockoutService ...
+func NewLockoutService(repo repositories.AuthRepository, users repositories.UserRepository, queue QueueService, cacheSrv CacheService, cfg LockoutConfig) LockoutService {
+	return &lockoutService{
+		repo:  repo,
+		users: users,
+		queue: queue,
+		cache: cacheSrv,
+		cfg:   cfg,
+	}
+}
+
+// attempts returns failures of key, empty when there are none
+func (s *lockoutService) attempts(ctx context.Context, key string) (*models.LoginAttempts, error) {
+	a, err := s.repo.FindLoginAttempts(ctx, key)
+	if err == models.ErrLoginAttemptsNotFound {
+		return &models.LoginAttempts{Key: key}, nil
+	}
+
+	return a, err
+}
+
+// keys returns user and, when known, client IP keys with their limits
+func (s *lockoutService) keys(username string, ip string) map[string]int {
+	keys := map[string]int{models.UserAttemptsKey(username): s.cfg.MaxAttempts}
+	if ip != "" {
+		keys[models.IPAttemptsKey(ip)] = s.cfg.MaxIPAttempts
+	}
+
+	return keys
+}
+
+// Check ...
+func (s *lockoutService) Check(ctx context.Context, username string, ip string) error {
+	now := time.Now()
+
+	var wait time.Duration
+	for key := range s.keys(username, ip) {
+		a, err := s.attempts(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		if w := a.Wait(now, s.cfg.Backoff, s.cfg.Duration); w > wait {
+			wait = w
+		}
+	}
+
+	if wait > 0 {
+		return &models.LoginThrottledError{RetryAfter: wait}
+	}
+
+	return nil
+}
+
+// Failed ...
+func (s *lockoutService) Failed(ctx context.Context, username string, ip string, user *models.User) error {
+	now := time.Now()
+
+	for key, max := range s.keys(username, ip) {
+		// concurrent failures are counted by repository, so none is lost
+		a, err := s.repo.FailLoginAttempt(ctx, key, now, now.Add(-s.cfg.Window))
+		if err != nil {
+			return err
+		}
+
+		if a.Failures < max || a.Locked(now) {
+			continue
+		}
+
+		a.LockedUntil = now.Add(s.cfg.Duration)
+
+		locked, err := s.repo.LockLoginAttempts(ctx, key, now, a.LockedUntil)
+		if err != nil {
+			return err
+		}
+
+		if !locked {
+			continue
+		}
+
+		xlog.Infof(ctx, "Password login of %s locked until %s", key, a.LockedUntil.Format(time.RFC3339))
+
+		if user != nil && key == models.UserAttemptsKey(username) {
+			if err := s.queue.AddObject(ctx, "user-locked", &models.WorkerRequest{ID: user.ID}); err != nil {
+				xlog.Errorf(ctx, "Unable to send request into a 'user-locked' queue, err: %s", err.Error())
+			}
+		}
+	}
+
+	return nil
+}
+
+// LockedUntil ...
+func (s *lockoutService) LockedUntil(ctx context.Context, user *models.User) (time.Time, error) {
+	a, err := s.attempts(ctx, models.UserAttemptsKey(user.Email))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if !a.Locked(time.Now()) {
+		return time.Time{}, nil
+	}
+
+	return a.LockedUntil, nil
+}
+
+// Succeeded ...
+func (s *lockoutService) Succeeded(ctx context.Context, username string) error {
+	return s.repo.DeleteLoginAttempts(ctx, models.UserAttemptsKey(username))
+}
+
+// Unlock ...
+func (s *lockoutService) Unlock(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	user, err := s.users.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.DeleteLoginAttempts(ctx, models.UserAttemptsKey(user.Email)); err != nil {
+		return nil, err
+	}
+
+	if user.Locked {
+		user.Locked = false
+		user.UpdatedAt = time.Now()
+
+		if _, err := s.users.Update(ctx, user); err != nil {
+			xlog.Errorf(ctx, "Unable to unlock user, err: %s", err.Error())
+
+			return nil, err
+		}
+
+		invalidateUser(ctx, s.cache, user.ID, user.Email)
+	}
+
+	if err := s.queue.AddObject(ctx, "user-unlocked", &models.WorkerRequest{ID: user.ID}); err != nil {
+		xlog.Errorf(ctx, "Unable to send request into a 'user-unlocked' queue, err: %s", err.Error())
+	}
+
+	return user, nil
+}
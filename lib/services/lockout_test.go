@@ -0,0 +1,271 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/providers/mock"
+	"github.com/stiks/gobs/lib/repositories"
+	"github.com/stiks/gobs/lib/services"
+	"github.com/stiks/gobs/pkg/helpers"
+)
+
+var _lockoutCfg = services.LockoutConfig{
+	MaxAttempts:   3,
+	MaxIPAttempts: 5,
+	Duration:      15 * time.Minute,
+	Window:        time.Hour,
+}
+
+// _eventQueue records names and requests of queued objects
+type _eventQueue struct {
+	names    []string
+	requests []models.WorkerRequest
+}
+
+func (q *_eventQueue) Add(ctx context.Context, queue string, data []byte) error {
+	return nil
+}
+
+func (q *_eventQueue) AddObject(ctx context.Context, queue string, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	req := models.WorkerRequest{}
+	if err := json.Unmarshal(b, &req); err != nil {
+		return err
+	}
+
+	q.names = append(q.names, queue)
+	q.requests = append(q.requests, req)
+
+	return nil
+}
+
+func (q *_eventQueue) AddToURL(ctx context.Context, queue string, data url.Values) error {
+	return nil
+}
+
+// _lockedAuthRepository reports every user as locked by admin
+type _lockedAuthRepository struct {
+	repositories.AuthRepository
+}
+
+func (r *_lockedAuthRepository) FindUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	user, err := r.AuthRepository.FindUserByUsername(ctx, username)
+	if err == nil {
+		user.Locked = true
+	}
+
+	return user, err
+}
+
+func _lockoutSrv(cfg services.LockoutConfig) (services.LockoutService, repositories.UserRepository, *_eventQueue) {
+	queue := new(_eventQueue)
+	users := mock.NewUserRepository()
+
+	return services.NewLockoutService(mock.NewAuthRepository(), users, services.NewQueueService(queue), _cacheSrv(), cfg), users, queue
+}
+
+func _throttled(t *testing.T, err error) time.Duration {
+	throttled, ok := err.(*models.LoginThrottledError)
+	if !assert.True(t, ok, "expected throttled error, got %v", err) {
+		return 0
+	}
+
+	return throttled.RetryAfter
+}
+
+func TestService_Lockout_Config(t *testing.T) {
+	cfg := _lockoutCfg
+	assert.NoError(t, cfg.Validate())
+
+	cfg.MaxAttempts = 0
+	cfg.Backoff = time.Hour
+	cfg.Window = time.Minute
+
+	err := cfg.Validate()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "AUTH_LOCKOUT_MAX_ATTEMPTS")
+		assert.Contains(t, err.Error(), "AUTH_LOCKOUT_BACKOFF")
+		assert.Contains(t, err.Error(), "AUTH_LOCKOUT_WINDOW")
+	}
+}
+
+func TestService_Lockout_Backoff(t *testing.T) {
+	cfg := _lockoutCfg
+	cfg.Backoff = time.Minute
+	srv, _, _ := _lockoutSrv(cfg)
+
+	ctx := context.Background()
+
+	assert.NoError(t, srv.Check(ctx, "peter@test.com", "10.0.0.1"))
+	assert.NoError(t, srv.Failed(ctx, "peter@test.com", "10.0.0.1", nil))
+
+	wait := _throttled(t, srv.Check(ctx, "Peter@test.com", "10.0.0.2"))
+	assert.True(t, wait > 0 && wait <= time.Minute, "first failure waits backoff, got %s", wait)
+
+	assert.NoError(t, srv.Failed(ctx, "peter@test.com", "10.0.0.1", nil))
+
+	wait = _throttled(t, srv.Check(ctx, "peter@test.com", ""))
+	assert.True(t, wait > time.Minute && wait <= 2*time.Minute, "backoff doubles, got %s", wait)
+
+	assert.NoError(t, srv.Succeeded(ctx, "peter@test.com"))
+	assert.NoError(t, srv.Check(ctx, "peter@test.com", ""))
+}
+
+func TestService_Lockout_User(t *testing.T) {
+	srv, _, queue := _lockoutSrv(_lockoutCfg)
+
+	ctx := context.Background()
+	user := &models.User{ID: helpers.UUIDFromString(t, "775a5b37-1742-4e54-9439-0357e768b011"), Email: "peter@test.com"}
+
+	for i := 0; i < _lockoutCfg.MaxAttempts; i++ {
+		assert.NoError(t, srv.Failed(ctx, "peter@test.com", "10.0.0.1", user))
+	}
+
+	wait := _throttled(t, srv.Check(ctx, "peter@test.com", "10.0.0.9"))
+	assert.True(t, wait > time.Minute, "locked for duration, got %s", wait)
+
+	if assert.Equal(t, []string{"user-locked"}, queue.names) {
+		assert.Equal(t, user.ID, queue.requests[0].ID)
+	}
+
+	until, err := srv.LockedUntil(ctx, user)
+	if assert.NoError(t, err) {
+		assert.True(t, until.After(time.Now().Add(time.Minute)), "locked for duration, got %s", until)
+	}
+
+	t.Run("Unknown user is not emailed", func(t *testing.T) {
+		for i := 0; i < _lockoutCfg.MaxAttempts; i++ {
+			assert.NoError(t, srv.Failed(ctx, "nobody@test.com", "10.0.0.2", nil))
+		}
+
+		_throttled(t, srv.Check(ctx, "nobody@test.com", ""))
+		assert.Len(t, queue.names, 1)
+	})
+
+	t.Run("Other users are not affected", func(t *testing.T) {
+		assert.NoError(t, srv.Check(ctx, "user@test.com", "10.0.0.3"))
+	})
+}
+
+func TestService_Lockout_IP(t *testing.T) {
+	srv, _, _ := _lockoutSrv(_lockoutCfg)
+
+	ctx := context.Background()
+
+	for i := 0; i < _lockoutCfg.MaxIPAttempts; i++ {
+		assert.NoError(t, srv.Failed(ctx, fmt.Sprintf("user%d@test.com", i), "10.0.0.1", nil))
+	}
+
+	_throttled(t, srv.Check(ctx, "user@test.com", "10.0.0.1"))
+	assert.NoError(t, srv.Check(ctx, "user@test.com", "10.0.0.2"))
+}
+
+func TestService_Lockout_Unlock(t *testing.T) {
+	srv, users, queue := _lockoutSrv(_lockoutCfg)
+
+	ctx := context.Background()
+
+	root, err := users.FindByUsername(ctx, "root@test.com")
+	if !assert.NoError(t, err) || !assert.True(t, root.Locked) {
+		return
+	}
+
+	for i := 0; i < _lockoutCfg.MaxAttempts; i++ {
+		assert.NoError(t, srv.Failed(ctx, "root@test.com", "", nil))
+	}
+
+	user, err := srv.Unlock(ctx, root.ID)
+	if assert.NoError(t, err) {
+		assert.False(t, user.Locked)
+		assert.NoError(t, srv.Check(ctx, "root@test.com", ""))
+		assert.Equal(t, []string{"user-unlocked"}, queue.names)
+	}
+
+	if stored, err := users.FindByID(ctx, root.ID); assert.NoError(t, err) {
+		assert.False(t, stored.Locked)
+	}
+
+	t.Run("Non-existing user", func(t *testing.T) {
+		_, err := srv.Unlock(ctx, helpers.UUIDFromString(t, "5fcc94e5-c6aa-4320-8469-f5021af54b88"))
+		assert.EqualError(t, err, models.ErrUserNotFound.Error())
+	})
+}
+
+func TestService_Auth_PasswordGrant_Lockout(t *testing.T) {
+	client := models.AuthClient{
+		ID:           helpers.UUIDFromString(nil, "775a5b37-1742-4e54-9439-0357e768b011"),
+		ClientID:     "SecRetAuthKey",
+		ClientSecret: "SecretSuper",
+	}
+
+	auth := models.AuthRequest{
+		GrantType: "password",
+		Username:  "peter@test.com",
+		Password:  "wrong-pass",
+		ClientIP:  "10.0.0.1",
+	}
+
+	t.Run("Throttled after failures", func(t *testing.T) {
+		cfg := _authCfg
+		cfg.Lockout, _, _ = _lockoutSrv(_lockoutCfg)
+		srv := _mustAuth(services.NewAuthService(mock.NewAuthRepository(), cfg))
+
+		for i := 0; i < _lockoutCfg.MaxAttempts; i++ {
+			_, err := srv.PasswordGrant(context.Background(), &auth, &client)
+			assert.EqualError(t, err, models.ErrInvalidUsernameOrPassword.Error())
+		}
+
+		valid := auth
+		valid.Password = "testpass"
+
+		_, err := srv.PasswordGrant(context.Background(), &valid, &client)
+		_throttled(t, err)
+	})
+
+	t.Run("Success forgets failures", func(t *testing.T) {
+		cfg := _authCfg
+		cfg.Lockout, _, _ = _lockoutSrv(_lockoutCfg)
+		srv := _mustAuth(services.NewAuthService(mock.NewAuthRepository(), cfg))
+
+		failed, valid := auth, auth
+		valid.Password = "testpass"
+
+		// IP failures are kept by success, so each round comes from another IP
+		for i := 0; i < 3; i++ {
+			failed.ClientIP = fmt.Sprintf("10.0.1.%d", i)
+			valid.ClientIP = failed.ClientIP
+
+			for j := 0; j < _lockoutCfg.MaxAttempts-1; j++ {
+				_, _ = srv.PasswordGrant(context.Background(), &failed, &client)
+			}
+
+			_, err := srv.PasswordGrant(context.Background(), &valid, &client)
+			assert.NoError(t, err)
+		}
+	})
+
+	t.Run("Locked user", func(t *testing.T) {
+		srv := _mustAuth(services.NewAuthService(&_lockedAuthRepository{mock.NewAuthRepository()}, _authCfg))
+
+		valid := auth
+		valid.Password = "testpass"
+
+		_, err := srv.PasswordGrant(context.Background(), &valid, &client)
+		assert.EqualError(t, err, models.ErrUserIsLocked.Error())
+
+		_, err = srv.PasswordGrant(context.Background(), &auth, &client)
+		assert.EqualError(t, err, models.ErrInvalidUsernameOrPassword.Error(), "lock is not revealed without password")
+	})
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/repositories"
+	"github.com/stiks/gobs/pkg/xlog"
+)
+
+// MFAService manages TOTP second factor and recovery codes of users
+type MFAService interface {
+	// Required reports whether user has to pass second factor on login,
+	// either enabled by the user or enforced by the role
+	Required(ctx context.Context, user *models.User) (bool, error)
+	// Enroll stores new pending secret, MFA is enabled once it is confirmed
+	Enroll(ctx context.Context, userID uuid.UUID) (*models.MFAEnrollment, error)
+	// Confirm enables MFA with first code of pending secret and returns
+	// recovery codes
+	Confirm(ctx context.Context, userID uuid.UUID, code string) ([]string, error)
+	// Authenticate checks second factor of login, pending enrollment is
+	// confirmed by it and recovery codes of it are returned
+	Authenticate(ctx context.Context, userID uuid.UUID, code string) (*models.User, []string, error)
+	// Disable turns MFA off, not allowed when role requires it, wrong codes
+	// from ip count toward lockout
+	Disable(ctx context.Context, userID uuid.UUID, code string, ip string) error
+	// RegenerateRecoveryCodes replaces recovery codes, old ones stop working,
+	// wrong codes from ip count toward lockout
+	RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string, ip string) ([]string, error)
+}
+
+type mfaService struct {
+	repo    repositories.UserRepository
+	policy  PolicyService
+	cache   CacheService
+	lockout LockoutService
+	issuer  string
+}
+
+// NewMFAService returns service, issuer names the account in authenticator
+// apps, lockout may be nil to leave codes of signed in users unthrottled
+func NewMFAService(repo repositories.UserRepository, policy PolicyService, cacheSrv CacheService, lockSrv LockoutService, issuer string) MFAService {
+	return &mfaService{
+		repo:    repo,
+		policy:  policy,
+		cache:   cacheSrv,
+		lockout: lockSrv,
+		issuer:  issuer,
+	}
+}
+
+// save stores MFA state of user, cached copies of the user are dropped
+func (s *mfaService) save(ctx context.Context, user *models.User) error {
+	user.UpdatedAt = time.Now()
+
+	if _, err := s.repo.Update(ctx, user); err != nil {
+		xlog.Errorf(ctx, "Unable to update MFA of user, err: %s", err.Error())
+
+		return err
+	}
+
+	invalidateUser(ctx, s.cache, user.ID, user.Email)
+
+	return nil
+}
+
+// verify checks code of enabled MFA, used TOTP step or recovery code is
+// stored so it can't be replayed
+func (s *mfaService) verify(ctx context.Context, userID uuid.UUID, code string) (*models.User, error) {
+	user, err := s.repo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.MFAEnabled {
+		return nil, models.ErrMFANotEnabled
+	}
+
+	if !user.VerifyMFA(code, time.Now()) {
+		return nil, models.ErrInvalidMFACode
+	}
+
+	if err := s.save(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Required ...
+func (s *mfaService) Required(ctx context.Context, user *models.User) (bool, error) {
+	if user.MFAEnabled {
+		return true, nil
+	}
+
+	return s.policy.MFARequired(ctx, user.Role)
+}
+
+// Enroll ...
+func (s *mfaService) Enroll(ctx context.Context, userID uuid.UUID) (*models.MFAEnrollment, error) {
+	user, err := s.repo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.MFAEnabled {
+		return nil, models.ErrMFAAlreadyEnabled
+	}
+
+	secret, err := models.NewTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	user.ResetMFA()
+	user.MFASecret = secret
+
+	if err := s.save(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return &models.MFAEnrollment{
+		Secret: secret,
+		URI:    models.TOTPURI(s.issuer, user.Email, secret),
+	}, nil
+}
+
+// Confirm ...
+func (s *mfaService) Confirm(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	_, codes, err := s.confirm(ctx, userID, code)
+
+	return codes, err
+}
+
+// confirm ...
+func (s *mfaService) confirm(ctx context.Context, userID uuid.UUID, code string) (*models.User, []string, error) {
+	user, err := s.repo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if user.MFAEnabled {
+		return nil, nil, models.ErrMFAAlreadyEnabled
+	}
+
+	if user.MFASecret == "" {
+		return nil, nil, models.ErrMFANotEnrolled
+	}
+
+	if !user.VerifyTOTP(code, time.Now()) {
+		return nil, nil, models.ErrInvalidMFACode
+	}
+
+	codes, err := user.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user.MFAEnabled = true
+
+	if err := s.save(ctx, user); err != nil {
+		return nil, nil, err
+	}
+
+	return user, codes, nil
+}
+
+// Authenticate ...
+func (s *mfaService) Authenticate(ctx context.Context, userID uuid.UUID, code string) (*models.User, []string, error) {
+	user, err := s.repo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !user.MFAEnabled {
+		return s.confirm(ctx, userID, code)
+	}
+
+	user, err = s.verify(ctx, userID, code)
+
+	return user, nil, err
+}
+
+// verifyThrottled checks code as verify does, codes are guessed the way
+// passwords are, so they share the lockout as in AuthService.MFAGrant
+func (s *mfaService) verifyThrottled(ctx context.Context, userID uuid.UUID, code string, ip string) (*models.User, error) {
+	if s.lockout == nil {
+		return s.verify(ctx, userID, code)
+	}
+
+	user, err := s.repo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.lockout.Check(ctx, user.Email, ip); err != nil {
+		xlog.Infof(ctx, "Second factor of user %s from %s throttled, err: %s", user.ID, ip, err.Error())
+
+		return nil, err
+	}
+
+	verified, err := s.verify(ctx, userID, code)
+	if err == models.ErrInvalidMFACode {
+		if err := s.lockout.Failed(ctx, user.Email, ip, user); err != nil {
+			xlog.Errorf(ctx, "Unable to record failed second factor, err: %s", err.Error())
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.lockout.Succeeded(ctx, user.Email); err != nil {
+		xlog.Errorf(ctx, "Unable to reset failed logins, err: %s", err.Error())
+	}
+
+	return verified, nil
+}
+
+// Disable ...
+func (s *mfaService) Disable(ctx context.Context, userID uuid.UUID, code string, ip string) error {
+	user, err := s.repo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	// checked first so the code is not used up in vain
+	required, err := s.policy.MFARequired(ctx, user.Role)
+	if err != nil {
+		return err
+	}
+
+	if required {
+		return models.ErrMFARequiredByRole
+	}
+
+	if user, err = s.verifyThrottled(ctx, userID, code, ip); err != nil {
+		return err
+	}
+
+	user.ResetMFA()
+
+	return s.save(ctx, user)
+}
+
+// RegenerateRecoveryCodes ...
+func (s *mfaService) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string, ip string) ([]string, error) {
+	user, err := s.verifyThrottled(ctx, userID, code, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := user.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.save(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
@@ -0,0 +1,151 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/providers/mock"
+	"github.com/stiks/gobs/lib/services"
+	"github.com/stiks/gobs/pkg/helpers"
+)
+
+var _mfaUser = helpers.UUIDFromString(nil, "3ab1ba2a-6031-4e34-aae3-dcd43a987775")
+
+// _totp returns current code of secret
+func _totp(t *testing.T, secret string) string {
+	code, err := models.TOTPCode(secret, models.TOTPStep(time.Now()))
+	assert.NoError(t, err)
+
+	return code
+}
+
+func TestService_MFA_Enrollment(t *testing.T) {
+	srv := services.NewMFAService(mock.NewUserRepository(), services.NewPolicyService(mock.NewRoleRepository(), _cacheSrv()), _cacheSrv(), nil, "GOBS")
+
+	t.Run("Confirm before enrollment", func(t *testing.T) {
+		_, err := srv.Confirm(context.Background(), _mfaUser, "123456")
+		assert.Equal(t, models.ErrMFANotEnrolled, err)
+	})
+
+	enrollment, err := srv.Enroll(context.Background(), _mfaUser)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NotEmpty(t, enrollment.Secret)
+	assert.Contains(t, enrollment.URI, "secret="+enrollment.Secret)
+
+	t.Run("Wrong code", func(t *testing.T) {
+		_, err := srv.Confirm(context.Background(), _mfaUser, "12345")
+		assert.Equal(t, models.ErrInvalidMFACode, err)
+	})
+
+	codes, err := srv.Confirm(context.Background(), _mfaUser, _totp(t, enrollment.Secret))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Len(t, codes, models.RecoveryCodeCount)
+
+	t.Run("Already enabled", func(t *testing.T) {
+		_, err := srv.Enroll(context.Background(), _mfaUser)
+		assert.Equal(t, models.ErrMFAAlreadyEnabled, err)
+	})
+
+	t.Run("Required once enabled", func(t *testing.T) {
+		required, err := srv.Required(context.Background(), &models.User{Role: models.RoleUser, MFAEnabled: true})
+		if assert.NoError(t, err) {
+			assert.True(t, required)
+		}
+	})
+
+	t.Run("Recovery code works once", func(t *testing.T) {
+		user, fresh, err := srv.Authenticate(context.Background(), _mfaUser, codes[0])
+		if assert.NoError(t, err) {
+			assert.Len(t, user.MFARecoveryCodes, models.RecoveryCodeCount-1)
+			assert.Empty(t, fresh)
+		}
+
+		_, _, err = srv.Authenticate(context.Background(), _mfaUser, codes[0])
+		assert.Equal(t, models.ErrInvalidMFACode, err)
+	})
+
+	t.Run("Regenerate", func(t *testing.T) {
+		fresh, err := srv.RegenerateRecoveryCodes(context.Background(), _mfaUser, codes[1], "")
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		_, _, err = srv.Authenticate(context.Background(), _mfaUser, codes[2])
+		assert.Equal(t, models.ErrInvalidMFACode, err, "old codes stop working")
+
+		assert.NoError(t, srv.Disable(context.Background(), _mfaUser, fresh[0], ""))
+
+		_, err = srv.RegenerateRecoveryCodes(context.Background(), _mfaUser, fresh[1], "")
+		assert.Equal(t, models.ErrMFANotEnabled, err)
+	})
+}
+
+func TestService_MFA_RequiredByRole(t *testing.T) {
+	policy := services.NewPolicyService(mock.NewRoleRepository(), _cacheSrv())
+	srv := services.NewMFAService(mock.NewUserRepository(), policy, _cacheSrv(), nil, "GOBS")
+
+	_, _ = policy.RequireMFA(context.Background(), models.RoleUser, true)
+
+	required, err := srv.Required(context.Background(), &models.User{Role: models.RoleUser})
+	if assert.NoError(t, err) {
+		assert.True(t, required)
+	}
+
+	enrollment, err := srv.Enroll(context.Background(), _mfaUser)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	t.Run("Login confirms enrollment", func(t *testing.T) {
+		user, codes, err := srv.Authenticate(context.Background(), _mfaUser, _totp(t, enrollment.Secret))
+		if assert.NoError(t, err) {
+			assert.True(t, user.MFAEnabled)
+			assert.Len(t, codes, models.RecoveryCodeCount)
+		}
+
+		_, _, err = srv.Authenticate(context.Background(), _mfaUser, _totp(t, enrollment.Secret))
+		assert.Equal(t, models.ErrInvalidMFACode, err, "TOTP step is used once")
+
+		err = srv.Disable(context.Background(), _mfaUser, codes[0], "")
+		assert.Equal(t, models.ErrMFARequiredByRole, err)
+	})
+}
+
+func TestService_MFA_Lockout(t *testing.T) {
+	lockout, users, _ := _lockoutSrv(_lockoutCfg)
+	srv := services.NewMFAService(users, services.NewPolicyService(mock.NewRoleRepository(), _cacheSrv()), _cacheSrv(), lockout, "GOBS")
+
+	enrollment, err := srv.Enroll(context.Background(), _mfaUser)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	codes, err := srv.Confirm(context.Background(), _mfaUser, _totp(t, enrollment.Secret))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for i := 1; i < _lockoutCfg.MaxAttempts; i++ {
+		assert.Equal(t, models.ErrInvalidMFACode, srv.Disable(context.Background(), _mfaUser, "000000", "10.0.0.1"))
+	}
+
+	_, err = srv.RegenerateRecoveryCodes(context.Background(), _mfaUser, "000000", "10.0.0.1")
+	assert.Equal(t, models.ErrInvalidMFACode, err)
+
+	t.Run("Locked user can't try codes", func(t *testing.T) {
+		_throttled(t, srv.Disable(context.Background(), _mfaUser, codes[0], "10.0.0.2"))
+
+		_, err := srv.RegenerateRecoveryCodes(context.Background(), _mfaUser, codes[0], "10.0.0.2")
+		_throttled(t, err)
+	})
+}
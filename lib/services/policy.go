@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/repositories"
+	"github.com/stiks/gobs/pkg/xlog"
+)
+
+// PolicyService decides what roles may do, permissions of a role come from
+// the repository once changed and from models.DefaultRoles until then. Roles
+// are checked on every request, so they are cached until changed.
+type PolicyService interface {
+	// Roles returns every role with its effective permissions
+	Roles(ctx context.Context) ([]models.Role, error)
+	Role(ctx context.Context, name string) (*models.Role, error)
+	// UpdateRole replaces permissions of the role, super user role is fixed
+	UpdateRole(ctx context.Context, role *models.Role) (*models.Role, error)
+	// RequireMFA turns MFA requirement of the role on or off, super user
+	// role included
+	RequireMFA(ctx context.Context, name string, required bool) (*models.Role, error)
+	// MFARequired reports whether users of role have to pass second factor
+	MFARequired(ctx context.Context, role string) (bool, error)
+	// Permits reports whether role has permission to any extent, even if
+	// only for owned resources
+	Permits(ctx context.Context, role string, permission string) (bool, error)
+	// Authorize returns models.ErrPermissionDenied unless actor has permission
+	// for resource owned by ownerID
+	Authorize(ctx context.Context, actor *models.Actor, permission string, ownerID uuid.UUID) error
+	// Access tells whether actor has permission for all or only owned resources
+	Access(ctx context.Context, actor *models.Actor, permission string) (models.Access, error)
+	// AuthorizeRole returns models.ErrPermissionDenied unless actor may give
+	// users role, only super users hand out super user role
+	AuthorizeRole(ctx context.Context, actor *models.Actor, role string) error
+}
+
+type policyService struct {
+	repo  repositories.RoleRepository
+	cache CacheService
+}
+
+// NewPolicyService ...
+func NewPolicyService(repo repositories.RoleRepository, cacheSrv CacheService) PolicyService {
+	return &policyService{
+		repo:  repo,
+		cache: cacheSrv,
+	}
+}
+
+// defaultRole ...
+func defaultRole(name string) *models.Role {
+	for _, role := range models.DefaultRoles() {
+		if role.Name == name {
+			return &role
+		}
+	}
+
+	return nil
+}
+
+// Roles ...
+func (s *policyService) Roles(ctx context.Context) ([]models.Role, error) {
+	stored, err := s.repo.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := models.DefaultRoles()
+	for i := range roles {
+		for _, role := range stored {
+			if role.Name == roles[i].Name {
+				roles[i] = *effectiveRole(&roles[i], &role)
+			}
+		}
+	}
+
+	return roles, nil
+}
+
+// effectiveRole returns stored role, super user always has every permission
+// so only its MFA requirement is taken from storage
+func effectiveRole(def *models.Role, stored *models.Role) *models.Role {
+	if def.Name != models.RoleSuperUser {
+		return stored
+	}
+
+	def.MFARequired = stored.MFARequired
+	def.UpdatedAt = stored.UpdatedAt
+
+	return def
+}
+
+// Role ...
+func (s *policyService) Role(ctx context.Context, name string) (*models.Role, error) {
+	def := defaultRole(name)
+	if def == nil {
+		return nil, models.ErrRoleNotFound
+	}
+
+	role := new(models.Role)
+
+	err := s.cache.GetOrLoad(ctx, roleKey(name), 0, role, func(ctx context.Context) (interface{}, []string, error) {
+		stored, err := s.repo.FindByName(ctx, name)
+		if err == models.ErrRoleNotFound {
+			return def, nil, nil
+		}
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return effectiveRole(def, stored), nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// cache doesn't tell empty permissions from none
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
+
+	return role, nil
+}
+
+// save stores role and drops its cached copy
+func (s *policyService) save(ctx context.Context, role *models.Role) (*models.Role, error) {
+	saved, err := s.repo.Save(ctx, role)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.cache.Delete(ctx, roleKey(role.Name)); err != nil {
+		xlog.Errorf(ctx, "Invalidating cache error: %s", err.Error())
+	}
+
+	return saved, nil
+}
+
+// roleKey of cached role
+func roleKey(name string) string {
+	return "role_" + name
+}
+
+// UpdateRole ...
+func (s *policyService) UpdateRole(ctx context.Context, role *models.Role) (*models.Role, error) {
+	if err := role.Validate(); err != nil {
+		return nil, err
+	}
+
+	if role.Name == models.RoleSuperUser {
+		return nil, models.ErrRoleNotEditable
+	}
+
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
+
+	role.UpdatedAt = time.Now().UTC()
+
+	return s.save(ctx, role)
+}
+
+// RequireMFA ...
+func (s *policyService) RequireMFA(ctx context.Context, name string, required bool) (*models.Role, error) {
+	role, err := s.Role(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	role.MFARequired = required
+	role.UpdatedAt = time.Now().UTC()
+
+	return s.save(ctx, role)
+}
+
+// MFARequired ...
+func (s *policyService) MFARequired(ctx context.Context, name string) (bool, error) {
+	role, err := s.Role(ctx, name)
+	if err == models.ErrRoleNotFound {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return role.MFARequired, nil
+}
+
+// access ...
+func (s *policyService) access(ctx context.Context, name string, permission string) (models.Access, error) {
+	role, err := s.Role(ctx, name)
+	if err == models.ErrRoleNotFound {
+		return models.AccessNone, nil
+	}
+
+	if err != nil {
+		return models.AccessNone, err
+	}
+
+	return role.Access(permission), nil
+}
+
+// Permits ...
+func (s *policyService) Permits(ctx context.Context, role string, permission string) (bool, error) {
+	access, err := s.access(ctx, role, permission)
+
+	return access != models.AccessNone, err
+}
+
+// Access ...
+func (s *policyService) Access(ctx context.Context, actor *models.Actor, permission string) (models.Access, error) {
+	return s.access(ctx, actor.Role, permission)
+}
+
+// Authorize ...
+func (s *policyService) Authorize(ctx context.Context, actor *models.Actor, permission string, ownerID uuid.UUID) error {
+	access, err := s.access(ctx, actor.Role, permission)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case access == models.AccessAll:
+		return nil
+	case access == models.AccessOwn && ownerID != uuid.Nil && ownerID == actor.ID:
+		return nil
+	}
+
+	return models.ErrPermissionDenied
+}
+
+// AuthorizeRole ...
+func (s *policyService) AuthorizeRole(ctx context.Context, actor *models.Actor, role string) error {
+	if role == "" || role == models.RoleUser {
+		return nil
+	}
+
+	if role == models.RoleSuperUser && actor.Role != models.RoleSuperUser {
+		return models.ErrPermissionDenied
+	}
+
+	return s.Authorize(ctx, actor, models.PermRolesAssign, uuid.Nil)
+}
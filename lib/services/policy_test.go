@@ -0,0 +1,213 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/providers/memory"
+	"github.com/stiks/gobs/lib/providers/mock"
+	"github.com/stiks/gobs/lib/repositories"
+	"github.com/stiks/gobs/lib/services"
+)
+
+func TestService_Policy_Roles(t *testing.T) {
+	srv := services.NewPolicyService(mock.NewRoleRepository(), _cacheSrv())
+
+	roles, err := srv.Roles(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, models.DefaultRoles(), roles)
+	}
+
+	t.Run("Stored role overrides default", func(t *testing.T) {
+		_, err := srv.UpdateRole(context.Background(), &models.Role{Name: models.RoleUser, Permissions: []string{models.PermUsersView + models.OwnSuffix}})
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		role, err := srv.Role(context.Background(), models.RoleUser)
+		if assert.NoError(t, err) {
+			assert.Equal(t, []string{"users.view:own"}, role.Permissions)
+		}
+	})
+
+	t.Run("Unknown role", func(t *testing.T) {
+		_, err := srv.Role(context.Background(), "guest")
+		assert.Equal(t, models.ErrRoleNotFound, err)
+	})
+}
+
+// roleCounter counts roles read from repository
+type roleCounter struct {
+	repositories.RoleRepository
+	reads int
+}
+
+func (r *roleCounter) FindByName(ctx context.Context, name string) (*models.Role, error) {
+	r.reads++
+
+	return r.RoleRepository.FindByName(ctx, name)
+}
+
+func TestService_Policy_Cache(t *testing.T) {
+	repo := &roleCounter{RoleRepository: mock.NewRoleRepository()}
+	srv := services.NewPolicyService(repo, services.NewCacheService(memory.NewCacheRepository(memory.Options{}), services.CacheConfig{}))
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		permitted, err := srv.Permits(ctx, models.RoleManager, models.PermUsersView)
+		if assert.NoError(t, err) {
+			assert.True(t, permitted)
+		}
+	}
+
+	assert.Equal(t, 1, repo.reads, "role is read once")
+
+	t.Run("Dropped on update", func(t *testing.T) {
+		_, err := srv.UpdateRole(ctx, &models.Role{Name: models.RoleManager, Permissions: []string{}})
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		permitted, err := srv.Permits(ctx, models.RoleManager, models.PermUsersView)
+		if assert.NoError(t, err) {
+			assert.False(t, permitted)
+		}
+
+		role, err := srv.Role(ctx, models.RoleManager)
+		if assert.NoError(t, err) {
+			assert.Equal(t, []string{}, role.Permissions)
+		}
+	})
+
+	t.Run("Dropped on MFA requirement", func(t *testing.T) {
+		_, err := srv.RequireMFA(ctx, models.RoleManager, true)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		required, err := srv.MFARequired(ctx, models.RoleManager)
+		if assert.NoError(t, err) {
+			assert.True(t, required)
+		}
+	})
+}
+
+func TestService_Policy_UpdateRole(t *testing.T) {
+	srv := services.NewPolicyService(mock.NewRoleRepository(), _cacheSrv())
+
+	t.Run("Super user role", func(t *testing.T) {
+		_, err := srv.UpdateRole(context.Background(), &models.Role{Name: models.RoleSuperUser})
+		assert.Equal(t, models.ErrRoleNotEditable, err)
+	})
+
+	t.Run("Unknown permission", func(t *testing.T) {
+		_, err := srv.UpdateRole(context.Background(), &models.Role{Name: models.RoleAdmin, Permissions: []string{"users.fly"}})
+		assert.Error(t, err)
+	})
+}
+
+func TestService_Policy_RequireMFA(t *testing.T) {
+	srv := services.NewPolicyService(mock.NewRoleRepository(), _cacheSrv())
+
+	required, err := srv.MFARequired(context.Background(), models.RoleSuperUser)
+	if assert.NoError(t, err) {
+		assert.False(t, required)
+	}
+
+	t.Run("Super user role", func(t *testing.T) {
+		role, err := srv.RequireMFA(context.Background(), models.RoleSuperUser, true)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.True(t, role.MFARequired)
+
+		required, err := srv.MFARequired(context.Background(), models.RoleSuperUser)
+		if assert.NoError(t, err) {
+			assert.True(t, required)
+		}
+
+		permitted, err := srv.Permits(context.Background(), models.RoleSuperUser, models.PermRolesManage)
+		if assert.NoError(t, err) {
+			assert.True(t, permitted, "super user keeps every permission")
+		}
+	})
+
+	t.Run("Kept on permission update", func(t *testing.T) {
+		if _, err := srv.RequireMFA(context.Background(), models.RoleManager, true); !assert.NoError(t, err) {
+			return
+		}
+
+		role, _ := srv.Role(context.Background(), models.RoleManager)
+		role.Permissions = []string{models.PermUsersView}
+
+		if _, err := srv.UpdateRole(context.Background(), role); !assert.NoError(t, err) {
+			return
+		}
+
+		required, err := srv.MFARequired(context.Background(), models.RoleManager)
+		if assert.NoError(t, err) {
+			assert.True(t, required)
+		}
+	})
+
+	t.Run("Unknown role", func(t *testing.T) {
+		_, err := srv.RequireMFA(context.Background(), "guest", true)
+		assert.Equal(t, models.ErrRoleNotFound, err)
+
+		required, err := srv.MFARequired(context.Background(), "guest")
+		if assert.NoError(t, err) {
+			assert.False(t, required)
+		}
+	})
+}
+
+func TestService_Policy_Authorize(t *testing.T) {
+	srv := services.NewPolicyService(mock.NewRoleRepository(), _cacheSrv())
+
+	admin := &models.Actor{ID: uuid.New(), Role: models.RoleAdmin}
+	manager := &models.Actor{ID: uuid.New(), Role: models.RoleManager}
+
+	t.Run("All access", func(t *testing.T) {
+		assert.NoError(t, srv.Authorize(context.Background(), admin, models.PermUsersUpdate, uuid.New()))
+	})
+
+	t.Run("Own access", func(t *testing.T) {
+		assert.NoError(t, srv.Authorize(context.Background(), manager, models.PermUsersUpdate, manager.ID))
+		assert.Equal(t, models.ErrPermissionDenied, srv.Authorize(context.Background(), manager, models.PermUsersUpdate, uuid.New()))
+		assert.Equal(t, models.ErrPermissionDenied, srv.Authorize(context.Background(), manager, models.PermUsersUpdate, uuid.Nil))
+	})
+
+	t.Run("No access", func(t *testing.T) {
+		user := &models.Actor{ID: uuid.New(), Role: models.RoleUser}
+		assert.Equal(t, models.ErrPermissionDenied, srv.Authorize(context.Background(), user, models.PermUsersView, user.ID))
+	})
+
+	t.Run("Permits own access", func(t *testing.T) {
+		ok, err := srv.Permits(context.Background(), models.RoleManager, models.PermUsersDelete)
+		if assert.NoError(t, err) {
+			assert.True(t, ok)
+		}
+
+		ok, err = srv.Permits(context.Background(), models.RoleManager, models.PermRolesManage)
+		if assert.NoError(t, err) {
+			assert.False(t, ok)
+		}
+	})
+}
+
+func TestService_Policy_AuthorizeRole(t *testing.T) {
+	srv := services.NewPolicyService(mock.NewRoleRepository(), _cacheSrv())
+
+	admin := &models.Actor{ID: uuid.New(), Role: models.RoleAdmin}
+	manager := &models.Actor{ID: uuid.New(), Role: models.RoleManager}
+
+	assert.NoError(t, srv.AuthorizeRole(context.Background(), manager, models.RoleUser))
+	assert.Equal(t, models.ErrPermissionDenied, srv.AuthorizeRole(context.Background(), manager, models.RoleAdmin))
+	assert.NoError(t, srv.AuthorizeRole(context.Background(), admin, models.RoleManager))
+	assert.Equal(t, models.ErrPermissionDenied, srv.AuthorizeRole(context.Background(), admin, models.RoleSuperUser), "only super users make super users")
+}
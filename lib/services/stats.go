@@ -8,7 +8,8 @@ import (
 )
 
 type statsService struct {
-	repo repositories.StatsRepository
+	repo  repositories.StatsRepository
+	cache repositories.CacheRepository
 }
 
 // StatsService ...
@@ -17,10 +18,12 @@ type StatsService interface {
 	GetStats(ctx echo.Context) (*models.Stats, error)
 }
 
-// NewStatsService ...
-func NewStatsService(repo repositories.StatsRepository) StatsService {
+// NewStatsService returns service, counters of cache are reported when it
+// implements repositories.MeteredCacheRepository
+func NewStatsService(repo repositories.StatsRepository, cache repositories.CacheRepository) StatsService {
 	return &statsService{
-		repo: repo,
+		repo:  repo,
+		cache: cache,
 	}
 }
 
@@ -31,5 +34,20 @@ func (s *statsService) Process(ctx echo.Context) error {
 
 // GetStats ...
 func (s *statsService) GetStats(ctx echo.Context) (*models.Stats, error) {
-	return s.repo.GetStats(ctx)
+	stats, err := s.repo.GetStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	metered, ok := s.cache.(repositories.MeteredCacheRepository)
+	if !ok {
+		return stats, nil
+	}
+
+	// repository may hand out its own copy, it is not changed
+	res := *stats
+	cache := metered.Stats()
+	res.Cache = &cache
+
+	return &res, nil
 }
@@ -0,0 +1,39 @@
+package services_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/lib/providers/memory"
+	"github.com/stiks/gobs/lib/providers/mock"
+	"github.com/stiks/gobs/lib/services"
+)
+
+func TestService_Stats_GetStats(t *testing.T) {
+	c := echo.New().NewContext(httptest.NewRequest("GET", "/", nil), httptest.NewRecorder())
+
+	t.Run("Cache without counters", func(t *testing.T) {
+		stats, err := services.NewStatsService(mock.NewStatsRepository(), mock.NewCacheRepository()).GetStats(c)
+		if assert.NoError(t, err) {
+			assert.Nil(t, stats.Cache)
+		}
+	})
+
+	t.Run("Memory cache", func(t *testing.T) {
+		cache := memory.NewCacheRepository(memory.Options{})
+		_ = cache.Create(context.Background(), "key", "value")
+		_ = cache.FindByKey(context.Background(), "key", new(string))
+		_ = cache.FindByKey(context.Background(), "other", new(string))
+
+		stats, err := services.NewStatsService(mock.NewStatsRepository(), cache).GetStats(c)
+		if assert.NoError(t, err) && assert.NotNil(t, stats.Cache) {
+			assert.Equal(t, uint64(1), stats.Cache.Hits)
+			assert.Equal(t, uint64(1), stats.Cache.Misses)
+			assert.Equal(t, 1, stats.Cache.Entries)
+		}
+	})
+}
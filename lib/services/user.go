@@ -9,6 +9,7 @@ import (
 
 	"github.com/stiks/gobs/lib/models"
 	"github.com/stiks/gobs/lib/repositories"
+	"github.com/stiks/gobs/pkg/tenant"
 	"github.com/stiks/gobs/pkg/xlog"
 )
 
@@ -32,6 +33,8 @@ type UserService interface {
 	UpdateUsername(ctx context.Context, id uuid.UUID, newUsername string) (*models.User, error)
 	UpdateLogin(ctx context.Context, user *models.User) (*models.User, error)
 	ResetPassword(ctx context.Context, username string) (*models.User, error)
+	Register(ctx context.Context, password string, user *models.User, codeLifetime time.Duration) (*models.User, error)
+	ResendConfirmation(ctx context.Context, user *models.User, codeLifetime time.Duration) (*models.User, error)
 }
 
 // NewUserService ...
@@ -45,35 +48,29 @@ func NewUserService(repo repositories.UserRepository, queue QueueService, cacheS
 
 // GetByUsername ...
 func (s *userService) GetByUsername(ctx context.Context, username string) (*models.User, error) {
-	cached := new(models.User)
+	user := new(models.User)
 
-	key := fmt.Sprintf("user_%s", username)
+	err := s.cache.GetOrLoad(ctx, fmt.Sprintf("user_%s", username), 0, user, func(ctx context.Context) (interface{}, []string, error) {
+		xlog.Infof(ctx, "Missed cache, getting from user by username service")
 
-	// we have cached result
-	err := s.cache.GetByKey(ctx, key, cached)
-	if err == nil {
-		xlog.Infof(ctx, "Returned cached result")
+		found, err := s.repo.FindByUsername(tenant.Unscoped(ctx), username)
+		if err != nil {
+			xlog.Errorf(ctx, "User find error: %s", err.Error())
 
-		return cached, nil
-	}
-
-	xlog.Infof(ctx, "Missed cache, getting from user by username service, err: %s", err.Error())
+			return nil, nil, err
+		}
 
-	cached, err = s.repo.FindByUsername(ctx, username)
+		return found, []string{userTag(found.ID)}, nil
+	})
 	if err != nil {
-		xlog.Errorf(ctx, "User find error: %s", err.Error())
-
 		return nil, err
 	}
 
-	xlog.Infof(ctx, "Creating cache for %s", key)
-
-	// adding results to the cache
-	if err := s.cache.Create(ctx, key, cached); err != nil {
-		xlog.Errorf(ctx, "Unable to create tag cache, err: %s", err.Error())
+	if !tenant.Allows(ctx, user.TenantID) {
+		return nil, models.ErrUserNotFound
 	}
 
-	return cached, nil
+	return user, nil
 }
 
 // GetAll ...
@@ -88,41 +85,35 @@ func (s *userService) CountAll(ctx context.Context, params *models.UserQueryPara
 
 // GetByID ...
 func (s *userService) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
-	cached := new(models.User)
-
 	if id.String() == "00000000-0000-0000-0000-000000000000" {
 		xlog.Infof(ctx, "Empty user ID, existing ...")
 
 		return nil, models.ErrUserNotFound
 	}
 
-	key := fmt.Sprintf("user_%s", id.String())
+	user := new(models.User)
 
-	// we have cached result
-	err := s.cache.GetByKey(ctx, key, cached)
-	if err == nil {
-		xlog.Infof(ctx, "Returned cached result")
+	err := s.cache.GetOrLoad(ctx, fmt.Sprintf("user_%s", id.String()), 0, user, func(ctx context.Context) (interface{}, []string, error) {
+		xlog.Infof(ctx, "Missed cache, getting from user by ID service")
 
-		return cached, nil
-	}
+		found, err := s.repo.FindByID(tenant.Unscoped(ctx), id)
+		if err != nil {
+			xlog.Errorf(ctx, "User find error: %s", err.Error())
 
-	xlog.Infof(ctx, "Missed cache, getting from user by ID service, err: %s", err.Error())
+			return nil, nil, err
+		}
 
-	cached, err = s.repo.FindByID(ctx, id)
+		return found, []string{userTag(id)}, nil
+	})
 	if err != nil {
-		xlog.Errorf(ctx, "User find error: %s", err.Error())
-
 		return nil, err
 	}
 
-	xlog.Infof(ctx, "Creating cache for %s", key)
-
-	// adding results to the cache
-	if err := s.cache.Create(ctx, key, cached); err != nil {
-		xlog.Errorf(ctx, "Unable to create tag cache, err: %s", err.Error())
+	if !tenant.Allows(ctx, user.TenantID) {
+		return nil, models.ErrUserNotFound
 	}
 
-	return cached, nil
+	return user, nil
 }
 
 // Create ...
@@ -135,13 +126,13 @@ func (s *userService) Create(ctx context.Context, password string, user *models.
 	user.UpdatedAt = time.Now()
 
 	user, err := s.repo.Create(ctx, user)
-
-	// Clear the cache
-	if err := s.cache.Flush(ctx); err != nil {
-		xlog.Errorf(ctx, "Flushing cache error: %s", err.Error())
+	if err != nil {
+		return nil, err
 	}
 
-	return user, err
+	invalidateUser(ctx, s.cache, user.ID, user.Email)
+
+	return user, nil
 }
 
 // Update ...
@@ -159,26 +150,24 @@ func (s *userService) Update(ctx context.Context, user *models.User) (*models.Us
 		xlog.Errorf(ctx, "Unable to send request into a 'user-password-reset' queue, err: %s", err.Error())
 	}
 
-	// Clear the cache
-	if err := s.cache.Flush(ctx); err != nil {
-		xlog.Errorf(ctx, "Flushing cache error: %s", err.Error())
-	}
+	invalidateUser(ctx, s.cache, user.ID, user.Email)
 
 	return user, nil
 }
 
 // Delete ...
 func (s *userService) Delete(ctx context.Context, id uuid.UUID) error {
-	err := s.repo.Delete(ctx, id)
+	user, err := s.repo.FindByID(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	// Clear the cache
-	if err := s.cache.Flush(ctx); err != nil {
-		xlog.Errorf(ctx, "Flushing cache error: %s", err.Error())
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
 	}
 
+	invalidateUser(ctx, s.cache, id, user.Email)
+
 	return nil
 }
 
@@ -206,10 +195,7 @@ func (s *userService) UpdatePassword(ctx context.Context, id uuid.UUID, newPassw
 		xlog.Errorf(ctx, "Unable to send request into a 'user-password-changed' queue, err: %s", err.Error())
 	}
 
-	// Clear the cache
-	if err := s.cache.Flush(ctx); err != nil {
-		xlog.Errorf(ctx, "Flushing cache error: %s", err.Error())
-	}
+	invalidateUser(ctx, s.cache, user.ID, user.Email)
 
 	return user, nil
 }
@@ -225,6 +211,7 @@ func (s *userService) UpdateUsername(ctx context.Context, id uuid.UUID, newUsern
 		return nil, models.ErrCannotSetEmptyUsername
 	}
 
+	previous := user.Email
 	user.Email = newUsername
 
 	user, err = s.Update(ctx, user)
@@ -232,12 +219,10 @@ func (s *userService) UpdateUsername(ctx context.Context, id uuid.UUID, newUsern
 		return nil, err
 	}
 
-	// Clear the cache
-	if err := s.cache.Flush(ctx); err != nil {
-		xlog.Errorf(ctx, "Flushing cache error: %s", err.Error())
-	}
+	// Update drops the new email, entry under the old one is stale too
+	invalidateUser(ctx, s.cache, user.ID, previous)
 
-	return user, err
+	return user, nil
 }
 
 // UpdateLogin ...
@@ -249,10 +234,7 @@ func (s *userService) UpdateLogin(ctx context.Context, user *models.User) (*mode
 		return nil, err
 	}
 
-	// Clear the cache
-	if err := s.cache.Flush(ctx); err != nil {
-		xlog.Errorf(ctx, "Flushing cache error: %s", err.Error())
-	}
+	invalidateUser(ctx, s.cache, user.ID, user.Email)
 
 	return user, nil
 }
@@ -286,10 +268,87 @@ func (s *userService) ResetPassword(ctx context.Context, username string) (*mode
 		return nil, err
 	}
 
-	// Clear the cache
-	if err := s.cache.Flush(ctx); err != nil {
-		xlog.Errorf(ctx, "Flushing cache error: %s", err.Error())
+	invalidateUser(ctx, s.cache, user.ID, user.Email)
+
+	return user, nil
+}
+
+// Register creates user and sends email confirmation code valid for codeLifetime
+func (s *userService) Register(ctx context.Context, password string, user *models.User, codeLifetime time.Duration) (*models.User, error) {
+	user.GenerateValidationHash(codeLifetime)
+
+	user, err := s.Create(ctx, password, user)
+	if err != nil {
+		return nil, err
+	}
+
+	// user can ask for another email, so registration itself succeeds
+	if err := s.queueConfirmation(ctx, user); err != nil {
+		xlog.Criticalf(ctx, "Unable to send request into a 'user-confirm-email' queue, err: %s", err.Error())
+	}
+
+	return user, nil
+}
+
+// ResendConfirmation replaces email confirmation code and sends it again. User
+// is read again from repository, so a cached copy doesn't overwrite changes.
+func (s *userService) ResendConfirmation(ctx context.Context, user *models.User, codeLifetime time.Duration) (*models.User, error) {
+	user, err := s.repo.FindByID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.IsActive {
+		return nil, models.ErrEmailAlreadyConfirmed
+	}
+
+	user.GenerateValidationHash(codeLifetime)
+	user.UpdatedAt = time.Now()
+
+	user, err = s.repo.Update(ctx, user)
+	if err != nil {
+		xlog.Errorf(ctx, "Unable update user, err: %s", err.Error())
+
+		return nil, err
+	}
+
+	invalidateUser(ctx, s.cache, user.ID, user.Email)
+
+	if err := s.queueConfirmation(ctx, user); err != nil {
+		xlog.Criticalf(ctx, "Unable to send request into a 'user-confirm-email' queue, err: %s", err.Error())
+
+		return nil, err
 	}
 
 	return user, nil
 }
+
+// queueConfirmation asks worker to email current confirmation code
+func (s *userService) queueConfirmation(ctx context.Context, user *models.User) error {
+	return s.queue.AddObject(ctx, "user-confirm-email", &models.WorkerRequest{ID: user.ID, Code: user.ValidationHash})
+}
+
+// userTag groups entries of one user, cached by ID and by email
+func userTag(id uuid.UUID) string {
+	return fmt.Sprintf("user_%s", id.String())
+}
+
+// invalidateUser drops cached user by ID and by every email given, such as the
+// old one after username change. Keys are deleted besides the tag, because
+// index of the tag may have been evicted.
+func invalidateUser(ctx context.Context, cache CacheService, id uuid.UUID, emails ...string) {
+	if err := cache.InvalidateTags(ctx, userTag(id)); err != nil {
+		xlog.Errorf(ctx, "Invalidating cache error: %s", err.Error())
+	}
+
+	keys := []string{fmt.Sprintf("user_%s", id.String())}
+	for _, email := range emails {
+		keys = append(keys, fmt.Sprintf("user_%s", email))
+	}
+
+	for _, key := range keys {
+		if err := cache.Delete(ctx, key); err != nil {
+			xlog.Errorf(ctx, "Invalidating cache error: %s", err.Error())
+		}
+	}
+}
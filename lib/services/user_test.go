@@ -1,19 +1,23 @@
 package services_test
 
 import (
+	"context"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/stiks/gobs/lib/models"
+	"github.com/stiks/gobs/lib/providers/memory"
 	"github.com/stiks/gobs/lib/providers/mock"
 	"github.com/stiks/gobs/lib/services"
 	"github.com/stiks/gobs/pkg/helpers"
+	"github.com/stiks/gobs/pkg/tenant"
 )
 
 func _userSrv() services.UserService {
-	return services.NewUserService(mock.NewUserRepository(), services.NewQueueService(mock.NewQueueRepository()), services.NewCacheService(mock.NewCacheRepository()))
+	return services.NewUserService(mock.NewUserRepository(), services.NewQueueService(mock.NewQueueRepository()), services.NewCacheService(mock.NewCacheRepository(), services.CacheConfig{}))
 }
 
 func TestService_User_NewUserService(t *testing.T) {
@@ -54,6 +58,95 @@ func TestService_User_CountAll(t *testing.T) {
 	}
 }
 
+func TestService_User_GetByUsername_MemoryCache(t *testing.T) {
+	cache := memory.NewCacheRepository(memory.Options{})
+	srv := services.NewUserService(mock.NewUserRepository(), services.NewQueueService(mock.NewQueueRepository()), services.NewCacheService(cache, services.CacheConfig{}))
+
+	first, err := srv.GetByUsername(context.Background(), "peter@test.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	first.Email = "changed@test.com"
+
+	second, err := srv.GetByUsername(context.Background(), "peter@test.com")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "peter@test.com", second.Email, "cached user is a copy")
+		assert.Equal(t, uint64(1), cache.Stats().Hits)
+	}
+}
+
+func TestService_User_CacheInvalidation(t *testing.T) {
+	cache := services.NewCacheService(memory.NewCacheRepository(memory.Options{}), services.CacheConfig{})
+	srv := services.NewUserService(mock.NewUserRepository(), services.NewQueueService(mock.NewQueueRepository()), cache)
+	ctx := context.Background()
+
+	user, err := srv.GetByUsername(ctx, "peter@test.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, _ = srv.GetByID(ctx, user.ID)
+	assert.NoError(t, cache.Create(ctx, "other", "value"))
+
+	_, err = srv.UpdateUsername(ctx, user.ID, "renamed@test.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, models.ErrMissCache, cache.GetByKey(ctx, "user_peter@test.com", new(models.User)), "old email is dropped")
+	assert.Equal(t, models.ErrMissCache, cache.GetByKey(ctx, "user_"+user.ID.String(), new(models.User)))
+	assert.NoError(t, cache.GetByKey(ctx, "other", new(string)), "unrelated entries stay")
+
+	_, err = srv.GetByUsername(ctx, "peter@test.com")
+	assert.Equal(t, models.ErrUserNotFound, err)
+
+	found, err := srv.GetByID(ctx, user.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "renamed@test.com", found.Email)
+	}
+}
+
+func TestService_User_Cache_Tenant(t *testing.T) {
+	cache := services.NewCacheService(memory.NewCacheRepository(memory.Options{}), services.CacheConfig{})
+	srv := services.NewUserService(mock.NewUserRepository(), services.NewQueueService(mock.NewQueueRepository()), cache)
+	ctx := context.Background()
+
+	user, err := srv.GetByUsername(ctx, "peter@test.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	own, other := tenant.NewContext(ctx, user.TenantID), tenant.NewContext(ctx, uuid.New())
+
+	t.Run("Other tenant", func(t *testing.T) {
+		_, err := srv.GetByID(other, user.ID)
+		assert.Equal(t, models.ErrUserNotFound, err)
+
+		_, err = srv.GetByUsername(other, "peter@test.com")
+		assert.Equal(t, models.ErrUserNotFound, err)
+	})
+
+	t.Run("Own tenant", func(t *testing.T) {
+		found, err := srv.GetByID(own, user.ID)
+		if assert.NoError(t, err, "lookup of other tenant didn't cache user as missing") {
+			assert.Equal(t, user.ID, found.ID)
+		}
+	})
+
+	t.Run("Invalidated by super user", func(t *testing.T) {
+		_, err := srv.UpdateUsername(ctx, user.ID, "renamed@test.com")
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		found, err := srv.GetByID(own, user.ID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "renamed@test.com", found.Email, "tenant shares entry dropped by super user")
+		}
+	})
+}
+
 func TestService_User_GetByID(t *testing.T) {
 	srv := _userSrv()
 
@@ -101,6 +194,27 @@ func TestService_User_Create(t *testing.T) {
 	})
 }
 
+func TestService_User_Create_NegativeCache(t *testing.T) {
+	repo := memory.NewCacheRepository(memory.Options{})
+	srv := services.NewUserService(mock.NewUserRepository(), services.NewQueueService(mock.NewQueueRepository()), services.NewCacheService(repo, services.CacheConfig{NegativeTTL: time.Minute}))
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		_, err := srv.GetByUsername(ctx, "new@friend.com")
+		assert.Equal(t, models.ErrUserNotFound, err)
+	}
+
+	assert.Equal(t, uint64(1), repo.Stats().Hits, "miss is cached")
+
+	_, err := srv.Create(ctx, "testpass", &models.User{ID: uuid.New(), Email: "new@friend.com"})
+	if assert.NoError(t, err) {
+		user, err := srv.GetByUsername(ctx, "new@friend.com")
+		if assert.NoError(t, err, "cached miss is dropped") {
+			assert.Equal(t, "new@friend.com", user.Email)
+		}
+	}
+}
+
 func TestService_User_Update(t *testing.T) {
 	srv := _userSrv()
 
@@ -208,6 +322,72 @@ func TestService_User_ResetPassword(t *testing.T) {
 	})
 }
 
+func TestService_User_Register(t *testing.T) {
+	srv := _userSrv()
+
+	user := &models.User{ID: uuid.New(), Email: "new@test.com", Role: models.RoleUser}
+
+	user, err := srv.Register(nil, "Test123456", user, time.Hour)
+	if assert.NoError(t, err) {
+		assert.NotEmpty(t, user.ValidationHash)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), user.ValidationExpiresAt, time.Minute)
+	}
+
+	_, err = srv.Register(nil, "Test123456", &models.User{ID: uuid.New(), Email: "new@test.com"}, time.Hour)
+	if assert.Error(t, err) {
+		assert.EqualError(t, err, "username taken")
+	}
+}
+
+func TestService_User_ResendConfirmation(t *testing.T) {
+	srv := _userSrv()
+
+	t.Run("Inactive user", func(t *testing.T) {
+		user, err := srv.GetByID(nil, helpers.UUIDFromString(t, "3ab1ba2a-6031-4e34-aae3-dcd43a987775"))
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		user, err = srv.ResendConfirmation(nil, user, time.Hour)
+		if assert.NoError(t, err) {
+			assert.NotEqual(t, "SomeHash123", user.ValidationHash)
+		}
+	})
+
+	t.Run("Confirmed user", func(t *testing.T) {
+		user, err := srv.GetByID(nil, helpers.UUIDFromString(t, "775a5b37-1742-4e54-9439-0357e768b011"))
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		_, err = srv.ResendConfirmation(nil, user, time.Hour)
+		if assert.Error(t, err) {
+			assert.EqualError(t, err, "email address already confirmed")
+		}
+	})
+
+	t.Run("Cached copy", func(t *testing.T) {
+		repo := mock.NewUserRepository()
+		srv := services.NewUserService(repo, services.NewQueueService(mock.NewQueueRepository()), services.NewCacheService(mock.NewCacheRepository(), services.CacheConfig{}))
+
+		stale, err := repo.FindByUsername(nil, "user@test.com")
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		current := *stale
+		current.FirstName = "Changed"
+		if _, err := repo.Update(nil, &current); !assert.NoError(t, err) {
+			return
+		}
+
+		user, err := srv.ResendConfirmation(nil, stale, time.Hour)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "Changed", user.FirstName, "user is read again before update")
+		}
+	})
+}
+
 func TestService_User_UpdateLogin(t *testing.T) {
 	srv := _userSrv()
 
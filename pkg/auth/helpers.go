@@ -5,6 +5,7 @@ import (
 	"github.com/labstack/echo/v4"
 
 	"github.com/stiks/gobs/pkg/parser"
+	"github.com/stiks/gobs/pkg/tenant"
 )
 
 // GetUserID ...
@@ -16,3 +17,41 @@ func GetUserID(c echo.Context) (uuid.UUID, error) {
 
 	return uuid.Parse(id)
 }
+
+// GetClientID returns ID of the auth client authorised with client_credentials
+func GetClientID(c echo.Context) (uuid.UUID, error) {
+	id, err := parser.String(c.Get("CLIENT_ID"), nil)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+
+	return uuid.Parse(id)
+}
+
+// GetRole returns role of the signed in user
+func GetRole(c echo.Context) string {
+	role, _ := c.Get("ROLE").(string)
+
+	return role
+}
+
+// GetTenantID returns tenant request is scoped to, false for super users
+// acting across tenants
+func GetTenantID(c echo.Context) (uuid.UUID, bool) {
+	return tenant.FromContext(c.Request().Context())
+}
+
+// GetAuthTime returns unix time the user signed in, 0 when access token
+// doesn't tell
+func GetAuthTime(c echo.Context) int64 {
+	at, _ := c.Get("AUTH_TIME").(float64)
+
+	return int64(at)
+}
+
+// GetScope returns space separated scope of the access token
+func GetScope(c echo.Context) string {
+	scope, _ := c.Get("SCOPE").(string)
+
+	return scope
+}
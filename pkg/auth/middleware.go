@@ -1,16 +1,53 @@
 package auth
 
 import (
+	"context"
 	"net/http"
+	"strings"
+	"sync"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 
-	"github.com/stiks/gobs/pkg/env"
+	"github.com/stiks/gobs/pkg/tenant"
+	"github.com/stiks/gobs/pkg/xlog"
 )
 
+// HeaderTenantID lets super users act for a tenant
+const HeaderTenantID = "X-Tenant-ID"
+
+// Config of token verification
+type Config struct {
+	SecretKey []byte
+	// Keyfunc resolves verification key by token kid, SecretKey verifies
+	// HS256 tokens when nil
+	Keyfunc jwt.Keyfunc
+	// Denylist of revoked tokens, every token is accepted until exp when nil
+	Denylist Denylist
+}
+
+// Denylist tells whether access token with jti claim was revoked
+type Denylist interface {
+	Revoked(ctx context.Context, jti string) (bool, error)
+}
+
+var (
+	mu     sync.RWMutex
+	config Config
+)
+
+// Configure sets verification settings, must be called before routes using
+// EnableAuthorisation are registered
+func Configure(cfg Config) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	config = cfg
+}
+
 // RequiredAuth ...
 func RequiredAuth() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
@@ -24,6 +61,83 @@ func RequiredAuth() echo.MiddlewareFunc {
 	}
 }
 
+// RequiredClientAuth only lets in tokens issued to a client by the
+// client_credentials grant
+func RequiredClientAuth() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Get("CLIENT_AUTHORISED") == nil || !c.Get("CLIENT_AUTHORISED").(bool) {
+				return echo.NewHTTPError(http.StatusUnauthorized, "client authorisation required")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// RequireScopes only lets in tokens whose scope has every one of scopes,
+// otherwise responds 403 insufficient_scope (RFC 6750)
+func RequireScopes(scopes ...string) echo.MiddlewareFunc {
+	required := strings.Join(scopes, " ")
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			granted := strings.Fields(GetScope(c))
+
+			for _, scope := range scopes {
+				if !hasScope(granted, scope) {
+					c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer error="insufficient_scope", scope="`+required+`"`)
+
+					return echo.NewHTTPError(http.StatusForbidden, echo.Map{
+						"error":             "insufficient_scope",
+						"error_description": "token scope is insufficient",
+						"scope":             required,
+					})
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// Policy tells whether role has permission, at least for resources it owns
+type Policy interface {
+	Permits(ctx context.Context, role string, permission string) (bool, error)
+}
+
+// RequirePermission only lets in users whose role has permission, ownership
+// of the resource is left to the handler
+func RequirePermission(policy Policy, permission string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ok, err := policy.Permits(c.Request().Context(), GetRole(c), permission)
+			if err != nil {
+				xlog.Errorf(c.Request().Context(), "Unable to check permission %s, err: %s", permission, err.Error())
+
+				return echo.NewHTTPError(http.StatusInternalServerError, "unable to check permission")
+			}
+
+			if !ok {
+				return echo.NewHTTPError(http.StatusForbidden, "permission denied")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// hasScope ...
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
 // SuperOnly ...
 func SuperOnly() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
@@ -52,12 +166,22 @@ func SuperOrAdminOnly() echo.MiddlewareFunc {
 
 // EnableAuthorisation ...
 func EnableAuthorisation() echo.MiddlewareFunc {
-	return middleware.JWTWithConfig(middleware.JWTConfig{
-		SigningKey:    []byte(env.MustGetString("AUTH_SECRET_KEY")),
+	mu.RLock()
+	key, keyfunc, denylist := config.SecretKey, config.Keyfunc, config.Denylist
+	mu.RUnlock()
+
+	if len(key) == 0 && keyfunc == nil {
+		panic("auth: secret key is not configured, call auth.Configure first")
+	}
+
+	verify := middleware.JWTWithConfig(middleware.JWTConfig{
+		SigningKey:    key,
+		KeyFunc:       keyfunc,
 		ContextKey:    "users",
 		SigningMethod: middleware.AlgorithmHS256,
 		BeforeFunc: func(c echo.Context) {
 			c.Set("AUTHORISED", false)
+			c.Set("CLIENT_AUTHORISED", false)
 		},
 		SuccessHandler: func(c echo.Context) {
 			/* we only authorise users when we have users details in Context */
@@ -67,19 +191,116 @@ func EnableAuthorisation() echo.MiddlewareFunc {
 					return
 				}
 
-				uid, ok := claims["uid"]
-				if !ok {
+				// user tokens carry uid, client_credentials tokens carry cid
+				// only, clients are never authorised as users
+				if uid, ok := claims["uid"]; ok {
+					c.Set("AUTHORISED", true)
+					c.Set("USER_ID", uid)
+				} else if cid, ok := claims["cid"]; ok {
+					c.Set("CLIENT_AUTHORISED", true)
+					c.Set("CLIENT_ID", cid)
+				} else {
 					return
 				}
 
-				c.Set("AUTHORISED", true)
-				c.Set("USER_ID", uid)
-
 				// check role
 				if val, ok := claims["auth"]; ok {
 					c.Set("ROLE", val)
 				}
+
+				if val, ok := claims["scope"]; ok {
+					c.Set("SCOPE", val)
+				}
+
+				if val, ok := claims["jti"]; ok {
+					c.Set("TOKEN_ID", val)
+				}
+
+				if val, ok := claims["tid"]; ok {
+					c.Set("TENANT_ID", val)
+				}
+
+				if val, ok := claims["auth_time"]; ok {
+					c.Set("AUTH_TIME", val)
+				}
 			}
 		},
 	})
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return verify(func(c echo.Context) error {
+			if err := checkRevoked(c, denylist); err != nil {
+				return err
+			}
+
+			if err := scopeTenant(c); err != nil {
+				return err
+			}
+
+			return next(c)
+		})
+	}
+}
+
+// checkRevoked rejects tokens found in denylist
+func checkRevoked(c echo.Context, denylist Denylist) error {
+	jti, ok := c.Get("TOKEN_ID").(string)
+	if denylist == nil || !ok {
+		return nil
+	}
+
+	revoked, err := denylist.Revoked(c.Request().Context(), jti)
+	if err != nil {
+		xlog.Errorf(c.Request().Context(), "Unable to check token %s, err: %s", jti, err.Error())
+
+		return echo.NewHTTPError(http.StatusInternalServerError, "unable to verify token")
+	}
+
+	if revoked {
+		return echo.NewHTTPError(http.StatusUnauthorized, "token revoked")
+	}
+
+	return nil
+}
+
+// scopeTenant scopes request context to tenant of the signed in user, see
+// package tenant. Super users act across tenants unless they pick one with
+// HeaderTenantID, other users may only name their own tenant.
+func scopeTenant(c echo.Context) error {
+	if authorised, _ := c.Get("AUTHORISED").(bool); !authorised {
+		return nil
+	}
+
+	requested := c.Request().Header.Get(HeaderTenantID)
+
+	if c.Get("ROLE") == "super" {
+		if requested == "" {
+			return nil
+		}
+
+		id, err := uuid.Parse(requested)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid tenant")
+		}
+
+		c.SetRequest(c.Request().WithContext(tenant.NewContext(c.Request().Context(), id)))
+
+		return nil
+	}
+
+	// tokens issued before tenants were introduced belong to uuid.Nil tenant
+	tid, _ := c.Get("TENANT_ID").(string)
+
+	id, err := uuid.Parse(tid)
+	if err != nil {
+		id = uuid.Nil
+	}
+
+	if requested != "" && requested != id.String() {
+		return echo.NewHTTPError(http.StatusForbidden, "tenant mismatch")
+	}
+
+	c.SetRequest(c.Request().WithContext(tenant.NewContext(c.Request().Context(), id)))
+
+	return nil
 }
@@ -0,0 +1,362 @@
+// Package config fills typed configuration structs from layered sources,
+// later layers override earlier ones: field defaults, optional YAML file,
+// .env file and finally process environment.
+//
+// Fields are bound with struct tags:
+//
+//	type Config struct {
+//		Secret   string        `env:"AUTH_SECRET_KEY" required:"true"`
+//		Lifetime time.Duration `env:"AUTH_ACCESS_TOKEN_LIFETIME" default:"8h"`
+//		Origins  []string      `env:"CORS_ORIGINS" sep:","`
+//	}
+//
+// Nested structs without a tag are filled too. Durations accept Go syntax
+// such as "90s" or a whole number of seconds, times accept RFC 3339 or a
+// date such as "2024-01-31", which is midnight UTC. Every problem is collected and
+// returned at once, so a misconfigured deployment fails on boot with the full
+// list instead of one key at a time.
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v2"
+)
+
+// Options of a configuration source
+type Options struct {
+	// EnvFile is a dotenv file, a missing file is not an error
+	EnvFile string
+	// YAMLFile is an optional YAML file, nested keys are joined with underscore
+	// so "auth: {secret_key: x}" sets AUTH_SECRET_KEY
+	YAMLFile string
+	// Lookup reads process environment, os.LookupEnv when nil
+	Lookup func(key string) (string, bool)
+}
+
+// Errors collects every problem found while loading configuration
+type Errors []error
+
+// Error ...
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// Validator is implemented by config structs with rules beyond required fields
+type Validator interface {
+	Validate() error
+}
+
+// Source of configuration values
+type Source struct {
+	lookup func(key string) (string, bool)
+	files  map[string]string
+}
+
+// New reads files named in opts
+func New(opts Options) (*Source, error) {
+	s := &Source{
+		lookup: opts.Lookup,
+		files:  make(map[string]string),
+	}
+
+	if s.lookup == nil {
+		s.lookup = os.LookupEnv
+	}
+
+	if opts.YAMLFile != "" {
+		values, err := readYAML(opts.YAMLFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %w", opts.YAMLFile, err)
+		}
+
+		for k, v := range values {
+			s.files[k] = v
+		}
+	}
+
+	if opts.EnvFile != "" {
+		if _, err := os.Stat(opts.EnvFile); err == nil {
+			values, err := godotenv.Read(opts.EnvFile)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read %s: %w", opts.EnvFile, err)
+			}
+
+			for k, v := range values {
+				s.files[k] = v
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// Lookup returns value of key and whether it is set in any layer
+func (s *Source) Lookup(key string) (string, bool) {
+	if v, ok := s.lookup(key); ok {
+		return v, true
+	}
+
+	v, ok := s.files[key]
+
+	return v, ok
+}
+
+// Get returns value of key or empty string
+func (s *Source) Get(key string) string {
+	v, _ := s.Lookup(key)
+
+	return v
+}
+
+// Fill sets tagged fields of the struct dst points to and runs Validate of
+// every struct implementing Validator whose fields were read without errors,
+// returned error is Errors
+func (s *Source) Fill(dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: Fill expects pointer to struct, got %T", dst)
+	}
+
+	var errs Errors
+	s.fill(v.Elem(), &errs)
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func (s *Source) fill(v reflect.Value, errs *Errors) {
+	t, failed := v.Type(), false
+
+	for i := 0; i < t.NumField(); i++ {
+		field, value := t.Field(i), v.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		key := field.Tag.Get("env")
+		if key == "" {
+			if value.Kind() == reflect.Struct {
+				s.fill(value, errs)
+			}
+
+			continue
+		}
+
+		raw, ok := s.Lookup(key)
+		if !ok || strings.TrimSpace(raw) == "" {
+			raw, ok = field.Tag.Lookup("default")
+		}
+
+		if !ok || strings.TrimSpace(raw) == "" {
+			if field.Tag.Get("required") == "true" {
+				*errs = append(*errs, fmt.Errorf("%s must be set", key))
+				failed = true
+			}
+
+			continue
+		}
+
+		sep := field.Tag.Get("sep")
+		if sep == "" {
+			sep = ","
+		}
+
+		if err := set(value, strings.TrimSpace(raw), sep); err != nil {
+			*errs = append(*errs, fmt.Errorf("%s: %s", key, err.Error()))
+			failed = true
+		}
+	}
+
+	// rules usually repeat required checks, so they run on complete structs only
+	if failed {
+		return
+	}
+
+	if validator, ok := v.Addr().Interface().(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			if list, ok := err.(Errors); ok {
+				*errs = append(*errs, list...)
+			} else {
+				*errs = append(*errs, err)
+			}
+		}
+	}
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// set parses raw into v according to its type
+func set(v reflect.Value, raw string, sep string) error {
+	if v.Type() == durationType {
+		d, err := parseDuration(raw)
+		if err != nil {
+			return err
+		}
+
+		v.SetInt(int64(d))
+
+		return nil
+	}
+
+	if v.Type() == timeType {
+		t, err := parseTime(raw)
+		if err != nil {
+			return err
+		}
+
+		v.Set(reflect.ValueOf(t))
+
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer %q", raw)
+		}
+
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+
+		v.SetFloat(f)
+	case reflect.Slice:
+		var parts []string
+		for _, part := range strings.Split(raw, sep) {
+			if part = strings.TrimSpace(part); part != "" {
+				parts = append(parts, part)
+			}
+		}
+
+		list := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := set(list.Index(i), part, sep); err != nil {
+				return err
+			}
+		}
+
+		v.Set(list)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+// parseDuration accepts Go durations and whole seconds
+func parseDuration(raw string) (time.Duration, error) {
+	if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", raw)
+	}
+
+	return d, nil
+}
+
+// parseTime accepts RFC 3339 times and dates
+func parseTime(raw string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q", raw)
+}
+
+// readYAML flattens YAML document into environment style keys
+func readYAML(path string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := make(map[interface{}]interface{})
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	flatten("", doc, values)
+
+	return values, nil
+}
+
+func flatten(prefix string, node interface{}, values map[string]string) {
+	switch n := node.(type) {
+	case map[interface{}]interface{}:
+		keys := make([]string, 0, len(n))
+		byName := make(map[string]interface{}, len(n))
+
+		for k, v := range n {
+			name := strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(fmt.Sprint(k)))
+			if prefix != "" {
+				name = prefix + "_" + name
+			}
+
+			keys = append(keys, name)
+			byName[name] = v
+		}
+
+		sort.Strings(keys)
+
+		for _, name := range keys {
+			flatten(name, byName[name], values)
+		}
+	case []interface{}:
+		parts := make([]string, len(n))
+		for i, item := range n {
+			parts[i] = fmt.Sprint(item)
+		}
+
+		values[prefix] = strings.Join(parts, ",")
+	case nil:
+		values[prefix] = ""
+	default:
+		values[prefix] = fmt.Sprint(n)
+	}
+}
@@ -0,0 +1,185 @@
+package config_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/pkg/config"
+)
+
+type _server struct {
+	Timeout time.Duration `env:"SERVER_TIMEOUT" default:"30s"`
+	Since   time.Time     `env:"SERVER_SINCE" default:"2024-01-31"`
+}
+
+type _auth struct {
+	Secret   string        `env:"AUTH_SECRET_KEY" required:"true"`
+	Lifetime time.Duration `env:"AUTH_LIFETIME" required:"true"`
+}
+
+func (a *_auth) Validate() error {
+	if len(a.Secret) < 3 {
+		return errors.New("AUTH_SECRET_KEY is too short")
+	}
+
+	return nil
+}
+
+type _config struct {
+	Name    string   `env:"NAME" default:"gobs"`
+	Debug   bool     `env:"DEBUG"`
+	Workers int      `env:"WORKERS" default:"2"`
+	Ratio   float64  `env:"RATIO"`
+	Origins []string `env:"ORIGINS"`
+	Ports   []int    `env:"PORTS" sep:" "`
+	Server  _server
+	Auth    _auth
+
+	ignored string
+}
+
+// _env returns lookup backed by map
+func _env(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := values[key]
+
+		return v, ok
+	}
+}
+
+func _write(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestConfig_Fill(t *testing.T) {
+	t.Run("Defaults and types", func(t *testing.T) {
+		src, err := config.New(config.Options{Lookup: _env(map[string]string{
+			"DEBUG":           "true",
+			"RATIO":           "0.5",
+			"ORIGINS":         " a.com, b.com ,,",
+			"PORTS":           "80 443",
+			"AUTH_SECRET_KEY": "secret",
+			"AUTH_LIFETIME":   "28800",
+		})})
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		cfg := new(_config)
+		if assert.NoError(t, src.Fill(cfg)) {
+			assert.Equal(t, "gobs", cfg.Name)
+			assert.True(t, cfg.Debug)
+			assert.Equal(t, 2, cfg.Workers)
+			assert.Equal(t, 0.5, cfg.Ratio)
+			assert.Equal(t, []string{"a.com", "b.com"}, cfg.Origins)
+			assert.Equal(t, []int{80, 443}, cfg.Ports)
+			assert.Equal(t, 30*time.Second, cfg.Server.Timeout)
+			assert.Equal(t, time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC), cfg.Server.Since)
+			assert.Equal(t, 8*time.Hour, cfg.Auth.Lifetime, "bare number is seconds")
+		}
+	})
+
+	t.Run("Every error is reported", func(t *testing.T) {
+		src, _ := config.New(config.Options{Lookup: _env(map[string]string{
+			"DEBUG":          "maybe",
+			"WORKERS":        "many",
+			"SERVER_TIMEOUT": "soon",
+			"SERVER_SINCE":   "yesterday",
+			"AUTH_LIFETIME":  "1h",
+		})})
+
+		err := src.Fill(new(_config))
+		if assert.Error(t, err) {
+			assert.IsType(t, config.Errors{}, err)
+			assert.Len(t, err, 5)
+			assert.Equal(t, `DEBUG: invalid boolean "maybe"; WORKERS: invalid integer "many"; SERVER_TIMEOUT: invalid duration "soon"; SERVER_SINCE: invalid time "yesterday"; AUTH_SECRET_KEY must be set`, err.Error())
+		}
+	})
+
+	t.Run("Validate runs on complete structs", func(t *testing.T) {
+		src, _ := config.New(config.Options{Lookup: _env(map[string]string{
+			"AUTH_SECRET_KEY": "x",
+			"AUTH_LIFETIME":   "1h",
+		})})
+
+		err := src.Fill(new(_config))
+		if assert.Error(t, err) {
+			assert.Equal(t, "AUTH_SECRET_KEY is too short", err.Error())
+		}
+	})
+
+	t.Run("Not a struct pointer", func(t *testing.T) {
+		src, _ := config.New(config.Options{Lookup: _env(nil)})
+
+		assert.Error(t, src.Fill(_config{}))
+	})
+}
+
+func TestConfig_Layers(t *testing.T) {
+	yaml := _write(t, "config.yaml", `
+name: from-yaml
+workers: 4
+origins:
+  - a.com
+  - b.com
+auth:
+  secret-key: yaml-secret
+  lifetime: 1h
+server:
+  timeout: 10s
+`)
+	env := _write(t, ".env", "WORKERS=8\nAUTH_SECRET_KEY=dotenv-secret\n")
+
+	src, err := config.New(config.Options{
+		YAMLFile: yaml,
+		EnvFile:  env,
+		Lookup:   _env(map[string]string{"AUTH_SECRET_KEY": "env-secret"}),
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	cfg := new(_config)
+	if assert.NoError(t, src.Fill(cfg)) {
+		assert.Equal(t, "from-yaml", cfg.Name)
+		assert.Equal(t, 8, cfg.Workers, ".env overrides YAML")
+		assert.Equal(t, "env-secret", cfg.Auth.Secret, "environment overrides .env")
+		assert.Equal(t, []string{"a.com", "b.com"}, cfg.Origins)
+		assert.Equal(t, time.Hour, cfg.Auth.Lifetime)
+		assert.Equal(t, 10*time.Second, cfg.Server.Timeout)
+	}
+
+	assert.Equal(t, "yaml-secret", func() string {
+		src, _ := config.New(config.Options{YAMLFile: yaml, Lookup: _env(nil)})
+
+		return src.Get("AUTH_SECRET_KEY")
+	}())
+
+	t.Run("Missing .env is ignored", func(t *testing.T) {
+		_, err := config.New(config.Options{EnvFile: filepath.Join(t.TempDir(), ".env")})
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("Missing YAML file", func(t *testing.T) {
+		_, err := config.New(config.Options{YAMLFile: filepath.Join(t.TempDir(), "config.yaml")})
+
+		assert.Error(t, err)
+	})
+
+	t.Run("Malformed YAML file", func(t *testing.T) {
+		_, err := config.New(config.Options{YAMLFile: _write(t, "bad.yaml", "name: [")})
+
+		assert.Error(t, err)
+	})
+}
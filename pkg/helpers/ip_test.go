@@ -0,0 +1,46 @@
+package helpers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/pkg/helpers"
+)
+
+func TestHelpers_NewIPExtractor(t *testing.T) {
+	request := func(peer string, forwarded string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = peer + ":4321"
+		req.Header.Set(echo.HeaderXForwardedFor, forwarded)
+
+		return req
+	}
+
+	t.Run("No trusted proxies", func(t *testing.T) {
+		extract, err := helpers.NewIPExtractor(nil)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "10.0.0.1", extract(request("10.0.0.1", "1.2.3.4")), "header is ignored")
+		}
+	})
+
+	t.Run("Trusted proxy", func(t *testing.T) {
+		extract, err := helpers.NewIPExtractor([]string{"10.0.0.0/8"})
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.Equal(t, "1.2.3.4", extract(request("10.0.0.1", "1.2.3.4")))
+		assert.Equal(t, "1.2.3.4", extract(request("10.0.0.1", "6.6.6.6, 1.2.3.4")), "spoofed entries before the proxy are ignored")
+		assert.Equal(t, "5.6.7.8", extract(request("5.6.7.8", "1.2.3.4")), "untrusted peer")
+		assert.Equal(t, "192.168.0.1", extract(request("192.168.0.1", "1.2.3.4")), "private networks are not trusted by default")
+	})
+
+	t.Run("Invalid range", func(t *testing.T) {
+		_, err := helpers.NewIPExtractor([]string{"10.0.0.1"})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,348 @@
+package helpers
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/stiks/gobs/pkg/parser"
+	"github.com/stiks/gobs/pkg/xlog"
+)
+
+// ErrRateLimited is message of 429 answered once limit is used up
+const ErrRateLimited = "too many requests"
+
+// RateLimitState is what algorithms keep per key between requests
+type RateLimitState struct {
+	// Tokens left in the bucket at Updated, token bucket only
+	Tokens  float64   `json:"tokens"`
+	Updated time.Time `json:"updated"`
+	// Window counters, sliding window only
+	WindowStart time.Time `json:"windowStart"`
+	Current     int       `json:"current"`
+	Previous    int       `json:"previous"`
+	// Expires is when the state is as good as new, stores may drop it then
+	Expires time.Time `json:"expires"`
+}
+
+// RateLimitResult of one request
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is time until the limit is fully available again
+	Reset time.Duration
+	// RetryAfter is time until next request is allowed, zero when allowed
+	RetryAfter time.Duration
+}
+
+// RateLimitAlgorithm decides on request and updates state of its key
+type RateLimitAlgorithm interface {
+	Allow(state *RateLimitState, now time.Time) RateLimitResult
+}
+
+// RateLimitStore keeps state per key, update runs fn on current state and
+// stores it back
+type RateLimitStore interface {
+	Update(ctx context.Context, key string, fn func(state *RateLimitState)) error
+}
+
+// RateLimitKey returns key requests are counted by
+type RateLimitKey func(c echo.Context) string
+
+// RateLimitConfig of one route group
+type RateLimitConfig struct {
+	// Name separates keys of route groups sharing the store
+	Name      string
+	Algorithm RateLimitAlgorithm
+	Store     RateLimitStore
+	// Key defaults to RateLimitByIP
+	Key RateLimitKey
+}
+
+type tokenBucket struct {
+	capacity float64
+	rate     float64
+}
+
+// NewTokenBucket allows bursts of limit requests refilled evenly over period
+func NewTokenBucket(limit int, period time.Duration) RateLimitAlgorithm {
+	return &tokenBucket{
+		capacity: float64(limit),
+		rate:     float64(limit) / period.Seconds(),
+	}
+}
+
+// Allow ...
+func (b *tokenBucket) Allow(state *RateLimitState, now time.Time) RateLimitResult {
+	tokens := b.capacity
+	if !state.Updated.IsZero() {
+		tokens = math.Min(b.capacity, state.Tokens+now.Sub(state.Updated).Seconds()*b.rate)
+	}
+
+	res := RateLimitResult{Limit: int(b.capacity)}
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = b.duration(1 - tokens)
+	}
+
+	state.Tokens = tokens
+	state.Updated = now
+
+	res.Remaining = int(math.Floor(tokens))
+	res.Reset = b.duration(b.capacity - tokens)
+	state.Expires = now.Add(res.Reset)
+
+	return res
+}
+
+// duration returns time to refill tokens
+func (b *tokenBucket) duration(tokens float64) time.Duration {
+	return time.Duration(tokens / b.rate * float64(time.Second))
+}
+
+type slidingWindow struct {
+	limit  int
+	window time.Duration
+}
+
+// NewSlidingWindow allows limit requests in any window, count of previous
+// fixed window is weighted by its overlap with the sliding one
+func NewSlidingWindow(limit int, window time.Duration) RateLimitAlgorithm {
+	return &slidingWindow{
+		limit:  limit,
+		window: window,
+	}
+}
+
+// Allow ...
+func (w *slidingWindow) Allow(state *RateLimitState, now time.Time) RateLimitResult {
+	start := now.Truncate(w.window)
+
+	if !state.WindowStart.Equal(start) {
+		if state.WindowStart.Equal(start.Add(-w.window)) {
+			state.Previous = state.Current
+		} else {
+			state.Previous = 0
+		}
+
+		state.Current = 0
+		state.WindowStart = start
+	}
+
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(w.window)
+	count := float64(state.Previous)*weight + float64(state.Current)
+
+	res := RateLimitResult{Limit: w.limit, Reset: w.window - elapsed}
+	if count+1 <= float64(w.limit) {
+		state.Current++
+		count++
+		res.Allowed = true
+	} else {
+		res.RetryAfter = w.retryAfter(state, elapsed)
+	}
+
+	if remaining := w.limit - int(math.Ceil(count)); remaining > 0 {
+		res.Remaining = remaining
+	}
+
+	state.Updated = now
+	state.Expires = start.Add(2 * w.window)
+
+	return res
+}
+
+// retryAfter returns time until weight of previous window drops enough, or
+// until current window is over when it alone uses the limit up
+func (w *slidingWindow) retryAfter(state *RateLimitState, elapsed time.Duration) time.Duration {
+	free := float64(w.limit - state.Current - 1)
+	if free < 0 || state.Previous == 0 {
+		return w.window - elapsed
+	}
+
+	at := time.Duration((1 - free/float64(state.Previous)) * float64(w.window))
+	if at <= elapsed {
+		return time.Second
+	}
+
+	return at - elapsed
+}
+
+type memoryRateLimitStore struct {
+	mu      sync.Mutex
+	states  map[string]*RateLimitState
+	cleaned time.Time
+}
+
+// NewMemoryRateLimitStore keeps limits of this instance only
+func NewMemoryRateLimitStore() RateLimitStore {
+	return &memoryRateLimitStore{
+		states: make(map[string]*RateLimitState),
+	}
+}
+
+// Update ...
+func (s *memoryRateLimitStore) Update(ctx context.Context, key string, fn func(state *RateLimitState)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	// expired states are dropped once a minute so idle keys don't pile up
+	if now.Sub(s.cleaned) > time.Minute {
+		for k, state := range s.states {
+			if now.After(state.Expires) {
+				delete(s.states, k)
+			}
+		}
+
+		s.cleaned = now
+	}
+
+	state, ok := s.states[key]
+	if !ok {
+		state = new(RateLimitState)
+		s.states[key] = state
+	}
+
+	fn(state)
+
+	return nil
+}
+
+// RateLimitCache is satisfied by cache repositories able to expire entries
+type RateLimitCache interface {
+	FindByKey(ctx context.Context, key string, obj interface{}) error
+	SetWithTTL(ctx context.Context, key string, data interface{}, ttl time.Duration) error
+}
+
+type cacheRateLimitStore struct {
+	cache RateLimitCache
+}
+
+// NewCacheRateLimitStore shares limits between instances using the same cache,
+// read and write are not atomic so concurrent requests may slip through
+func NewCacheRateLimitStore(cache RateLimitCache) RateLimitStore {
+	return &cacheRateLimitStore{
+		cache: cache,
+	}
+}
+
+// Update ...
+func (s *cacheRateLimitStore) Update(ctx context.Context, key string, fn func(state *RateLimitState)) error {
+	key = "ratelimit_" + key
+
+	// missing entry and entry the cache can't decode both start over
+	state := new(RateLimitState)
+	if err := s.cache.FindByKey(ctx, key, state); err != nil {
+		state = new(RateLimitState)
+	}
+
+	fn(state)
+
+	// entry lives until the state is as good as new, a second at least as
+	// ttl 0 would keep it forever
+	ttl := time.Until(state.Expires)
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+
+	return s.cache.SetWithTTL(ctx, key, state, ttl)
+}
+
+// RateLimitByIP counts requests per client IP
+func RateLimitByIP(c echo.Context) string {
+	return "ip:" + c.RealIP()
+}
+
+// RateLimitByLogin counts requests per client IP and username of the form,
+// so users behind one IP don't share the limit. client_id of form or Basic
+// auth separates clients too, once known reports it is registered, made up
+// IDs don't get limits of their own. Every username gets a limit of its own,
+// so it is meant to run behind a RateLimitByIP limit.
+func RateLimitByLogin(known func(ctx context.Context, clientID string) bool) RateLimitKey {
+	return func(c echo.Context) string {
+		key := RateLimitByIP(c)
+
+		if username := strings.ToLower(strings.TrimSpace(c.FormValue("username"))); username != "" {
+			key += ":user:" + username
+		}
+
+		id, _, ok := c.Request().BasicAuth()
+		if !ok || id == "" {
+			id = c.FormValue("client_id")
+		}
+
+		if id != "" && known(c.Request().Context(), id) {
+			key += ":client:" + id
+		}
+
+		return key
+	}
+}
+
+// RateLimitByUser counts requests per USER_ID set by authorisation, anonymous
+// requests are counted per IP
+func RateLimitByUser(c echo.Context) string {
+	if id, err := parser.String(c.Get("USER_ID"), nil); err == nil && id != "" {
+		return "user:" + id
+	}
+
+	return RateLimitByIP(c)
+}
+
+// RateLimit middleware answers 429 once limit of the key is used up, every
+// response carries RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset
+// headers, store errors let requests through
+func RateLimit(cfg RateLimitConfig) echo.MiddlewareFunc {
+	if cfg.Algorithm == nil || cfg.Store == nil {
+		panic("helpers: rate limit requires algorithm and store")
+	}
+
+	if cfg.Key == nil {
+		cfg.Key = RateLimitByIP
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+
+			var res RateLimitResult
+			err := cfg.Store.Update(ctx, cfg.Name+":"+cfg.Key(c), func(state *RateLimitState) {
+				res = cfg.Algorithm.Allow(state, time.Now())
+			})
+			if err != nil {
+				xlog.Errorf(ctx, "Unable to update rate limit, err: %s", err.Error())
+
+				return next(c)
+			}
+
+			h := c.Response().Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(seconds(res.Reset)))
+
+			if !res.Allowed {
+				h.Set("Retry-After", strconv.Itoa(seconds(res.RetryAfter)))
+
+				return echo.NewHTTPError(http.StatusTooManyRequests, ErrRateLimited)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// seconds rounds up, so clients don't come back too early
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
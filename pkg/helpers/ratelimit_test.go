@@ -0,0 +1,225 @@
+package helpers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/pkg/helpers"
+)
+
+// _jsonCache stores entries as JSON like remote caches do
+type _jsonCache struct {
+	entries map[string][]byte
+	ttls    map[string]time.Duration
+}
+
+func (c *_jsonCache) FindByKey(ctx context.Context, key string, obj interface{}) error {
+	b, ok := c.entries[key]
+	if !ok {
+		return errors.New("cache miss")
+	}
+
+	return json.Unmarshal(b, obj)
+}
+
+func (c *_jsonCache) SetWithTTL(ctx context.Context, key string, data interface{}, ttl time.Duration) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	c.entries[key] = b
+	c.ttls[key] = ttl
+
+	return nil
+}
+
+func TestHelpers_TokenBucket(t *testing.T) {
+	bucket := helpers.NewTokenBucket(3, 3*time.Second)
+	state := new(helpers.RateLimitState)
+	now := time.Now()
+
+	for i := 2; i >= 0; i-- {
+		res := bucket.Allow(state, now)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 3, res.Limit)
+		assert.Equal(t, i, res.Remaining)
+	}
+
+	res := bucket.Allow(state, now)
+	assert.False(t, res.Allowed, "burst is used up")
+	assert.Equal(t, time.Second, res.RetryAfter)
+	assert.Equal(t, 3*time.Second, res.Reset)
+
+	res = bucket.Allow(state, now.Add(time.Second))
+	assert.True(t, res.Allowed, "one token is refilled")
+	assert.Equal(t, 0, res.Remaining)
+
+	res = bucket.Allow(state, now.Add(time.Hour))
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 2, res.Remaining, "bucket is refilled up to capacity")
+}
+
+func TestHelpers_SlidingWindow(t *testing.T) {
+	window := helpers.NewSlidingWindow(4, time.Minute)
+	state := new(helpers.RateLimitState)
+	start := time.Now().Truncate(time.Minute)
+
+	for i := 3; i >= 0; i-- {
+		res := window.Allow(state, start.Add(10*time.Second))
+		assert.True(t, res.Allowed)
+		assert.Equal(t, i, res.Remaining)
+	}
+
+	res := window.Allow(state, start.Add(10*time.Second))
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 50*time.Second, res.RetryAfter, "current window alone uses limit up")
+
+	t.Run("Previous window is weighted", func(t *testing.T) {
+		// 4 * 3/4 of previous window leaves room for one request
+		res := window.Allow(state, start.Add(75*time.Second))
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 0, res.Remaining)
+
+		res = window.Allow(state, start.Add(75*time.Second))
+		assert.False(t, res.Allowed)
+		assert.Equal(t, 15*time.Second, res.RetryAfter)
+
+		assert.True(t, window.Allow(state, start.Add(90*time.Second)).Allowed)
+	})
+
+	t.Run("Old windows are forgotten", func(t *testing.T) {
+		res := window.Allow(state, start.Add(10*time.Minute))
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 3, res.Remaining)
+	})
+}
+
+func TestHelpers_RateLimit(t *testing.T) {
+	e := echo.New()
+	e.POST("/token", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, helpers.RateLimit(helpers.RateLimitConfig{
+		Name:      "token",
+		Algorithm: helpers.NewSlidingWindow(2, time.Hour),
+		Store:     helpers.NewMemoryRateLimitStore(),
+		Key:       helpers.RateLimitByLogin(_knownClient),
+	}))
+
+	request := func(username string) *httptest.ResponseRecorder {
+		form := url.Values{"client_id": {"known"}, "username": {username}}
+
+		req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	for i := 1; i >= 0; i-- {
+		rec := request("first")
+		if assert.Equal(t, http.StatusOK, rec.Code) {
+			assert.Equal(t, "2", rec.Header().Get("RateLimit-Limit"))
+			assert.Equal(t, strconv.Itoa(i), rec.Header().Get("RateLimit-Remaining"))
+			assert.NotEmpty(t, rec.Header().Get("RateLimit-Reset"))
+			assert.Empty(t, rec.Header().Get("Retry-After"))
+		}
+	}
+
+	rec := request("first")
+	if assert.Equal(t, http.StatusTooManyRequests, rec.Code) {
+		assert.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+		assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+	}
+
+	assert.Equal(t, http.StatusOK, request("second").Code, "users are limited apart")
+}
+
+func TestHelpers_RateLimit_IPAndLogin(t *testing.T) {
+	store := helpers.NewMemoryRateLimitStore()
+
+	e := echo.New()
+	e.POST("/token", func(c echo.Context) error { return c.NoContent(http.StatusOK) },
+		helpers.RateLimit(helpers.RateLimitConfig{Name: "token-ip", Algorithm: helpers.NewSlidingWindow(3, time.Hour), Store: store}),
+		helpers.RateLimit(helpers.RateLimitConfig{Name: "token", Algorithm: helpers.NewSlidingWindow(2, time.Hour), Store: store, Key: helpers.RateLimitByLogin(_knownClient)}),
+	)
+
+	request := func(username string) int {
+		form := url.Values{"client_id": {"known"}, "username": {username}}
+
+		req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, request("first"))
+	assert.Equal(t, http.StatusOK, request("second"))
+	assert.Equal(t, http.StatusOK, request("third"))
+	assert.Equal(t, http.StatusTooManyRequests, request("fourth"), "new username doesn't escape limit of the IP")
+}
+
+// _knownClient pretends only client "known" is registered
+func _knownClient(ctx context.Context, clientID string) bool {
+	return clientID == "known"
+}
+
+func TestHelpers_RateLimitKeys(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/?client_id=known", nil)
+	req.Header.Set(echo.HeaderXRealIP, "10.0.0.1")
+
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	byLogin := helpers.RateLimitByLogin(_knownClient)
+
+	assert.Equal(t, "ip:10.0.0.1", helpers.RateLimitByIP(c))
+	assert.Equal(t, "ip:10.0.0.1:client:known", byLogin(c))
+	assert.Equal(t, "ip:10.0.0.1", helpers.RateLimitByUser(c))
+
+	req.SetBasicAuth("made-up", "secret")
+	c.Set("USER_ID", "775a5b37-1742-4e54-9439-0357e768b011")
+
+	assert.Equal(t, "ip:10.0.0.1", byLogin(c), "unknown client shares limit of its IP")
+	assert.Equal(t, "user:775a5b37-1742-4e54-9439-0357e768b011", helpers.RateLimitByUser(c))
+
+	req = httptest.NewRequest(http.MethodPost, "/?client_id=known&username=Peter@Test.com", nil)
+	req.Header.Set(echo.HeaderXRealIP, "10.0.0.1")
+
+	assert.Equal(t, "ip:10.0.0.1:user:peter@test.com:client:known", byLogin(echo.New().NewContext(req, httptest.NewRecorder())))
+}
+
+func TestHelpers_CacheRateLimitStore(t *testing.T) {
+	cache := &_jsonCache{entries: make(map[string][]byte), ttls: make(map[string]time.Duration)}
+	bucket := helpers.NewTokenBucket(2, time.Hour)
+
+	// instances sharing cache share limit
+	first, second := helpers.NewCacheRateLimitStore(cache), helpers.NewCacheRateLimitStore(cache)
+
+	var res helpers.RateLimitResult
+	allow := func(state *helpers.RateLimitState) { res = bucket.Allow(state, time.Now()) }
+
+	assert.NoError(t, first.Update(context.Background(), "key", allow))
+	assert.True(t, res.Allowed)
+
+	assert.NoError(t, second.Update(context.Background(), "key", allow))
+	assert.True(t, res.Allowed)
+
+	assert.NoError(t, first.Update(context.Background(), "key", allow))
+	assert.False(t, res.Allowed)
+
+	assert.Contains(t, cache.entries, "ratelimit_key")
+	assert.InDelta(t, time.Hour, cache.ttls["ratelimit_key"], float64(time.Minute), "entry expires once the bucket is full again")
+}
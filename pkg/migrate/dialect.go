@@ -0,0 +1,93 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// lockID is an arbitrary application wide key for postgres advisory lock
+const lockID = 7261636565
+
+// Postgres holds a session level advisory lock, so replicas starting at the
+// same time wait for each other instead of racing on schema changes
+type Postgres struct{}
+
+// Placeholder ...
+func (Postgres) Placeholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+// Lock ...
+func (Postgres) Lock(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID)
+
+	return err
+}
+
+// Unlock ...
+func (Postgres) Unlock(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", lockID)
+
+	return err
+}
+
+// SQLite has no advisory locks, processes sharing the database file take
+// turns by owning the single row of schema_lock table. A lock older than
+// StaleAfter is considered abandoned by a crashed process and taken over.
+type SQLite struct {
+	StaleAfter time.Duration
+	RetryEvery time.Duration
+}
+
+// Placeholder ...
+func (SQLite) Placeholder(n int) string {
+	return "?"
+}
+
+// Lock ...
+func (d SQLite) Lock(ctx context.Context, conn *sql.Conn) error {
+	staleAfter, retryEvery := d.StaleAfter, d.RetryEvery
+	if staleAfter <= 0 {
+		staleAfter = 10 * time.Minute
+	}
+
+	if retryEvery <= 0 {
+		retryEvery = 100 * time.Millisecond
+	}
+
+	if _, err := conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_lock (id INTEGER PRIMARY KEY, locked_at INTEGER NOT NULL)"); err != nil {
+		return err
+	}
+
+	for {
+		now := time.Now()
+
+		if _, err := conn.ExecContext(ctx, "DELETE FROM schema_lock WHERE locked_at < ?", now.Add(-staleAfter).Unix()); err != nil {
+			return err
+		}
+
+		res, err := conn.ExecContext(ctx, "INSERT OR IGNORE INTO schema_lock (id, locked_at) VALUES (1, ?)", now.Unix())
+		if err != nil {
+			return err
+		}
+
+		if n, err := res.RowsAffected(); err == nil && n == 1 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryEvery):
+		}
+	}
+}
+
+// Unlock ...
+func (SQLite) Unlock(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, "DELETE FROM schema_lock WHERE id = 1")
+
+	return err
+}
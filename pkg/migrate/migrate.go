@@ -0,0 +1,292 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var (
+	// ErrChecksumMismatch ...
+	ErrChecksumMismatch = errors.New("applied migration was modified")
+	// ErrIrreversible ...
+	ErrIrreversible = errors.New("migration cannot be reverted")
+	// ErrDuplicateVersion ...
+	ErrDuplicateVersion = errors.New("duplicate migration version")
+	// ErrUnknownVersion ...
+	ErrUnknownVersion = errors.New("applied migration is unknown to this binary")
+)
+
+// Migration is a single schema change, Up and Down may contain several statements
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Checksum of the Up script, used to detect migrations edited after they were applied
+func (m Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Status of a single migration
+type Status struct {
+	Version   int64     `json:"version"`
+	Name      string    `json:"name"`
+	Applied   bool      `json:"applied"`
+	AppliedAt time.Time `json:"appliedAt"`
+	Modified  bool      `json:"modified"`
+	Unknown   bool      `json:"unknown"`
+}
+
+// Dialect isolates database specific parts of the migrator
+type Dialect interface {
+	// Placeholder returns n-th (1-based) query argument placeholder
+	Placeholder(n int) string
+	// Lock blocks until the exclusive migration lock is held by conn
+	Lock(ctx context.Context, conn *sql.Conn) error
+	// Unlock releases lock taken by Lock
+	Unlock(ctx context.Context, conn *sql.Conn) error
+}
+
+type applied struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// Migrator applies and reverts migrations, applied versions are recorded in
+// schema_migrations table
+type Migrator struct {
+	db         *sql.DB
+	dialect    Dialect
+	migrations []Migration
+}
+
+// New returns migrator for the given set of migrations, order of the set does not matter
+func New(db *sql.DB, dialect Dialect, migrations []Migration) (*Migrator, error) {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Version == sorted[i-1].Version {
+			return nil, fmt.Errorf("%w: %d", ErrDuplicateVersion, sorted[i].Version)
+		}
+	}
+
+	return &Migrator{
+		db:         db,
+		dialect:    dialect,
+		migrations: sorted,
+	}, nil
+}
+
+// Up applies all pending migrations and returns them
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+
+	err := m.locked(ctx, func(conn *sql.Conn, history map[int64]applied) error {
+		if err := m.verify(history); err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := history[migration.Version]; ok {
+				continue
+			}
+
+			insert := fmt.Sprintf("INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (%s, %s, %s, %s)",
+				m.dialect.Placeholder(1), m.dialect.Placeholder(2), m.dialect.Placeholder(3), m.dialect.Placeholder(4))
+
+			err := m.tx(ctx, conn, migration.Up, insert, migration.Version, migration.Name, migration.Checksum(), time.Now().UTC())
+			if err != nil {
+				return fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+			}
+
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Down reverts the given number of most recently applied migrations and returns them
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+
+	err := m.locked(ctx, func(conn *sql.Conn, history map[int64]applied) error {
+		if err := m.verify(history); err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := m.migrations[i]
+
+			if _, ok := history[migration.Version]; !ok {
+				continue
+			}
+
+			if migration.Down == "" {
+				return fmt.Errorf("%w: %d %s", ErrIrreversible, migration.Version, migration.Name)
+			}
+
+			remove := "DELETE FROM schema_migrations WHERE version = " + m.dialect.Placeholder(1)
+
+			if err := m.tx(ctx, conn, migration.Down, remove, migration.Version); err != nil {
+				return fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+			}
+
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Status lists known and applied migrations ordered by version
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var list []Status
+
+	err := m.locked(ctx, func(conn *sql.Conn, history map[int64]applied) error {
+		known := make(map[int64]bool)
+
+		for _, migration := range m.migrations {
+			known[migration.Version] = true
+
+			s := Status{Version: migration.Version, Name: migration.Name}
+			if a, ok := history[migration.Version]; ok {
+				s.Applied = true
+				s.AppliedAt = a.appliedAt
+				s.Modified = a.checksum != migration.Checksum()
+			}
+
+			list = append(list, s)
+		}
+
+		for version, a := range history {
+			if !known[version] {
+				list = append(list, Status{Version: version, Name: a.name, Applied: true, AppliedAt: a.appliedAt, Unknown: true})
+			}
+		}
+
+		sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+
+		return nil
+	})
+
+	return list, err
+}
+
+// verify makes sure applied migrations match the ones compiled into the binary
+func (m *Migrator) verify(history map[int64]applied) error {
+	known := make(map[int64]Migration)
+	for _, migration := range m.migrations {
+		known[migration.Version] = migration
+	}
+
+	for version, a := range history {
+		migration, ok := known[version]
+		if !ok {
+			return fmt.Errorf("%w: %d %s", ErrUnknownVersion, version, a.name)
+		}
+
+		if a.checksum != migration.Checksum() {
+			return fmt.Errorf("%w: %d %s", ErrChecksumMismatch, version, migration.Name)
+		}
+	}
+
+	return nil
+}
+
+// locked runs fn holding the migration lock on a dedicated connection
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn, history map[int64]applied) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := m.dialect.Lock(ctx, conn); err != nil {
+		return fmt.Errorf("unable to acquire migration lock: %w", err)
+	}
+
+	defer m.dialect.Unlock(context.Background(), conn)
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    BIGINT PRIMARY KEY,
+		name       VARCHAR(255) NOT NULL,
+		checksum   VARCHAR(64) NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+
+	history, err := m.history(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn, history)
+}
+
+// history returns applied migrations keyed by version
+func (m *Migrator) history(ctx context.Context, conn *sql.Conn) (map[int64]applied, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make(map[int64]applied)
+	for rows.Next() {
+		var (
+			version int64
+			a       applied
+		)
+
+		if err := rows.Scan(&version, &a.name, &a.checksum, &a.appliedAt); err != nil {
+			return nil, err
+		}
+
+		history[version] = a
+	}
+
+	return history, rows.Err()
+}
+
+// tx runs script and bookkeeping statement in a single transaction
+func (m *Migrator) tx(ctx context.Context, conn *sql.Conn, script string, query string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		tx.Rollback()
+
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		tx.Rollback()
+
+		return err
+	}
+
+	return tx.Commit()
+}
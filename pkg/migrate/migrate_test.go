@@ -0,0 +1,248 @@
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/pkg/migrate"
+)
+
+var _migrations = []migrate.Migration{
+	{Version: 2, Name: "create posts", Up: "CREATE TABLE posts (id INTEGER PRIMARY KEY)", Down: "DROP TABLE posts"},
+	{Version: 1, Name: "create users", Up: "CREATE TABLE users (id INTEGER PRIMARY KEY)", Down: "DROP TABLE users"},
+}
+
+func _db(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Unable to open database: %s", err.Error())
+	}
+
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func _tableExists(t *testing.T, db *sql.DB, name string) bool {
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&n); err != nil {
+		t.Fatalf("Unable to query schema: %s", err.Error())
+	}
+
+	return n == 1
+}
+
+func TestMigrate_New(t *testing.T) {
+	_, err := migrate.New(nil, migrate.SQLite{}, append(_migrations, migrate.Migration{Version: 1, Name: "again"}))
+	assert.True(t, errors.Is(err, migrate.ErrDuplicateVersion))
+}
+
+func TestMigrate_UpDown(t *testing.T) {
+	ctx := context.Background()
+	db := _db(t)
+
+	m, err := migrate.New(db, migrate.SQLite{}, _migrations)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	t.Run("Pending status", func(t *testing.T) {
+		list, err := m.Status(ctx)
+		if assert.NoError(t, err) && assert.Len(t, list, 2) {
+			assert.Equal(t, int64(1), list[0].Version)
+			assert.False(t, list[0].Applied)
+			assert.False(t, list[1].Applied)
+		}
+	})
+
+	t.Run("Apply in version order", func(t *testing.T) {
+		done, err := m.Up(ctx)
+		if assert.NoError(t, err) && assert.Len(t, done, 2) {
+			assert.Equal(t, "create users", done[0].Name)
+			assert.Equal(t, "create posts", done[1].Name)
+		}
+
+		assert.True(t, _tableExists(t, db, "users"))
+		assert.True(t, _tableExists(t, db, "posts"))
+	})
+
+	t.Run("Nothing left to apply", func(t *testing.T) {
+		done, err := m.Up(ctx)
+		assert.NoError(t, err)
+		assert.Empty(t, done)
+	})
+
+	t.Run("Applied status", func(t *testing.T) {
+		list, err := m.Status(ctx)
+		if assert.NoError(t, err) && assert.Len(t, list, 2) {
+			assert.True(t, list[0].Applied)
+			assert.False(t, list[0].Modified)
+			assert.WithinDuration(t, time.Now(), list[0].AppliedAt, time.Minute)
+		}
+	})
+
+	t.Run("Revert latest", func(t *testing.T) {
+		done, err := m.Down(ctx, 1)
+		if assert.NoError(t, err) && assert.Len(t, done, 1) {
+			assert.Equal(t, int64(2), done[0].Version)
+		}
+
+		assert.True(t, _tableExists(t, db, "users"))
+		assert.False(t, _tableExists(t, db, "posts"))
+	})
+
+	t.Run("Revert more than applied", func(t *testing.T) {
+		done, err := m.Down(ctx, 5)
+		assert.NoError(t, err)
+		assert.Len(t, done, 1)
+		assert.False(t, _tableExists(t, db, "users"))
+	})
+}
+
+func TestMigrate_FailedMigration(t *testing.T) {
+	ctx := context.Background()
+	db := _db(t)
+
+	m, _ := migrate.New(db, migrate.SQLite{}, []migrate.Migration{
+		_migrations[1],
+		{Version: 2, Name: "broken", Up: "CREATE TABLE broken (id INTEGER PRIMARY KEY); INSERT INTO nowhere VALUES (1)"},
+	})
+
+	done, err := m.Up(ctx)
+	assert.Error(t, err)
+	assert.Len(t, done, 1)
+
+	// failed migration is rolled back and not recorded
+	assert.False(t, _tableExists(t, db, "broken"))
+
+	list, err := m.Status(ctx)
+	if assert.NoError(t, err) && assert.Len(t, list, 2) {
+		assert.True(t, list[0].Applied)
+		assert.False(t, list[1].Applied)
+	}
+}
+
+func TestMigrate_Verify(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Modified migration", func(t *testing.T) {
+		db := _db(t)
+
+		m, _ := migrate.New(db, migrate.SQLite{}, _migrations)
+		_, err := m.Up(ctx)
+		assert.NoError(t, err)
+
+		modified := []migrate.Migration{_migrations[0], _migrations[1]}
+		modified[1].Up = "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)"
+
+		m, _ = migrate.New(db, migrate.SQLite{}, modified)
+		_, err = m.Up(ctx)
+		assert.True(t, errors.Is(err, migrate.ErrChecksumMismatch))
+
+		list, err := m.Status(ctx)
+		if assert.NoError(t, err) {
+			assert.True(t, list[0].Modified)
+		}
+	})
+
+	t.Run("Unknown migration", func(t *testing.T) {
+		db := _db(t)
+
+		m, _ := migrate.New(db, migrate.SQLite{}, _migrations)
+		_, err := m.Up(ctx)
+		assert.NoError(t, err)
+
+		m, _ = migrate.New(db, migrate.SQLite{}, _migrations[1:])
+		_, err = m.Up(ctx)
+		assert.True(t, errors.Is(err, migrate.ErrUnknownVersion))
+
+		list, err := m.Status(ctx)
+		if assert.NoError(t, err) && assert.Len(t, list, 2) {
+			assert.True(t, list[1].Unknown)
+		}
+	})
+
+	t.Run("Irreversible migration", func(t *testing.T) {
+		db := _db(t)
+
+		m, _ := migrate.New(db, migrate.SQLite{}, []migrate.Migration{{Version: 1, Name: "seed", Up: "CREATE TABLE seed (id INTEGER)"}})
+		_, err := m.Up(ctx)
+		assert.NoError(t, err)
+
+		_, err = m.Down(ctx, 1)
+		assert.True(t, errors.Is(err, migrate.ErrIrreversible))
+		assert.True(t, _tableExists(t, db, "seed"))
+	})
+}
+
+func TestMigrate_Lock(t *testing.T) {
+	ctx := context.Background()
+
+	// two handles to the same file behave like two replicas
+	path := filepath.Join(t.TempDir(), "lock.db")
+	open := func() *sql.DB {
+		db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000")
+		if err != nil {
+			t.Fatalf("Unable to open database: %s", err.Error())
+		}
+
+		db.SetMaxOpenConns(1)
+		t.Cleanup(func() { db.Close() })
+
+		return db
+	}
+
+	first, second := open(), open()
+	dialect := migrate.SQLite{RetryEvery: 10 * time.Millisecond}
+
+	// hold the lock as if another replica was migrating
+	conn, err := first.Conn(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	assert.NoError(t, dialect.Lock(ctx, conn))
+
+	m, _ := migrate.New(second, dialect, _migrations)
+
+	t.Run("Waits for lock", func(t *testing.T) {
+		short, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+
+		_, err := m.Up(short)
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	})
+
+	t.Run("Proceeds once released", func(t *testing.T) {
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			dialect.Unlock(ctx, conn)
+		}()
+
+		done, err := m.Up(ctx)
+		assert.NoError(t, err)
+		assert.Len(t, done, 2)
+	})
+
+	t.Run("Stale lock is taken over", func(t *testing.T) {
+		assert.NoError(t, dialect.Lock(ctx, conn))
+
+		stale := migrate.SQLite{StaleAfter: time.Nanosecond, RetryEvery: 10 * time.Millisecond}
+		m, _ := migrate.New(second, stale, _migrations)
+
+		short, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+
+		_, err := m.Status(short)
+		assert.NoError(t, err)
+	})
+}
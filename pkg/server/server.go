@@ -0,0 +1,201 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Config of the native HTTP server, zero values fall back to defaults
+type Config struct {
+	Addr              string
+	ReadTimeout       time.Duration `env:"SERVER_READ_TIMEOUT"`
+	ReadHeaderTimeout time.Duration `env:"SERVER_READ_HEADER_TIMEOUT"`
+	WriteTimeout      time.Duration `env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `env:"SERVER_IDLE_TIMEOUT"`
+	// ShutdownTimeout limits draining of in-flight requests and shutdown hooks together
+	ShutdownTimeout time.Duration `env:"SERVER_SHUTDOWN_TIMEOUT"`
+}
+
+// DefaultConfig ...
+var DefaultConfig = Config{
+	Addr:              ":8080",
+	ReadTimeout:       15 * time.Second,
+	ReadHeaderTimeout: 5 * time.Second,
+	WriteTimeout:      30 * time.Second,
+	IdleTimeout:       60 * time.Second,
+	ShutdownTimeout:   25 * time.Second,
+}
+
+func (c Config) withDefaults() Config {
+	if c.Addr == "" {
+		c.Addr = DefaultConfig.Addr
+	}
+
+	if c.ReadTimeout <= 0 {
+		c.ReadTimeout = DefaultConfig.ReadTimeout
+	}
+
+	if c.ReadHeaderTimeout <= 0 {
+		c.ReadHeaderTimeout = DefaultConfig.ReadHeaderTimeout
+	}
+
+	if c.WriteTimeout <= 0 {
+		c.WriteTimeout = DefaultConfig.WriteTimeout
+	}
+
+	if c.IdleTimeout <= 0 {
+		c.IdleTimeout = DefaultConfig.IdleTimeout
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		c.ShutdownTimeout = DefaultConfig.ShutdownTimeout
+	}
+
+	return c
+}
+
+// Hook releases a resource on shutdown, ctx expires with the shutdown timeout
+type Hook func(ctx context.Context) error
+
+type hook struct {
+	name string
+	fn   Hook
+}
+
+// Server serves handler with a native http.Server and shuts down gracefully
+// on SIGTERM or SIGINT, the way Kubernetes and most process managers stop pods
+type Server struct {
+	config Config
+	http   *http.Server
+
+	mu    sync.Mutex
+	hooks []hook
+}
+
+// New returns server for handler
+func New(handler http.Handler, config Config) *Server {
+	config = config.withDefaults()
+
+	return &Server{
+		config: config,
+		http: &http.Server{
+			Addr:              config.Addr,
+			Handler:           handler,
+			ReadTimeout:       config.ReadTimeout,
+			ReadHeaderTimeout: config.ReadHeaderTimeout,
+			WriteTimeout:      config.WriteTimeout,
+			IdleTimeout:       config.IdleTimeout,
+		},
+	}
+}
+
+// OnShutdown registers hook run after in-flight requests are drained. Hooks
+// run in reverse order of registration, so a provider registered first, such
+// as the database, is closed after everything built on top of it.
+func (s *Server) OnShutdown(name string, fn Hook) {
+	s.mu.Lock()
+	s.hooks = append(s.hooks, hook{name: name, fn: fn})
+	s.mu.Unlock()
+}
+
+// Go runs background worker, such as a queue consumer, until shutdown. Its
+// context is cancelled by a shutdown hook which then waits for fn to return.
+func (s *Server) Go(name string, fn func(ctx context.Context) error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() {
+		done <- fn(ctx)
+	}()
+
+	s.OnShutdown(name, func(shutdown context.Context) error {
+		cancel()
+
+		select {
+		case err := <-done:
+			return err
+		case <-shutdown.Done():
+			return shutdown.Err()
+		}
+	})
+}
+
+// ListenAndServe listens on configured address and serves until a stop signal
+// is received or ctx is cancelled
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.config.Addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(ctx, ln)
+}
+
+// Serve accepts connections on ln until a stop signal is received or ctx is
+// cancelled, then drains requests, runs shutdown hooks and returns
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
+
+	failed := make(chan error, 1)
+	go func() {
+		if err := s.http.Serve(ln); err != nil && err != http.ErrServerClosed {
+			failed <- err
+		}
+	}()
+
+	log.Printf("Listening on %s", ln.Addr().String())
+
+	var serveErr error
+	select {
+	case sig := <-signals:
+		log.Printf("Received %s, waiting up to %s for in-flight requests", sig, s.config.ShutdownTimeout)
+	case <-ctx.Done():
+		log.Printf("Shutting down, waiting up to %s for in-flight requests", s.config.ShutdownTimeout)
+	case serveErr = <-failed:
+	}
+
+	return s.shutdown(serveErr)
+}
+
+// shutdown drains requests and runs hooks within the shutdown timeout
+func (s *Server) shutdown(serveErr error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+	defer cancel()
+
+	var errs []string
+	if serveErr != nil {
+		errs = append(errs, serveErr.Error())
+	}
+
+	if err := s.http.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Sprintf("draining requests: %s", err.Error()))
+	}
+
+	s.mu.Lock()
+	hooks := s.hooks
+	s.mu.Unlock()
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i].fn(ctx); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", hooks[i].name, err.Error()))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+
+	return nil
+}
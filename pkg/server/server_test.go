@@ -0,0 +1,176 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/pkg/server"
+)
+
+// _serve starts server on a random port, returns its URL and channel with the Serve result
+func _serve(t *testing.T, ctx context.Context, srv *server.Server) (string, chan error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err.Error())
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(ctx, ln)
+	}()
+
+	return "http://" + ln.Addr().String(), done
+}
+
+func _wait(t *testing.T, done chan error) error {
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not stop")
+	}
+
+	return nil
+}
+
+func TestServer_Drain(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	url, done := _serve(t, ctx, server.New(handler, server.Config{ShutdownTimeout: 5 * time.Second}))
+
+	body := make(chan string, 1)
+	go func() {
+		res, err := http.Get(url)
+		if err != nil {
+			body <- err.Error()
+
+			return
+		}
+		defer res.Body.Close()
+
+		b, _ := ioutil.ReadAll(res.Body)
+		body <- string(b)
+	}()
+
+	<-started
+	cancel()
+
+	// in-flight request completes, new connections are refused
+	assert.Equal(t, "done", <-body)
+	assert.NoError(t, _wait(t, done))
+
+	_, err := http.Get(url)
+	assert.Error(t, err)
+}
+
+func TestServer_ShutdownTimeout(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	url, done := _serve(t, ctx, server.New(handler, server.Config{ShutdownTimeout: 100 * time.Millisecond}))
+	go http.Get(url)
+
+	<-started
+	cancel()
+
+	err := _wait(t, done)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "draining requests")
+	}
+}
+
+func TestServer_Hooks(t *testing.T) {
+	srv := server.New(http.NotFoundHandler(), server.Config{})
+
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+
+	record := func(name string, err error) server.Hook {
+		return func(ctx context.Context) error {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+
+			return err
+		}
+	}
+
+	srv.OnShutdown("database", record("database", nil))
+	srv.OnShutdown("cache", record("cache", errors.New("already closed")))
+
+	srv.Go("worker", func(ctx context.Context) error {
+		<-ctx.Done()
+
+		// finishing current task
+		time.Sleep(50 * time.Millisecond)
+		record("worker", nil)(ctx)
+
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, done := _serve(t, ctx, srv)
+	cancel()
+
+	err := _wait(t, done)
+	if assert.Error(t, err) {
+		assert.Equal(t, "cache: already closed", err.Error(), "failing hook does not stop the rest")
+	}
+
+	assert.Equal(t, []string{"worker", "cache", "database"}, order)
+}
+
+func TestServer_Signal(t *testing.T) {
+	srv := server.New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), server.Config{})
+
+	url, done := _serve(t, context.Background(), srv)
+
+	// wait until server is up, the signal handler is installed by then
+	for i := 0; i < 50; i++ {
+		if res, err := http.Get(url); err == nil {
+			res.Body.Close()
+
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+	assert.NoError(t, _wait(t, done))
+}
+
+func TestServer_ListenAndServe(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err.Error())
+	}
+	defer ln.Close()
+
+	// address in use
+	err = server.New(http.NotFoundHandler(), server.Config{Addr: ln.Addr().String()}).ListenAndServe(context.Background())
+	assert.Error(t, err)
+}
@@ -0,0 +1,46 @@
+// Package tenant carries the tenant a request acts for in its context.
+// Repositories scope every query to the tenant found in context, a context
+// without tenant, such as one of a super user or a background worker, is not
+// scoped at all.
+package tenant
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+type contextKey struct{}
+
+// NewContext returns ctx scoped to tenant id
+func NewContext(ctx context.Context, id uuid.UUID) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns tenant ctx is scoped to
+func FromContext(ctx context.Context) (uuid.UUID, bool) {
+	if ctx == nil {
+		return uuid.Nil, false
+	}
+
+	id, ok := ctx.Value(contextKey{}).(uuid.UUID)
+
+	return id, ok
+}
+
+// Unscoped returns ctx acting for every tenant, e.g. to load entries cached
+// for all of them
+func Unscoped(ctx context.Context) context.Context {
+	if _, ok := FromContext(ctx); !ok {
+		return ctx
+	}
+
+	return context.WithValue(ctx, contextKey{}, nil)
+}
+
+// Allows reports whether ctx acts for tenant id
+func Allows(ctx context.Context, id uuid.UUID) bool {
+	scope, ok := FromContext(ctx)
+
+	return !ok || scope == id
+}
@@ -0,0 +1,36 @@
+package tenant_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stiks/gobs/pkg/tenant"
+)
+
+func TestTenant_FromContext(t *testing.T) {
+	_, ok := tenant.FromContext(context.Background())
+	assert.False(t, ok, "context is not scoped")
+
+	id, ok := tenant.FromContext(tenant.NewContext(context.Background(), uuid.Nil))
+	if assert.True(t, ok, "nil tenant is a tenant too") {
+		assert.Equal(t, uuid.Nil, id)
+	}
+}
+
+func TestTenant_Unscoped(t *testing.T) {
+	id := uuid.New()
+
+	_, ok := tenant.FromContext(tenant.Unscoped(tenant.NewContext(context.Background(), id)))
+	assert.False(t, ok, "tenant is dropped")
+}
+
+func TestTenant_Allows(t *testing.T) {
+	id := uuid.New()
+
+	assert.True(t, tenant.Allows(context.Background(), id), "context without tenant acts for all")
+	assert.True(t, tenant.Allows(tenant.NewContext(context.Background(), id), id))
+	assert.False(t, tenant.Allows(tenant.NewContext(context.Background(), uuid.New()), id))
+}